@@ -0,0 +1,219 @@
+// Package cache keeps the results of the read-only queries of the package managers, such as Find and ListUpgradable,
+// on disk, so that repeated queries, also from separate runs of the CLI, do not run the package manager again.
+//
+// Package managers are cached by decorating them with Wrap, usually through syspkg.IncludeOptions.Decorators:
+//
+//	c := cache.New(cache.DefaultDir)
+//	sysPkg, err := syspkg.New(syspkg.IncludeOptions{
+//	    AllAvailable: true,
+//	    Decorators:   []manager.Decorator{c.Wrap},
+//	})
+//
+// A cached result is used until its TTL passes, a mutating operation runs through the decorated package manager,
+// or the state files of the package manager change (see manager.StateReporter), whichever process changed them.
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// DefaultDir is the directory of the system cache.
+const DefaultDir = "/var/cache/syspkg"
+
+// Operation is a cached query.
+type Operation string
+
+// Operation constants define the queries that can be cached.
+const (
+	OperationFind           Operation = "find"
+	OperationGetPackageInfo Operation = "info"
+	OperationListInstalled  Operation = "installed"
+	OperationListUpgradable Operation = "upgradable"
+)
+
+// DefaultTTLs are the TTLs of the caches returned by New. ListInstalled is not cached by default, as it is fast
+// for most package managers, and the package managers that do not implement manager.StateReporter would not notice
+// the packages installed by other processes until the TTL passes.
+var DefaultTTLs = map[Operation]time.Duration{
+	OperationFind:           time.Hour,
+	OperationGetPackageInfo: time.Hour,
+	OperationListUpgradable: time.Hour,
+}
+
+// Cache is a cache of query results stored in a directory, one JSON file per package manager.
+// It is safe for concurrent use. Processes that update the cache of a package manager at the same time
+// may drop each other's results, which only costs running the query again.
+type Cache struct {
+	// Dir is the directory of the cache. It is created by the first result stored.
+	Dir string
+
+	// TTLs are how long the results of each operation are used. The operations without a TTL are not cached.
+	TTLs map[Operation]time.Duration
+
+	mu sync.Mutex
+}
+
+// New returns the cache stored in dir, with the DefaultTTLs.
+func New(dir string) *Cache {
+	ttls := make(map[Operation]time.Duration, len(DefaultTTLs))
+	for op, ttl := range DefaultTTLs {
+		ttls[op] = ttl
+	}
+	return &Cache{Dir: dir, TTLs: ttls}
+}
+
+// entry is a cached query result.
+type entry struct {
+	Time     time.Time             `json:"time"`
+	Packages []manager.PackageInfo `json:"packages"`
+}
+
+// file is the cache of a package manager: the state of the package manager its entries were queried in,
+// see State, and the entries, by key.
+type file struct {
+	State   string           `json:"state"`
+	Entries map[string]entry `json:"entries"`
+}
+
+// State returns a fingerprint of the state files of pm, if it implements manager.StateReporter: their paths,
+// modification times and sizes. It changes when the packages of pm change. It is empty for the other package managers.
+func State(pm manager.PackageManager) string {
+	reporter, ok := manager.As[manager.StateReporter](pm)
+	if !ok {
+		return ""
+	}
+	var b strings.Builder
+	for _, path := range reporter.StateFiles() {
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%s %d %d\n", path, info.ModTime().UnixNano(), info.Size())
+		} else {
+			fmt.Fprintf(&b, "%s -\n", path)
+		}
+	}
+	return b.String()
+}
+
+// key returns the key of the result of op with args and opts: the custom arguments of opts, which the package managers
+// pass to their commands, such as the --repo of dnf, select the result too.
+func key(op Operation, args []string, opts *manager.Options) string {
+	k := strings.Join(append([]string{string(op)}, args...), "\x00")
+	if opts != nil && len(opts.CustomCommandArgs) > 0 {
+		k += "\x00\x01" + strings.Join(opts.CustomCommandArgs, "\x00")
+	}
+	return k
+}
+
+// path returns the path of the cache file of the package manager with the given name.
+func (c *Cache) path(name string) string {
+	return filepath.Join(c.Dir, name+".json")
+}
+
+// get returns the result of op cached with the key k for the package manager with the given name, if it is younger
+// than the TTL of op and was queried in state.
+func (c *Cache) get(name, state string, op Operation, k string) ([]manager.PackageInfo, bool) {
+	ttl := c.TTLs[op]
+	if ttl <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := c.read(name)
+	if err != nil || f.State != state {
+		return nil, false
+	}
+	e, ok := f.Entries[k]
+	if !ok || time.Since(e.Time) > ttl || e.Time.After(time.Now()) {
+		return nil, false
+	}
+	return e.Packages, true
+}
+
+// put caches the result of op with the key k for the package manager with the given name, queried in state,
+// and drops the results queried in another state or older than their TTL.
+func (c *Cache) put(name, state string, op Operation, k string, packages []manager.PackageInfo, queried time.Time) error {
+	if c.TTLs[op] <= 0 {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, err := c.read(name)
+	if err != nil || f.State != state {
+		f = &file{State: state}
+	}
+	entries := make(map[string]entry, len(f.Entries)+1)
+	for old, e := range f.Entries {
+		op, _, _ := strings.Cut(old, "\x00")
+		if time.Since(e.Time) <= c.TTLs[Operation(op)] {
+			entries[old] = e
+		}
+	}
+	entries[k] = entry{Time: queried, Packages: packages}
+	f.Entries = entries
+	return c.write(name, f)
+}
+
+// Invalidate drops the cached results of the package manager with the given name.
+func (c *Cache) Invalidate(name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.Remove(c.path(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// read reads the cache file of the package manager with the given name.
+func (c *Cache) read(name string) (*file, error) {
+	data, err := os.ReadFile(c.path(name))
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", c.path(name), err)
+	}
+	return &f, nil
+}
+
+// write writes the cache file of the package manager with the given name, through a temporary file renamed
+// to its final name, so that readers never see a partial file.
+func (c *Cache) write(name string, f *file) error {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(c.Dir, "."+name+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp makes the file private, but the results are not secrets
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(name))
+}
@@ -0,0 +1,148 @@
+package cache_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/cache"
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/apt"
+	"github.com/sjwhyte/syspkg/manager/runnertest"
+)
+
+func TestWrap(t *testing.T) {
+	const show = "Package: curl\nVersion: 7.81.0-1ubuntu1.15\nArchitecture: amd64\nSection: web\n"
+	runner := runnertest.New(runnertest.Response{Stdout: show})
+	root, dir := t.TempDir(), t.TempDir()
+	pm := cache.New(dir).Wrap(&apt.PackageManager{Runner: runner, Root: root})
+
+	want, err := pm.GetPackageInfo("curl", nil)
+	if err != nil {
+		t.Fatalf("GetPackageInfo() error = %v", err)
+	}
+	if got, err := pm.GetPackageInfo("curl", nil); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetPackageInfo() from the cache = %+v, %v, want %+v", got, err, want)
+	}
+	// another process with the same cache
+	again := cache.New(dir).Wrap(&apt.PackageManager{Runner: runner, Root: root})
+	if got, err := again.GetPackageInfo("curl", nil); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("GetPackageInfo() from the cache on disk = %+v, %v, want %+v", got, err, want)
+	}
+	if n := len(runner.Argv()); n != 1 {
+		t.Errorf("GetPackageInfo() ran %d commands, want the first query only", n)
+	}
+
+	// installing a package drops the cache, even from another process
+	runner.Push(runnertest.Response{}, runnertest.Response{Stdout: show})
+	if _, err := again.Install([]string{"curl"}, nil); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if _, err := pm.GetPackageInfo("curl", nil); err != nil {
+		t.Fatalf("GetPackageInfo() error = %v", err)
+	}
+	if n := len(runner.Argv()); n != 3 {
+		t.Errorf("GetPackageInfo() after Install() ran %d commands, want the query again", n-2)
+	}
+
+	// so does a change of the dpkg status database
+	runner.Push(runnertest.Response{Stdout: show})
+	if err := os.MkdirAll(filepath.Join(root, "var/lib/dpkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "var/lib/dpkg/status"), []byte("Package: curl\nStatus: install ok installed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pm.GetPackageInfo("curl", nil); err != nil {
+		t.Fatalf("GetPackageInfo() error = %v", err)
+	}
+	if n := len(runner.Argv()); n != 4 {
+		t.Errorf("GetPackageInfo() after a change of the status database ran %d commands, want the query again", n-3)
+	}
+
+	// errors are not cached, and the operations without a TTL are not cached
+	runner.Push(runnertest.Response{Stderr: "E: No packages found\n", ExitCode: 100}, runnertest.Response{Stdout: show})
+	if _, err := pm.GetPackageInfo("nosuchpackage", nil); err == nil {
+		t.Errorf("GetPackageInfo(nosuchpackage) error = nil, want an error")
+	}
+	if _, err := pm.GetPackageInfo("nosuchpackage", nil); err != nil {
+		t.Errorf("GetPackageInfo(nosuchpackage) again: error = %v, want the query to run again", err)
+	}
+	uncached := &cache.Cache{Dir: dir}
+	runner.Push(runnertest.Response{Stdout: show})
+	if _, err := uncached.Wrap(&apt.PackageManager{Runner: runner, Root: root}).GetPackageInfo("curl", nil); err != nil {
+		t.Fatalf("GetPackageInfo() without TTLs error = %v", err)
+	}
+	if n := len(runner.Argv()); n != 7 {
+		t.Errorf("ran %d commands, want 7", n)
+	}
+
+	if _, ok := manager.As[*apt.PackageManager](pm); !ok {
+		t.Errorf("As[*apt.PackageManager](Wrap(apt)) = false, want the wrapped package manager")
+	}
+}
+
+func TestWrapHold(t *testing.T) {
+	const upgradable = "Listing...\ncurl/jammy-updates 7.81.0-1ubuntu1.16 amd64 [upgradable from: 7.81.0-1ubuntu1.15]\n"
+	runner := runnertest.New(runnertest.Response{Stdout: upgradable}, runnertest.Response{})
+	pm := cache.New(t.TempDir()).Wrap(&apt.PackageManager{Runner: runner, Root: t.TempDir()})
+
+	if _, err := pm.ListUpgradable(nil); err != nil {
+		t.Fatalf("ListUpgradable() error = %v", err)
+	}
+	h, ok := manager.As[manager.HoldManager](pm)
+	if !ok {
+		t.Fatalf("As[HoldManager](Wrap(apt)) = false, want apt to hold packages")
+	}
+
+	// holding a package drops the cache, so that ListUpgradable reports it as held
+	runner.Push(runnertest.Response{}, runnertest.Response{Stdout: upgradable}, runnertest.Response{Stdout: "curl\n"})
+	if _, err := h.HoldContext(context.Background(), []string{"curl"}, nil); err != nil {
+		t.Fatalf("HoldContext() error = %v", err)
+	}
+	packages, err := pm.ListUpgradable(nil)
+	if err != nil {
+		t.Fatalf("ListUpgradable() error = %v", err)
+	}
+	if len(packages) != 1 || packages[0].Status != manager.PackageStatusHeld {
+		t.Errorf("ListUpgradable() after HoldContext() = %+v, want curl held", packages)
+	}
+	if n := len(runner.Argv()); n != 5 {
+		t.Errorf("ran %d commands, want 5", n)
+	}
+}
+
+func TestWrapOptions(t *testing.T) {
+	const show = "Package: curl\nVersion: 7.81.0-1ubuntu1.15\nArchitecture: amd64\nSection: web\n"
+	runner := runnertest.New(runnertest.Response{Stdout: show}, runnertest.Response{Stdout: show})
+	pm := cache.New(t.TempDir()).Wrap(&apt.PackageManager{Runner: runner, Root: t.TempDir()})
+
+	// the custom arguments are part of the query
+	custom := &manager.Options{CustomCommandArgs: []string{"-o", "Dir::Etc::SourceList=/etc/apt/other.list"}}
+	for _, opts := range []*manager.Options{nil, custom, {Verbose: true}, custom} {
+		if _, err := pm.GetPackageInfo("curl", opts); err != nil {
+			t.Fatalf("GetPackageInfo() error = %v", err)
+		}
+	}
+	if n := len(runner.Argv()); n != 2 {
+		t.Errorf("GetPackageInfo() ran %d commands, want one without and one with the custom arguments", n)
+	}
+
+	// removing the unused packages drops the cache
+	remover, ok := manager.As[manager.AutoRemover](pm)
+	if !ok {
+		t.Fatalf("As[AutoRemover](Wrap(apt)) = false, want apt to remove the unused packages")
+	}
+	runner.Push(runnertest.Response{}, runnertest.Response{Stdout: show})
+	if _, err := remover.AutoRemoveContext(context.Background(), nil); err != nil {
+		t.Fatalf("AutoRemoveContext() error = %v", err)
+	}
+	if _, err := pm.GetPackageInfo("curl", nil); err != nil {
+		t.Fatalf("GetPackageInfo() error = %v", err)
+	}
+	if n := len(runner.Argv()); n != 4 {
+		t.Errorf("GetPackageInfo() after AutoRemoveContext() ran %d commands, want the query again", n-3)
+	}
+}
@@ -0,0 +1,308 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// Wrap returns pm decorated to cache the results of its Find, GetPackageInfo, ListInstalled and ListUpgradable queries
+// in c, for the operations that have a TTL. It is a manager.Decorator.
+//
+// The cached results of pm are dropped when its Install, Delete, UpgradeAll or Refresh operations run, even if they fail,
+// and when the mutating operations of the optional interfaces it implements among manager.AutoRemover,
+// manager.HistoryManager, manager.HoldManager, manager.RequestInstaller, manager.Downgrader, manager.SecurityUpgrader
+// and manager.FileInstaller run, as found by manager.As. The results of the queries with other
+// Options.CustomCommandArgs are cached apart. They are not used once its state files change (see State), which catches the changes made
+// by other processes. Errors are not cached. Failing to read or write the cache is logged, but does not fail the query.
+func (c *Cache) Wrap(pm manager.PackageManager) manager.PackageManager {
+	return &cached{PackageManagerContext: manager.WithContext(pm), wrapped: pm, cache: c}
+}
+
+// cached is a package manager that caches the results of the queries of the package manager it wraps.
+type cached struct {
+	manager.PackageManagerContext
+	wrapped manager.PackageManager
+	cache   *Cache
+}
+
+// make sure cached implements manager.PackageManagerContext and manager.Wrapper
+var (
+	_ manager.PackageManagerContext = (*cached)(nil)
+	_ manager.Wrapper               = (*cached)(nil)
+	_ manager.AutoRemover           = (*cachedRemover)(nil)
+	_ manager.HistoryManager        = (*cachedHistory)(nil)
+	_ manager.HoldManager           = (*cachedHolder)(nil)
+	_ manager.RequestInstaller      = (*cachedInstaller)(nil)
+	_ manager.Downgrader            = (*cachedDowngrader)(nil)
+	_ manager.SecurityUpgrader      = (*cachedSecurityUpgrader)(nil)
+	_ manager.FileInstaller         = (*cachedFileInstaller)(nil)
+)
+
+// Unwrap returns the cached package manager.
+func (c *cached) Unwrap() manager.PackageManager {
+	return c.wrapped
+}
+
+// As sets target to the implementation of the optional interface it points to that drops the cached results
+// when its mutating operations run, if the cached package manager implements it.
+func (c *cached) As(target any) bool {
+	switch target := target.(type) {
+	case *manager.AutoRemover:
+		remover, ok := manager.As[manager.AutoRemover](c.wrapped)
+		if ok {
+			*target = &cachedRemover{cached: c, remover: remover}
+		}
+		return ok
+	case *manager.HistoryManager:
+		history, ok := manager.As[manager.HistoryManager](c.wrapped)
+		if ok {
+			*target = &cachedHistory{cached: c, history: history}
+		}
+		return ok
+	case *manager.HoldManager:
+		holder, ok := manager.As[manager.HoldManager](c.wrapped)
+		if ok {
+			*target = &cachedHolder{cached: c, holder: holder}
+		}
+		return ok
+	case *manager.RequestInstaller:
+		installer, ok := manager.As[manager.RequestInstaller](c.wrapped)
+		if ok {
+			*target = &cachedInstaller{cached: c, installer: installer}
+		}
+		return ok
+	case *manager.Downgrader:
+		downgrader, ok := manager.As[manager.Downgrader](c.wrapped)
+		if ok {
+			*target = &cachedDowngrader{cached: c, downgrader: downgrader}
+		}
+		return ok
+	case *manager.SecurityUpgrader:
+		upgrader, ok := manager.As[manager.SecurityUpgrader](c.wrapped)
+		if ok {
+			*target = &cachedSecurityUpgrader{cached: c, upgrader: upgrader}
+		}
+		return ok
+	case *manager.FileInstaller:
+		installer, ok := manager.As[manager.FileInstaller](c.wrapped)
+		if ok {
+			*target = &cachedFileInstaller{cached: c, installer: installer}
+		}
+		return ok
+	}
+	return false
+}
+
+func (c *cached) Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return c.FindContext(context.Background(), keywords, opts)
+}
+
+func (c *cached) FindContext(ctx context.Context, keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return c.query(OperationFind, keywords, opts, func() ([]manager.PackageInfo, error) {
+		return c.PackageManagerContext.FindContext(ctx, keywords, opts)
+	})
+}
+
+func (c *cached) ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return c.ListInstalledContext(context.Background(), opts)
+}
+
+func (c *cached) ListInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return c.query(OperationListInstalled, nil, opts, func() ([]manager.PackageInfo, error) {
+		return c.PackageManagerContext.ListInstalledContext(ctx, opts)
+	})
+}
+
+func (c *cached) ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return c.ListUpgradableContext(context.Background(), opts)
+}
+
+func (c *cached) ListUpgradableContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return c.query(OperationListUpgradable, nil, opts, func() ([]manager.PackageInfo, error) {
+		return c.PackageManagerContext.ListUpgradableContext(ctx, opts)
+	})
+}
+
+func (c *cached) GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	return c.GetPackageInfoContext(context.Background(), pkg, opts)
+}
+
+func (c *cached) GetPackageInfoContext(ctx context.Context, pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	packages, err := c.query(OperationGetPackageInfo, []string{pkg}, opts, func() ([]manager.PackageInfo, error) {
+		info, err := c.PackageManagerContext.GetPackageInfoContext(ctx, pkg, opts)
+		if err != nil {
+			return nil, err
+		}
+		return []manager.PackageInfo{info}, nil
+	})
+	if err != nil || len(packages) == 0 {
+		return manager.PackageInfo{}, err
+	}
+	return packages[0], nil
+}
+
+func (c *cached) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return c.InstallContext(context.Background(), pkgs, opts)
+}
+
+func (c *cached) InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	defer c.invalidate(opts)
+	return c.PackageManagerContext.InstallContext(ctx, pkgs, opts)
+}
+
+func (c *cached) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return c.DeleteContext(context.Background(), pkgs, opts)
+}
+
+func (c *cached) DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	defer c.invalidate(opts)
+	return c.PackageManagerContext.DeleteContext(ctx, pkgs, opts)
+}
+
+func (c *cached) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return c.UpgradeAllContext(context.Background(), pkgs, opts)
+}
+
+func (c *cached) UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	defer c.invalidate(opts)
+	return c.PackageManagerContext.UpgradeAllContext(ctx, pkgs, opts)
+}
+
+func (c *cached) Refresh(opts *manager.Options) error {
+	return c.RefreshContext(context.Background(), opts)
+}
+
+func (c *cached) RefreshContext(ctx context.Context, opts *manager.Options) error {
+	defer c.invalidate(opts)
+	return c.PackageManagerContext.RefreshContext(ctx, opts)
+}
+
+// cachedRemover drops the cached results of a package manager when it removes the unused packages.
+type cachedRemover struct {
+	*cached
+	remover manager.AutoRemover
+}
+
+func (c *cachedRemover) AutoRemoveContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	defer c.invalidate(opts)
+	return c.remover.AutoRemoveContext(ctx, opts)
+}
+
+// cachedHistory drops the cached results of a package manager when it undoes a transaction of its history.
+type cachedHistory struct {
+	*cached
+	history manager.HistoryManager
+}
+
+func (c *cachedHistory) LastTransactionContext(ctx context.Context, opts *manager.Options) (string, error) {
+	return c.history.LastTransactionContext(ctx, opts)
+}
+
+func (c *cachedHistory) UndoTransactionContext(ctx context.Context, id string, opts *manager.Options) error {
+	defer c.invalidate(opts)
+	return c.history.UndoTransactionContext(ctx, id, opts)
+}
+
+// cachedHolder drops the cached results of a package manager when it holds or releases packages,
+// which changes what ListUpgradable reports.
+type cachedHolder struct {
+	*cached
+	holder manager.HoldManager
+}
+
+func (c *cachedHolder) ListHeldContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return c.holder.ListHeldContext(ctx, opts)
+}
+
+func (c *cachedHolder) HoldContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	defer c.invalidate(opts)
+	return c.holder.HoldContext(ctx, pkgs, opts)
+}
+
+func (c *cachedHolder) UnholdContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	defer c.invalidate(opts)
+	return c.holder.UnholdContext(ctx, pkgs, opts)
+}
+
+// cachedInstaller drops the cached results of a package manager when it installs given versions of packages.
+type cachedInstaller struct {
+	*cached
+	installer manager.RequestInstaller
+}
+
+func (c *cachedInstaller) InstallRequestsContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	defer c.invalidate(opts)
+	return c.installer.InstallRequestsContext(ctx, reqs, opts)
+}
+
+// cachedDowngrader drops the cached results of a package manager when it downgrades packages.
+type cachedDowngrader struct {
+	*cached
+	downgrader manager.Downgrader
+}
+
+func (c *cachedDowngrader) DowngradeContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	defer c.invalidate(opts)
+	return c.downgrader.DowngradeContext(ctx, reqs, opts)
+}
+
+// cachedSecurityUpgrader drops the cached results of a package manager when it applies the security updates.
+type cachedSecurityUpgrader struct {
+	*cached
+	upgrader manager.SecurityUpgrader
+}
+
+func (c *cachedSecurityUpgrader) UpgradeSecurityContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	defer c.invalidate(opts)
+	return c.upgrader.UpgradeSecurityContext(ctx, opts)
+}
+
+// cachedFileInstaller drops the cached results of a package manager when it installs package files.
+type cachedFileInstaller struct {
+	*cached
+	installer manager.FileInstaller
+}
+
+func (c *cachedFileInstaller) PackageFileTypes() []manager.PackageFileType {
+	return c.installer.PackageFileTypes()
+}
+
+func (c *cachedFileInstaller) InstallFilesContext(ctx context.Context, paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	defer c.invalidate(opts)
+	return c.installer.InstallFilesContext(ctx, paths, opts)
+}
+
+// query returns the cached result of op with args and opts, or runs it and caches its result if it succeeds.
+func (c *cached) query(op Operation, args []string, opts *manager.Options, run func() ([]manager.PackageInfo, error)) ([]manager.PackageInfo, error) {
+	name := c.GetPackageManager()
+	k := key(op, args, opts)
+	// the state is taken before running the query, so that a change while it runs makes its result stale
+	state := State(c.wrapped)
+	if packages, ok := c.cache.get(name, state, op, k); ok {
+		return packages, nil
+	}
+
+	queried := time.Now()
+	packages, err := run()
+	if err != nil {
+		return packages, err
+	}
+	if putErr := c.cache.put(name, state, op, k, packages, queried); putErr != nil {
+		log.Printf("%s: cannot cache the %s results: %v\n", name, op, putErr)
+	}
+	return packages, nil
+}
+
+// invalidate drops the cached results after a mutating operation, unless it was a dry run.
+func (c *cached) invalidate(opts *manager.Options) {
+	if opts != nil && opts.DryRun {
+		return
+	}
+	name := c.GetPackageManager()
+	if err := c.cache.Invalidate(name); err != nil {
+		log.Printf("%s: cannot drop the cached results: %v\n", name, err)
+	}
+}
@@ -2,42 +2,49 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	// "github.com/rs/zerolog/log"
 	"github.com/urfave/cli/v2"
 
-	"github.com/bluet/syspkg"
+	"github.com/sjwhyte/syspkg"
+	"github.com/sjwhyte/syspkg/cache"
+	"github.com/sjwhyte/syspkg/journal"
 	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manifest"
+	"github.com/sjwhyte/syspkg/pkgfile"
+	"github.com/sjwhyte/syspkg/snapshot"
 )
 
 // main function initializes syspkg and sets up the CLI application.
 func main() {
-	// Check if the user has root privileges.
-	if os.Geteuid() != 0 {
-		fmt.Println("(This command must be run with root privileges. If you got exist codes 100 or 101, please run this command with sudo.)")
-	}
-
 	// Initialize syspkg and find available package managers.
 	s, err := syspkg.New(
 		syspkg.IncludeOptions(syspkg.IncludeOptions{
 			AllAvailable: true,
+			Decorators:   decorators(),
 		}),
 	)
 	if err != nil {
 		fmt.Printf("Error while initializing syspkg: %+v\n", err)
 		os.Exit(1)
 	}
-	pms, err := s.FindPackageManagers(syspkg.IncludeOptions{
-		AllAvailable: true,
-	})
-	if err != nil {
-		fmt.Printf("Error while initializing package managers: %+v\n", err)
-		os.Exit(1)
-	}
+	// Stop the running package manager commands (and their children) on Ctrl-C or SIGTERM.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	cancelTimeout := context.CancelFunc(func() {})
 
 	// Set up the CLI application.
 	app := &cli.App{
@@ -46,37 +53,66 @@ func main() {
 		EnableBashCompletion:   true,
 		UseShortOptionHandling: true,
 		Suggest:                true,
+		Before: func(c *cli.Context) error {
+			history.Dir = c.String("journal")
+			queryCache.Dir = c.String("cache")
+			if c.Bool("no-cache") {
+				queryCache.TTLs = nil
+			}
+			if timeout := c.Duration("timeout"); timeout > 0 {
+				c.Context, cancelTimeout = context.WithTimeout(c.Context, timeout)
+			}
+			return nil
+		},
+		After: func(c *cli.Context) error {
+			cancelTimeout()
+			return nil
+		},
 		// Action: func(c *cli.Context) error {
 		// 	var opts = getOptions(c)
 		// 	pms = filterPackageManager(pms, c)
 
 		// 	log.Printf("Listing upgradable packages for %T...\n", pms)
-		// 	listUpgradablePackages(pms, opts)
+		// 	listUpgradablePackages(c.Context, pms, opts)
 		// 	return nil
 		// },
 		// DefaultCommand: "show upgradable",
 		Commands: []*cli.Command{
 			{
-				Name:    "install",
-				Aliases: []string{"i"},
-				Usage:   "Install packages",
+				Name:      "install",
+				Aliases:   []string{"i"},
+				Usage:     "Install packages",
+				ArgsUsage: "PACKAGE[:ARCH][=VERSION][@SOURCE]|FILE...",
+				Description: "Install packages with every package manager, or, when a version, an architecture or a source is given, " +
+					"with the package manager selected by the flags, or else the one of the system. " +
+					"The version is a revision for snap and a commit for flatpak, and the source is a release for apt, a channel for snap and a remote for flatpak. " +
+					"Local package files (.deb, .rpm, .snap, .flatpakref and .flatpak bundles) are installed with the package manager of their type.",
 				Action: func(c *cli.Context) error {
 					var opts = getOptions(c)
-					pms = filterPackageManager(pms, c)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
+					}
 
-					log.Printf("Installing packages for %T...\n", pms)
+					log.Println("Installing packages...")
 
-					pkgNames := c.Args().Slice()
-					for _, pm := range pms {
-						log.Printf("Installing packages for %T...\n", pm)
-						packages, err := pm.Install(pkgNames, opts)
-						if err != nil {
-							fmt.Printf("Error while installing packages for %T: %+v\n%+v", pm, err, packages)
-							continue
+					files, pkgNames := packageFiles(c.Args().Slice())
+					if len(files) > 0 {
+						packages, err := syspkg.InstallFiles(c.Context, s, files, opts)
+						log.Printf("Installed packages:\n%+v\n", packages)
+						if err != nil || len(pkgNames) == 0 {
+							return printErrors("installing package files", err)
 						}
-						log.Printf("Installed packages for %T:\n%+v\n", pm, packages)
 					}
-					return nil
+					reqs, pinned, err := installRequests(pkgNames)
+					if err != nil {
+						return err
+					}
+					if pinned {
+						return installRequested(c, s, reqs, opts)
+					}
+					packages, err := s.InstallContext(c.Context, pkgNames, opts)
+					log.Printf("Installed packages:\n%+v\n", packages)
+					return printErrors("installing packages", err)
 				},
 			},
 			{
@@ -85,21 +121,16 @@ func main() {
 				Usage:   "Delete packages",
 				Action: func(c *cli.Context) error {
 					var opts = getOptions(c)
-					pms = filterPackageManager(pms, c)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
+					}
 					pkgNames := c.Args().Slice()
 
-					log.Printf("Deleting packages... for %T\n", pms)
+					log.Println("Deleting packages...")
 
-					for _, pm := range pms {
-						log.Printf("Deleting packages for %T...\n", pm)
-						packages, err := pm.Delete(pkgNames, opts)
-						if err != nil {
-							fmt.Printf("Error while deleting packages for %T: %+v\n%+v\n", pm, err, packages)
-							continue
-						}
-						log.Printf("Deleted packages for %T:\n%+v\n", pm, packages)
-					}
-					return nil
+					packages, err := s.DeleteContext(c.Context, pkgNames, opts)
+					log.Printf("Deleted packages:\n%+v\n", packages)
+					return printErrors("deleting packages", err)
 				},
 			},
 			{
@@ -108,46 +139,45 @@ func main() {
 				Usage:   "Refresh package list",
 				Action: func(c *cli.Context) error {
 					var opts = getOptions(c)
-					pms = filterPackageManager(pms, c)
-
-					log.Printf("Refreshing package list... for %T\n", pms)
-					for _, pm := range pms {
-						log.Printf("Refreshing package list for %T...\n", pm)
-						err := pm.Refresh(opts)
-						if err != nil {
-							fmt.Printf("Error while updating package list for %T: %+v\n", pm, err)
-							continue
-						}
-						log.Printf("Refreshed package list for %T\n", pm)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
 					}
-					return nil
+
+					log.Println("Refreshing package list...")
+					err := s.RefreshContext(c.Context, opts)
+					return printErrors("updating package list", err)
 				},
 			},
 			{
 				Name:    "upgrade",
 				Aliases: []string{"U", "ug"},
 				Usage:   "Upgrade packages",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{Name: "security-only", Usage: "only apply the security updates, with the package managers that can tell them apart (apt and dnf)"},
+				},
 				Action: func(c *cli.Context) error {
 					var opts = getOptions(c)
-					pms = filterPackageManager(pms, c)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
+					}
+					securityOnly := c.Bool("security-only")
 
-					log.Printf("Upgrading packages... for %T\n", pms)
+					log.Println("Upgrading packages...")
 
-					listUpgradablePackages(pms, opts)
+					// the package managers that can be listed are still upgraded, their errors are printed
+					_ = listUpgradablePackages(c.Context, s, opts, securityOnly)
 					if !opts.AssumeYes {
-						fmt.Print("\nDo you want to perform the system package upgrade? [Y/n]: ")
-						input := ""
-						_, _ = fmt.Scanln(&input)
-						input = strings.ToLower(input)
-
-						if input != "y" && input != "" {
+						if !confirm("Do you want to perform the system package upgrade?") {
 							fmt.Println("Upgrade cancelled.")
 							return nil
 						}
 						log.Println("User confirmed upgrade.")
 					}
 
-					return performUpgrade(pms, opts)
+					if securityOnly {
+						return performSecurityUpgrade(c.Context, s, opts)
+					}
+					return performUpgrade(c.Context, s, opts)
 				},
 			},
 			{
@@ -156,30 +186,608 @@ func main() {
 				Usage:   "Find matching packages",
 				Action: func(c *cli.Context) error {
 					var opts = getOptions(c)
-					pms = filterPackageManager(pms, c)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
+					}
 					keywords := c.Args().Slice()
 
 					if len(keywords) == 0 {
 						fmt.Println("Please specify keywords to search.")
 						return nil
 					}
-					log.Printf("Finding packages for %T: %+v\n", pms, keywords)
+					log.Printf("Finding packages: %+v\n", keywords)
+
+					pkgs, err := s.FindContext(c.Context, keywords, opts)
+					fmt.Println("Found results:")
+					for _, pkg := range pkgs {
+						fmt.Printf("%s: %s [%s][%s] (%s)\n", pkg.PackageManager, pkg.Name, pkg.Version, pkg.NewVersion, pkg.Status)
+					}
+					return printErrors("searching packages", err)
+				},
+			},
+			{
+				Name:        "which",
+				Usage:       "Show the packages that own a file",
+				ArgsUsage:   "PATH",
+				Description: "Show the installed packages that own the file or directory PATH. A PATH without slashes is looked up in the PATH environment variable, like a command.",
+				Action: func(c *cli.Context) error {
+					var opts = getOptions(c)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
+					}
+					if c.NArg() != 1 {
+						fmt.Println("Please specify one and only one path.")
+						return nil
+					}
+					path, err := lookPath(c.Args().First())
+					if err != nil {
+						return err
+					}
 
-					for _, pm := range pms {
-						pkgs, err := pm.Find(keywords, opts)
+					errs := make(syspkg.ManagerErrors)
+					found := false
+					for _, pm := range packageManagers(s) {
+						fm, ok := manager.As[manager.FileManager](pm)
+						if !ok {
+							continue
+						}
+						pkgs, err := fm.OwnerOfContext(c.Context, path, opts)
+						if errors.Is(err, manager.ErrPackageNotFound) {
+							continue
+						}
 						if err != nil {
-							fmt.Printf("Error while searching packages for %T: %+v\n", pm, err)
+							errs[pm.GetPackageManager()] = err
 							continue
 						}
-
-						fmt.Printf("Found results for %T:\n", pm)
 						for _, pkg := range pkgs {
-							fmt.Printf("%s: %s [%s][%s] (%s)\n", pkg.PackageManager, pkg.Name, pkg.Version, pkg.NewVersion, pkg.Status)
+							found = true
+							fmt.Printf("%s: %s\n", pkg.PackageManager, pkg.Name)
+						}
+					}
+					if !found && len(errs) == 0 {
+						fmt.Printf("%s is not owned by any package.\n", path)
+						return cli.Exit("", 1)
+					}
+					if len(errs) > 0 {
+						return printErrors("finding the owner of "+path, errs)
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "files",
+				Usage:     "List the files of an installed package",
+				ArgsUsage: "PACKAGE",
+				Action: func(c *cli.Context) error {
+					var opts = getOptions(c)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
+					}
+					if c.NArg() != 1 {
+						fmt.Println("Please specify one and only one package name.")
+						return nil
+					}
+					pkg := c.Args().First()
+
+					// the package is listed by the first package manager that has it installed
+					errs := make(syspkg.ManagerErrors)
+					for _, pm := range packageManagers(s) {
+						fm, ok := manager.As[manager.FileManager](pm)
+						if !ok {
+							continue
 						}
+						files, err := fm.ListFilesContext(c.Context, pkg, opts)
+						if errors.Is(err, manager.ErrPackageNotFound) {
+							continue
+						}
+						if err != nil {
+							errs[pm.GetPackageManager()] = err
+							continue
+						}
+						for _, file := range files {
+							fmt.Println(file)
+						}
+						return nil
+					}
+					if len(errs) > 0 {
+						return printErrors("listing the files of "+pkg, errs)
+					}
+					fmt.Printf("%s is not installed.\n", pkg)
+					return cli.Exit("", 1)
+				},
+			},
+			{
+				Name:        "inspect",
+				Usage:       "Show the metadata of a package file",
+				ArgsUsage:   "FILE",
+				Description: "Show the metadata of the .deb or .rpm package FILE, read in Go without installing it and without running any package manager.",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 1 {
+						fmt.Println("Please specify one and only one package file.")
+						return nil
+					}
+					pkg, meta, err := pkgfile.Inspect(c.Args().First())
+					if err != nil {
+						return err
+					}
+					printPackageFile(pkg, meta)
+					return nil
+				},
+			},
+			{
+				Name:        "hold",
+				Usage:       "Hold packages at their installed version",
+				ArgsUsage:   "PACKAGE...",
+				Description: "Hold packages so that upgrades leave them alone: apt-mark hold for apt, the versionlock plugin for dnf, snap refresh --hold for snap and flatpak mask for flatpak.",
+				Action: func(c *cli.Context) error {
+					return holdPackages(c, s, true)
+				},
+			},
+			{
+				Name:      "unhold",
+				Usage:     "Release held packages, so that they are upgraded again",
+				ArgsUsage: "PACKAGE...",
+				Action: func(c *cli.Context) error {
+					return holdPackages(c, s, false)
+				},
+			},
+			{
+				Name:      "downgrade",
+				Usage:     "Downgrade packages to an older version",
+				ArgsUsage: "PACKAGE[=VERSION]...",
+				Description: "Downgrade packages with the package manager selected by the flags, or else the one of the system: " +
+					"apt install --allow-downgrades for apt, dnf downgrade for dnf, snap revert for snap and flatpak update --commit for flatpak. " +
+					"dnf and snap go back to the previous version when no VERSION is given, apt and flatpak need one, see `syspkg show versions`.",
+				Action: func(c *cli.Context) error {
+					var opts = getOptions(c)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
+					}
+					if c.NArg() == 0 {
+						fmt.Println("Please specify package names.")
+						return nil
+					}
+					reqs, _, err := installRequests(c.Args().Slice())
+					if err != nil {
+						return err
+					}
+
+					pm := s.GetPackageManager("")
+					if pm == nil {
+						return fmt.Errorf("no package manager is available")
+					}
+					d, ok := manager.As[manager.Downgrader](pm)
+					if !ok {
+						return printErrors("downgrading packages", fmt.Errorf("%s cannot downgrade packages: %w", pm.GetPackageManager(), manager.ErrUnsupported))
+					}
+					pkgs, err := d.DowngradeContext(c.Context, reqs, opts)
+					for _, pkg := range pkgs {
+						fmt.Printf("%s: %s %s -> %s\n", pkg.PackageManager, pkg.Name, pkg.Version, pkg.NewVersion)
+					}
+					return printErrors("downgrading packages", err)
+				},
+			},
+			{
+				Name:  "repo",
+				Usage: "List, add, remove, enable and disable package repositories",
+				Description: "Repositories are changed with the package manager selected by the flags, or else the one of the system, " +
+					"then its package lists are refreshed unless --no-refresh is given.",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "list",
+						Aliases: []string{"l", "ls"},
+						Usage:   "List the repositories of all the package managers",
+						Action: func(c *cli.Context) error {
+							var opts = getOptions(c)
+							if err := filterPackageManager(s, c); err != nil {
+								return err
+							}
+
+							errs := make(syspkg.ManagerErrors)
+							for _, pm := range packageManagers(s) {
+								rm, ok := manager.As[manager.RepositoryManager](pm)
+								if !ok {
+									continue
+								}
+								repos, err := rm.ListRepositoriesContext(c.Context, opts)
+								if err != nil {
+									errs[pm.GetPackageManager()] = err
+									continue
+								}
+								for _, repo := range repos {
+									fmt.Printf("%s: %s\n", pm.GetPackageManager(), repo)
+								}
+							}
+							if len(errs) > 0 {
+								return printErrors("listing repositories", errs)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "add",
+						Aliases:   []string{"a"},
+						Usage:     "Add a repository",
+						ArgsUsage: "NAME URL...",
+						Flags: []cli.Flag{
+							&cli.StringFlag{Name: "title", Usage: "human-readable name of the repository"},
+							&cli.StringFlag{Name: "key", Usage: "signing key of the repository: the path of a keyring for apt, the URL of a key for dnf, the path of a GPG key for flatpak"},
+							&cli.StringSliceFlag{Name: "type", Usage: "apt source type, deb or deb-src (default: deb)"},
+							&cli.StringSliceFlag{Name: "suite", Usage: "apt suite, such as jammy"},
+							&cli.StringSliceFlag{Name: "component", Usage: "apt component, such as main"},
+							&cli.StringSliceFlag{Name: "arch", Usage: "apt architecture, such as amd64"},
+							&cli.BoolFlag{Name: "disabled", Usage: "add the repository disabled"},
+							noRefreshFlag,
+						},
+						Action: func(c *cli.Context) error {
+							if c.NArg() < 2 {
+								fmt.Println("Please specify the name and the URL of the repository.")
+								return nil
+							}
+							repo := manager.Repository{
+								Name:          c.Args().First(),
+								URLs:          c.Args().Tail(),
+								Title:         c.String("title"),
+								Key:           c.String("key"),
+								Types:         c.StringSlice("type"),
+								Suites:        c.StringSlice("suite"),
+								Components:    c.StringSlice("component"),
+								Architectures: c.StringSlice("arch"),
+								Disabled:      c.Bool("disabled"),
+							}
+							return changeRepository(c, s, "adding repository "+repo.Name, func(rm manager.RepositoryManager, opts *manager.Options) error {
+								return rm.AddRepositoryContext(c.Context, repo, opts)
+							})
+						},
+					},
+					{
+						Name:      "remove",
+						Aliases:   []string{"rm"},
+						Usage:     "Remove a repository",
+						ArgsUsage: "NAME",
+						Flags:     []cli.Flag{noRefreshFlag},
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								fmt.Println("Please specify the name of one repository.")
+								return nil
+							}
+							name := c.Args().First()
+							return changeRepository(c, s, "removing repository "+name, func(rm manager.RepositoryManager, opts *manager.Options) error {
+								return rm.RemoveRepositoryContext(c.Context, name, opts)
+							})
+						},
+					},
+					{
+						Name:      "enable",
+						Usage:     "Enable a repository",
+						ArgsUsage: "NAME",
+						Flags:     []cli.Flag{noRefreshFlag},
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								fmt.Println("Please specify the name of one repository.")
+								return nil
+							}
+							name := c.Args().First()
+							return changeRepository(c, s, "enabling repository "+name, func(rm manager.RepositoryManager, opts *manager.Options) error {
+								return rm.SetRepositoryEnabledContext(c.Context, name, true, opts)
+							})
+						},
+					},
+					{
+						Name:      "disable",
+						Usage:     "Disable a repository",
+						ArgsUsage: "NAME",
+						Flags:     []cli.Flag{noRefreshFlag},
+						Action: func(c *cli.Context) error {
+							if c.NArg() != 1 {
+								fmt.Println("Please specify the name of one repository.")
+								return nil
+							}
+							name := c.Args().First()
+							return changeRepository(c, s, "disabling repository "+name, func(rm manager.RepositoryManager, opts *manager.Options) error {
+								return rm.SetRepositoryEnabledContext(c.Context, name, false, opts)
+							})
+						},
+					},
+				},
+			},
+			{
+				Name:      "apply",
+				Usage:     "Install, remove and hold packages to match a manifest",
+				ArgsUsage: "MANIFEST",
+				Description: "Compare the packages of the system with a YAML or JSON manifest, print the plan that reconciles them, and apply it. " +
+					"Use `--plan` to only print the plan.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "plan",
+						Usage: "Only print the plan, do not apply it",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					var opts = getOptions(c)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
+					}
+
+					if c.NArg() != 1 {
+						fmt.Println("Please specify one and only one manifest file.")
+						return nil
+					}
+					m, err := manifest.Load(c.Args().First())
+					if err != nil {
+						return err
+					}
+
+					plan, err := manifest.NewPlan(c.Context, s, m, opts)
+					if err != nil {
+						return printErrors("planning the changes", err)
+					}
+					if plan.Empty() {
+						fmt.Println("The system already matches the manifest.")
+						return nil
+					}
+					fmt.Printf("Plan:\n%s", plan)
+					if c.Bool("plan") {
+						return nil
+					}
+
+					if !opts.AssumeYes {
+						if !confirm("Do you want to apply the plan?") {
+							fmt.Println("Apply cancelled.")
+							return nil
+						}
+						log.Println("User confirmed apply.")
+					}
+
+					packages, err := manifest.Apply(c.Context, s, plan, opts)
+					log.Printf("Changed packages:\n%+v\n", packages)
+					return printErrors("applying the plan", err)
+				},
+			},
+			{
+				Name:  "snapshot",
+				Usage: "Export or restore the list of installed packages",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "export",
+						Usage:     "Write the installed packages to a JSON lockfile, or to the standard output",
+						ArgsUsage: "[FILE]",
+						Action: func(c *cli.Context) error {
+							var opts = getOptions(c)
+							if err := filterPackageManager(s, c); err != nil {
+								return err
+							}
+
+							log.Println("Listing installed packages...")
+
+							snap, err := snapshot.Take(c.Context, s, opts)
+							if err != nil {
+								return printErrors("listing installed packages", err)
+							}
+							if c.NArg() == 0 || c.Args().First() == "-" {
+								return snap.Write(os.Stdout)
+							}
+							if err := snap.Save(c.Args().First()); err != nil {
+								return err
+							}
+							log.Printf("Exported %d packages to %s\n", len(snap.Packages), c.Args().First())
+							return nil
+						},
+					},
+					{
+						Name:      "restore",
+						Usage:     "Install the packages of a JSON lockfile, at their version where the package manager supports it",
+						ArgsUsage: "FILE",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "plan",
+								Usage: "Only print the plan, do not apply it",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							var opts = getOptions(c)
+							if err := filterPackageManager(s, c); err != nil {
+								return err
+							}
+
+							if c.NArg() != 1 {
+								fmt.Println("Please specify one and only one snapshot file.")
+								return nil
+							}
+							snap, err := snapshot.Load(c.Args().First())
+							if err != nil {
+								return err
+							}
+
+							plan, unsatisfied, err := snap.Plan(c.Context, s, opts)
+							if err != nil {
+								return printErrors("planning the changes", err)
+							}
+							fmt.Printf("Plan:\n%s", plan)
+							if c.Bool("plan") {
+								printUnsatisfied(unsatisfied)
+								return nil
+							}
+
+							if !opts.AssumeYes {
+								if !confirm("Do you want to restore the snapshot?") {
+									fmt.Println("Restore cancelled.")
+									return nil
+								}
+								log.Println("User confirmed restore.")
+							}
+
+							unsatisfied, err = snapshot.Restore(c.Context, s, snap, opts)
+							printUnsatisfied(unsatisfied)
+							return printErrors("restoring the snapshot", err)
+						},
+					},
+				},
+			},
+			{
+				Name:        "diff",
+				Usage:       "Compare two snapshots, or a snapshot with the installed packages",
+				ArgsUsage:   "FROM [TO]",
+				Description: "Report the packages added, removed, upgraded and downgraded from the snapshot FROM to the snapshot TO, or to the installed packages if TO is not given.",
+				Action: func(c *cli.Context) error {
+					var opts = getOptions(c)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
+					}
+
+					if c.NArg() < 1 || c.NArg() > 2 {
+						fmt.Println("Please specify one or two snapshot files.")
+						return nil
+					}
+					from, err := snapshot.Load(c.Args().Get(0))
+					if err != nil {
+						return err
+					}
+					var to *snapshot.Snapshot
+					if c.NArg() == 2 {
+						to, err = snapshot.Load(c.Args().Get(1))
+						if err != nil {
+							return err
+						}
+					} else {
+						log.Println("Listing installed packages...")
+						to, err = snapshot.Take(c.Context, s, opts)
+						if err != nil {
+							return printErrors("listing installed packages", err)
+						}
+					}
+
+					changes := snapshot.Diff(from, to)
+					if len(changes) == 0 {
+						fmt.Println("No differences.")
+					}
+					for _, change := range changes {
+						fmt.Println(change)
 					}
 					return nil
 				},
 			},
+			{
+				Name:  "history",
+				Usage: "Show the recorded installs, removals and upgrades",
+				Subcommands: []*cli.Command{
+					{
+						Name:    "list",
+						Aliases: []string{"l", "ls"},
+						Usage:   "List the recorded transactions",
+						Action: func(c *cli.Context) error {
+							transactions, err := history.List()
+							if err != nil {
+								return err
+							}
+							for _, t := range transactions {
+								fmt.Printf("%d\t%s\t%s\t%s: %s %s\t%d changes\t%s\n", t.ID, t.Time.Local().Format("2006-01-02 15:04:05"), t.User,
+									t.PackageManager, t.Operation, strings.Join(t.Requested, " "), len(t.Changes), transactionStatus(t))
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "show",
+						Aliases:   []string{"s"},
+						Usage:     "Show a recorded transaction",
+						ArgsUsage: "ID",
+						Action: func(c *cli.Context) error {
+							id, err := strconv.Atoi(c.Args().First())
+							if c.NArg() != 1 || err != nil {
+								fmt.Println("Please specify the ID of one transaction.")
+								return nil
+							}
+							t, err := history.Get(id)
+							if err != nil {
+								return err
+							}
+
+							fmt.Printf("Transaction %d\n", t.ID)
+							fmt.Printf("Time: %s\n", t.Time.Local().Format(time.RFC1123))
+							fmt.Printf("User: %s\n", t.User)
+							fmt.Printf("Package manager: %s\n", t.PackageManager)
+							fmt.Printf("Operation: %s %s\n", t.Operation, strings.Join(t.Requested, " "))
+							fmt.Printf("Duration: %s\n", t.Duration.Round(time.Millisecond))
+							fmt.Printf("Status: %s\n", transactionStatus(t))
+							fmt.Println("Changes:")
+							for _, change := range t.Changes {
+								fmt.Printf("  %s\n", change)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:        "rollback",
+				Usage:       "Revert a recorded transaction, by default the last one",
+				ArgsUsage:   "[ID]",
+				Description: "Remove the packages installed by the transaction, and install the packages it removed, upgraded or downgraded at their previous version where the repositories still offer it. dnf transactions are undone with `dnf history undo`.",
+				Action: func(c *cli.Context) error {
+					var opts = getOptions(c)
+					if err := filterPackageManager(s, c); err != nil {
+						return err
+					}
+
+					var t journal.Transaction
+					switch c.NArg() {
+					case 0:
+						transactions, err := history.List()
+						if err != nil {
+							return err
+						}
+						if len(transactions) == 0 {
+							fmt.Println("No transaction was recorded.")
+							return nil
+						}
+						t = transactions[len(transactions)-1]
+					case 1:
+						id, err := strconv.Atoi(c.Args().First())
+						if err != nil {
+							fmt.Println("Please specify the ID of one transaction.")
+							return nil
+						}
+						if t, err = history.Get(id); err != nil {
+							return err
+						}
+					default:
+						fmt.Println("Please specify the ID of one transaction.")
+						return nil
+					}
+
+					if len(t.Changes) == 0 && t.NativeID == "" {
+						fmt.Printf("Transaction %d did not change any package.\n", t.ID)
+						return nil
+					}
+					fmt.Printf("Rolling back transaction %d (%s: %s %s):\n", t.ID, t.PackageManager, t.Operation, strings.Join(t.Requested, " "))
+					for _, change := range t.Changes {
+						fmt.Printf("  %s\n", change)
+					}
+
+					if !opts.AssumeYes {
+						if !confirm("Do you want to roll back the transaction?") {
+							fmt.Println("Rollback cancelled.")
+							return nil
+						}
+						log.Println("User confirmed rollback.")
+					}
+
+					unreverted, err := journal.Rollback(c.Context, s, t, opts)
+					if err != nil {
+						return printErrors("rolling back the transaction", err)
+					}
+					if len(unreverted) == 0 {
+						fmt.Println("Rollback completed.")
+						return nil
+					}
+					fmt.Println("Changes that could not be reverted:")
+					for _, u := range unreverted {
+						fmt.Printf("  %s\n", u)
+					}
+					return cli.Exit("", 1)
+				},
+			},
 			{
 				Name:        "show",
 				Aliases:     []string{"s"},
@@ -192,12 +800,13 @@ func main() {
 						Usage:   "Show upgradable packages",
 						Action: func(c *cli.Context) error {
 							var opts = getOptions(c)
-							pms = filterPackageManager(pms, c)
+							if err := filterPackageManager(s, c); err != nil {
+								return err
+							}
 
 							log.Println("Showing upgradable packages...")
 
-							listUpgradablePackages(pms, opts)
-							return nil
+							return listUpgradablePackages(c.Context, s, opts, false)
 						},
 					},
 					{
@@ -206,7 +815,9 @@ func main() {
 						Usage:   "Show package information",
 						Action: func(c *cli.Context) error {
 							var opts = getOptions(c)
-							pms = filterPackageManager(pms, c)
+							if err := filterPackageManager(s, c); err != nil {
+								return err
+							}
 							pkgNames := c.Args().Slice()
 
 							if len(pkgNames) != 1 {
@@ -216,46 +827,167 @@ func main() {
 
 							log.Println("Showing package information...")
 
-							for _, pm := range pms {
-								log.Printf("Showing package information for %T...\n", pm)
-								pkg, err := pm.GetPackageInfo(pkgNames[0], opts)
+							pkgs, err := s.GetPackageInfoContext(c.Context, pkgNames[0], opts)
+							fmt.Println("Search results:")
+							for _, pkg := range pkgs {
+								fmt.Printf("%s: %s [%s][%s] (%s) %s:%s\n", pkg.PackageManager, pkg.Name, pkg.Version, pkg.NewVersion, pkg.Status, pkg.Category, pkg.Arch)
+							}
+							return printErrors("showing package info", err)
+						},
+					},
+					{
+						Name:      "deps",
+						Aliases:   []string{"d"},
+						Usage:     "Show the dependencies of a package, or the installed packages that depend on it",
+						ArgsUsage: "PACKAGE",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:    "reverse",
+								Aliases: []string{"r"},
+								Usage:   "Show the installed packages that depend on the package",
+							},
+							&cli.BoolFlag{
+								Name:    "tree",
+								Aliases: []string{"t"},
+								Usage:   "Show the dependencies of the dependencies too, as a tree",
+							},
+							&cli.IntFlag{
+								Name:  "depth",
+								Usage: "Limit the tree to `N` levels, 0 for no limit",
+							},
+						},
+						Action: func(c *cli.Context) error {
+							var opts = getOptions(c)
+							if err := filterPackageManager(s, c); err != nil {
+								return err
+							}
+							if c.NArg() != 1 {
+								fmt.Println("Please specify one and only one package name.")
+								return nil
+							}
+							pkg := c.Args().First()
+
+							pm := s.GetPackageManager("")
+							if pm == nil {
+								return fmt.Errorf("no package manager is available")
+							}
+							dm, ok := manager.As[manager.DependencyManager](pm)
+							if !ok {
+								return printErrors("showing dependencies", fmt.Errorf("%s cannot show dependencies: %w", pm.GetPackageManager(), manager.ErrUnsupported))
+							}
+
+							if c.Bool("tree") {
+								tree, err := manager.DependencyTree(c.Context, dm, pkg, c.Bool("reverse"), c.Int("depth"), opts)
 								if err != nil {
-									fmt.Printf("Error while showing package info for %T: %+v\n", pm, err)
-									continue
+									return printErrors("showing dependencies", err)
 								}
+								fmt.Println(pkg)
+								printDependencyTree(tree, "  ")
+								return nil
+							}
 
-								fmt.Printf("Search results for %T:\n", pm)
-								fmt.Printf("%s: %s [%s][%s] (%s) %s:%s\n", pkg.PackageManager, pkg.Name, pkg.Version, pkg.NewVersion, pkg.Status, pkg.Category, pkg.Arch)
+							query := dm.DependenciesContext
+							if c.Bool("reverse") {
+								query = dm.ReverseDependenciesContext
 							}
-							return nil
+							deps, err := query(c.Context, pkg, opts)
+							for _, dep := range deps {
+								fmt.Println(dep)
+							}
+							return printErrors("showing dependencies", err)
 						},
 					},
 					{
-						Name:    "installed",
-						Aliases: []string{"i"},
-						Usage:   "Show installed packages",
+						Name:      "versions",
+						Aliases:   []string{"v"},
+						Usage:     "Show the versions of a package that can be installed",
+						ArgsUsage: "PACKAGE",
 						Action: func(c *cli.Context) error {
 							var opts = getOptions(c)
-							pms = filterPackageManager(pms, c)
-
-							log.Println("Showing installed packages...")
+							if err := filterPackageManager(s, c); err != nil {
+								return err
+							}
+							if c.NArg() != 1 {
+								fmt.Println("Please specify one and only one package name.")
+								return nil
+							}
+							pkg := c.Args().First()
 
-							for _, pm := range pms {
-								log.Printf("Showing installed packages for %T...\n", pm)
-								pkgs, err := pm.ListInstalled(opts)
+							errs := make(syspkg.ManagerErrors)
+							for _, pm := range packageManagers(s) {
+								vl, ok := manager.As[manager.VersionLister](pm)
+								if !ok {
+									continue
+								}
+								versions, err := vl.ListVersionsContext(c.Context, pkg, opts)
+								if errors.Is(err, manager.ErrPackageNotFound) {
+									continue
+								}
 								if err != nil {
-									fmt.Printf("Error while showing installed packages for %T: %+v\n", pm, err)
+									errs[pm.GetPackageManager()] = err
 									continue
 								}
+								for _, v := range versions {
+									fmt.Printf("%s: %s %s %s %s (%s)\n", v.PackageManager, v.Name, v.Version, v.Arch, v.Category, v.Status)
+								}
+							}
+							if len(errs) > 0 {
+								return printErrors("showing versions", errs)
+							}
+							return nil
+						},
+					},
+					{
+						Name:    "held",
+						Aliases: []string{"h"},
+						Usage:   "Show held packages",
+						Action: func(c *cli.Context) error {
+							var opts = getOptions(c)
+							if err := filterPackageManager(s, c); err != nil {
+								return err
+							}
 
-								fmt.Printf("Search results for %T:\n", pm)
+							errs := make(syspkg.ManagerErrors)
+							for _, pm := range packageManagers(s) {
+								hm, ok := manager.As[manager.HoldManager](pm)
+								if !ok {
+									continue
+								}
+								pkgs, err := hm.ListHeldContext(c.Context, opts)
+								if err != nil {
+									errs[pm.GetPackageManager()] = err
+									continue
+								}
 								for _, pkg := range pkgs {
-									fmt.Printf("%s: %s [%s][%s] (%s)\n", pkg.PackageManager, pkg.Name, pkg.Version, pkg.NewVersion, pkg.Status)
+									fmt.Printf("%s: %s %s\n", pkg.PackageManager, pkg.Name, pkg.Version)
 								}
 							}
+							if len(errs) > 0 {
+								return printErrors("showing held packages", errs)
+							}
 							return nil
 						},
 					},
+					{
+						Name:    "installed",
+						Aliases: []string{"i"},
+						Usage:   "Show installed packages",
+						Action: func(c *cli.Context) error {
+							var opts = getOptions(c)
+							if err := filterPackageManager(s, c); err != nil {
+								return err
+							}
+
+							log.Println("Showing installed packages...")
+
+							pkgs, err := s.ListInstalledContext(c.Context, opts)
+							fmt.Println("Search results:")
+							for _, pkg := range pkgs {
+								fmt.Printf("%s: %s [%s][%s] (%s)\n", pkg.PackageManager, pkg.Name, pkg.Version, pkg.NewVersion, pkg.Status)
+							}
+							return printErrors("showing installed packages", err)
+						},
+					},
 				},
 			},
 		},
@@ -285,6 +1017,28 @@ func main() {
 				Aliases: []string{"i"},
 				Usage:   "Interactive - Ask questions interactively.",
 			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Usage: "Concurrency - Query at most this many package managers at once when searching or listing packages. (0 means no limit)",
+			},
+			&cli.StringFlag{
+				Name:  "journal",
+				Value: journal.DefaultDir,
+				Usage: "Journal - Record the installs, removals and upgrades in this directory.",
+			},
+			&cli.StringFlag{
+				Name:  "cache",
+				Value: defaultCacheDir(),
+				Usage: "Cache - Keep the results of searches, package information and upgradable packages in this directory.",
+			},
+			&cli.BoolFlag{
+				Name:  "no-cache",
+				Usage: "No cache - Always run the package managers for searches, package information and upgradable packages.",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "Timeout - Stop the package manager commands if they take longer than this (e.g. 10m). Disabled by default.",
+			},
 			&cli.BoolFlag{
 				Name:    "verbose",
 				Aliases: []string{"v"},
@@ -334,13 +1088,38 @@ func main() {
 	}
 
 	// Run the CLI application.
-	err = app.Run(os.Args)
+	err = app.RunContext(ctx, os.Args)
 	if err != nil {
 		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
 }
 
+// history is the journal the installs, removals and upgrades are recorded in.
+var history = journal.New(journal.DefaultDir)
+
+// queryCache is the cache of the results of the queries of the package managers.
+var queryCache = cache.New(defaultCacheDir())
+
+// decorators returns the decorators of the package managers: they record their operations in history,
+// and cache the results of their queries in queryCache. The cache is applied last, so that history lists
+// the packages changed by an operation with the package manager itself.
+func decorators() []manager.Decorator {
+	return []manager.Decorator{history.Wrap, queryCache.Wrap}
+}
+
+// defaultCacheDir returns the directory of the cache: the system one for root, and the one of the user for the others,
+// who cannot write the system one. The state files of the package managers tell both caches when packages change.
+func defaultCacheDir() string {
+	if os.Geteuid() == 0 {
+		return cache.DefaultDir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "syspkg")
+	}
+	return cache.DefaultDir
+}
+
 // getOptions extracts options from the CLI context and returns a manager.Options struct.
 func getOptions(c *cli.Context) *manager.Options {
 	var opts manager.Options
@@ -348,6 +1127,7 @@ func getOptions(c *cli.Context) *manager.Options {
 	opts.DryRun = c.Bool("dry-run")
 	opts.Interactive = c.Bool("interactive")
 	opts.Debug = c.Bool("debug")
+	opts.Concurrency = c.Int("concurrency")
 
 	if !opts.Interactive {
 		opts.AssumeYes = true
@@ -356,58 +1136,331 @@ func getOptions(c *cli.Context) *manager.Options {
 	return &opts
 }
 
-// filterPackageManager filters the available package managers based on user input.
-func filterPackageManager(availablePMs map[string]syspkg.PackageManager, c *cli.Context) map[string]syspkg.PackageManager {
-	if len(availablePMs) == 0 {
-		log.Fatal("No package managers available!")
+// filterPackageManager restricts s to the package managers selected by the user, if any.
+func filterPackageManager(s syspkg.SysPkg, c *cli.Context) error {
+	include := syspkg.IncludeOptions{Decorators: decorators()}
+	for _, name := range []string{"apt", "flatpak", "snap", "yum", "dnf", "pacman", "apk", "zypper"} {
+		if !c.Bool(name) {
+			continue
+		}
+		if _, err := manager.Lookup(name); err != nil {
+			return fmt.Errorf("%s package manager is not supported", name)
+		}
+		include.Managers = append(include.Managers, name)
 	}
 
 	// if no specific package manager is specified, use all available
-	if !c.Bool("apt") && !c.Bool("flatpak") && !c.Bool("snap") && !c.Bool("yum") && !c.Bool("dnf") && !c.Bool("pacman") && !c.Bool("apk") && !c.Bool("zypper") {
-		return availablePMs
+	if len(include.Managers) == 0 {
+		return nil
+	}
+
+	_, err := s.RefreshPackageManagers(include)
+	return err
+}
+
+// printErrors prints the errors of the package managers that failed while doing action, each with its hint.
+// It returns an error making syspkg exit with a non-zero status if err is not nil.
+func printErrors(action string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var errs syspkg.ManagerErrors
+	if !errors.As(err, &errs) {
+		fmt.Printf("Error while %s: %+v\n", action, err)
+		printErrorHint(err)
+		return cli.Exit("", 1)
+	}
+	for _, name := range errs.Names() {
+		fmt.Printf("Error while %s for %s: %+v\n", action, name, errs[name])
+		printErrorHint(errs[name])
+	}
+	return cli.Exit("", 1)
+}
+
+// printErrorHint prints a hint on how to deal with err, if it is a known kind of package manager failure.
+func printErrorHint(err error) {
+	switch {
+	case errors.Is(err, manager.ErrPermissionDenied):
+		fmt.Println("(This command must be run with root privileges, please run it with sudo.)")
+	case errors.Is(err, manager.ErrLocked):
+		fmt.Println("(Another process is using the package manager, please try again once it has finished.)")
+	case errors.Is(err, manager.ErrNetwork):
+		fmt.Println("(A repository could not be reached, please check your network connection and try again.)")
+	case errors.Is(err, manager.ErrDiskFull):
+		fmt.Println("(There is not enough disk space, please free some space and try again.)")
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Println("(The command took longer than the --timeout.)")
+	}
+}
+
+// confirm asks the user the question, and reports whether they answered yes, which is the default.
+func confirm(question string) bool {
+	fmt.Printf("\n%s [Y/n]: ", question)
+	input := ""
+	_, _ = fmt.Scanln(&input)
+	input = strings.ToLower(input)
+	return input == "y" || input == ""
+}
+
+// transactionStatus returns whether the transaction t succeeded, or how it failed.
+func transactionStatus(t journal.Transaction) string {
+	if t.Error == "" {
+		return "ok"
+	}
+	return fmt.Sprintf("failed (exit status %d): %s", t.ExitCode, t.Error)
+}
+
+// printUnsatisfied prints the packages of a snapshot that cannot be restored as they were.
+func printUnsatisfied(unsatisfied []snapshot.Unsatisfied) {
+	if len(unsatisfied) == 0 {
+		return
+	}
+	fmt.Println("Packages that cannot be restored:")
+	for _, u := range unsatisfied {
+		fmt.Println(u)
 	}
+}
+
+// packageManagers returns the package managers of s, by decreasing priority.
+func packageManagers(s syspkg.SysPkg) []manager.PackageManager {
+	var pms []manager.PackageManager
+	for _, r := range manager.Registered() {
+		if pm := s.GetPackageManager(r.Name); pm != nil {
+			pms = append(pms, pm)
+		}
+	}
+	return pms
+}
 
-	var wantedPMs = make(map[string]syspkg.PackageManager)
-	for name, pm := range availablePMs {
-		if c.Bool(name) {
-			wantedPMs[name] = pm
+// packageFileExtensions are the extensions of the package files the install command takes without a slash.
+var packageFileExtensions = []string{".deb", ".rpm", ".snap", ".flatpakref", ".flatpak"}
+
+// packageFiles splits the arguments of the install command into the paths of local package files, and the package names.
+// An argument is a package file if it is an existing regular file, and has a slash or the extension of a package file.
+func packageFiles(args []string) (files, pkgNames []string) {
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		isPath := strings.ContainsRune(arg, filepath.Separator) || slices.Contains(packageFileExtensions, strings.ToLower(filepath.Ext(arg)))
+		if err == nil && info.Mode().IsRegular() && isPath {
+			files = append(files, arg)
+		} else {
+			pkgNames = append(pkgNames, arg)
 		}
 	}
-	return wantedPMs
+	return files, pkgNames
 }
 
-// listUpgradablePackages lists upgradable packages for the given package managers.
-func listUpgradablePackages(pms map[string]syspkg.PackageManager, opts *manager.Options) {
-	for _, pm := range pms {
-		log.Printf("Listing upgradable packages for %T...\n", pm)
-		upgradablePackages, err := pm.ListUpgradable(opts)
+// installRequests parses the arguments of the install command, and reports whether one of them
+// gives more than a package name.
+func installRequests(args []string) ([]manager.InstallRequest, bool, error) {
+	reqs := make([]manager.InstallRequest, 0, len(args))
+	pinned := false
+	for _, arg := range args {
+		req, err := manager.ParseInstallRequest(arg)
 		if err != nil {
-			fmt.Printf("Error while listing upgradable packages for %T: %+v\n", pm, err)
+			return nil, false, err
+		}
+		if req.Version != "" || req.Arch != "" || req.Source != "" {
+			pinned = true
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, pinned, nil
+}
+
+// installRequested installs reqs with the package manager selected by the flags, or else the one of the system.
+func installRequested(c *cli.Context, s syspkg.SysPkg, reqs []manager.InstallRequest, opts *manager.Options) error {
+	pm := s.GetPackageManager("")
+	if pm == nil {
+		return fmt.Errorf("no package manager is available")
+	}
+	ri, ok := manager.As[manager.RequestInstaller](pm)
+	if !ok {
+		return printErrors("installing packages", fmt.Errorf("%s cannot install given versions: %w", pm.GetPackageManager(), manager.ErrUnsupported))
+	}
+	packages, err := ri.InstallRequestsContext(c.Context, reqs, opts)
+	log.Printf("Installed packages:\n%+v\n", packages)
+	return printErrors("installing packages", err)
+}
+
+// holdPackages holds the packages given as arguments, or releases them if hold is false,
+// with the package manager selected by the flags, or else the one of the system.
+func holdPackages(c *cli.Context, s syspkg.SysPkg, hold bool) error {
+	var opts = getOptions(c)
+	if err := filterPackageManager(s, c); err != nil {
+		return err
+	}
+	if c.NArg() == 0 {
+		fmt.Println("Please specify package names.")
+		return nil
+	}
+
+	action := "holding packages"
+	if !hold {
+		action = "releasing held packages"
+	}
+	pm := s.GetPackageManager("")
+	if pm == nil {
+		return fmt.Errorf("no package manager is available")
+	}
+	hm, ok := manager.As[manager.HoldManager](pm)
+	if !ok {
+		return printErrors(action, fmt.Errorf("%s cannot hold packages: %w", pm.GetPackageManager(), manager.ErrUnsupported))
+	}
+
+	run := hm.HoldContext
+	if !hold {
+		run = hm.UnholdContext
+	}
+	pkgs, err := run(c.Context, c.Args().Slice(), opts)
+	for _, pkg := range pkgs {
+		fmt.Printf("%s: %s (%s)\n", pkg.PackageManager, pkg.Name, pkg.Status)
+	}
+	return printErrors(action, err)
+}
+
+// noRefreshFlag skips the refresh of the package lists after a repository change.
+var noRefreshFlag = &cli.BoolFlag{Name: "no-refresh", Usage: "do not refresh the package lists after the change"}
+
+// changeRepository runs change with the first package manager of s that manages repositories, then refreshes
+// its package lists unless the no-refresh flag is set.
+func changeRepository(c *cli.Context, s syspkg.SysPkg, action string, change func(manager.RepositoryManager, *manager.Options) error) error {
+	var opts = getOptions(c)
+	if err := filterPackageManager(s, c); err != nil {
+		return err
+	}
+
+	for _, pm := range packageManagers(s) {
+		rm, ok := manager.As[manager.RepositoryManager](pm)
+		if !ok {
 			continue
 		}
+		name := pm.GetPackageManager()
+		log.Printf("%s: %s...\n", name, action)
+		if err := change(rm, opts); err != nil {
+			return printErrors(action, syspkg.ManagerErrors{name: err})
+		}
+		if c.Bool("no-refresh") || opts.DryRun {
+			return nil
+		}
+		if err := manager.WithContext(pm).RefreshContext(c.Context, opts); err != nil {
+			return printErrors("refreshing package lists", syspkg.ManagerErrors{name: err})
+		}
+		return nil
+	}
+	return fmt.Errorf("no available package manager manages repositories")
+}
+
+// lookPath returns the absolute path of path, looking it up in the PATH environment variable if it has no slashes.
+func lookPath(path string) (string, error) {
+	if !strings.ContainsRune(path, '/') {
+		if found, err := exec.LookPath(path); err == nil {
+			path = found
+		}
+	}
+	return filepath.Abs(path)
+}
 
-		fmt.Printf("Upgradable packages for %T:\n", pm)
-		for _, pkg := range upgradablePackages {
-			fmt.Printf("%s: %s %s -> %s (%s)\n", pkg.PackageManager, pkg.Name, pkg.Version, pkg.NewVersion, pkg.Status)
+// printDependencyTree prints the nodes of a dependency tree, one per line, indented by their depth.
+func printDependencyTree(nodes []manager.DependencyNode, indent string) {
+	for _, node := range nodes {
+		if node.Repeated {
+			fmt.Printf("%s%s (see above)\n", indent, node.Dependency)
+			continue
 		}
+		fmt.Printf("%s%s\n", indent, node.Dependency)
+		printDependencyTree(node.Children, indent+"  ")
 	}
 }
 
-// performUpgrade upgrades packages for the given package managers.
-func performUpgrade(pms map[string]syspkg.PackageManager, opts *manager.Options) error {
+// printPackageFile prints the package and the metadata of a package file read by the inspect command.
+func printPackageFile(pkg manager.PackageInfo, meta *pkgfile.Metadata) {
+	fmt.Printf("%s %s (%s, %s package)\n", pkg.Name, pkg.Version, pkg.Arch, meta.Type)
+	if meta.Maintainer != "" {
+		fmt.Printf("Maintainer: %s\n", meta.Maintainer)
+	}
+	if meta.Summary != "" {
+		fmt.Printf("Summary: %s\n", meta.Summary)
+	}
+	fmt.Printf("Installed size: %d bytes\n", meta.InstalledSize)
+	fmt.Println("Dependencies:")
+	for _, dep := range meta.Dependencies {
+		fmt.Printf("  %s\n", dep)
+	}
+	fmt.Printf("Scripts: %s\n", strings.Join(meta.Scripts, ", "))
+	fmt.Printf("Files (%d):\n", len(meta.Files))
+	for _, file := range meta.Files {
+		fmt.Printf("  %s\n", file)
+	}
+}
+
+// listUpgradablePackages lists upgradable packages for the package managers of s, or only their security updates
+// if securityOnly is true.
+func listUpgradablePackages(ctx context.Context, s syspkg.SysPkg, opts *manager.Options, securityOnly bool) error {
+	upgradablePackages, err := s.ListUpgradableContext(ctx, opts)
+
+	fmt.Println("Upgradable packages:")
+	for _, pkg := range upgradablePackages {
+		if securityOnly && pkg.UpdateType != manager.UpdateTypeSecurity {
+			continue
+		}
+		fmt.Printf("%s: %s %s -> %s (%s)%s\n", pkg.PackageManager, pkg.Name, pkg.Version, pkg.NewVersion, pkg.Status, updateLabel(pkg))
+	}
+	return printErrors("listing upgradable packages", err)
+}
+
+// updateLabel returns the kind and severity of the update of pkg, such as " [security, Important]",
+// or an empty string if the package manager does not report them.
+func updateLabel(pkg manager.PackageInfo) string {
+	switch {
+	case pkg.UpdateType == manager.UpdateTypeUnknown:
+		return ""
+	case pkg.Severity == "":
+		return fmt.Sprintf(" [%s]", pkg.UpdateType)
+	}
+	return fmt.Sprintf(" [%s, %s]", pkg.UpdateType, pkg.Severity)
+}
+
+// performUpgrade upgrades packages for the package managers of s.
+func performUpgrade(ctx context.Context, s syspkg.SysPkg, opts *manager.Options) error {
 	fmt.Println("Performing package upgrade...")
 
-	for _, pm := range pms {
-		packages, err := pm.UpgradeAll(opts)
-		if err != nil {
-			fmt.Printf("Error while upgrading packages for %T: %+v\n%+v", pm, err, packages)
+	packages, err := s.UpgradeAllContext(ctx, nil, opts)
+	log.Println("Packages upgraded:")
+	for _, pkg := range packages {
+		fmt.Printf("%s: %s -> %s (%s)\n", pkg.PackageManager, pkg.Name, pkg.NewVersion, pkg.Status)
+	}
+	if err != nil {
+		return printErrors("upgrading packages", err)
+	}
+
+	fmt.Println("Upgrade completed.")
+	return nil
+}
+
+// performSecurityUpgrade applies the security updates with the package managers of s that can tell them apart,
+// and skips the others.
+func performSecurityUpgrade(ctx context.Context, s syspkg.SysPkg, opts *manager.Options) error {
+	fmt.Println("Performing security upgrade...")
+
+	errs := make(syspkg.ManagerErrors)
+	for _, pm := range packageManagers(s) {
+		su, ok := manager.As[manager.SecurityUpgrader](pm)
+		if !ok {
+			log.Printf("%s cannot tell security updates apart, skipping it\n", pm.GetPackageManager())
 			continue
 		}
-		// log.Printf("Upgraded packages for %T: %+v", pm, packages)
-		log.Printf("Packages upgraded for %T:\n", pm)
+		packages, err := su.UpgradeSecurityContext(ctx, opts)
 		for _, pkg := range packages {
 			fmt.Printf("%s: %s -> %s (%s)\n", pkg.PackageManager, pkg.Name, pkg.NewVersion, pkg.Status)
 		}
+		if err != nil {
+			errs[pm.GetPackageManager()] = err
+		}
+	}
+	if len(errs) > 0 {
+		return printErrors("upgrading packages", errs)
 	}
 
 	fmt.Println("Upgrade completed.")
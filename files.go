@@ -0,0 +1,61 @@
+package syspkg
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// InstallFiles installs the packages of the local package files at paths, such as internal builds shipped as artifacts.
+// The type of each file is detected with manager.DetectPackageFile, and the file is installed by the package manager of s
+// with the highest priority that installs that type (see manager.FileInstaller): apt for .deb packages, dnf for .rpm packages,
+// snap for .snap files, and flatpak for .flatpakref files and .flatpak bundles. It fails before installing anything
+// if a file is not a package file, or if no package manager of s installs it.
+// A package manager failing does not stop the others: the failures are returned together as a ManagerErrors.
+func InstallFiles(ctx context.Context, s SysPkg, paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	var names []string
+	files := make(map[string][]string)
+	installers := make(map[string]manager.FileInstaller)
+	for _, path := range paths {
+		t, err := manager.DetectPackageFile(path)
+		if err != nil {
+			return nil, err
+		}
+		name, fi := fileInstaller(s, t)
+		if fi == nil {
+			return nil, fmt.Errorf("%s: no available package manager installs %s files: %w", path, t, manager.ErrUnsupported)
+		}
+		if _, ok := files[name]; !ok {
+			names = append(names, name)
+			installers[name] = fi
+		}
+		files[name] = append(files[name], path)
+	}
+
+	var packages []manager.PackageInfo
+	errs := make(ManagerErrors)
+	for _, name := range names {
+		pkgs, err := installers[name].InstallFilesContext(ctx, files[name], opts)
+		packages = append(packages, pkgs...)
+		if err != nil {
+			errs[name] = err
+		}
+	}
+	if len(errs) > 0 {
+		return packages, errs
+	}
+	return packages, nil
+}
+
+// fileInstaller returns the package manager of s with the highest priority that installs package files of type t, and its name.
+func fileInstaller(s SysPkg, t manager.PackageFileType) (string, manager.FileInstaller) {
+	for _, r := range manager.Registered() {
+		fi, ok := manager.As[manager.FileInstaller](s.GetPackageManager(r.Name))
+		if ok && slices.Contains(fi.PackageFileTypes(), t) {
+			return r.Name, fi
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,93 @@
+package syspkg_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg"
+	"github.com/sjwhyte/syspkg/journal"
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// fakeFileInstaller is a package manager that installs .deb packages, and records the files it installs.
+type fakeFileInstaller struct {
+	fakeManager
+	installed []string
+}
+
+func (f *fakeFileInstaller) PackageFileTypes() []manager.PackageFileType {
+	return []manager.PackageFileType{manager.PackageFileDeb}
+}
+
+func (f *fakeFileInstaller) InstallFilesContext(ctx context.Context, paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	f.installed = append(f.installed, paths...)
+	return f.pkgs, f.err
+}
+
+func init() {
+	manager.Register("fake-files", manager.PriorityUniversal, func() manager.PackageManager {
+		return &fakeFileInstaller{fakeManager: fakeManager{name: "fake-files", pkgs: []manager.PackageInfo{{Name: "hello", PackageManager: "fake-files"}}}}
+	})
+}
+
+func TestInstallFiles(t *testing.T) {
+	s, err := syspkg.New(syspkg.IncludeOptions{Managers: []string{"fake-high", "fake-files"}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	dir := t.TempDir()
+	deb := filepath.Join(dir, "hello_1.0_amd64.deb")
+	rpm := filepath.Join(dir, "hello-1.0-1.x86_64.rpm")
+	if err := os.WriteFile(deb, []byte("!<arch>\ndebian-binary   "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rpm, []byte("\xed\xab\xee\xdb"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pkgs, err := syspkg.InstallFiles(context.Background(), s, []string{deb}, nil)
+	if err != nil {
+		t.Fatalf("InstallFiles() error = %v", err)
+	}
+	if want := []manager.PackageInfo{{Name: "hello", PackageManager: "fake-files"}}; !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("InstallFiles() = %+v, want %+v", pkgs, want)
+	}
+	fi, _ := manager.As[*fakeFileInstaller](s.GetPackageManager("fake-files"))
+	if !reflect.DeepEqual(fi.installed, []string{deb}) {
+		t.Errorf("InstallFiles() installed %+v with fake-files, want %s", fi.installed, deb)
+	}
+
+	if _, err := syspkg.InstallFiles(context.Background(), s, []string{deb, rpm}, nil); !errors.Is(err, manager.ErrUnsupported) {
+		t.Errorf("InstallFiles() of an .rpm without dnf: error = %v, want %v", err, manager.ErrUnsupported)
+	}
+	if len(fi.installed) != 1 {
+		t.Errorf("InstallFiles() of an .rpm without dnf installed %+v, want nothing more", fi.installed)
+	}
+}
+
+func TestInstallFilesRecorded(t *testing.T) {
+	j := journal.New(t.TempDir())
+	s, err := syspkg.New(syspkg.IncludeOptions{Managers: []string{"fake-files"}, Decorators: []manager.Decorator{j.Wrap}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	deb := filepath.Join(t.TempDir(), "hello_1.0_amd64.deb")
+	if err := os.WriteFile(deb, []byte("!<arch>\ndebian-binary   "), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := syspkg.InstallFiles(context.Background(), s, []string{deb}, nil); err != nil {
+		t.Fatalf("InstallFiles() error = %v", err)
+	}
+	transactions, err := j.List()
+	if err != nil || len(transactions) != 1 {
+		t.Fatalf("List() = %+v, %v, want the installation of the files recorded", transactions, err)
+	}
+	if tr := transactions[0]; tr.Operation != journal.OperationInstall || !reflect.DeepEqual(tr.Requested, []string{deb}) {
+		t.Errorf("InstallFiles() recorded %+v, want an install of %s", tr, deb)
+	}
+}
@@ -4,7 +4,12 @@ go 1.22
 
 require github.com/urfave/cli/v2 v2.26.0 // direct
 
-require github.com/bluet/syspkg v0.1.4
+require (
+	github.com/bluet/syspkg v0.1.4
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.15
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/cpuguy83/go-md2man/v2 v2.0.3 // indirect
@@ -1,39 +1,17 @@
 package syspkg
 
-import "github.com/sjwhyte/syspkg/manager"
+import (
+	"context"
 
-// PackageManager is the interface that defines the methods for interacting with various package managers.
-type PackageManager interface {
-	// IsAvailable checks if the package manager is available on the current system.
-	IsAvailable() bool
-
-	// GetPackageManager returns the name of the package manager.
-	GetPackageManager() string
-
-	// Install installs the specified packages using the package manager.
-	Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
-
-	// Delete removes the specified packages using the package manager.
-	Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
+	"github.com/sjwhyte/syspkg/manager"
+)
 
-	// Find searches for packages using the specified keywords.
-	Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error)
-
-	// ListInstalled lists all installed packages.
-	ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error)
-
-	// ListUpgradable lists all upgradable packages.
-	ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error)
-
-	// UpgradeAll Upgrade upgrades all packages or only the specified ones.
-	UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
-
-	// Refresh refreshes the package index.
-	Refresh(opts *manager.Options) error
+// PackageManager is the interface that defines the methods for interacting with various package managers.
+// It is an alias of manager.PackageManager, which package managers outside of syspkg implement to register themselves with manager.Register.
+type PackageManager = manager.PackageManager
 
-	// GetPackageInfo returns information about the specified package.
-	GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error)
-}
+// PackageManagerContext is the context-aware variant of PackageManager. See manager.PackageManagerContext.
+type PackageManagerContext = manager.PackageManagerContext
 
 // SysPkg is the interface that defines the methods for interacting with the SysPkg library.
 type SysPkg interface {
@@ -55,12 +33,62 @@ type SysPkg interface {
 	// Note: only package managers that are specified in the IncludeOptions when creating the SysPkg instance (with New() method) will be returned. If you want to use package managers that are not specified in the IncludeOptions, you should use the FindPackageManagers() method to get a list of all available package managers, or use RefreshPackageManagers() with the IncludeOptions parameter to refresh the package manager list.
 	GetPackageManager(name string) PackageManager
 
-	// Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
-	// Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
-	// Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error)
-	// ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error)
-	// ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error)
-	// Upgrade(opts *manager.Options) ([]manager.PackageInfo, error)
-	// Refresh(opts *manager.Options) error
-	// GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error)
+	// GetPackageManagerContext is like GetPackageManager, but returns the context-aware variant of the package manager.
+	// It returns nil if the package manager is not found, or if it does not implement PackageManagerContext.
+	GetPackageManagerContext(name string) PackageManagerContext
+
+	// The following methods run an operation on every package manager of the SysPkg instance,
+	// and merge the packages they return by decreasing priority of the package managers. A package manager failing does not stop the others:
+	// the failures are returned together as a ManagerErrors, mapping the names of the failed package managers to their error.
+	// Read-only operations (Find, ListInstalled, ListUpgradable and GetPackageInfo) query the package managers concurrently,
+	// up to opts.Concurrency at once. Mutating operations run on one package manager after the other,
+	// and never at the same time as another operation on the same package manager.
+
+	// Install installs the specified packages with every package manager.
+	Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// InstallContext is like Install but uses ctx to bound the commands.
+	InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// Delete removes the specified packages with every package manager.
+	Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// DeleteContext is like Delete but uses ctx to bound the commands.
+	DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// Find searches for packages using the specified keywords with every package manager.
+	Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// FindContext is like Find but uses ctx to bound the commands.
+	FindContext(ctx context.Context, keywords []string, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// ListInstalled lists the installed packages of every package manager.
+	ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// ListInstalledContext is like ListInstalled but uses ctx to bound the commands.
+	ListInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// ListUpgradable lists the upgradable packages of every package manager.
+	ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// ListUpgradableContext is like ListUpgradable but uses ctx to bound the commands.
+	ListUpgradableContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// UpgradeAll upgrades all packages, or only the specified ones, with every package manager.
+	UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// UpgradeAllContext is like UpgradeAll but uses ctx to bound the commands.
+	UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// Refresh refreshes the package index of every package manager.
+	Refresh(opts *manager.Options) error
+
+	// RefreshContext is like Refresh but uses ctx to bound the commands.
+	RefreshContext(ctx context.Context, opts *manager.Options) error
+
+	// GetPackageInfo returns information about the specified package from every package manager that knows it.
+	GetPackageInfo(pkg string, opts *manager.Options) ([]manager.PackageInfo, error)
+
+	// GetPackageInfoContext is like GetPackageInfo but uses ctx to bound the commands.
+	GetPackageInfoContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.PackageInfo, error)
 }
@@ -0,0 +1,231 @@
+// Package journal keeps a persistent record of the transactions run by the package managers:
+// which packages were requested, which ones changed and from which version to which, by whom, and whether it worked.
+//
+// Package managers are recorded by decorating them with Wrap, usually through syspkg.IncludeOptions.Decorators:
+//
+//	j := journal.New(journal.DefaultDir)
+//	sysPkg, err := syspkg.New(syspkg.IncludeOptions{
+//	    AllAvailable: true,
+//	    Decorators:   []manager.Decorator{j.Wrap},
+//	})
+//	...
+//	transactions, err := j.List()
+package journal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultDir is the directory of the system journal.
+const DefaultDir = "/var/lib/syspkg/journal"
+
+// Operation is the kind of operation of a transaction.
+type Operation string
+
+// Operation constants define the recorded operations.
+const (
+	OperationInstall         Operation = "install"
+	OperationDelete          Operation = "delete"
+	OperationUpgrade         Operation = "upgrade"
+	OperationUpgradeSecurity Operation = "upgrade-security"
+	OperationDowngrade       Operation = "downgrade"
+	OperationAutoRemove      Operation = "autoremove"
+	OperationHold            Operation = "hold"
+	OperationUnhold          Operation = "unhold"
+)
+
+// Transaction is the record of a mutating operation run by a package manager.
+type Transaction struct {
+	// ID identifies the transaction in its journal. IDs increase with time.
+	ID int `json:"id"`
+
+	// Time is when the operation started.
+	Time time.Time `json:"time"`
+
+	// User is the name of the user who ran the operation, or of the user who ran sudo.
+	User string `json:"user,omitempty"`
+
+	// PackageManager is the name of the package manager that ran the operation.
+	PackageManager string `json:"package_manager"`
+
+	// Operation is what was run.
+	Operation Operation `json:"operation"`
+
+	// Requested are the packages passed to the operation. Empty for operations on all packages.
+	Requested []string `json:"requested,omitempty"`
+
+	// Changes are the packages that the operation installed, removed, upgraded or downgraded.
+	Changes []Change `json:"changes,omitempty"`
+
+	// ExitCode is the exit code of the package manager command: 0 if it succeeded,
+	// -1 if it failed without exiting, e.g. because it was canceled.
+	ExitCode int `json:"exit_code"`
+
+	// Error is the error returned by the operation, if any.
+	Error string `json:"error,omitempty"`
+
+	// Duration is how long the operation took.
+	Duration time.Duration `json:"duration"`
+
+	// NativeID is the ID of the transaction in the history of the package manager, for the package managers
+	// that implement manager.HistoryManager. It is empty if the operation did not add a transaction to that history.
+	NativeID string `json:"native_id,omitempty"`
+}
+
+// Change is the change of a package in a transaction.
+type Change struct {
+	Name string `json:"name"`
+	Arch string `json:"arch,omitempty"`
+
+	// OldVersion is the version before the transaction, empty if the package was installed by it.
+	OldVersion string `json:"old_version,omitempty"`
+
+	// NewVersion is the version after the transaction, empty if the package was removed by it.
+	NewVersion string `json:"new_version,omitempty"`
+}
+
+// String returns a human-readable description of the change, such as "vim 2:8.2-1 -> 2:9.0-1".
+func (c Change) String() string {
+	name := c.Name
+	if c.Arch != "" {
+		name += ":" + c.Arch
+	}
+	switch {
+	case c.OldVersion == "" && c.NewVersion == "":
+		// the package was held or released
+		return name
+	case c.OldVersion == "":
+		return fmt.Sprintf("%s (installed %s)", name, c.NewVersion)
+	case c.NewVersion == "":
+		return fmt.Sprintf("%s (removed %s)", name, c.OldVersion)
+	}
+	return fmt.Sprintf("%s %s -> %s", name, c.OldVersion, c.NewVersion)
+}
+
+// Journal is a journal of transactions stored in a directory, one JSON file per transaction.
+// It is safe for concurrent use, also by several processes.
+type Journal struct {
+	// Dir is the directory of the journal. It is created by the first transaction recorded.
+	Dir string
+}
+
+// New returns the journal stored in dir.
+func New(dir string) *Journal {
+	return &Journal{Dir: dir}
+}
+
+// Append stores t in the journal, with the next ID, and sets t.ID.
+func (j *Journal) Append(t *Transaction) error {
+	if err := os.MkdirAll(j.Dir, 0o755); err != nil {
+		return err
+	}
+
+	// the transaction is written to a temporary file, then linked to its final name,
+	// so that readers never see a partial file, and two processes never take the same ID
+	tmp, err := os.CreateTemp(j.Dir, ".transaction-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for {
+		ids, err := j.ids()
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		t.ID = 1
+		if len(ids) > 0 {
+			t.ID = ids[len(ids)-1] + 1
+		}
+
+		data, err := json.MarshalIndent(t, "", "  ")
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := tmp.Truncate(0); err != nil {
+			tmp.Close()
+			return err
+		}
+		if _, err := tmp.WriteAt(append(data, '\n'), 0); err != nil {
+			tmp.Close()
+			return err
+		}
+
+		err = os.Link(tmp.Name(), j.path(t.ID))
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+}
+
+// List returns the transactions of the journal, oldest first. An empty or missing journal has no transactions.
+func (j *Journal) List() ([]Transaction, error) {
+	ids, err := j.ids()
+	if err != nil {
+		return nil, err
+	}
+	var transactions []Transaction
+	for _, id := range ids {
+		t, err := j.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, t)
+	}
+	return transactions, nil
+}
+
+// Get returns the transaction with the given ID. It returns an error wrapping fs.ErrNotExist if there is none.
+func (j *Journal) Get(id int) (Transaction, error) {
+	var t Transaction
+	data, err := os.ReadFile(j.path(id))
+	if err != nil {
+		return t, fmt.Errorf("transaction %d: %w", id, err)
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return t, fmt.Errorf("transaction %d: %w", id, err)
+	}
+	return t, nil
+}
+
+// path returns the path of the file of the transaction with the given ID.
+func (j *Journal) path(id int) string {
+	return filepath.Join(j.Dir, strconv.Itoa(id)+".json")
+}
+
+// ids returns the IDs of the transactions of the journal, in increasing order.
+func (j *Journal) ids() ([]int, error) {
+	entries, err := os.ReadDir(j.Dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, entry := range entries {
+		id, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
@@ -0,0 +1,215 @@
+package journal_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/journal"
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/apt"
+	"github.com/sjwhyte/syspkg/manager/runnertest"
+)
+
+func TestAppendList(t *testing.T) {
+	j := journal.New(t.TempDir())
+
+	transactions, err := j.List()
+	if err != nil || len(transactions) != 0 {
+		t.Fatalf("List() of an empty journal = %+v, %v, want no transactions", transactions, err)
+	}
+
+	for _, pkg := range []string{"vim", "curl"} {
+		if err := j.Append(&journal.Transaction{PackageManager: "apt", Operation: journal.OperationInstall, Requested: []string{pkg}}); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	transactions, err = j.List()
+	if err != nil || len(transactions) != 2 {
+		t.Fatalf("List() = %+v, %v, want 2 transactions", transactions, err)
+	}
+	if transactions[0].ID != 1 || transactions[1].ID != 2 || transactions[1].Requested[0] != "curl" {
+		t.Errorf("List() = %+v, want the transactions 1 and 2 in order", transactions)
+	}
+
+	if _, err := j.Get(3); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Get(3) error = %v, want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "nano 6.2-1\nvim 2:8.2.3995-1ubuntu2\n"},
+		runnertest.Response{Stdout: "Setting up vim (2:8.2.3995-1ubuntu2.1) ...\nSetting up vim-runtime (2:8.2.3995-1ubuntu2.1) ...\n"},
+		runnertest.Response{Stdout: "nano 6.2-1\nvim 2:8.2.3995-1ubuntu2.1\nvim-runtime 2:8.2.3995-1ubuntu2.1\n"},
+	)
+	j := journal.New(t.TempDir())
+	pm := j.Wrap(&apt.PackageManager{Runner: runner, Root: t.TempDir()})
+
+	if _, err := pm.Install([]string{"vim"}, nil); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	transactions, err := j.List()
+	if err != nil || len(transactions) != 1 {
+		t.Fatalf("List() = %+v, %v, want 1 transaction", transactions, err)
+	}
+	tr := transactions[0]
+	if tr.PackageManager != "apt" || tr.Operation != journal.OperationInstall || !reflect.DeepEqual(tr.Requested, []string{"vim"}) || tr.ExitCode != 0 {
+		t.Errorf("Install() recorded %+v, want a successful apt install of vim", tr)
+	}
+	wantChanges := []journal.Change{
+		{Name: "vim", OldVersion: "2:8.2.3995-1ubuntu2", NewVersion: "2:8.2.3995-1ubuntu2.1"},
+		{Name: "vim-runtime", NewVersion: "2:8.2.3995-1ubuntu2.1"},
+	}
+	if !reflect.DeepEqual(tr.Changes, wantChanges) {
+		t.Errorf("Install() recorded changes %+v, want %+v", tr.Changes, wantChanges)
+	}
+
+	if _, ok := manager.As[manager.AutoRemover](pm); !ok {
+		t.Errorf("As[AutoRemover](Wrap(apt)) = false, want the AutoRemove of apt to be recorded too")
+	}
+	if _, ok := manager.As[*apt.PackageManager](pm); !ok {
+		t.Errorf("As[*apt.PackageManager](Wrap(apt)) = false, want the wrapped package manager")
+	}
+
+	runner.Push(runnertest.Response{})
+	if _, err := pm.Install([]string{"vim"}, &manager.Options{DryRun: true}); err != nil {
+		t.Fatalf("Install() with DryRun error = %v", err)
+	}
+	if n := len(runner.Argv()); n != 4 {
+		t.Errorf("Install() with DryRun ran %d commands, want only the install command", n-3)
+	}
+	if transactions, _ := j.List(); len(transactions) != 1 {
+		t.Errorf("Install() with DryRun recorded a transaction, want none")
+	}
+}
+
+func TestWrapHold(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "vim 2:8.2.3995-1ubuntu2\n"},
+		runnertest.Response{Stdout: "vim set on hold.\n"},
+		runnertest.Response{Stdout: "vim 2:8.2.3995-1ubuntu2\n"},
+	)
+	j := journal.New(t.TempDir())
+	pm := j.Wrap(&apt.PackageManager{Runner: runner, Root: t.TempDir()})
+
+	h, ok := manager.As[manager.HoldManager](pm)
+	if !ok {
+		t.Fatalf("As[HoldManager](Wrap(apt)) = false, want the holds of apt to be recorded")
+	}
+	if _, err := h.HoldContext(context.Background(), []string{"vim"}, nil); err != nil {
+		t.Fatalf("HoldContext() error = %v", err)
+	}
+
+	if got, want := runner.Argv()[1], []string{"apt-mark", "hold", "vim"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("HoldContext() ran %q, want %q", got, want)
+	}
+	transactions, err := j.List()
+	if err != nil || len(transactions) != 1 {
+		t.Fatalf("List() = %+v, %v, want 1 transaction", transactions, err)
+	}
+	if tr := transactions[0]; tr.Operation != journal.OperationHold || !reflect.DeepEqual(tr.Requested, []string{"vim"}) || len(tr.Changes) != 0 {
+		t.Errorf("HoldContext() recorded %+v, want a hold of vim without changes", tr)
+	}
+}
+
+func TestWrapInstallRequests(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "curl 7.81.0-1ubuntu1.15\n"},
+		runnertest.Response{Stdout: "Setting up curl (7.81.0-1ubuntu1.14) ...\n"},
+		runnertest.Response{Stdout: "curl 7.81.0-1ubuntu1.14\n"},
+	)
+	j := journal.New(t.TempDir())
+	pm := j.Wrap(&apt.PackageManager{Runner: runner, Root: t.TempDir()})
+
+	ri, ok := manager.As[manager.RequestInstaller](pm)
+	if !ok {
+		t.Fatalf("As[RequestInstaller](Wrap(apt)) = false, want the install requests of apt to be recorded")
+	}
+	reqs := []manager.InstallRequest{{Name: "curl", Version: "7.81.0-1ubuntu1.14"}}
+	if _, err := ri.InstallRequestsContext(context.Background(), reqs, nil); err != nil {
+		t.Fatalf("InstallRequestsContext() error = %v", err)
+	}
+
+	transactions, err := j.List()
+	if err != nil || len(transactions) != 1 {
+		t.Fatalf("List() = %+v, %v, want 1 transaction", transactions, err)
+	}
+	tr := transactions[0]
+	if tr.Operation != journal.OperationInstall || !reflect.DeepEqual(tr.Requested, []string{"curl=7.81.0-1ubuntu1.14"}) {
+		t.Errorf("InstallRequestsContext() recorded %+v, want an install of curl=7.81.0-1ubuntu1.14", tr)
+	}
+	wantChanges := []journal.Change{{Name: "curl", OldVersion: "7.81.0-1ubuntu1.15", NewVersion: "7.81.0-1ubuntu1.14"}}
+	if !reflect.DeepEqual(tr.Changes, wantChanges) {
+		t.Errorf("InstallRequestsContext() recorded changes %+v, want %+v", tr.Changes, wantChanges)
+	}
+}
+
+func TestWrapDowngrade(t *testing.T) {
+	const before, after = "curl 7.81.0-1ubuntu1.15\n", "curl 7.81.0-1ubuntu1.14\n"
+	runner := runnertest.New(
+		runnertest.Response{Stdout: before},
+		runnertest.Response{Stdout: before},
+		runnertest.Response{Stdout: "Setting up curl (7.81.0-1ubuntu1.14) ...\n"},
+		runnertest.Response{Stdout: after},
+		runnertest.Response{Stdout: after},
+	)
+	j := journal.New(t.TempDir())
+	pm := j.Wrap(&apt.PackageManager{Runner: runner, Root: t.TempDir()})
+
+	d, ok := manager.As[manager.Downgrader](pm)
+	if !ok {
+		t.Fatalf("As[Downgrader](Wrap(apt)) = false, want the downgrades of apt to be recorded")
+	}
+	reqs := []manager.InstallRequest{{Name: "curl", Version: "7.81.0-1ubuntu1.14"}}
+	if _, err := d.DowngradeContext(context.Background(), reqs, nil); err != nil {
+		t.Fatalf("DowngradeContext() error = %v", err)
+	}
+
+	transactions, err := j.List()
+	if err != nil || len(transactions) != 1 {
+		t.Fatalf("List() = %+v, %v, want 1 transaction", transactions, err)
+	}
+	tr := transactions[0]
+	if tr.Operation != journal.OperationDowngrade || !reflect.DeepEqual(tr.Requested, []string{"curl=7.81.0-1ubuntu1.14"}) {
+		t.Errorf("DowngradeContext() recorded %+v, want a downgrade of curl=7.81.0-1ubuntu1.14", tr)
+	}
+	wantChanges := []journal.Change{{Name: "curl", OldVersion: "7.81.0-1ubuntu1.15", NewVersion: "7.81.0-1ubuntu1.14"}}
+	if !reflect.DeepEqual(tr.Changes, wantChanges) {
+		t.Errorf("DowngradeContext() recorded changes %+v, want %+v", tr.Changes, wantChanges)
+	}
+}
+
+func TestWrapUpgradeSecurity(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "libssl3:amd64 3.0.2-0ubuntu1.14\n"},
+		runnertest.Response{Stdout: "Listing...\nlibssl3/jammy-updates,jammy-security 3.0.2-0ubuntu1.15 amd64 [upgradable from: 3.0.2-0ubuntu1.14]\n"},
+		runnertest.Response{},
+		runnertest.Response{Stdout: "Setting up libssl3:amd64 (3.0.2-0ubuntu1.15) ...\n"},
+		runnertest.Response{Stdout: "libssl3:amd64 3.0.2-0ubuntu1.15\n"},
+	)
+	j := journal.New(t.TempDir())
+	pm := j.Wrap(&apt.PackageManager{Runner: runner, Root: t.TempDir()})
+
+	su, ok := manager.As[manager.SecurityUpgrader](pm)
+	if !ok {
+		t.Fatalf("As[SecurityUpgrader](Wrap(apt)) = false, want the security upgrades of apt to be recorded")
+	}
+	if _, err := su.UpgradeSecurityContext(context.Background(), nil); err != nil {
+		t.Fatalf("UpgradeSecurityContext() error = %v", err)
+	}
+
+	transactions, err := j.List()
+	if err != nil || len(transactions) != 1 {
+		t.Fatalf("List() = %+v, %v, want 1 transaction", transactions, err)
+	}
+	tr := transactions[0]
+	wantChanges := []journal.Change{{Name: "libssl3", Arch: "amd64", OldVersion: "3.0.2-0ubuntu1.14", NewVersion: "3.0.2-0ubuntu1.15"}}
+	if tr.Operation != journal.OperationUpgradeSecurity || !reflect.DeepEqual(tr.Changes, wantChanges) {
+		t.Errorf("UpgradeSecurityContext() recorded %+v, want a security upgrade with changes %+v", tr, wantChanges)
+	}
+}
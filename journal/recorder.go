@@ -0,0 +1,325 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// Wrap returns pm decorated to record its Install, Delete and UpgradeAll operations in j,
+// and the operations of the optional interfaces it implements among manager.AutoRemover, manager.HoldManager,
+// manager.RequestInstaller, manager.Downgrader, manager.SecurityUpgrader and manager.FileInstaller,
+// as found by manager.As. It is a manager.Decorator.
+//
+// The changes of a transaction are found by listing the installed packages before and after it, and, for the package
+// managers that implement manager.HistoryManager, the ID of the transaction in their history by comparing the last one.
+// Dry runs are not recorded. Failing to record a transaction is logged, but does not fail the operation.
+func (j *Journal) Wrap(pm manager.PackageManager) manager.PackageManager {
+	return &recorder{PackageManagerContext: manager.WithContext(pm), wrapped: pm, journal: j}
+}
+
+// recorder is a package manager that records the mutating operations of the package manager it wraps.
+type recorder struct {
+	manager.PackageManagerContext
+	wrapped manager.PackageManager
+	journal *Journal
+}
+
+// make sure recorder implements manager.PackageManagerContext and manager.Wrapper
+var (
+	_ manager.PackageManagerContext = (*recorder)(nil)
+	_ manager.Wrapper               = (*recorder)(nil)
+	_ manager.AutoRemover           = (*autoRemoveRecorder)(nil)
+	_ manager.HoldManager           = (*holdRecorder)(nil)
+	_ manager.RequestInstaller      = (*requestRecorder)(nil)
+	_ manager.Downgrader            = (*downgradeRecorder)(nil)
+	_ manager.SecurityUpgrader      = (*securityRecorder)(nil)
+	_ manager.FileInstaller         = (*fileRecorder)(nil)
+)
+
+// Unwrap returns the recorded package manager.
+func (r *recorder) Unwrap() manager.PackageManager {
+	return r.wrapped
+}
+
+// As sets target to the recorder of the optional interface it points to, if the recorded package manager implements it,
+// so that manager.As returns it instead of the unrecorded one.
+func (r *recorder) As(target any) bool {
+	switch target := target.(type) {
+	case *manager.AutoRemover:
+		remover, ok := manager.As[manager.AutoRemover](r.wrapped)
+		if ok {
+			*target = &autoRemoveRecorder{recorder: r, remover: remover}
+		}
+		return ok
+	case *manager.HoldManager:
+		holder, ok := manager.As[manager.HoldManager](r.wrapped)
+		if ok {
+			*target = &holdRecorder{recorder: r, holder: holder}
+		}
+		return ok
+	case *manager.RequestInstaller:
+		installer, ok := manager.As[manager.RequestInstaller](r.wrapped)
+		if ok {
+			*target = &requestRecorder{recorder: r, installer: installer}
+		}
+		return ok
+	case *manager.Downgrader:
+		downgrader, ok := manager.As[manager.Downgrader](r.wrapped)
+		if ok {
+			*target = &downgradeRecorder{recorder: r, downgrader: downgrader}
+		}
+		return ok
+	case *manager.SecurityUpgrader:
+		upgrader, ok := manager.As[manager.SecurityUpgrader](r.wrapped)
+		if ok {
+			*target = &securityRecorder{recorder: r, upgrader: upgrader}
+		}
+		return ok
+	case *manager.FileInstaller:
+		installer, ok := manager.As[manager.FileInstaller](r.wrapped)
+		if ok {
+			*target = &fileRecorder{recorder: r, installer: installer}
+		}
+		return ok
+	}
+	return false
+}
+
+func (r *recorder) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.InstallContext(context.Background(), pkgs, opts)
+}
+
+func (r *recorder) InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.record(ctx, OperationInstall, pkgs, opts, func() ([]manager.PackageInfo, error) {
+		return r.PackageManagerContext.InstallContext(ctx, pkgs, opts)
+	})
+}
+
+func (r *recorder) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.DeleteContext(context.Background(), pkgs, opts)
+}
+
+func (r *recorder) DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.record(ctx, OperationDelete, pkgs, opts, func() ([]manager.PackageInfo, error) {
+		return r.PackageManagerContext.DeleteContext(ctx, pkgs, opts)
+	})
+}
+
+func (r *recorder) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.UpgradeAllContext(context.Background(), pkgs, opts)
+}
+
+func (r *recorder) UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.record(ctx, OperationUpgrade, pkgs, opts, func() ([]manager.PackageInfo, error) {
+		return r.PackageManagerContext.UpgradeAllContext(ctx, pkgs, opts)
+	})
+}
+
+// autoRemoveRecorder records the AutoRemove operation of a recorded package manager.
+type autoRemoveRecorder struct {
+	*recorder
+	remover manager.AutoRemover
+}
+
+func (r *autoRemoveRecorder) AutoRemove(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.AutoRemoveContext(context.Background(), opts)
+}
+
+func (r *autoRemoveRecorder) AutoRemoveContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.record(ctx, OperationAutoRemove, nil, opts, func() ([]manager.PackageInfo, error) {
+		return r.remover.AutoRemoveContext(ctx, opts)
+	})
+}
+
+// holdRecorder records the Hold and Unhold operations of a recorded package manager.
+type holdRecorder struct {
+	*recorder
+	holder manager.HoldManager
+}
+
+func (r *holdRecorder) ListHeldContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.holder.ListHeldContext(ctx, opts)
+}
+
+func (r *holdRecorder) HoldContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.record(ctx, OperationHold, pkgs, opts, func() ([]manager.PackageInfo, error) {
+		return r.holder.HoldContext(ctx, pkgs, opts)
+	})
+}
+
+func (r *holdRecorder) UnholdContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.record(ctx, OperationUnhold, pkgs, opts, func() ([]manager.PackageInfo, error) {
+		return r.holder.UnholdContext(ctx, pkgs, opts)
+	})
+}
+
+// requestRecorder records the InstallRequests operation of a recorded package manager.
+type requestRecorder struct {
+	*recorder
+	installer manager.RequestInstaller
+}
+
+func (r *requestRecorder) InstallRequestsContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.record(ctx, OperationInstall, requested(reqs), opts, func() ([]manager.PackageInfo, error) {
+		return r.installer.InstallRequestsContext(ctx, reqs, opts)
+	})
+}
+
+// downgradeRecorder records the Downgrade operation of a recorded package manager.
+type downgradeRecorder struct {
+	*recorder
+	downgrader manager.Downgrader
+}
+
+func (r *downgradeRecorder) DowngradeContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.record(ctx, OperationDowngrade, requested(reqs), opts, func() ([]manager.PackageInfo, error) {
+		return r.downgrader.DowngradeContext(ctx, reqs, opts)
+	})
+}
+
+// securityRecorder records the UpgradeSecurity operation of a recorded package manager.
+type securityRecorder struct {
+	*recorder
+	upgrader manager.SecurityUpgrader
+}
+
+func (r *securityRecorder) UpgradeSecurityContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.record(ctx, OperationUpgradeSecurity, nil, opts, func() ([]manager.PackageInfo, error) {
+		return r.upgrader.UpgradeSecurityContext(ctx, opts)
+	})
+}
+
+// fileRecorder records the InstallFiles operation of a recorded package manager, with the paths of the files as the
+// requested packages.
+type fileRecorder struct {
+	*recorder
+	installer manager.FileInstaller
+}
+
+func (r *fileRecorder) PackageFileTypes() []manager.PackageFileType {
+	return r.installer.PackageFileTypes()
+}
+
+func (r *fileRecorder) InstallFilesContext(ctx context.Context, paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return r.record(ctx, OperationInstall, paths, opts, func() ([]manager.PackageInfo, error) {
+		return r.installer.InstallFilesContext(ctx, paths, opts)
+	})
+}
+
+// requested returns reqs as the requested packages of a transaction, such as "curl=7.81.0-1ubuntu1.15".
+func requested(reqs []manager.InstallRequest) []string {
+	pkgs := make([]string, len(reqs))
+	for i, req := range reqs {
+		pkgs[i] = req.String()
+	}
+	return pkgs
+}
+
+// record runs the operation op on pkgs, and appends its transaction to the journal.
+func (r *recorder) record(ctx context.Context, op Operation, pkgs []string, opts *manager.Options, run func() ([]manager.PackageInfo, error)) ([]manager.PackageInfo, error) {
+	if opts != nil && opts.DryRun {
+		return run()
+	}
+
+	name := r.GetPackageManager()
+	before, listErr := r.ListInstalledContext(ctx, opts)
+	history, hasHistory := manager.As[manager.HistoryManager](r.wrapped)
+	var lastBefore string
+	var historyErr error
+	if hasHistory {
+		lastBefore, historyErr = history.LastTransactionContext(ctx, opts)
+	}
+
+	t := &Transaction{
+		Time:           time.Now().UTC(),
+		User:           currentUser(),
+		PackageManager: name,
+		Operation:      op,
+		Requested:      pkgs,
+	}
+	packages, err := run()
+	t.Duration = time.Since(t.Time)
+	t.ExitCode = exitCode(err)
+	if err != nil {
+		t.Error = err.Error()
+	}
+
+	// list the packages even if ctx is done, to record what a canceled operation changed
+	if listErr == nil {
+		var after []manager.PackageInfo
+		after, listErr = r.ListInstalledContext(context.WithoutCancel(ctx), opts)
+		t.Changes = changes(before, after)
+	}
+	if listErr != nil {
+		log.Printf("%s: cannot list the packages changed by %s: %v\n", name, op, listErr)
+	}
+	if hasHistory && historyErr == nil {
+		var lastAfter string
+		lastAfter, historyErr = history.LastTransactionContext(context.WithoutCancel(ctx), opts)
+		if lastAfter != lastBefore {
+			t.NativeID = lastAfter
+		}
+	}
+	if historyErr != nil {
+		log.Printf("%s: cannot find the %s transaction in the history of the package manager: %v\n", name, op, historyErr)
+	}
+
+	if appendErr := r.journal.Append(t); appendErr != nil {
+		log.Printf("%s: cannot record the %s transaction in the journal: %v\n", name, op, appendErr)
+	}
+	return packages, err
+}
+
+// changes returns the packages that differ between the installed packages before and after a transaction.
+func changes(before, after []manager.PackageInfo) []Change {
+	type key struct{ name, arch string }
+	versions := make(map[key]string, len(before))
+	for _, pkg := range before {
+		versions[key{pkg.Name, pkg.Arch}] = pkg.Version
+	}
+
+	var changes []Change
+	for _, pkg := range after {
+		k := key{pkg.Name, pkg.Arch}
+		old, ok := versions[k]
+		delete(versions, k)
+		if !ok || old != pkg.Version {
+			changes = append(changes, Change{Name: pkg.Name, Arch: pkg.Arch, OldVersion: old, NewVersion: pkg.Version})
+		}
+	}
+	for _, pkg := range before {
+		if old, ok := versions[key{pkg.Name, pkg.Arch}]; ok {
+			changes = append(changes, Change{Name: pkg.Name, Arch: pkg.Arch, OldVersion: old})
+		}
+	}
+	return changes
+}
+
+// exitCode returns the exit code of the command that returned err: 0 for no error, -1 if the command did not exit.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *manager.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode
+	}
+	return -1
+}
+
+// currentUser returns the name of the user who ran sudo, if any, or the name of the current user.
+func currentUser() string {
+	if name := os.Getenv("SUDO_USER"); name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return ""
+}
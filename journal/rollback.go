@@ -0,0 +1,198 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sjwhyte/syspkg"
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manifest"
+)
+
+// Unreverted is a change of a transaction that a rollback could not revert.
+type Unreverted struct {
+	Change Change
+
+	// Reason is why the change could not be reverted, such as "version 2:9.0-1 is installed instead".
+	Reason string
+}
+
+// String returns a human-readable description of the unreverted change, such as "vim 2:8.2-1 -> 2:9.0-1: not installed".
+func (u Unreverted) String() string {
+	return fmt.Sprintf("%s: %s", u.Change, u.Reason)
+}
+
+// Rollback reverts the changes of t with its package manager in s: it removes the packages t installed,
+// and installs the packages t removed, upgraded or downgraded at their previous version, for the package managers
+// that can install a given version (see manifest.PinsVersions) and as long as their repositories still offer it.
+// These package managers revert the changes of each architecture of a package.
+// Upgrades are reverted with manager.Downgrader. The holds of the packages are left alone, except by the rollback
+// of a transaction that held or released packages, which releases them or holds them again with manager.HoldManager.
+// For the package managers that implement manager.HistoryManager, the transaction is undone by the package manager
+// itself if t has its NativeID.
+//
+// Rollback returns the changes it could not revert, found by listing the installed packages once it is done.
+// With opts.DryRun, nothing is changed and no change is returned.
+func Rollback(ctx context.Context, s syspkg.SysPkg, t Transaction, opts *manager.Options) ([]Unreverted, error) {
+	pm := s.GetPackageManagerContext(t.PackageManager)
+	if pm == nil {
+		return nil, fmt.Errorf("package manager %s is not available", t.PackageManager)
+	}
+	dryRun := opts != nil && opts.DryRun
+	if t.Operation == OperationHold || t.Operation == OperationUnhold {
+		return rollbackHold(ctx, pm, t, opts)
+	}
+
+	failures := make(map[packageKey]error)
+	if history, ok := manager.As[manager.HistoryManager](pm); ok && t.NativeID != "" {
+		if err := history.UndoTransactionContext(ctx, t.NativeID, opts); err != nil {
+			return nil, fmt.Errorf("undoing %s transaction %s: %w", t.PackageManager, t.NativeID, err)
+		}
+	} else {
+		plan, err := manifest.NewPlan(ctx, s, rollbackManifest(t), opts)
+		if err != nil {
+			return nil, err
+		}
+		// the steps are applied one by one if applying them together fails,
+		// so that a version the repositories no longer offer does not prevent reverting the other changes
+		var stepErrs manifest.StepErrors
+		if _, err := manifest.ApplyEach(ctx, s, withoutHolds(plan), opts); errors.As(err, &stepErrs) {
+			for _, stepErr := range stepErrs {
+				failures[packageKey{stepErr.Step.Name, stepErr.Step.Arch}] = stepErr.Err
+			}
+		} else if err != nil && !dryRun {
+			return nil, err
+		}
+	}
+	if dryRun {
+		return nil, nil
+	}
+
+	installed, err := pm.ListInstalledContext(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("listing the packages installed by %s: %w", t.PackageManager, err)
+	}
+	return unreverted(t, installed, failures), nil
+}
+
+// rollbackHold releases the packages t held, or holds the packages t released again, and returns the ones
+// whose hold is not reverted, found by listing the held packages once it is done.
+// With opts.DryRun, nothing is changed and nothing is returned.
+func rollbackHold(ctx context.Context, pm manager.PackageManager, t Transaction, opts *manager.Options) ([]Unreverted, error) {
+	h, ok := manager.As[manager.HoldManager](pm)
+	if !ok {
+		return nil, fmt.Errorf("%s cannot hold packages: %w", t.PackageManager, manager.ErrUnsupported)
+	}
+	revert, wantHeld, reason := h.UnholdContext, false, "still held"
+	if t.Operation == OperationUnhold {
+		revert, wantHeld, reason = h.HoldContext, true, "not held"
+	}
+	_, revertErr := revert(ctx, t.Requested, opts)
+	if opts != nil && opts.DryRun {
+		return nil, nil
+	}
+
+	held, err := h.ListHeldContext(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("listing the packages held by %s: %w", t.PackageManager, err)
+	}
+	var unreverted []Unreverted
+	for _, pkg := range t.Requested {
+		req, err := manager.ParseInstallRequest(pkg)
+		if err != nil {
+			req = manager.InstallRequest{Name: pkg}
+		}
+		info := manager.MarkHeld([]manager.PackageInfo{{Name: req.Name, Arch: req.Arch}}, held)[0]
+		if (info.Status == manager.PackageStatusHeld) == wantHeld {
+			continue
+		}
+		u := Unreverted{Change: Change{Name: req.Name, Arch: req.Arch}, Reason: reason}
+		if revertErr != nil {
+			u.Reason = fmt.Sprintf("%s: %v", reason, revertErr)
+		}
+		unreverted = append(unreverted, u)
+	}
+	return unreverted, nil
+}
+
+// packageKey identifies a package of a given architecture, or of any architecture if arch is empty.
+type packageKey struct{ name, arch string }
+
+// changeKey returns the key of the package of c in the rollback manifest of a transaction of the package manager
+// with the given name: the package managers that pin versions revert each architecture of a package,
+// and the others the package whatever its architecture.
+func changeKey(packageManager string, c Change) packageKey {
+	if manifest.PinsVersions(packageManager) {
+		return packageKey{c.Name, c.Arch}
+	}
+	return packageKey{c.Name, ""}
+}
+
+// rollbackManifest returns the manifest of the packages of t at their state before t.
+func rollbackManifest(t Transaction) *manifest.Manifest {
+	m := &manifest.Manifest{}
+	seen := make(map[packageKey]bool)
+	for _, c := range t.Changes {
+		k := changeKey(t.PackageManager, c)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		e := manifest.Entry{Name: c.Name, Arch: k.arch, Manager: t.PackageManager}
+		switch {
+		case c.OldVersion == "":
+			e.State = manifest.StateAbsent
+		case manifest.PinsVersions(t.PackageManager):
+			e.Version = c.OldVersion
+		}
+		m.Packages = append(m.Packages, e)
+	}
+	return m
+}
+
+// withoutHolds returns the steps of plan that do not hold or release packages: a rollback leaves the holds alone.
+func withoutHolds(plan *manifest.Plan) *manifest.Plan {
+	kept := &manifest.Plan{}
+	for _, step := range plan.Steps {
+		if step.Action != manifest.ActionHold && step.Action != manifest.ActionUnhold {
+			kept.Steps = append(kept.Steps, step)
+		}
+	}
+	return kept
+}
+
+// unreverted returns the changes of t that are not reverted in the installed packages,
+// with the failures of the steps that were meant to revert them, by package.
+func unreverted(t Transaction, installed []manager.PackageInfo, failures map[packageKey]error) []Unreverted {
+	versions := make(map[packageKey]string, len(installed))
+	for _, pkg := range installed {
+		versions[packageKey{pkg.Name, pkg.Arch}] = pkg.Version
+	}
+
+	var unreverted []Unreverted
+	for _, c := range t.Changes {
+		v, ok := versions[packageKey{c.Name, c.Arch}]
+		var reason string
+		switch {
+		case c.OldVersion == "" && ok:
+			reason = fmt.Sprintf("still installed at version %s", v)
+		case c.OldVersion == "":
+			continue
+		case !ok:
+			reason = "not installed"
+		case (manager.PackageInfo{Version: v, PackageManager: t.PackageManager}).Compare(c.OldVersion) == 0:
+			continue
+		case !manifest.PinsVersions(t.PackageManager):
+			reason = fmt.Sprintf("%s cannot install a given version, version %s is installed instead", t.PackageManager, v)
+		default:
+			reason = fmt.Sprintf("version %s is installed instead", v)
+		}
+		if err := failures[changeKey(t.PackageManager, c)]; err != nil {
+			reason = fmt.Sprintf("%s: %v", reason, err)
+		}
+		unreverted = append(unreverted, Unreverted{c, reason})
+	}
+	return unreverted
+}
@@ -0,0 +1,250 @@
+package journal_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg"
+	"github.com/sjwhyte/syspkg/journal"
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/apt"
+	"github.com/sjwhyte/syspkg/manager/runnertest"
+)
+
+// fakeManager is a package manager that installs the latest version of packages, "2.0".
+type fakeManager struct {
+	name      string
+	installed map[string]string
+}
+
+func (f *fakeManager) IsAvailable() bool         { return true }
+func (f *fakeManager) GetPackageManager() string { return f.name }
+func (f *fakeManager) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.InstallContext(context.Background(), pkgs, opts)
+}
+func (f *fakeManager) InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	for _, pkg := range pkgs {
+		f.installed[pkg] = "2.0"
+	}
+	return nil, nil
+}
+func (f *fakeManager) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.DeleteContext(context.Background(), pkgs, opts)
+}
+func (f *fakeManager) DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	for _, pkg := range pkgs {
+		delete(f.installed, pkg)
+	}
+	return nil, nil
+}
+func (f *fakeManager) Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) FindContext(ctx context.Context, keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.ListInstalledContext(context.Background(), opts)
+}
+func (f *fakeManager) ListInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	var pkgs []manager.PackageInfo
+	for name, version := range f.installed {
+		pkgs = append(pkgs, manager.PackageInfo{Name: name, Version: version, PackageManager: f.name})
+	}
+	return pkgs, nil
+}
+func (f *fakeManager) ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) ListUpgradableContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) Refresh(opts *manager.Options) error { return nil }
+func (f *fakeManager) RefreshContext(ctx context.Context, opts *manager.Options) error {
+	return nil
+}
+func (f *fakeManager) GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	return manager.PackageInfo{}, nil
+}
+func (f *fakeManager) GetPackageInfoContext(ctx context.Context, pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	return manager.PackageInfo{}, nil
+}
+
+// historyManager is a fakeManager with its own history of transactions, that records the ones it undoes.
+type historyManager struct {
+	fakeManager
+	undone []string
+}
+
+func (f *historyManager) LastTransactionContext(ctx context.Context, opts *manager.Options) (string, error) {
+	return "7", nil
+}
+func (f *historyManager) UndoTransactionContext(ctx context.Context, id string, opts *manager.Options) error {
+	f.undone = append(f.undone, id)
+	return nil
+}
+
+var (
+	fake        = &fakeManager{name: "journal-fake", installed: map[string]string{"git": "2.0", "vim": "9.1"}}
+	withHistory = &historyManager{fakeManager: fakeManager{name: "journal-history", installed: map[string]string{}}}
+)
+
+func init() {
+	manager.Register(fake.name, manager.PrioritySystem, func() manager.PackageManager { return fake })
+	manager.Register(withHistory.name, manager.PriorityUniversal, func() manager.PackageManager { return withHistory })
+}
+
+func TestRollback(t *testing.T) {
+	s, err := syspkg.New(syspkg.IncludeOptions{Managers: []string{fake.name, withHistory.name}})
+	if err != nil {
+		t.Fatalf("syspkg.New() error = %v", err)
+	}
+
+	tr := journal.Transaction{PackageManager: fake.name, Operation: journal.OperationInstall, Changes: []journal.Change{
+		{Name: "git", NewVersion: "2.0"},
+		{Name: "nano", OldVersion: "6.2"},
+		{Name: "vim", OldVersion: "9.0", NewVersion: "9.1"},
+	}}
+	unreverted, err := journal.Rollback(context.Background(), s, tr, nil)
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	want := []journal.Unreverted{
+		{Change: tr.Changes[1], Reason: "journal-fake cannot install a given version, version 2.0 is installed instead"},
+		{Change: tr.Changes[2], Reason: "journal-fake cannot install a given version, version 9.1 is installed instead"},
+	}
+	if !reflect.DeepEqual(unreverted, want) {
+		t.Errorf("Rollback() = %+v, want %+v", unreverted, want)
+	}
+	if wantInstalled := map[string]string{"nano": "2.0", "vim": "9.1"}; !reflect.DeepEqual(fake.installed, wantInstalled) {
+		t.Errorf("Rollback() left %v installed, want %v", fake.installed, wantInstalled)
+	}
+
+	tr = journal.Transaction{PackageManager: withHistory.name, Operation: journal.OperationUpgrade, NativeID: "7"}
+	if _, err := journal.Rollback(context.Background(), s, tr, nil); err != nil {
+		t.Fatalf("Rollback() of a transaction in the package manager history error = %v", err)
+	}
+	if !reflect.DeepEqual(withHistory.undone, []string{"7"}) {
+		t.Errorf("Rollback() undid the transactions %v of the package manager history, want 7", withHistory.undone)
+	}
+
+	if _, err := journal.Rollback(context.Background(), s, journal.Transaction{PackageManager: "flatpak"}, nil); err == nil {
+		t.Errorf("Rollback() of a transaction of an unavailable package manager: error = nil, want an error")
+	}
+}
+
+// aptSysPkg is a syspkg.SysPkg with a single apt package manager.
+type aptSysPkg struct {
+	syspkg.SysPkg
+	apt *apt.PackageManager
+}
+
+func (s aptSysPkg) GetPackageManager(name string) syspkg.PackageManager {
+	if name != "" && name != "apt" {
+		return nil
+	}
+	return s.apt
+}
+
+func (s aptSysPkg) GetPackageManagerContext(name string) syspkg.PackageManagerContext {
+	if name != "" && name != "apt" {
+		return nil
+	}
+	return s.apt
+}
+
+func TestRollbackAptUpgrade(t *testing.T) {
+	const upgraded = "curl 7.81.0-1ubuntu1.16\nvim 2:8.2.3995-1ubuntu2.15\n"
+	const reverted = "curl 7.81.0-1ubuntu1.15\nvim 2:8.2.3995-1ubuntu2.15\n"
+	runner := runnertest.New(
+		runnertest.Response{Stdout: upgraded},
+		runnertest.Response{Stdout: "curl\nvim\n"},
+		runnertest.Response{Stdout: upgraded},
+		runnertest.Response{},
+		runnertest.Response{Stdout: reverted},
+		runnertest.Response{Stdout: reverted},
+	)
+	s := aptSysPkg{apt: &apt.PackageManager{Runner: runner, Root: t.TempDir()}}
+
+	tr := journal.Transaction{PackageManager: "apt", Operation: journal.OperationUpgrade, Changes: []journal.Change{
+		{Name: "curl", OldVersion: "7.81.0-1ubuntu1.15", NewVersion: "7.81.0-1ubuntu1.16"},
+	}}
+	unreverted, err := journal.Rollback(context.Background(), s, tr, nil)
+	if err != nil || len(unreverted) != 0 {
+		t.Fatalf("Rollback() = %+v, %v, want the upgrade reverted", unreverted, err)
+	}
+
+	// the held curl is downgraded without touching its hold
+	wantArgv := [][]string{
+		{"dpkg-query", "-W", "-f", "${binary:Package} ${Version}\n"},
+		{"apt-mark", "showhold"},
+		{"dpkg-query", "-W", "-f", "${binary:Package} ${Version}\n"},
+		{"apt", "install", "-f", "--allow-downgrades", "curl=7.81.0-1ubuntu1.15", "-y"},
+		{"dpkg-query", "-W", "-f", "${binary:Package} ${Version}\n"},
+		{"dpkg-query", "-W", "-f", "${binary:Package} ${Version}\n"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("Rollback() ran %q, want %q", runner.Argv(), wantArgv)
+	}
+}
+
+func TestRollbackAptArch(t *testing.T) {
+	const upgraded = "libc6 2.35-0ubuntu3.7\nlibc6:i386 2.35-0ubuntu3.7\n"
+	const reverted = "libc6 2.35-0ubuntu3.6\nlibc6:i386 2.35-0ubuntu3.6\n"
+	runner := runnertest.New(
+		runnertest.Response{Stdout: upgraded},
+		runnertest.Response{},
+		runnertest.Response{Stdout: upgraded},
+		runnertest.Response{},
+		runnertest.Response{Stdout: reverted},
+		runnertest.Response{Stdout: reverted},
+	)
+	s := aptSysPkg{apt: &apt.PackageManager{Runner: runner, Root: t.TempDir()}}
+
+	tr := journal.Transaction{PackageManager: "apt", Operation: journal.OperationUpgrade, Changes: []journal.Change{
+		{Name: "libc6", OldVersion: "2.35-0ubuntu3.6", NewVersion: "2.35-0ubuntu3.7"},
+		{Name: "libc6", Arch: "i386", OldVersion: "2.35-0ubuntu3.6", NewVersion: "2.35-0ubuntu3.7"},
+	}}
+	unreverted, err := journal.Rollback(context.Background(), s, tr, nil)
+	if err != nil || len(unreverted) != 0 {
+		t.Fatalf("Rollback() = %+v, %v, want the upgrade reverted", unreverted, err)
+	}
+
+	// both architectures are downgraded
+	want := []string{"apt", "install", "-f", "--allow-downgrades", "libc6=2.35-0ubuntu3.6", "libc6:i386=2.35-0ubuntu3.6", "-y"}
+	if got := runner.Argv()[3]; !reflect.DeepEqual(got, want) {
+		t.Errorf("Rollback() ran %q, want %q", got, want)
+	}
+}
+
+func TestRollbackAptHold(t *testing.T) {
+	runner := runnertest.New(runnertest.Response{}, runnertest.Response{Stdout: "libc6:i386\n"})
+	s := aptSysPkg{apt: &apt.PackageManager{Runner: runner, Root: t.TempDir()}}
+
+	tr := journal.Transaction{PackageManager: "apt", Operation: journal.OperationHold, Requested: []string{"curl", "libc6:i386"}}
+	unreverted, err := journal.Rollback(context.Background(), s, tr, nil)
+	if err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	// the packages are released, and the ones still held reported
+	want := []journal.Unreverted{{Change: journal.Change{Name: "libc6", Arch: "i386"}, Reason: "still held"}}
+	if !reflect.DeepEqual(unreverted, want) {
+		t.Errorf("Rollback() = %+v, want %+v", unreverted, want)
+	}
+	wantArgv := [][]string{
+		{"apt-mark", "unhold", "curl", "libc6:i386"},
+		{"apt-mark", "showhold"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("Rollback() ran %q, want %q", runner.Argv(), wantArgv)
+	}
+}
@@ -0,0 +1,78 @@
+package manager
+
+import "context"
+
+// WithContext returns the context-aware variant of pm. Package managers that do not implement PackageManagerContext
+// are wrapped so that their operations are not started once ctx is done.
+func WithContext(pm PackageManager) PackageManagerContext {
+	if ctxPM, ok := pm.(PackageManagerContext); ok {
+		return ctxPM
+	}
+	return contextAdapter{pm}
+}
+
+// contextAdapter implements PackageManagerContext for a PackageManager that does not support contexts.
+type contextAdapter struct {
+	PackageManager
+}
+
+// Unwrap returns the adapted package manager, so that As finds its optional interfaces.
+func (a contextAdapter) Unwrap() PackageManager {
+	return a.PackageManager
+}
+
+func (a contextAdapter) InstallContext(ctx context.Context, pkgs []string, opts *Options) ([]PackageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Install(pkgs, opts)
+}
+
+func (a contextAdapter) DeleteContext(ctx context.Context, pkgs []string, opts *Options) ([]PackageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Delete(pkgs, opts)
+}
+
+func (a contextAdapter) FindContext(ctx context.Context, keywords []string, opts *Options) ([]PackageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.Find(keywords, opts)
+}
+
+func (a contextAdapter) ListInstalledContext(ctx context.Context, opts *Options) ([]PackageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.ListInstalled(opts)
+}
+
+func (a contextAdapter) ListUpgradableContext(ctx context.Context, opts *Options) ([]PackageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.ListUpgradable(opts)
+}
+
+func (a contextAdapter) UpgradeAllContext(ctx context.Context, pkgs []string, opts *Options) ([]PackageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return a.UpgradeAll(pkgs, opts)
+}
+
+func (a contextAdapter) RefreshContext(ctx context.Context, opts *Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return a.Refresh(opts)
+}
+
+func (a contextAdapter) GetPackageInfoContext(ctx context.Context, pkg string, opts *Options) (PackageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return PackageInfo{}, err
+	}
+	return a.GetPackageInfo(pkg, opts)
+}
@@ -15,9 +15,14 @@
 package apt
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
-	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	// "github.com/rs/zerolog"
 	// "github.com/rs/zerolog/log"
@@ -27,23 +32,48 @@ import (
 
 var pm string = "apt"
 
+func init() {
+	manager.Register(pm, manager.PrioritySystem, func() manager.PackageManager { return &PackageManager{} })
+}
+
 // Constants used for apt commands
 const (
-	ArgsAssumeYes    string = "-y"
-	ArgsAssumeNo     string = "--assume-no"
-	ArgsDryRun       string = "--dry-run"
-	ArgsFixBroken    string = "-f"
-	ArgsQuiet        string = "-qq"
-	ArgsPurge        string = "--purge"
-	ArgsAutoRemove   string = "--autoremove"
-	ArgsShowProgress string = "--show-progress"
+	ArgsAssumeYes       string = "-y"
+	ArgsAssumeNo        string = "--assume-no"
+	ArgsDryRun          string = "--dry-run"
+	ArgsFixBroken       string = "-f"
+	ArgsQuiet           string = "-qq"
+	ArgsPurge           string = "--purge"
+	ArgsAutoRemove      string = "--autoremove"
+	ArgsShowProgress    string = "--show-progress"
+	ArgsStatusFd        string = "-oAPT::Status-Fd=1"
+	ArgsAllowDowngrades string = "--allow-downgrades"
+	ArgsOnlyUpgrade     string = "--only-upgrade"
 )
 
 // ENV_NonInteractive contains environment variables used to set non-interactive mode for apt and dpkg.
 var ENV_NonInteractive []string = []string{"LC_ALL=C", "DEBIAN_FRONTEND=noninteractive", "DEBCONF_NONINTERACTIVE_SEEN=true"}
 
 // PackageManager implements the manager.PackageManager interface for the apt package manager.
-type PackageManager struct{}
+type PackageManager struct {
+	// Runner runs the package manager commands. If nil, manager.DefaultRunner is used.
+	Runner manager.CommandRunner
+
+	// Root is the root directory of the files that the package manager reads and writes itself, such as its sources.
+	// If empty, "/" is used.
+	Root string
+}
+
+// runner returns the CommandRunner used to run the package manager commands.
+func (a *PackageManager) runner() manager.CommandRunner {
+	return manager.RunnerOrDefault(a.Runner)
+}
+
+// run runs cmd with the CommandRunner of the package manager, and classifies its failures with errorRules.
+func (a *PackageManager) run(ctx context.Context, cmd manager.Command) (manager.Result, error) {
+	res, err := a.runner().Run(ctx, cmd)
+	return res, manager.ClassifyError(pm, res, err, errorRules)
+}
 
 // IsAvailable checks if the apt package manager is available on the system.
 func (a *PackageManager) IsAvailable() bool {
@@ -58,8 +88,22 @@ func (a *PackageManager) GetPackageManager() string {
 
 // Install installs the provided packages using the apt package manager.
 func (a *PackageManager) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
-	args := append([]string{"install", ArgsFixBroken}, pkgs...)
+	return a.InstallContext(context.Background(), pkgs, opts)
+}
+
+// InstallContext is like Install but uses ctx to bound the apt command.
+func (a *PackageManager) InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.install(ctx, pkgs, nil, opts)
+}
 
+// install installs pkgs with apt install, passing it the extra flags.
+func (a *PackageManager) install(ctx context.Context, pkgs []string, flags []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.runInstall(ctx, pm, append(append([]string{"install", ArgsFixBroken}, flags...), pkgs...), opts)
+}
+
+// runInstall runs the install command name with args, such as `apt install -f pkgs...`, and returns the installed
+// packages. It assumes yes unless opts is interactive.
+func (a *PackageManager) runInstall(ctx context.Context, name string, args []string, opts *manager.Options) ([]manager.PackageInfo, error) {
 	if opts == nil {
 		opts = &manager.Options{
 			DryRun:      false,
@@ -77,26 +121,30 @@ func (a *PackageManager) Install(pkgs []string, opts *manager.Options) ([]manage
 		args = append(args, ArgsAssumeYes)
 	}
 
-	cmd := exec.Command(pm, args...)
+	// report machine-readable progress on stdout, next to the regular output
+	if !opts.Interactive && opts.Progress != nil {
+		args = append(args, ArgsStatusFd)
+	}
 
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: name, Args: args, Interactive: true})
 		return nil, err
 	} else {
-		cmd.Env = ENV_NonInteractive
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: name, Args: args, Env: ENV_NonInteractive, Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
 		if err != nil {
 			return nil, err
 		}
-		return ParseInstallOutput(string(out), opts), nil
+		return ParseInstallOutput(string(res.Stdout), opts), nil
 	}
 }
 
 // Delete removes the provided packages using the apt package manager.
 func (a *PackageManager) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.DeleteContext(context.Background(), pkgs, opts)
+}
+
+// DeleteContext is like Delete but uses ctx to bound the apt command.
+func (a *PackageManager) DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
 	// args := append([]string{"remove", ArgsFixBroken, ArgsPurge, ArgsAutoRemove}, pkgs...)
 	args := append([]string{"remove", ArgsFixBroken, ArgsAutoRemove}, pkgs...)
 	if opts == nil {
@@ -114,29 +162,30 @@ func (a *PackageManager) Delete(pkgs []string, opts *manager.Options) ([]manager
 		args = append(args, ArgsAssumeYes)
 	}
 
-	cmd := exec.Command(pm, args...)
+	// report machine-readable progress on stdout, next to the regular output
+	if !opts.Interactive && opts.Progress != nil {
+		args = append(args, ArgsStatusFd)
+	}
 
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	} else {
-		cmd.Env = ENV_NonInteractive
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: ENV_NonInteractive, Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
 		if err != nil {
 			return nil, err
 		}
-		return ParseDeletedOutput(string(out), opts), nil
+		return ParseDeletedOutput(string(res.Stdout), opts), nil
 	}
 }
 
 // Refresh updates the package list using the apt package manager.
 func (a *PackageManager) Refresh(opts *manager.Options) error {
-	cmd := exec.Command(pm, "update")
-	cmd.Env = ENV_NonInteractive
+	return a.RefreshContext(context.Background(), opts)
+}
 
+// RefreshContext is like Refresh but uses ctx to bound the apt command.
+func (a *PackageManager) RefreshContext(ctx context.Context, opts *manager.Options) error {
 	if opts == nil {
 		opts = &manager.Options{
 			DryRun:      false,
@@ -145,18 +194,15 @@ func (a *PackageManager) Refresh(opts *manager.Options) error {
 		}
 	}
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"update"}, Env: ENV_NonInteractive, Interactive: true})
 		return err
 	} else {
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"update"}, Env: ENV_NonInteractive})
 		if err != nil {
 			return err
 		}
 		if opts.Verbose {
-			log.Println(string(out))
+			log.Println(string(res.Stdout))
 		}
 		return nil
 	}
@@ -164,43 +210,92 @@ func (a *PackageManager) Refresh(opts *manager.Options) error {
 
 // Find searches for packages matching the provided keywords using the apt package manager.
 func (a *PackageManager) Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
-	args := append([]string{"search"}, keywords...)
-	cmd := exec.Command("apt", args...)
-	cmd.Env = ENV_NonInteractive
+	return a.FindContext(context.Background(), keywords, opts)
+}
+
+// FindContext is like Find but uses ctx to bound the apt command. The packages are searched in the indexes
+// of the lists under Root, see SearchIndexes, and apt search is only run on systems without them. The status
+// of the found packages is read from the dpkg status database, or from dpkg-query on systems without it.
+func (a *PackageManager) FindContext(ctx context.Context, keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	found, err := a.SearchIndexes(keywords, false)
+	if err == nil {
+		return a.indexPackageStatus(ctx, found)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
 
-	out, err := cmd.Output()
+	args := append([]string{"search"}, keywords...)
+	res, err := a.run(ctx, manager.Command{Name: "apt", Args: args, Env: ENV_NonInteractive})
 	if err != nil {
 		return nil, err
 	}
 
-	return ParseFindOutput(string(out), opts), nil
+	packages := parseFindOutput(ctx, a.packageStatus, string(res.Stdout), opts)
+	if err := ctx.Err(); err != nil {
+		// the package status lookup was cut short
+		return nil, err
+	}
+	return packages, nil
 }
 
 // ListInstalled lists all installed packages using the apt package manager.
 func (a *PackageManager) ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
-	cmd := exec.Command("dpkg-query", "-W", "-f", "${binary:Package} ${Version}\n")
+	return a.ListInstalledContext(context.Background(), opts)
+}
+
+// ListInstalledContext is like ListInstalled but uses ctx to bound the dpkg-query command.
+// The packages are read from the dpkg status database under Root, see ReadDpkgStatus, and dpkg-query is only run
+// on systems without it. Either way, like ${binary:Package} of dpkg-query, only the packages of a foreign architecture
+// and the Multi-Arch: same ones have an Arch.
+func (a *PackageManager) ListInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	if packages, ok, err := a.installedFromDpkgStatus(); ok {
+		return packages, err
+	}
+
 	// NOTE: can also use `apt list --installed`, but it's slower
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	res, err := a.run(ctx, manager.Command{Name: "dpkg-query", Args: []string{"-W", "-f", "${binary:Package} ${Version}\n"}, Env: ENV_NonInteractive})
 	if err != nil {
 		return nil, err
 	}
-	return ParseListInstalledOutput(string(out), opts), nil
+	return ParseListInstalledOutput(string(res.Stdout), opts), nil
 }
 
 // ListUpgradable lists all upgradable packages using the apt package manager.
 func (a *PackageManager) ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error) {
-	cmd := exec.Command(pm, "list", "--upgradable")
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	return a.ListUpgradableContext(context.Background(), opts)
+}
+
+// ListUpgradableContext is like ListUpgradable but uses ctx to bound the apt and apt-mark commands.
+// Held packages are reported with manager.PackageStatusHeld.
+func (a *PackageManager) ListUpgradableContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	packages, err := a.listUpgradable(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	held, err := a.ListHeldContext(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return manager.MarkHeld(packages, held), nil
+}
+
+// listUpgradable lists the upgradable packages, held or not.
+func (a *PackageManager) listUpgradable(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"list", "--upgradable"}, Env: ENV_NonInteractive})
 	if err != nil {
 		return nil, err
 	}
-	return ParseListUpgradableOutput(string(out), opts), nil
+	return ParseListUpgradableOutput(string(res.Stdout), opts), nil
 }
 
 // Upgrade upgrades the provided packages using the apt package manager.
 func (a *PackageManager) Upgrade(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.UpgradeContext(context.Background(), pkgs, opts)
+}
+
+// UpgradeContext is like Upgrade but uses ctx to bound the apt command.
+func (a *PackageManager) UpgradeContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
 	args := []string{"upgrade"}
 	if len(pkgs) > 0 {
 		args = append(args, pkgs...)
@@ -221,37 +316,72 @@ func (a *PackageManager) Upgrade(pkgs []string, opts *manager.Options) ([]manage
 		args = append(args, ArgsAssumeYes)
 	}
 
-	cmd := exec.Command(pm, args...)
+	// report machine-readable progress on stdout, next to the regular output
+	if !opts.Interactive && opts.Progress != nil {
+		args = append(args, ArgsStatusFd)
+	}
 
 	log.Printf("Running command: %s %s", pm, args)
 
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	}
 
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: ENV_NonInteractive, Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
 	if err != nil {
 		return nil, err
 	}
-	return ParseInstallOutput(string(out), opts), nil
+	return ParseInstallOutput(string(res.Stdout), opts), nil
 }
 
 // UpgradeAll upgrades all installed packages using the apt package manager.
 func (a *PackageManager) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
-	// TODO: add support for upgrade specific packages
-	return a.Upgrade(pkgs, opts)
+	return a.UpgradeAllContext(context.Background(), pkgs, opts)
+}
+
+// UpgradeAllContext is like UpgradeAll but uses ctx to bound the apt and apt-mark commands.
+// Held packages are not upgraded, but reported with manager.PackageStatusHeld.
+func (a *PackageManager) UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return manager.UpgradeHolding(ctx, a, pkgs, opts, a.listUpgradable, a.UpgradeContext)
+}
+
+// UpgradeSecurity upgrades the installed packages whose new version is shipped by a -security suite, such as jammy-security.
+// Held packages are not upgraded.
+func (a *PackageManager) UpgradeSecurity(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.UpgradeSecurityContext(context.Background(), opts)
+}
+
+// UpgradeSecurityContext is like UpgradeSecurity but uses ctx to bound the apt, apt-mark and apt-get commands.
+// The packages are upgraded with apt-get install --only-upgrade: apt upgrade, given packages, upgrades all the others too.
+func (a *PackageManager) UpgradeSecurityContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	packages, err := a.ListUpgradableContext(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	var pkgs []string
+	for _, pkg := range packages {
+		if pkg.UpdateType != manager.UpdateTypeSecurity || pkg.Status == manager.PackageStatusHeld {
+			continue
+		}
+		if pkg.Arch != "" {
+			pkg.Name += ":" + pkg.Arch
+		}
+		pkgs = append(pkgs, pkg.Name)
+	}
+	if len(pkgs) == 0 {
+		return nil, nil
+	}
+	return a.runInstall(ctx, "apt-get", append([]string{"install", ArgsOnlyUpgrade}, pkgs...), opts)
 }
 
 // Clean cleans the local package cache used by the apt package manager.
 func (a *PackageManager) Clean(opts *manager.Options) error {
-	cmd := exec.Command(pm, "autoclean")
-	cmd.Env = ENV_NonInteractive
+	return a.CleanContext(context.Background(), opts)
+}
 
+// CleanContext is like Clean but uses ctx to bound the apt command.
+func (a *PackageManager) CleanContext(ctx context.Context, opts *manager.Options) error {
 	if opts == nil {
 		opts = &manager.Options{
 			DryRun:      false,
@@ -260,18 +390,15 @@ func (a *PackageManager) Clean(opts *manager.Options) error {
 		}
 	}
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"autoclean"}, Env: ENV_NonInteractive, Interactive: true})
 		return err
 	} else {
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"autoclean"}, Env: ENV_NonInteractive})
 		if err != nil {
 			return err
 		}
 		if opts.Verbose {
-			log.Println(string(out))
+			log.Println(string(res.Stdout))
 		}
 		return nil
 	}
@@ -279,17 +406,25 @@ func (a *PackageManager) Clean(opts *manager.Options) error {
 
 // GetPackageInfo retrieves package information for the specified package using the apt package manager.
 func (a *PackageManager) GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error) {
-	cmd := exec.Command("apt-cache", "show", pkg)
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	return a.GetPackageInfoContext(context.Background(), pkg, opts)
+}
+
+// GetPackageInfoContext is like GetPackageInfo but uses ctx to bound the apt-cache command.
+func (a *PackageManager) GetPackageInfoContext(ctx context.Context, pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: "apt-cache", Args: []string{"show", pkg}, Env: ENV_NonInteractive})
 	if err != nil {
 		return manager.PackageInfo{}, err
 	}
-	return ParsePackageInfoOutput(string(out), opts), nil
+	return ParsePackageInfoOutput(string(res.Stdout), opts), nil
 }
 
 // AutoRemove removes unused packages and dependencies using the apt package manager.
 func (a *PackageManager) AutoRemove(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.AutoRemoveContext(context.Background(), opts)
+}
+
+// AutoRemoveContext is like AutoRemove but uses ctx to bound the apt command.
+func (a *PackageManager) AutoRemoveContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
 	args := []string{"autoremove"}
 	if opts == nil {
 		opts = &manager.Options{
@@ -306,20 +441,258 @@ func (a *PackageManager) AutoRemove(opts *manager.Options) ([]manager.PackageInf
 		args = append(args, ArgsAssumeYes)
 	}
 
-	cmd := exec.Command(pm, args...)
+	// report machine-readable progress on stdout, next to the regular output
+	if !opts.Interactive && opts.Progress != nil {
+		args = append(args, ArgsStatusFd)
+	}
 
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	} else {
-		cmd.Env = ENV_NonInteractive
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: ENV_NonInteractive, Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
 		if err != nil {
 			return nil, err
 		}
-		return ParseDeletedOutput(string(out), opts), nil
+		return ParseDeletedOutput(string(res.Stdout), opts), nil
+	}
+}
+
+// ListAutoInstalled lists the packages that were installed automatically, as dependencies, using apt-mark.
+func (a *PackageManager) ListAutoInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.ListAutoInstalledContext(context.Background(), opts)
+}
+
+// ListAutoInstalledContext is like ListAutoInstalled but uses ctx to bound the apt-mark command.
+func (a *PackageManager) ListAutoInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: "apt-mark", Args: []string{"showauto"}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	return ParseAptMarkShowOutput(string(res.Stdout), opts), nil
+}
+
+// MarkAutoInstalled marks the specified packages as installed automatically using apt-mark,
+// so that `apt autoremove` removes them once no other package depends on them.
+func (a *PackageManager) MarkAutoInstalled(pkgs []string, opts *manager.Options) error {
+	return a.MarkAutoInstalledContext(context.Background(), pkgs, opts)
+}
+
+// MarkAutoInstalledContext is like MarkAutoInstalled but uses ctx to bound the apt-mark command.
+func (a *PackageManager) MarkAutoInstalledContext(ctx context.Context, pkgs []string, opts *manager.Options) error {
+	if opts != nil && opts.DryRun {
+		log.Printf("apt: would mark as automatically installed: %v\n", pkgs)
+		return nil
+	}
+	_, err := a.run(ctx, manager.Command{Name: "apt-mark", Args: append([]string{"auto"}, pkgs...), Env: ENV_NonInteractive})
+	return err
+}
+
+// ListHeld lists the packages held at their installed version using apt-mark.
+func (a *PackageManager) ListHeld(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.ListHeldContext(context.Background(), opts)
+}
+
+// ListHeldContext is like ListHeld but uses ctx to bound the apt-mark command.
+func (a *PackageManager) ListHeldContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: "apt-mark", Args: []string{"showhold"}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
 	}
+	packages := ParseAptMarkShowOutput(string(res.Stdout), opts)
+	for i := range packages {
+		packages[i].Status = manager.PackageStatusHeld
+	}
+	return packages, nil
+}
+
+// Hold holds the specified packages at their installed version using apt-mark, so that apt does not upgrade them.
+func (a *PackageManager) Hold(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.HoldContext(context.Background(), pkgs, opts)
+}
+
+// HoldContext is like Hold but uses ctx to bound the apt-mark command.
+func (a *PackageManager) HoldContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.mark(ctx, "hold", pkgs, manager.PackageStatusHeld, opts)
+}
+
+// Unhold releases the hold of the specified packages using apt-mark.
+func (a *PackageManager) Unhold(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.UnholdContext(context.Background(), pkgs, opts)
+}
+
+// UnholdContext is like Unhold but uses ctx to bound the apt-mark command.
+func (a *PackageManager) UnholdContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.mark(ctx, "unhold", pkgs, manager.PackageStatusInstalled, opts)
+}
+
+// mark runs `apt-mark command pkgs...`, and returns pkgs with the given status.
+func (a *PackageManager) mark(ctx context.Context, command string, pkgs []string, status manager.PackageStatus, opts *manager.Options) ([]manager.PackageInfo, error) {
+	if opts != nil && opts.DryRun {
+		log.Printf("apt: would %s: %v\n", command, pkgs)
+		return nil, nil
+	}
+	if _, err := a.run(ctx, manager.Command{Name: "apt-mark", Args: append([]string{command}, pkgs...), Env: ENV_NonInteractive}); err != nil {
+		return nil, err
+	}
+	packages := make([]manager.PackageInfo, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		name, arch, _ := strings.Cut(pkg, ":")
+		packages = append(packages, manager.PackageInfo{Name: name, Arch: arch, Status: status, PackageManager: pm})
+	}
+	return packages, nil
+}
+
+// Dependencies returns the relationships of the candidate version of the specified package with other packages, using apt-cache.
+func (a *PackageManager) Dependencies(pkg string, opts *manager.Options) ([]manager.Dependency, error) {
+	return a.DependenciesContext(context.Background(), pkg, opts)
+}
+
+// DependenciesContext is like Dependencies but uses ctx to bound the apt-cache command.
+func (a *PackageManager) DependenciesContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.Dependency, error) {
+	res, err := a.run(ctx, manager.Command{Name: "apt-cache", Args: []string{"show", "--no-all-versions", pkg}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	return ParseDependenciesOutput(string(res.Stdout), opts), nil
+}
+
+// ReverseDependencies returns the installed packages that depend on, recommend, suggest, conflict with or break
+// the specified package, using apt-cache rdepends.
+func (a *PackageManager) ReverseDependencies(pkg string, opts *manager.Options) ([]manager.Dependency, error) {
+	return a.ReverseDependenciesContext(context.Background(), pkg, opts)
+}
+
+// ReverseDependenciesContext is like ReverseDependencies but uses ctx to bound the apt-cache command.
+func (a *PackageManager) ReverseDependenciesContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.Dependency, error) {
+	args := []string{"rdepends", "--installed", "-o", "APT::Cache::ShowDependencyType=1", "-o", "APT::Cache::ShowVersion=1", pkg}
+	res, err := a.run(ctx, manager.Command{Name: "apt-cache", Args: args, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	return ParseReverseDependenciesOutput(string(res.Stdout), opts), nil
+}
+
+// OwnerOf returns the installed packages that own the file or directory at path, using dpkg -S.
+func (a *PackageManager) OwnerOf(path string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.OwnerOfContext(context.Background(), path, opts)
+}
+
+// OwnerOfContext is like OwnerOf but uses ctx to bound the dpkg command.
+func (a *PackageManager) OwnerOfContext(ctx context.Context, path string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: "dpkg", Args: []string{"-S", path}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	packages := ParseOwnerOutput(string(res.Stdout), path, opts)
+	if len(packages) == 0 {
+		return nil, fmt.Errorf("%s: %w", path, manager.ErrPackageNotFound)
+	}
+	return packages, nil
+}
+
+// ListFiles returns the files shipped by the specified installed package, using dpkg -L.
+func (a *PackageManager) ListFiles(pkg string, opts *manager.Options) ([]string, error) {
+	return a.ListFilesContext(context.Background(), pkg, opts)
+}
+
+// ListFilesContext is like ListFiles but uses ctx to bound the dpkg command.
+func (a *PackageManager) ListFilesContext(ctx context.Context, pkg string, opts *manager.Options) ([]string, error) {
+	res, err := a.run(ctx, manager.Command{Name: "dpkg", Args: []string{"-L", pkg}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	return ParseListFilesOutput(string(res.Stdout), opts), nil
+}
+
+// InstallRequests installs the packages of reqs using apt, as name:arch=version, or name/release for a Source.
+// A request cannot have both a Version and a Source.
+func (a *PackageManager) InstallRequests(reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.InstallRequestsContext(context.Background(), reqs, opts)
+}
+
+// InstallRequestsContext is like InstallRequests but uses ctx to bound the apt command.
+func (a *PackageManager) InstallRequestsContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	args := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		arg, err := InstallArg(req)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return a.InstallContext(ctx, args, opts)
+}
+
+// ListVersions lists the versions of the specified package offered by the apt repositories, using apt-cache madison.
+func (a *PackageManager) ListVersions(pkg string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.ListVersionsContext(context.Background(), pkg, opts)
+}
+
+// ListVersionsContext is like ListVersions but uses ctx to bound the apt-cache command.
+func (a *PackageManager) ListVersionsContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: "apt-cache", Args: []string{"madison", pkg}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	versions := ParseMadisonOutput(string(res.Stdout), opts)
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%s: %w", pkg, manager.ErrPackageNotFound)
+	}
+	return versions, nil
+}
+
+// Downgrade installs the older Version requested for each package of reqs using apt install --allow-downgrades.
+// apt cannot find the previous version by itself: each request must have a Version, see ListVersions.
+func (a *PackageManager) Downgrade(reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.DowngradeContext(context.Background(), reqs, opts)
+}
+
+// DowngradeContext is like Downgrade but uses ctx to bound the apt and dpkg-query commands.
+func (a *PackageManager) DowngradeContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	args := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		if req.Version == "" {
+			return nil, fmt.Errorf("%s: apt needs the version to downgrade to", req.Name)
+		}
+		arg, err := InstallArg(req)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return manager.TrackVersions(ctx, opts, a.ListInstalledContext, func() error {
+		_, err := a.install(ctx, args, []string{ArgsAllowDowngrades}, opts)
+		return err
+	})
+}
+
+// PackageFileTypes returns the types of the package files apt installs: .deb packages.
+func (a *PackageManager) PackageFileTypes() []manager.PackageFileType {
+	return []manager.PackageFileType{manager.PackageFileDeb}
+}
+
+// InstallFiles installs the .deb packages at paths using apt install, which installs their dependencies from the repositories.
+func (a *PackageManager) InstallFiles(paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.InstallFilesContext(context.Background(), paths, opts)
+}
+
+// InstallFilesContext is like InstallFiles but uses ctx to bound the apt command.
+func (a *PackageManager) InstallFilesContext(ctx context.Context, paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	// apt takes arguments with a slash as files, and the others as package names
+	args := make([]string, 0, len(paths))
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, abs)
+	}
+	return a.install(ctx, args, nil, opts)
+}
+
+// StateFiles returns the files under Root that change with the packages: the dpkg status database,
+// the lists of the package index, and the record of the automatically installed packages.
+func (a *PackageManager) StateFiles() []string {
+	return []string{a.path(dpkgStatusFile), a.path(listsDir), a.path("var/lib/apt/extended_states")}
 }
@@ -2,9 +2,14 @@
 package apt_test
 
 import (
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/sjwhyte/syspkg/manager"
 	"github.com/sjwhyte/syspkg/manager/apt"
+	"github.com/sjwhyte/syspkg/manager/runnertest"
 )
 
 func TestAptPackageManager(t *testing.T) {
@@ -16,3 +21,366 @@ func TestAptPackageManager(t *testing.T) {
 		t.Fatal("AptPackageManager is not available")
 	}
 }
+
+func TestInstallArgs(t *testing.T) {
+	runner := runnertest.New(runnertest.Response{
+		Stdout: "Setting up vim:amd64 (8.2.3995-1ubuntu2) ...\n",
+	})
+	aptManager := &apt.PackageManager{Runner: runner}
+
+	pkgs, err := aptManager.Install([]string{"vim"}, &manager.Options{DryRun: true})
+	if err != nil {
+		t.Fatalf("Install() error: %+v", err)
+	}
+
+	wantArgv := [][]string{{"apt", "install", "-f", "vim", "--dry-run", "-y"}}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("Install() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+	if env := runner.Calls()[0].Env; !reflect.DeepEqual(env, apt.ENV_NonInteractive) {
+		t.Errorf("Install() env = %+v, want %+v", env, apt.ENV_NonInteractive)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "vim" || pkgs[0].Version != "8.2.3995-1ubuntu2" {
+		t.Errorf("Install() = %+v, want vim 8.2.3995-1ubuntu2", pkgs)
+	}
+}
+
+func TestFindArgs(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "Sorting...\nFull Text Search...\nzvbi/jammy 0.2.35-19 amd64\n  Vertical Blanking Interval (VBI) utilities\n"},
+		runnertest.Response{Stderr: "dpkg-query: no packages found matching zvbi\n", ExitCode: 1},
+	)
+	// without a dpkg status database under Root, the status is looked up with dpkg-query
+	aptManager := &apt.PackageManager{Runner: runner, Root: t.TempDir()}
+
+	pkgs, err := aptManager.Find([]string{"zvbi"}, &manager.Options{})
+	if err != nil {
+		t.Fatalf("Find() error: %+v", err)
+	}
+
+	wantArgv := [][]string{
+		{"apt", "search", "zvbi"},
+		{"dpkg-query", "-W", "--showformat", "${binary:Package} ${Status} ${Version}\n", "zvbi"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("Find() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "zvbi" || pkgs[0].Status != manager.PackageStatusUnknown {
+		t.Errorf("Find() = %+v, want zvbi with unknown status", pkgs)
+	}
+}
+
+func TestRefreshExitError(t *testing.T) {
+	runner := runnertest.New(runnertest.Response{Stderr: "E: Could not get lock /var/lib/apt/lists/lock. It is held by process 1234 (apt)\n", ExitCode: 100})
+	aptManager := &apt.PackageManager{Runner: runner}
+
+	err := aptManager.Refresh(nil)
+
+	var exitErr *manager.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 100 {
+		t.Errorf("Refresh() error = %+v, want exit status 100", err)
+	}
+	if !errors.Is(err, manager.ErrLocked) || !manager.IsTemporary(err) {
+		t.Errorf("Refresh() error = %+v, want manager.ErrLocked", err)
+	}
+}
+
+func TestInstallErrors(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   error
+	}{
+		{"E: Unable to locate package nosuchpackage\n", manager.ErrPackageNotFound},
+		{"E: Package 'python' has no installation candidate\n", manager.ErrPackageNotFound},
+		{"E: Could not open lock file /var/lib/dpkg/lock-frontend - open (13: Permission denied)\nE: Unable to acquire the dpkg frontend lock (/var/lib/dpkg/lock-frontend), are you root?\n", manager.ErrPermissionDenied},
+		{"E: Could not get lock /var/lib/dpkg/lock-frontend. It is held by process 4321 (unattended-upgr)\n", manager.ErrLocked},
+		{"E: Unable to correct problems, you have held broken packages.\n", manager.ErrDependencyConflict},
+		{"E: Failed to fetch http://archive.ubuntu.com/ubuntu/pool/main/v/vim/vim_8.2.deb  Temporary failure resolving 'archive.ubuntu.com'\n", manager.ErrNetwork},
+		{"E: You don't have enough free space in /var/cache/apt/archives/.\n", manager.ErrDiskFull},
+	}
+	for _, tt := range tests {
+		runner := runnertest.New(runnertest.Response{Stderr: tt.stderr, ExitCode: 100})
+		aptManager := &apt.PackageManager{Runner: runner}
+
+		_, err := aptManager.Install([]string{"vim"}, nil)
+
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Install() with stderr %q: error = %+v, want %+v", tt.stderr, err, tt.want)
+		}
+		var pmErr *manager.Error
+		if !errors.As(err, &pmErr) || pmErr.Stderr != tt.stderr {
+			t.Errorf("Install() with stderr %q: error = %+v, want the captured stderr", tt.stderr, err)
+		}
+	}
+}
+
+func TestInstallProgress(t *testing.T) {
+	runner := runnertest.New(runnertest.Response{Stdout: strings.Join([]string{
+		"dlstatus:1:50.0000:Retrieving file 1 of 1",
+		"pmstatus:dpkg-exec:0.0000:Running dpkg",
+		"pmstatus:vim:20.0000:Preparing vim (amd64)",
+		"pmstatus:vim:40.0000:Unpacking vim (amd64)",
+		"Setting up vim (8.2.3995-1ubuntu2) ...",
+		"pmstatus:vim:80.0000:Configuring vim (amd64)",
+		"pmstatus:vim:100.0000:Installed vim (amd64)",
+		"",
+	}, "\n")})
+	aptManager := &apt.PackageManager{Runner: runner}
+
+	var events []manager.ProgressEvent
+	opts := &manager.Options{Progress: func(event manager.ProgressEvent) { events = append(events, event) }}
+	pkgs, err := aptManager.Install([]string{"vim"}, opts)
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	wantArgv := [][]string{{"apt", "install", "-f", "vim", "-y", "-oAPT::Status-Fd=1"}}
+	if got := runner.Argv(); !reflect.DeepEqual(got, wantArgv) {
+		t.Errorf("Install() ran %+v, want %+v", got, wantArgv)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "vim" {
+		t.Errorf("Install() = %+v, want vim", pkgs)
+	}
+
+	want := []manager.ProgressEvent{
+		{PackageManager: "apt", Type: manager.ProgressStatus, Phase: manager.ProgressPhaseDownloading, Percent: 50, Message: "Retrieving file 1 of 1"},
+		{PackageManager: "apt", Type: manager.ProgressPackageStarted, Phase: manager.ProgressPhaseUnpacking, Package: "vim", Percent: 20, Message: "Preparing vim (amd64)"},
+		{PackageManager: "apt", Type: manager.ProgressStatus, Phase: manager.ProgressPhaseUnpacking, Package: "vim", Percent: 20, Message: "Preparing vim (amd64)"},
+		{PackageManager: "apt", Type: manager.ProgressStatus, Phase: manager.ProgressPhaseUnpacking, Package: "vim", Percent: 40, Message: "Unpacking vim (amd64)"},
+		{PackageManager: "apt", Type: manager.ProgressStatus, Phase: manager.ProgressPhaseConfiguring, Package: "vim", Percent: 80, Message: "Configuring vim (amd64)"},
+		{PackageManager: "apt", Type: manager.ProgressStatus, Phase: manager.ProgressPhaseConfiguring, Package: "vim", Percent: 100, Message: "Installed vim (amd64)"},
+		{PackageManager: "apt", Type: manager.ProgressPackageFinished, Phase: manager.ProgressPhaseConfiguring, Package: "vim", Percent: 100, Message: "Installed vim (amd64)"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("Install() progress = %+v, want %+v", events, want)
+	}
+}
+
+func TestAutoInstalled(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "libc6\nlibc6:i386\n"},
+		runnertest.Response{},
+	)
+	aptManager := &apt.PackageManager{Runner: runner}
+
+	pkgs, err := aptManager.ListAutoInstalled(nil)
+	if err != nil {
+		t.Fatalf("ListAutoInstalled() error: %+v", err)
+	}
+	want := []manager.PackageInfo{
+		{Name: "libc6", Status: manager.PackageStatusInstalled, PackageManager: "apt"},
+		{Name: "libc6", Arch: "i386", Status: manager.PackageStatusInstalled, PackageManager: "apt"},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("ListAutoInstalled() = %+v, want %+v", pkgs, want)
+	}
+
+	if err := aptManager.MarkAutoInstalled([]string{"libfoo", "libbar"}, nil); err != nil {
+		t.Fatalf("MarkAutoInstalled() error: %+v", err)
+	}
+
+	wantArgv := [][]string{{"apt-mark", "showauto"}, {"apt-mark", "auto", "libfoo", "libbar"}}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+}
+
+func TestHold(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{},
+		runnertest.Response{Stdout: "Listing...\nlinux-image-generic/jammy-updates 5.15.0.92.89 amd64 [upgradable from: 5.15.0.91.88]\nvim/jammy-updates 2:8.2.3995-1ubuntu2.15 amd64 [upgradable from: 2:8.2.3995-1ubuntu2.13]\n"},
+		runnertest.Response{Stdout: "linux-image-generic\n"},
+		runnertest.Response{Stdout: "linux-image-generic\n"},
+		runnertest.Response{Stdout: "Listing...\nlinux-image-generic/jammy-updates 5.15.0.92.89 amd64 [upgradable from: 5.15.0.91.88]\n"},
+	)
+	aptManager := &apt.PackageManager{Runner: runner}
+
+	if _, err := aptManager.Hold([]string{"linux-image-generic"}, nil); err != nil {
+		t.Fatalf("Hold() error: %+v", err)
+	}
+
+	pkgs, err := aptManager.ListUpgradable(nil)
+	if err != nil {
+		t.Fatalf("ListUpgradable() error: %+v", err)
+	}
+	if len(pkgs) != 2 || pkgs[0].Status != manager.PackageStatusHeld || pkgs[1].Status != manager.PackageStatusUpgradable {
+		t.Errorf("ListUpgradable() = %+v, want linux-image-generic held and vim upgradable", pkgs)
+	}
+
+	pkgs, err = aptManager.UpgradeAll([]string{"linux-image-generic"}, nil)
+	if err != nil {
+		t.Fatalf("UpgradeAll() error: %+v", err)
+	}
+	want := []manager.PackageInfo{
+		{Name: "linux-image-generic", Version: "5.15.0.91.88", NewVersion: "5.15.0.92.89", Category: "jammy-updates", Arch: "amd64", Status: manager.PackageStatusHeld, UpdateType: manager.UpdateTypeBugfix, PackageManager: "apt"},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("UpgradeAll() of a held package = %+v, want %+v", pkgs, want)
+	}
+
+	wantArgv := [][]string{
+		{"apt-mark", "hold", "linux-image-generic"},
+		{"apt", "list", "--upgradable"},
+		{"apt-mark", "showhold"},
+		{"apt-mark", "showhold"},
+		{"apt", "list", "--upgradable"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("ran %+v, want %+v, and no upgrade", runner.Argv(), wantArgv)
+	}
+}
+
+func TestInstallRequests(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{},
+		runnertest.Response{Stdout: "     nginx | 1.18.0-6ubuntu14.4 | http://archive.ubuntu.com/ubuntu jammy-updates/main amd64 Packages\n     nginx | 1.18.0-6ubuntu14 | http://archive.ubuntu.com/ubuntu jammy/main amd64 Packages\n     nginx | 1.18.0-6ubuntu14 | http://archive.ubuntu.com/ubuntu jammy/main Sources\n"},
+		runnertest.Response{Stdout: "N: Unable to locate package nginx-full\n"},
+	)
+	aptManager := &apt.PackageManager{Runner: runner}
+
+	reqs := []manager.InstallRequest{
+		{Name: "nginx", Version: "1.18.0-6ubuntu14"},
+		{Name: "libc6", Arch: "i386"},
+		{Name: "golang", Source: "jammy-backports"},
+	}
+	if _, err := aptManager.InstallRequests(reqs, nil); err != nil {
+		t.Fatalf("InstallRequests() error: %+v", err)
+	}
+	if _, err := aptManager.InstallRequests([]manager.InstallRequest{{Name: "nginx", Version: "1.18.0-6ubuntu14", Source: "jammy"}}, nil); !errors.Is(err, manager.ErrUnsupported) {
+		t.Errorf("InstallRequests() with a version and a source: error = %v, want %v", err, manager.ErrUnsupported)
+	}
+
+	versions, err := aptManager.ListVersions("nginx", nil)
+	if err != nil {
+		t.Fatalf("ListVersions() error: %+v", err)
+	}
+	want := []manager.PackageInfo{
+		{Name: "nginx", Version: "1.18.0-6ubuntu14.4", Category: "jammy-updates/main", Arch: "amd64", Status: manager.PackageStatusAvailable, PackageManager: "apt"},
+		{Name: "nginx", Version: "1.18.0-6ubuntu14", Category: "jammy/main", Arch: "amd64", Status: manager.PackageStatusAvailable, PackageManager: "apt"},
+	}
+	if !reflect.DeepEqual(versions, want) {
+		t.Errorf("ListVersions() = %+v, want %+v", versions, want)
+	}
+	if _, err := aptManager.ListVersions("nginx-full", nil); !errors.Is(err, manager.ErrPackageNotFound) {
+		t.Errorf("ListVersions() of an unknown package: error = %v, want %v", err, manager.ErrPackageNotFound)
+	}
+
+	wantArgv := [][]string{
+		{"apt", "install", "-f", "nginx=1.18.0-6ubuntu14", "libc6:i386", "golang/jammy-backports", "-y"},
+		{"apt-cache", "madison", "nginx"},
+		{"apt-cache", "madison", "nginx-full"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+}
+
+func TestOwnerOfListFiles(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "diversion by dash from: /bin/sh\ndiversion by dash to: /bin/sh.distrib\ndash: /bin/sh\n"},
+		runnertest.Response{Stdout: "libc6:amd64, libc6:i386: /usr/share/doc/libc6\nlibc6-dev:amd64: /usr/share/doc/libc6-dev\n"},
+		runnertest.Response{Stderr: "dpkg-query: no path found matching pattern /usr/bin/foo\n", ExitCode: 1},
+		runnertest.Response{Stdout: "/.\n/usr\n/usr/bin\n/usr/bin/curl\n"},
+	)
+	aptManager := &apt.PackageManager{Runner: runner}
+
+	pkgs, err := aptManager.OwnerOf("/bin/sh", nil)
+	if err != nil || len(pkgs) != 1 || pkgs[0].Name != "dash" {
+		t.Errorf("OwnerOf(/bin/sh) = %+v, %v, want dash", pkgs, err)
+	}
+
+	pkgs, err = aptManager.OwnerOf("/usr/share/doc/libc6", nil)
+	want := []manager.PackageInfo{
+		{Name: "libc6", Arch: "amd64", Status: manager.PackageStatusInstalled, PackageManager: "apt"},
+		{Name: "libc6", Arch: "i386", Status: manager.PackageStatusInstalled, PackageManager: "apt"},
+	}
+	if err != nil || !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("OwnerOf(/usr/share/doc/libc6) = %+v, %v, want %+v", pkgs, err, want)
+	}
+
+	if _, err := aptManager.OwnerOf("/usr/bin/foo", nil); !errors.Is(err, manager.ErrPackageNotFound) {
+		t.Errorf("OwnerOf() of a file without package: error = %+v, want %+v", err, manager.ErrPackageNotFound)
+	}
+
+	files, err := aptManager.ListFiles("curl", nil)
+	if wantFiles := []string{"/usr", "/usr/bin", "/usr/bin/curl"}; err != nil || !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("ListFiles() = %+v, %v, want %+v", files, err, wantFiles)
+	}
+
+	wantArgv := [][]string{{"dpkg", "-S", "/bin/sh"}, {"dpkg", "-S", "/usr/share/doc/libc6"}, {"dpkg", "-S", "/usr/bin/foo"}, {"dpkg", "-L", "curl"}}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+}
+
+func TestDowngrade(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "nginx 1.18.0-6ubuntu14.4\nnginx-common 1.18.0-6ubuntu14.4\n"},
+		runnertest.Response{},
+		runnertest.Response{Stdout: "nginx 1.18.0-6ubuntu14\nnginx-common 1.18.0-6ubuntu14.4\n"},
+	)
+	aptManager := &apt.PackageManager{Runner: runner, Root: t.TempDir()}
+
+	pkgs, err := aptManager.Downgrade([]manager.InstallRequest{{Name: "nginx", Version: "1.18.0-6ubuntu14"}}, nil)
+	if err != nil {
+		t.Fatalf("Downgrade() error: %+v", err)
+	}
+	want := []manager.PackageInfo{
+		{Name: "nginx", Version: "1.18.0-6ubuntu14.4", NewVersion: "1.18.0-6ubuntu14", Status: manager.PackageStatusInstalled, PackageManager: "apt"},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("Downgrade() = %+v, want %+v", pkgs, want)
+	}
+	if _, err := aptManager.Downgrade([]manager.InstallRequest{{Name: "nginx"}}, nil); err == nil {
+		t.Errorf("Downgrade() without a version: error = nil, want an error")
+	}
+
+	wantArgv := [][]string{
+		{"dpkg-query", "-W", "-f", "${binary:Package} ${Version}\n"},
+		{"apt", "install", "-f", "--allow-downgrades", "nginx=1.18.0-6ubuntu14", "-y"},
+		{"dpkg-query", "-W", "-f", "${binary:Package} ${Version}\n"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("Downgrade() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+}
+
+func TestUpgradeSecurity(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "Listing...\nlibssl3/jammy-updates,jammy-security 3.0.2-0ubuntu1.15 amd64 [upgradable from: 3.0.2-0ubuntu1.14]\nlinux-image-generic/jammy-updates,jammy-security 5.15.0.92.89 amd64 [upgradable from: 5.15.0.91.88]\nvim/jammy-updates 2:8.2.3995-1ubuntu2.15 amd64 [upgradable from: 2:8.2.3995-1ubuntu2.13]\n"},
+		runnertest.Response{Stdout: "linux-image-generic\n"},
+		runnertest.Response{},
+	)
+	aptManager := &apt.PackageManager{Runner: runner}
+
+	if _, err := aptManager.UpgradeSecurity(nil); err != nil {
+		t.Fatalf("UpgradeSecurity() error: %+v", err)
+	}
+
+	wantArgv := [][]string{
+		{"apt", "list", "--upgradable"},
+		{"apt-mark", "showhold"},
+		{"apt-get", "install", "--only-upgrade", "libssl3:amd64", "-y"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("UpgradeSecurity() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+}
+
+func TestInstallFiles(t *testing.T) {
+	runner := runnertest.New(runnertest.Response{Stdout: "Setting up hello (1.0-1) ...\n"})
+	aptManager := &apt.PackageManager{Runner: runner}
+
+	pkgs, err := aptManager.InstallFiles([]string{"/srv/artifacts/hello_1.0-1_amd64.deb"}, nil)
+	if err != nil {
+		t.Fatalf("InstallFiles() error: %+v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "hello" || pkgs[0].Version != "1.0-1" {
+		t.Errorf("InstallFiles() = %+v, want hello 1.0-1", pkgs)
+	}
+
+	wantArgv := [][]string{{"apt", "install", "-f", "/srv/artifacts/hello_1.0-1_amd64.deb", "-y"}}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("InstallFiles() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+}
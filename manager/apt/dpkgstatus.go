@@ -0,0 +1,242 @@
+package apt
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// dpkgStatusFile is the path of the dpkg status database, relative to the Root of the package manager.
+const dpkgStatusFile = "var/lib/dpkg/status"
+
+// DpkgPackage is a package of the dpkg status database.
+type DpkgPackage struct {
+	Name    string
+	Version string
+	Arch    string
+
+	// MultiArch is the Multi-Arch field of the package: "same", "foreign", "allowed", or empty for no.
+	MultiArch string
+
+	// Want, Flag and State are the words of the Status field, such as "install ok installed": the action selected
+	// for the package (install, hold, deinstall or purge), ok or reinstreq, and the state of the package on the system.
+	Want  string
+	Flag  string
+	State string
+
+	Essential bool
+	Priority  string
+	Section   string
+
+	// InstalledSize is the size of the installed files, in KiB, as declared by the package.
+	InstalledSize int64
+
+	// Dependencies are the relationships of the installed version of the package with other packages.
+	Dependencies []manager.Dependency
+}
+
+// PackageInfo returns p as a manager.PackageInfo. The packages in the installed state, or waiting for triggers,
+// are installed, the packages removed but not purged are config-files, the packages that are only known to dpkg
+// are available, and the packages in a broken state, such as half-installed, are unknown.
+func (p DpkgPackage) PackageInfo() manager.PackageInfo {
+	pkg := manager.PackageInfo{
+		Name:           p.Name,
+		Version:        p.Version,
+		Arch:           p.Arch,
+		Category:       p.Section,
+		PackageManager: pm,
+	}
+	switch p.State {
+	case "installed", "triggers-awaited", "triggers-pending":
+		pkg.Status = manager.PackageStatusInstalled
+	case "config-files":
+		pkg.Status = manager.PackageStatusConfigFiles
+	case "not-installed":
+		pkg.Status = manager.PackageStatusAvailable
+	default:
+		pkg.Status = manager.PackageStatusUnknown
+	}
+	return pkg
+}
+
+// ParseDpkgStatus parses the content of the dpkg status database, /var/lib/dpkg/status, and returns its packages
+// in the order of the database. Example content:
+//
+//	Package: curl
+//	Status: install ok installed
+//	Priority: optional
+//	Section: web
+//	Installed-Size: 453
+//	Architecture: amd64
+//	Version: 7.81.0-1ubuntu1.15
+//	Depends: libc6 (>= 2.34), libcurl4 (= 7.81.0-1ubuntu1.15), zlib1g (>= 1:1.1.4)
+func ParseDpkgStatus(content string) []DpkgPackage {
+	var packages []DpkgPackage
+	for _, stanza := range deb822Stanzas(content) {
+		var p DpkgPackage
+		var field string
+		fields := make(map[string]string)
+		for _, line := range stanza {
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				// continuation line of a multi-line field, such as Description or Conffiles
+				if field != "" {
+					fields[field] += "\n" + line
+				}
+				continue
+			}
+			name, value, ok := strings.Cut(line, ":")
+			if !ok {
+				field = ""
+				continue
+			}
+			field = name
+			fields[field] = strings.TrimSpace(value)
+		}
+
+		p.Name = fields["Package"]
+		if p.Name == "" {
+			continue
+		}
+		p.Version = fields["Version"]
+		p.Arch = fields["Architecture"]
+		p.MultiArch = fields["Multi-Arch"]
+		if status := strings.Fields(fields["Status"]); len(status) == 3 {
+			p.Want, p.Flag, p.State = status[0], status[1], status[2]
+		}
+		p.Essential = fields["Essential"] == "yes"
+		p.Priority = fields["Priority"]
+		p.Section = fields["Section"]
+		if size, err := strconv.ParseInt(fields["Installed-Size"], 10, 64); err == nil {
+			p.InstalledSize = size
+		}
+		// relationship fields in the order apt-cache show prints them
+		for _, name := range []string{"Pre-Depends", "Depends", "Recommends", "Suggests", "Conflicts", "Breaks", "Provides"} {
+			if value, ok := fields[name]; ok {
+				p.Dependencies = append(p.Dependencies, ParseRelationships(relationshipFields[name], value)...)
+			}
+		}
+		packages = append(packages, p)
+	}
+	return packages
+}
+
+// ReadDpkgStatus reads the dpkg status database under the Root of the package manager, without running dpkg,
+// so that the packages of a chroot or of a mounted image can be listed too. It returns an error wrapping fs.ErrNotExist
+// if the database does not exist, such as on systems without dpkg.
+func (a *PackageManager) ReadDpkgStatus() ([]DpkgPackage, error) {
+	content, err := os.ReadFile(a.path(dpkgStatusFile))
+	if err != nil {
+		return nil, err
+	}
+	return ParseDpkgStatus(string(content)), nil
+}
+
+// installedFromDpkgStatus returns the installed packages of the dpkg status database, and reports whether
+// the database exists. The other errors reading it are returned.
+func (a *PackageManager) installedFromDpkgStatus() ([]manager.PackageInfo, bool, error) {
+	db, err := a.ReadDpkgStatus()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, true, err
+	}
+
+	native := nativeArch(db)
+	var packages []manager.PackageInfo
+	for _, p := range db {
+		pkg := p.PackageInfo()
+		if pkg.Status != manager.PackageStatusInstalled {
+			continue
+		}
+		// like ${binary:Package} of dpkg-query, only the packages that can be installed for several architectures
+		// at once and the packages of foreign architectures have theirs
+		if p.MultiArch != "same" && (p.Arch == native || p.Arch == "all") {
+			pkg.Arch = ""
+		}
+		packages = append(packages, pkg)
+	}
+	return packages, true, nil
+}
+
+// debianArches maps the values of runtime.GOARCH to the Debian architectures that differ.
+var debianArches = map[string]string{
+	"386":      "i386",
+	"arm":      "armhf",
+	"mips64le": "mips64el",
+	"mipsle":   "mipsel",
+	"ppc64le":  "ppc64el",
+}
+
+// nativeArch returns the native architecture of dpkg, which is the architecture of the dpkg package of db,
+// or, if db has none, the Debian name of the architecture of the running program.
+func nativeArch(db []DpkgPackage) string {
+	for _, p := range db {
+		if p.Name == "dpkg" && p.Arch != "" {
+			return p.Arch
+		}
+	}
+	if arch, ok := debianArches[runtime.GOARCH]; ok {
+		return arch
+	}
+	return runtime.GOARCH
+}
+
+// packageStatus is like getPackageStatus, but looks the packages up in the dpkg status database when it exists,
+// instead of running dpkg-query.
+func (a *PackageManager) packageStatus(ctx context.Context, packages map[string]manager.PackageInfo) ([]manager.PackageInfo, error) {
+	db, err := a.ReadDpkgStatus()
+	if errors.Is(err, fs.ErrNotExist) {
+		return getPackageStatus(ctx, a.runner(), packages)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return DpkgStatusOf(db, packages), nil
+}
+
+// DpkgStatusOf returns the packages of the map of package names and manager.PackageInfo objects, sorted by name,
+// with their status and version set from the packages db of the dpkg status database, like ParseDpkgQueryOutput does
+// from the output of dpkg-query. The packages that db knows without a version keep theirs, the packages of several
+// architectures take the status of the installed one, if any, and the packages that are not in db have an unknown
+// status and no version.
+func DpkgStatusOf(db []DpkgPackage, packages map[string]manager.PackageInfo) []manager.PackageInfo {
+	byName := make(map[string]manager.PackageInfo)
+	for _, p := range db {
+		if _, ok := packages[p.Name]; !ok {
+			continue
+		}
+		if found, ok := byName[p.Name]; ok && found.Status == manager.PackageStatusInstalled {
+			continue
+		}
+		byName[p.Name] = p.PackageInfo()
+	}
+
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]manager.PackageInfo, 0, len(names))
+	for _, name := range names {
+		pkg := packages[name]
+		if found, ok := byName[name]; ok {
+			pkg.Status = found.Status
+			if found.Version != "" {
+				pkg.Version = found.Version
+			}
+		} else {
+			pkg.Status, pkg.Version = manager.PackageStatusUnknown, ""
+		}
+		list = append(list, pkg)
+	}
+	return list
+}
@@ -0,0 +1,129 @@
+package apt_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/apt"
+	"github.com/sjwhyte/syspkg/manager/runnertest"
+)
+
+const dpkgStatus = `Package: curl
+Status: install ok installed
+Priority: optional
+Section: web
+Installed-Size: 453
+Maintainer: Ubuntu Developers <ubuntu-devel-discuss@lists.ubuntu.com>
+Architecture: amd64
+Multi-Arch: foreign
+Version: 7.81.0-1ubuntu1.15
+Depends: libc6 (>= 2.34), libcurl4 (= 7.81.0-1ubuntu1.15),
+ zlib1g (>= 1:1.1.4)
+Description: command line tool for transferring data with URL syntax
+ This is a command line tool and library for transferring data with URLs.
+
+Package: dpkg
+Essential: yes
+Status: hold ok installed
+Priority: required
+Section: admin
+Installed-Size: 6740
+Architecture: amd64
+Version: 1.21.1ubuntu2.2
+Pre-Depends: libbz2-1.0, libc6 (>= 2.34)
+Conffiles:
+ /etc/alternatives/README 7be88b21f7e386c8d5a8790c2461c92b
+ /etc/dpkg/dpkg.cfg f4413ffb515f8f753624ae3bb365b81b
+
+Package: libc6
+Status: install ok installed
+Architecture: i386
+Version: 2.35-0ubuntu3.6
+
+Package: libssl3
+Status: install ok installed
+Architecture: amd64
+Multi-Arch: same
+Version: 3.0.2-0ubuntu1.15
+
+Package: nginx
+Status: deinstall ok config-files
+Architecture: amd64
+Version: 1.18.0-6ubuntu14.4
+`
+
+func TestParseDpkgStatus(t *testing.T) {
+	want := []apt.DpkgPackage{
+		{
+			Name: "curl", Version: "7.81.0-1ubuntu1.15", Arch: "amd64", MultiArch: "foreign", Want: "install", Flag: "ok", State: "installed",
+			Priority: "optional", Section: "web", InstalledSize: 453,
+			Dependencies: []manager.Dependency{
+				{Kind: manager.DependencyDepends, Name: "libc6", Constraint: ">= 2.34"},
+				{Kind: manager.DependencyDepends, Name: "libcurl4", Constraint: "= 7.81.0-1ubuntu1.15"},
+				{Kind: manager.DependencyDepends, Name: "zlib1g", Constraint: ">= 1:1.1.4"},
+			},
+		},
+		{
+			Name: "dpkg", Version: "1.21.1ubuntu2.2", Arch: "amd64", Want: "hold", Flag: "ok", State: "installed",
+			Essential: true, Priority: "required", Section: "admin", InstalledSize: 6740,
+			Dependencies: []manager.Dependency{
+				{Kind: manager.DependencyPreDepends, Name: "libbz2-1.0"},
+				{Kind: manager.DependencyPreDepends, Name: "libc6", Constraint: ">= 2.34"},
+			},
+		},
+		{Name: "libc6", Version: "2.35-0ubuntu3.6", Arch: "i386", Want: "install", Flag: "ok", State: "installed"},
+		{Name: "libssl3", Version: "3.0.2-0ubuntu1.15", Arch: "amd64", MultiArch: "same", Want: "install", Flag: "ok", State: "installed"},
+		{Name: "nginx", Version: "1.18.0-6ubuntu14.4", Arch: "amd64", Want: "deinstall", Flag: "ok", State: "config-files"},
+	}
+	if got := apt.ParseDpkgStatus(dpkgStatus); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDpkgStatus() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDpkgStatusRoot(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "var/lib/dpkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "var/lib/dpkg/status"), []byte(dpkgStatus), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner := runnertest.New(runnertest.Response{Stdout: "Sorting...\nFull Text Search...\ncurl/jammy-updates 7.81.0-1ubuntu1.16 amd64\n  command line tool for transferring data with URL syntax\n\nnginx/jammy-updates 1.18.0-6ubuntu14.4 amd64\n  small, powerful, scalable web/proxy server\n\nzvbi/jammy 0.2.35-19 amd64\n  Vertical Blanking Interval (VBI) utilities\n"})
+	aptManager := &apt.PackageManager{Runner: runner, Root: root}
+
+	pkgs, err := aptManager.ListInstalled(nil)
+	if err != nil {
+		t.Fatalf("ListInstalled() error: %+v", err)
+	}
+	// like dpkg-query, the architecture is given for the packages of a foreign architecture and the Multi-Arch: same ones
+	want := []manager.PackageInfo{
+		{Name: "curl", Version: "7.81.0-1ubuntu1.15", Category: "web", Status: manager.PackageStatusInstalled, PackageManager: "apt"},
+		{Name: "dpkg", Version: "1.21.1ubuntu2.2", Category: "admin", Status: manager.PackageStatusInstalled, PackageManager: "apt"},
+		{Name: "libc6", Version: "2.35-0ubuntu3.6", Arch: "i386", Status: manager.PackageStatusInstalled, PackageManager: "apt"},
+		{Name: "libssl3", Version: "3.0.2-0ubuntu1.15", Arch: "amd64", Status: manager.PackageStatusInstalled, PackageManager: "apt"},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("ListInstalled() = %+v, want %+v", pkgs, want)
+	}
+
+	pkgs, err = aptManager.Find([]string{"curl"}, nil)
+	if err != nil {
+		t.Fatalf("Find() error: %+v", err)
+	}
+	want = []manager.PackageInfo{
+		{Name: "curl", Version: "7.81.0-1ubuntu1.15", NewVersion: "7.81.0-1ubuntu1.16", Category: "jammy-updates", Arch: "amd64", Status: manager.PackageStatusInstalled, PackageManager: "apt"},
+		{Name: "nginx", Version: "1.18.0-6ubuntu14.4", NewVersion: "1.18.0-6ubuntu14.4", Category: "jammy-updates", Arch: "amd64", Status: manager.PackageStatusConfigFiles, PackageManager: "apt"},
+		{Name: "zvbi", NewVersion: "0.2.35-19", Category: "jammy", Arch: "amd64", Status: manager.PackageStatusUnknown, PackageManager: "apt"},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("Find() = %+v, want %+v", pkgs, want)
+	}
+
+	// only apt search is run, the statuses come from the database
+	if wantArgv := [][]string{{"apt", "search", "curl"}}; !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+}
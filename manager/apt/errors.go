@@ -0,0 +1,18 @@
+package apt
+
+import (
+	"regexp"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// errorRules classify the failures of apt, apt-cache, dpkg and dpkg-query, checked in order.
+// apt exits with status 100 for nearly every error, so the classification relies on its "E:" messages.
+var errorRules = []manager.ErrorRule{
+	{Kind: manager.ErrPermissionDenied, Pattern: regexp.MustCompile(`Permission denied|are you root\?|requires superuser privilege`)},
+	{Kind: manager.ErrLocked, Pattern: regexp.MustCompile(`Could not get lock|Unable to acquire the dpkg frontend lock|Unable to lock|is locked by another process|dpkg status database is locked`)},
+	{Kind: manager.ErrDiskFull, Pattern: regexp.MustCompile(`You don't have enough free space|No space left on device`)},
+	{Kind: manager.ErrPackageNotFound, Pattern: regexp.MustCompile(`Unable to locate package|has no installation candidate|No packages found|no packages found matching|is not installed|Couldn't find any package|no path found matching`)},
+	{Kind: manager.ErrDependencyConflict, Pattern: regexp.MustCompile(`Unmet dependencies|unmet dependencies|held broken packages|dependency problems|Conflicts:|Breaks:`)},
+	{Kind: manager.ErrNetwork, Pattern: regexp.MustCompile(`Failed to fetch|Temporary failure resolving|Could not resolve|Could not connect|Connection failed|Some index files failed to download|is not signed|NO_PUBKEY|Hash Sum mismatch`)},
+}
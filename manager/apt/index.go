@@ -0,0 +1,361 @@
+package apt
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/version"
+)
+
+// listsDir is the directory of the indexes downloaded by apt update, relative to the Root of the package manager.
+const listsDir = "var/lib/apt/lists"
+
+// indexExtensions are the extensions of the Packages indexes apt keeps, uncompressed or compressed
+// when Acquire::GzipIndexes or Acquire::CompressionTypes ask for it.
+var indexExtensions = []string{"", ".gz", ".xz", ".zst", ".bz2"}
+
+// IndexPackage is a version of a package in an apt index: a Packages file of the lists downloaded by apt update.
+type IndexPackage struct {
+	Name    string
+	Version string
+	Arch    string
+	Section string
+
+	// Description is the Description field of the index: the synopsis of the package, followed by its long description
+	// when the index has it rather than the Translation files.
+	Description string
+
+	// Origin, Suite and Codename are the fields of the Release file of the index, such as Ubuntu, jammy-updates and jammy.
+	Origin   string
+	Suite    string
+	Codename string
+
+	// NotAutomatic reports that the Release file asks apt not to install the versions of the index unless they are requested,
+	// as for backports and experimental.
+	NotAutomatic bool
+}
+
+// PackageInfo returns p as an available manager.PackageInfo, with its version as NewVersion, its Suite as Category,
+// like `apt search`, and its Origin, if any, as the "origin" AdditionalData.
+func (p IndexPackage) PackageInfo() manager.PackageInfo {
+	pkg := manager.PackageInfo{
+		Name:           p.Name,
+		Version:        p.Version,
+		NewVersion:     p.Version,
+		Status:         manager.PackageStatusAvailable,
+		Category:       p.Suite,
+		Arch:           p.Arch,
+		PackageManager: pm,
+	}
+	if p.Origin != "" {
+		pkg.AdditionalData = map[string]string{"origin": p.Origin}
+	}
+	return pkg
+}
+
+// ParsePackagesIndex parses the apt index read from r, a Packages file, and returns its packages in the order of the index.
+// Example content:
+//
+//	Package: curl
+//	Architecture: amd64
+//	Version: 7.81.0-1ubuntu1.15
+//	Priority: optional
+//	Section: web
+//	Depends: libc6 (>= 2.34), libcurl4 (= 7.81.0-1ubuntu1.15), zlib1g (>= 1:1.1.4)
+//	Description: command line tool for transferring data with URL syntax
+func ParsePackagesIndex(r io.Reader) ([]IndexPackage, error) {
+	var packages []IndexPackage
+	var p IndexPackage
+	var inDescription bool
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			if p.Name != "" {
+				packages = append(packages, p)
+			}
+			p, inDescription = IndexPackage{}, false
+			continue
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"):
+			if inDescription {
+				p.Description += "\n" + strings.TrimPrefix(line, " ")
+			}
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+		inDescription = field == "Description"
+		switch field {
+		case "Package":
+			p.Name = value
+		case "Version":
+			p.Version = value
+		case "Architecture":
+			p.Arch = value
+		case "Section":
+			p.Section = value
+		case "Description":
+			p.Description = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if p.Name != "" {
+		packages = append(packages, p)
+	}
+	return packages, nil
+}
+
+// release is the part of a Release file of an apt repository that describes its indexes.
+type release struct {
+	origin, suite, codename string
+	notAutomatic            bool
+}
+
+// parseRelease parses the content of a Release or InRelease file. The signature of InRelease files is not checked:
+// apt checked it when it downloaded the file.
+func parseRelease(content string) release {
+	var r release
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "-----BEGIN PGP SIGNATURE") {
+			break
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, " ") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch field {
+		case "Origin":
+			r.origin = value
+		case "Suite":
+			r.suite = value
+		case "Codename":
+			r.codename = value
+		case "NotAutomatic":
+			r.notAutomatic = value == "yes"
+		}
+	}
+	return r
+}
+
+// releaseFile returns the path of the InRelease or Release file of the Packages index at path, or an empty string
+// if there is none. The indexes of a distribution are named like
+// archive.ubuntu.com_ubuntu_dists_jammy-updates_main_binary-amd64_Packages, and its Release file like
+// archive.ubuntu.com_ubuntu_dists_jammy-updates_InRelease. The indexes of flat repositories are next to their Release file.
+func releaseFile(path string) string {
+	prefix := strings.TrimSuffix(path, "_Packages"+indexExtension(path))
+	if i := strings.LastIndex(prefix, "_binary-"); i >= 0 {
+		// drop the component
+		if j := strings.LastIndex(prefix[:i], "_"); j >= 0 {
+			prefix = prefix[:j]
+		}
+	}
+	for _, name := range []string{"_InRelease", "_Release"} {
+		if _, err := os.Stat(prefix + name); err == nil {
+			return prefix + name
+		}
+	}
+	return ""
+}
+
+// indexExtension returns the extension of the index file at path, one of indexExtensions. Uncompressed indexes
+// have none, and filepath.Ext does not tell it, as the names of the indexes start with the host name of their repository.
+func indexExtension(path string) string {
+	for _, ext := range indexExtensions[1:] {
+		if strings.HasSuffix(path, "_Packages"+ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// indexFiles returns the Packages indexes of the lists under Root, one file per index, preferring the uncompressed one.
+func (a *PackageManager) indexFiles() ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+	for _, ext := range indexExtensions {
+		matches, err := filepath.Glob(filepath.Join(a.path(listsDir), "*_Packages"+ext))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range matches {
+			index := strings.TrimSuffix(file, ext)
+			if !seen[index] {
+				seen[index] = true
+				files = append(files, file)
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// openIndex opens the index file at path, and decompresses it according to its extension.
+func openIndex(path string) (io.Reader, func() error, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var r io.Reader
+	switch indexExtension(path) {
+	case ".gz":
+		r, err = gzip.NewReader(f)
+	case ".xz":
+		r, err = xz.NewReader(f)
+	case ".zst":
+		var zr *zstd.Decoder
+		if zr, err = zstd.NewReader(f); err == nil {
+			r = zr
+			return r, func() error { zr.Close(); return f.Close() }, nil
+		}
+	case ".bz2":
+		r = bzip2.NewReader(f)
+	default:
+		r = f
+	}
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return r, f.Close, nil
+}
+
+// ReadIndexes reads the Packages indexes of the lists downloaded by apt update under Root, uncompressed or compressed
+// with gzip, xz, zstd or bzip2, and returns all the versions of their packages, with the fields of the Release file
+// of their index. It returns an error wrapping fs.ErrNotExist if there are no indexes, such as on systems without apt.
+func (a *PackageManager) ReadIndexes() ([]IndexPackage, error) {
+	files, err := a.indexFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no apt indexes in %s: %w", a.path(listsDir), fs.ErrNotExist)
+	}
+
+	var packages []IndexPackage
+	releases := make(map[string]release)
+	for _, file := range files {
+		r, closeIndex, err := openIndex(file)
+		if err != nil {
+			return nil, err
+		}
+		pkgs, err := ParsePackagesIndex(r)
+		closeIndex()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		name := releaseFile(file)
+		rel, ok := releases[name]
+		if !ok && name != "" {
+			content, err := os.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			rel = parseRelease(string(content))
+			releases[name] = rel
+		}
+		for i := range pkgs {
+			pkgs[i].Origin, pkgs[i].Suite, pkgs[i].Codename, pkgs[i].NotAutomatic = rel.origin, rel.suite, rel.codename, rel.notAutomatic
+		}
+		packages = append(packages, pkgs...)
+	}
+	return packages, nil
+}
+
+// Candidates returns the version of each package and architecture of packages that apt installs by default,
+// sorted by name and architecture: the highest version, from the indexes that are not NotAutomatic if the package
+// is in any. The priorities of /etc/apt/preferences are not applied.
+func Candidates(packages []IndexPackage) []IndexPackage {
+	candidates := make(map[string]IndexPackage)
+	for _, p := range packages {
+		key := p.Name + ":" + p.Arch
+		c, ok := candidates[key]
+		switch {
+		case !ok,
+			c.NotAutomatic && !p.NotAutomatic,
+			c.NotAutomatic == p.NotAutomatic && version.CompareDebian(p.Version, c.Version) > 0:
+			candidates[key] = p
+		}
+	}
+
+	list := make([]IndexPackage, 0, len(candidates))
+	for _, c := range candidates {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Arch < list[j].Arch
+	})
+	return list
+}
+
+// SearchIndexes returns the candidates of the packages of the apt indexes (see ReadIndexes and Candidates) that match
+// all the patterns, regular expressions matched case-insensitively against their name, and their description
+// unless namesOnly is true, like `apt search`, but without running apt.
+func (a *PackageManager) SearchIndexes(patterns []string, namesOnly bool) ([]IndexPackage, error) {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, re)
+	}
+
+	packages, err := a.ReadIndexes()
+	if err != nil {
+		return nil, err
+	}
+	var found []IndexPackage
+	for _, p := range Candidates(packages) {
+		matches := true
+		for _, re := range res {
+			if !re.MatchString(p.Name) && (namesOnly || !re.MatchString(p.Description)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+// indexPackageStatus returns the packages found in the apt indexes, one per name, with their status looked up
+// like the packages found by apt search.
+func (a *PackageManager) indexPackageStatus(ctx context.Context, found []IndexPackage) ([]manager.PackageInfo, error) {
+	packages := make(map[string]manager.PackageInfo)
+	for _, p := range found {
+		if _, ok := packages[p.Name]; !ok {
+			packages[p.Name] = p.PackageInfo()
+		}
+	}
+	if len(packages) == 0 {
+		return nil, nil
+	}
+	return a.packageStatus(ctx, packages)
+}
@@ -0,0 +1,115 @@
+package apt_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/apt"
+	"github.com/sjwhyte/syspkg/manager/runnertest"
+)
+
+func gzipped(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func zstded(data []byte) []byte {
+	zw, _ := zstd.NewWriter(nil)
+	defer zw.Close()
+	return zw.EncodeAll(data, nil)
+}
+
+func TestIndexes(t *testing.T) {
+	root := t.TempDir()
+	lists := filepath.Join(root, "var/lib/apt/lists")
+	if err := os.MkdirAll(filepath.Join(root, "var/lib/dpkg"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(lists, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"archive.ubuntu.com_ubuntu_dists_jammy_InRelease": []byte("-----BEGIN PGP SIGNED MESSAGE-----\nHash: SHA512\n\nOrigin: Ubuntu\nLabel: Ubuntu\nSuite: jammy\nCodename: jammy\nSHA256:\n 6a8b3d7e 1024 main/binary-amd64/Packages\n-----BEGIN PGP SIGNATURE-----\n\nSuite: forged\n-----END PGP SIGNATURE-----\n"),
+		"archive.ubuntu.com_ubuntu_dists_jammy_main_binary-amd64_Packages": []byte(
+			"Package: curl\nArchitecture: amd64\nVersion: 7.81.0-1\nSection: web\nDescription: command line tool for transferring data with URL syntax\n\n" +
+				"Package: zvbi\nArchitecture: amd64\nVersion: 0.2.35-19\nSection: universe/devel\nDescription: Vertical Blanking Interval (VBI) utilities\n The VBI is the part of the television signal without picture.\n"),
+		"archive.ubuntu.com_ubuntu_dists_jammy-updates_Release": []byte("Origin: Ubuntu\nSuite: jammy-updates\nCodename: jammy\n"),
+		"archive.ubuntu.com_ubuntu_dists_jammy-updates_main_binary-amd64_Packages.zst": zstded([]byte(
+			"Package: curl\nArchitecture: amd64\nVersion: 7.81.0-1ubuntu1.15\nSection: web\nDescription: command line tool for transferring data with URL syntax\n\n" +
+				"Package: curl\nArchitecture: i386\nVersion: 7.81.0-1ubuntu1.15\nSection: web\nDescription: command line tool for transferring data with URL syntax\n")),
+		"archive.ubuntu.com_ubuntu_dists_jammy-backports_InRelease": []byte("Origin: Ubuntu\nSuite: jammy-backports\nCodename: jammy\nNotAutomatic: yes\nButAutomaticUpgrades: yes\n"),
+		"archive.ubuntu.com_ubuntu_dists_jammy-backports_main_binary-amd64_Packages.gz": gzipped([]byte(
+			"Package: curl\nArchitecture: amd64\nVersion: 8.0.1-1\nDescription: command line tool for transferring data with URL syntax\n\n" +
+				"Package: hello\nArchitecture: amd64\nVersion: 2.10-2\nDescription: example package based on GNU hello\n")),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(lists, name), content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "var/lib/dpkg/status"), []byte(dpkgStatus), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runner := runnertest.New()
+	aptManager := &apt.PackageManager{Runner: runner, Root: root}
+
+	packages, err := aptManager.ReadIndexes()
+	if err != nil {
+		t.Fatalf("ReadIndexes() error: %+v", err)
+	}
+	if len(packages) != 6 {
+		t.Errorf("ReadIndexes() = %+v, want the 6 package versions of the indexes", packages)
+	}
+
+	updates := apt.IndexPackage{Name: "curl", Version: "7.81.0-1ubuntu1.15", Arch: "amd64", Section: "web", Description: "command line tool for transferring data with URL syntax", Origin: "Ubuntu", Suite: "jammy-updates", Codename: "jammy"}
+	updatesI386 := updates
+	updatesI386.Arch = "i386"
+	hello := apt.IndexPackage{Name: "hello", Version: "2.10-2", Arch: "amd64", Description: "example package based on GNU hello", Origin: "Ubuntu", Suite: "jammy-backports", Codename: "jammy", NotAutomatic: true}
+	zvbi := apt.IndexPackage{Name: "zvbi", Version: "0.2.35-19", Arch: "amd64", Section: "universe/devel", Description: "Vertical Blanking Interval (VBI) utilities\nThe VBI is the part of the television signal without picture.", Origin: "Ubuntu", Suite: "jammy", Codename: "jammy"}
+	if got, want := apt.Candidates(packages), []apt.IndexPackage{updates, updatesI386, hello, zvbi}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Candidates() = %+v, want %+v", got, want)
+	}
+
+	searches := []struct {
+		patterns  []string
+		namesOnly bool
+		want      []apt.IndexPackage
+	}{
+		{[]string{"TELEVISION"}, false, []apt.IndexPackage{zvbi}},
+		{[]string{"television"}, true, nil},
+		{[]string{"^(hello|zvbi)$"}, true, []apt.IndexPackage{hello, zvbi}},
+		{[]string{"transfer", "url"}, false, []apt.IndexPackage{updates, updatesI386}},
+	}
+	for _, tt := range searches {
+		if got, err := aptManager.SearchIndexes(tt.patterns, tt.namesOnly); err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SearchIndexes(%q, %v) = %+v, %v, want %+v", tt.patterns, tt.namesOnly, got, err, tt.want)
+		}
+	}
+	if _, err := aptManager.SearchIndexes([]string{"c++("}, false); err == nil {
+		t.Errorf("SearchIndexes() with an invalid pattern: error = nil, want an error")
+	}
+
+	pkgs, err := aptManager.Find([]string{"curl|zvbi"}, nil)
+	if err != nil {
+		t.Fatalf("Find() error: %+v", err)
+	}
+	want := []manager.PackageInfo{
+		{Name: "curl", Version: "7.81.0-1ubuntu1.15", NewVersion: "7.81.0-1ubuntu1.15", Status: manager.PackageStatusInstalled, Category: "jammy-updates", Arch: "amd64", PackageManager: "apt", AdditionalData: map[string]string{"origin": "Ubuntu"}},
+		{Name: "zvbi", NewVersion: "0.2.35-19", Status: manager.PackageStatusUnknown, Category: "jammy", Arch: "amd64", PackageManager: "apt", AdditionalData: map[string]string{"origin": "Ubuntu"}},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("Find() = %+v, want %+v", pkgs, want)
+	}
+	if len(runner.Argv()) != 0 {
+		t.Errorf("Find() ran %+v, want no command", runner.Argv())
+	}
+}
@@ -0,0 +1,448 @@
+package apt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// Paths of the apt sources, relative to the Root of the package manager.
+const (
+	sourcesList    = "etc/apt/sources.list"
+	sourcesListDir = "etc/apt/sources.list.d"
+)
+
+// path returns the path of the file at the given path relative to the Root of the package manager.
+func (a *PackageManager) path(name string) string {
+	root := a.Root
+	if root == "" {
+		root = "/"
+	}
+	return filepath.Join(root, name)
+}
+
+// sourceFiles returns the files apt reads its sources from: sources.list, then the .list and .sources files
+// of sources.list.d, sorted by name. Missing files are skipped.
+func (a *PackageManager) sourceFiles() ([]string, error) {
+	var files []string
+	if _, err := os.Stat(a.path(sourcesList)); err == nil {
+		files = append(files, a.path(sourcesList))
+	}
+
+	entries, err := os.ReadDir(a.path(sourcesListDir))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if ext := filepath.Ext(entry.Name()); !entry.IsDir() && (ext == ".list" || ext == ".sources") {
+			files = append(files, filepath.Join(a.path(sourcesListDir), entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// sourceName returns the name of the sources defined in file: its name without directory nor extension.
+func sourceName(file string) string {
+	base := filepath.Base(file)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// findSourceFile returns the file that defines the sources with the given name.
+func (a *PackageManager) findSourceFile(name string) (string, error) {
+	files, err := a.sourceFiles()
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		if sourceName(file) == name {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", name, manager.ErrRepositoryNotFound)
+}
+
+// ListRepositories returns the apt sources of sources.list and sources.list.d, in the one-line and deb822 formats.
+// Each line or stanza is a repository, named after its file. Commented-out one-line sources are listed as disabled.
+func (a *PackageManager) ListRepositories(opts *manager.Options) ([]manager.Repository, error) {
+	return a.ListRepositoriesContext(context.Background(), opts)
+}
+
+// ListRepositoriesContext is like ListRepositories. It does not run any command.
+func (a *PackageManager) ListRepositoriesContext(ctx context.Context, opts *manager.Options) ([]manager.Repository, error) {
+	files, err := a.sourceFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []manager.Repository
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var fileRepos []manager.Repository
+		if filepath.Ext(file) == ".sources" {
+			fileRepos = ParseDeb822Sources(string(data))
+		} else {
+			fileRepos = ParseSourcesList(string(data))
+		}
+		for _, repo := range fileRepos {
+			repo.Name = sourceName(file)
+			repo.File = file
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
+}
+
+// AddRepository validates repo, then writes it to sources.list.d/<name>.sources, in the deb822 format.
+// The keyring of its Key, if any, must exist.
+func (a *PackageManager) AddRepository(repo manager.Repository, opts *manager.Options) error {
+	return a.AddRepositoryContext(context.Background(), repo, opts)
+}
+
+// AddRepositoryContext is like AddRepository. It does not run any command.
+func (a *PackageManager) AddRepositoryContext(ctx context.Context, repo manager.Repository, opts *manager.Options) error {
+	if err := a.validateSource(repo); err != nil {
+		return err
+	}
+	if _, err := a.findSourceFile(repo.Name); err == nil {
+		return fmt.Errorf("repository %s already exists", repo.Name)
+	}
+
+	file := filepath.Join(a.path(sourcesListDir), repo.Name+".sources")
+	if opts != nil && opts.DryRun {
+		log.Printf("apt: would write %s:\n%s", file, FormatDeb822Source(repo))
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(FormatDeb822Source(repo)), 0o644)
+}
+
+// validateSource checks that repo is a valid apt source.
+func (a *PackageManager) validateSource(repo manager.Repository) error {
+	if err := repo.Validate(); err != nil {
+		return err
+	}
+	if repo.Title != "" {
+		return fmt.Errorf("repository %s: apt sources have no title", repo.Name)
+	}
+	for _, t := range repo.Types {
+		if t != "deb" && t != "deb-src" {
+			return fmt.Errorf("repository %s: invalid type %q, want deb or deb-src", repo.Name, t)
+		}
+	}
+	if len(repo.Suites) == 0 {
+		return fmt.Errorf("repository %s: no suite", repo.Name)
+	}
+	flat := strings.HasSuffix(repo.Suites[0], "/")
+	for _, suite := range repo.Suites {
+		if strings.HasSuffix(suite, "/") != flat {
+			return fmt.Errorf("repository %s: cannot mix flat and regular suites", repo.Name)
+		}
+	}
+	if flat && len(repo.Components) > 0 {
+		return fmt.Errorf("repository %s: flat repositories have no components", repo.Name)
+	}
+	if !flat && len(repo.Components) == 0 {
+		return fmt.Errorf("repository %s: no component", repo.Name)
+	}
+	if repo.Key != "" {
+		if !filepath.IsAbs(repo.Key) {
+			return fmt.Errorf("repository %s: the keyring %s must be an absolute path", repo.Name, repo.Key)
+		}
+		if _, err := os.Stat(a.path(repo.Key)); err != nil {
+			return fmt.Errorf("repository %s: keyring: %w", repo.Name, err)
+		}
+	}
+	return nil
+}
+
+// RemoveRepository removes the file of sources.list.d that defines the apt sources with the given name.
+// The sources of sources.list cannot be removed, only disabled.
+func (a *PackageManager) RemoveRepository(name string, opts *manager.Options) error {
+	return a.RemoveRepositoryContext(context.Background(), name, opts)
+}
+
+// RemoveRepositoryContext is like RemoveRepository. It does not run any command.
+func (a *PackageManager) RemoveRepositoryContext(ctx context.Context, name string, opts *manager.Options) error {
+	file, err := a.findSourceFile(name)
+	if err != nil {
+		return err
+	}
+	if file == a.path(sourcesList) {
+		return fmt.Errorf("the sources of %s cannot be removed, disable them instead", file)
+	}
+	if opts != nil && opts.DryRun {
+		log.Printf("apt: would remove %s\n", file)
+		return nil
+	}
+	return os.Remove(file)
+}
+
+// SetRepositoryEnabled enables or disables all the apt sources of the file with the given name:
+// it sets the Enabled field of deb822 sources, and comments or uncomments one-line sources.
+func (a *PackageManager) SetRepositoryEnabled(name string, enabled bool, opts *manager.Options) error {
+	return a.SetRepositoryEnabledContext(context.Background(), name, enabled, opts)
+}
+
+// SetRepositoryEnabledContext is like SetRepositoryEnabled. It does not run any command.
+func (a *PackageManager) SetRepositoryEnabledContext(ctx context.Context, name string, enabled bool, opts *manager.Options) error {
+	file, err := a.findSourceFile(name)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var content string
+	if filepath.Ext(file) == ".sources" {
+		content = setDeb822Enabled(string(data), enabled)
+	} else {
+		content = setSourcesListEnabled(string(data), enabled)
+	}
+	if opts != nil && opts.DryRun {
+		log.Printf("apt: would write %s:\n%s", file, content)
+		return nil
+	}
+	return os.WriteFile(file, []byte(content), info.Mode().Perm())
+}
+
+// ParseSourcesList parses the one-line apt sources of a sources.list file. Commented-out sources are returned
+// as disabled, and other comments are skipped. Example content:
+//
+//	deb http://archive.ubuntu.com/ubuntu jammy main restricted
+//	deb [arch=amd64 signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu jammy stable
+//	# deb-src http://archive.ubuntu.com/ubuntu jammy main restricted
+func ParseSourcesList(content string) []manager.Repository {
+	var repos []manager.Repository
+
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		disabled := strings.HasPrefix(line, "#")
+		if disabled {
+			line = strings.TrimSpace(strings.TrimLeft(line, "#"))
+		}
+		repo, ok := parseSourceLine(line)
+		if !ok {
+			continue
+		}
+		repo.Disabled = disabled
+		repos = append(repos, repo)
+	}
+
+	return repos
+}
+
+// parseSourceLine parses a one-line apt source, and reports whether line is one.
+func parseSourceLine(line string) (manager.Repository, bool) {
+	var repo manager.Repository
+
+	line, _, _ = strings.Cut(line, "#")
+	typ, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+	if typ != "deb" && typ != "deb-src" {
+		return repo, false
+	}
+	rest = strings.TrimSpace(rest)
+
+	var options string
+	if strings.HasPrefix(rest, "[") {
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return repo, false
+		}
+		options, rest = rest[1:end], rest[end+1:]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) < 2 {
+		return repo, false
+	}
+
+	repo.Types = []string{typ}
+	repo.URLs = fields[:1]
+	repo.Suites = fields[1:2]
+	if len(fields) > 2 {
+		repo.Components = fields[2:]
+	}
+	for _, option := range strings.Fields(options) {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "arch":
+			repo.Architectures = strings.Split(value, ",")
+		case "signed-by":
+			repo.Key = value
+		}
+	}
+	return repo, true
+}
+
+// ParseDeb822Sources parses the apt sources of a .sources file, in the deb822 format. Keys embedded in the Signed-By
+// field are reported as the Key "inline". Example content:
+//
+//	Types: deb
+//	URIs: https://download.docker.com/linux/ubuntu
+//	Suites: jammy
+//	Components: stable
+//	Signed-By: /etc/apt/keyrings/docker.gpg
+//	Enabled: no
+func ParseDeb822Sources(content string) []manager.Repository {
+	var repos []manager.Repository
+
+	for _, stanza := range deb822Stanzas(content) {
+		fields := make(map[string]string)
+		var key string
+		for _, line := range stanza {
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				// continuation lines are only kept to tell inline keys from keyring files
+				if key != "" && fields[key] == "" {
+					fields[key] = strings.TrimSpace(line)
+				}
+				continue
+			}
+			k, v, ok := strings.Cut(line, ":")
+			if !ok {
+				continue
+			}
+			key = strings.ToLower(strings.TrimSpace(k))
+			fields[key] = strings.TrimSpace(v)
+		}
+		if fields["types"] == "" || fields["uris"] == "" {
+			continue
+		}
+
+		repo := manager.Repository{
+			Types:         strings.Fields(fields["types"]),
+			URLs:          strings.Fields(fields["uris"]),
+			Suites:        strings.Fields(fields["suites"]),
+			Components:    strings.Fields(fields["components"]),
+			Architectures: strings.Fields(fields["architectures"]),
+			Key:           fields["signed-by"],
+			Disabled:      strings.EqualFold(fields["enabled"], "no"),
+		}
+		if strings.HasPrefix(repo.Key, "-----BEGIN") {
+			repo.Key = "inline"
+		}
+		if len(repo.Components) == 0 {
+			repo.Components = nil
+		}
+		if len(repo.Architectures) == 0 {
+			repo.Architectures = nil
+		}
+		repos = append(repos, repo)
+	}
+
+	return repos
+}
+
+// deb822Stanzas splits content into its stanzas, separated by blank lines, without the comment lines.
+func deb822Stanzas(content string) [][]string {
+	var stanzas [][]string
+	var stanza []string
+	for _, line := range strings.Split(content, "\n") {
+		switch {
+		case strings.TrimSpace(line) == "":
+			if stanza != nil {
+				stanzas = append(stanzas, stanza)
+				stanza = nil
+			}
+		case !strings.HasPrefix(line, "#"):
+			stanza = append(stanza, line)
+		}
+	}
+	if stanza != nil {
+		stanzas = append(stanzas, stanza)
+	}
+	return stanzas
+}
+
+// FormatDeb822Source returns repo as an apt source in the deb822 format, of type "deb" if it has no Types.
+func FormatDeb822Source(repo manager.Repository) string {
+	types := repo.Types
+	if len(types) == 0 {
+		types = []string{"deb"}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Types: %s\n", strings.Join(types, " "))
+	fmt.Fprintf(&b, "URIs: %s\n", strings.Join(repo.URLs, " "))
+	fmt.Fprintf(&b, "Suites: %s\n", strings.Join(repo.Suites, " "))
+	if len(repo.Components) > 0 {
+		fmt.Fprintf(&b, "Components: %s\n", strings.Join(repo.Components, " "))
+	}
+	if len(repo.Architectures) > 0 {
+		fmt.Fprintf(&b, "Architectures: %s\n", strings.Join(repo.Architectures, " "))
+	}
+	if repo.Key != "" {
+		fmt.Fprintf(&b, "Signed-By: %s\n", repo.Key)
+	}
+	if repo.Disabled {
+		b.WriteString("Enabled: no\n")
+	}
+	return b.String()
+}
+
+// setDeb822Enabled returns the content of a .sources file with all of its sources enabled or disabled.
+func setDeb822Enabled(content string, enabled bool) string {
+	var out []string
+	inSource := false
+	flush := func() {
+		if inSource && !enabled {
+			out = append(out, "Enabled: no")
+		}
+		inSource = false
+	}
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		if strings.TrimSpace(line) == "" {
+			flush()
+			out = append(out, line)
+			continue
+		}
+		key, _, _ := strings.Cut(line, ":")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if key == "enabled" && !strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key == "types" {
+			inSource = true
+		}
+		out = append(out, line)
+	}
+	flush()
+	return strings.Join(out, "\n") + "\n"
+}
+
+// setSourcesListEnabled returns the content of a sources.list file with all of its sources enabled or disabled,
+// by uncommenting or commenting them.
+func setSourcesListEnabled(content string, enabled bool) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		commented := strings.HasPrefix(trimmed, "#")
+		uncommented := strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+		if _, ok := parseSourceLine(uncommented); !ok {
+			continue
+		}
+		switch {
+		case enabled && commented:
+			lines[i] = uncommented
+		case !enabled && !commented:
+			lines[i] = "# " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,133 @@
+package apt_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/apt"
+)
+
+func TestParseSourcesList(t *testing.T) {
+	content := `# See http://help.ubuntu.com/community/UpgradeNotes
+deb http://archive.ubuntu.com/ubuntu jammy main restricted
+# deb-src http://archive.ubuntu.com/ubuntu jammy main restricted
+deb [arch=amd64,arm64 signed-by=/etc/apt/keyrings/docker.gpg] https://download.docker.com/linux/ubuntu jammy stable # docker
+deb https://example.com/flat ./
+`
+	want := []manager.Repository{
+		{Types: []string{"deb"}, URLs: []string{"http://archive.ubuntu.com/ubuntu"}, Suites: []string{"jammy"}, Components: []string{"main", "restricted"}},
+		{Types: []string{"deb-src"}, URLs: []string{"http://archive.ubuntu.com/ubuntu"}, Suites: []string{"jammy"}, Components: []string{"main", "restricted"}, Disabled: true},
+		{Types: []string{"deb"}, URLs: []string{"https://download.docker.com/linux/ubuntu"}, Suites: []string{"jammy"}, Components: []string{"stable"}, Architectures: []string{"amd64", "arm64"}, Key: "/etc/apt/keyrings/docker.gpg"},
+		{Types: []string{"deb"}, URLs: []string{"https://example.com/flat"}, Suites: []string{"./"}},
+	}
+	if got := apt.ParseSourcesList(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSourcesList() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseDeb822Sources(t *testing.T) {
+	content := `Types: deb deb-src
+URIs: http://archive.ubuntu.com/ubuntu
+Suites: noble noble-updates
+Components: main universe
+Signed-By: /usr/share/keyrings/ubuntu-archive-keyring.gpg
+
+# disabled while testing
+Types: deb
+URIs: https://ppa.launchpadcontent.net/foo/bar/ubuntu
+Suites: noble
+Components: main
+Enabled: no
+Signed-By:
+ -----BEGIN PGP PUBLIC KEY BLOCK-----
+ .
+ mQINBGRG3rgBEAC
+ -----END PGP PUBLIC KEY BLOCK-----
+`
+	want := []manager.Repository{
+		{Types: []string{"deb", "deb-src"}, URLs: []string{"http://archive.ubuntu.com/ubuntu"}, Suites: []string{"noble", "noble-updates"}, Components: []string{"main", "universe"}, Key: "/usr/share/keyrings/ubuntu-archive-keyring.gpg"},
+		{Types: []string{"deb"}, URLs: []string{"https://ppa.launchpadcontent.net/foo/bar/ubuntu"}, Suites: []string{"noble"}, Components: []string{"main"}, Key: "inline", Disabled: true},
+	}
+	if got := apt.ParseDeb822Sources(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDeb822Sources() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRepositories(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "etc/apt/keyrings"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc/apt/sources.list"), []byte("deb http://archive.ubuntu.com/ubuntu jammy main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc/apt/keyrings/docker.gpg"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	aptManager := &apt.PackageManager{Root: root}
+
+	docker := manager.Repository{
+		Name:       "docker",
+		URLs:       []string{"https://download.docker.com/linux/ubuntu"},
+		Suites:     []string{"jammy"},
+		Components: []string{"stable"},
+		Key:        "/etc/apt/keyrings/docker.gpg",
+	}
+	invalid := []manager.Repository{
+		{Name: "../docker", URLs: docker.URLs, Suites: docker.Suites, Components: docker.Components},
+		{Name: "docker", URLs: []string{"download.docker.com"}, Suites: docker.Suites, Components: docker.Components},
+		{Name: "docker", URLs: docker.URLs, Suites: docker.Suites},
+		{Name: "docker", URLs: docker.URLs, Suites: docker.Suites, Components: docker.Components, Key: "/etc/apt/keyrings/missing.gpg"},
+		{Name: "sources", URLs: docker.URLs, Suites: docker.Suites, Components: docker.Components},
+	}
+	for _, repo := range invalid {
+		if err := aptManager.AddRepository(repo, nil); err == nil {
+			t.Errorf("AddRepository(%+v) error = nil, want an error", repo)
+		}
+	}
+
+	if err := aptManager.AddRepository(docker, nil); err != nil {
+		t.Fatalf("AddRepository() error = %v", err)
+	}
+	if err := aptManager.SetRepositoryEnabled("docker", false, nil); err != nil {
+		t.Fatalf("SetRepositoryEnabled(false) error = %v", err)
+	}
+	if err := aptManager.SetRepositoryEnabled("sources", false, nil); err != nil {
+		t.Fatalf("SetRepositoryEnabled(false) of sources.list error = %v", err)
+	}
+
+	repos, err := aptManager.ListRepositories(nil)
+	if err != nil {
+		t.Fatalf("ListRepositories() error = %v", err)
+	}
+	if len(repos) != 2 || repos[0].Name != "sources" || !repos[0].Disabled || repos[1].Name != "docker" || !repos[1].Disabled {
+		t.Fatalf("ListRepositories() = %+v, want the disabled sources and docker repositories", repos)
+	}
+	docker.Types = []string{"deb"}
+	docker.Disabled = true
+	docker.File = filepath.Join(root, "etc/apt/sources.list.d/docker.sources")
+	if !reflect.DeepEqual(repos[1], docker) {
+		t.Errorf("ListRepositories() = %+v, want %+v", repos[1], docker)
+	}
+
+	if err := aptManager.SetRepositoryEnabled("docker", true, nil); err != nil {
+		t.Fatalf("SetRepositoryEnabled(true) error = %v", err)
+	}
+	if repos, _ := aptManager.ListRepositories(nil); repos[1].Disabled {
+		t.Errorf("SetRepositoryEnabled(true) left %+v disabled", repos[1])
+	}
+
+	if err := aptManager.RemoveRepository("docker", nil); err != nil {
+		t.Fatalf("RemoveRepository() error = %v", err)
+	}
+	if err := aptManager.RemoveRepository("docker", nil); !errors.Is(err, manager.ErrRepositoryNotFound) {
+		t.Errorf("RemoveRepository() of a removed repository: error = %v, want %v", err, manager.ErrRepositoryNotFound)
+	}
+	if err := aptManager.RemoveRepository("sources", nil); err == nil {
+		t.Errorf("RemoveRepository() of sources.list: error = nil, want an error")
+	}
+}
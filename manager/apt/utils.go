@@ -4,10 +4,13 @@ package apt
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os/exec"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	// "github.com/rs/zerolog"
@@ -136,6 +139,14 @@ func ParseDeletedOutput(msg string, opts *manager.Options) []manager.PackageInfo
 // lines, and then processes each package entry line to extract relevant
 // information.
 func ParseFindOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	status := func(ctx context.Context, packages map[string]manager.PackageInfo) ([]manager.PackageInfo, error) {
+		return getPackageStatus(ctx, manager.DefaultRunner, packages)
+	}
+	return parseFindOutput(context.Background(), status, msg, opts)
+}
+
+// parseFindOutput is like ParseFindOutput but looks up the status of the found packages with status, bound to ctx.
+func parseFindOutput(ctx context.Context, status func(context.Context, map[string]manager.PackageInfo) ([]manager.PackageInfo, error), msg string, opts *manager.Options) []manager.PackageInfo {
 	var packages []manager.PackageInfo
 	var packagesDict = make(map[string]manager.PackageInfo)
 
@@ -173,7 +184,7 @@ func ParseFindOutput(msg string, opts *manager.Options) []manager.PackageInfo {
 		return packages
 	}
 
-	packages, err := getPackageStatus(packagesDict)
+	packages, err := status(ctx, packagesDict)
 	if err != nil {
 		log.Printf("apt: getPackageStatus error: %s\n", err)
 	}
@@ -231,6 +242,7 @@ func ParseListUpgradableOutput(msg string, opts *manager.Options) []manager.Pack
 	// cloudflared/unknown 2023.4.0 amd64 [upgradable from: 2023.3.1]
 	// libllvm15/jammy-updates 1:15.0.7-0ubuntu0.22.04.1 amd64 [upgradable from: 1:15.0.6-3~ubuntu0.22.04.2]
 	// libllvm15/jammy-updates 1:15.0.7-0ubuntu0.22.04.1 i386 [upgradable from: 1:15.0.6-3~ubuntu0.22.04.2]
+	// openssl/jammy-updates,jammy-security 3.0.2-0ubuntu1.15 amd64 [upgradable from: 3.0.2-0ubuntu1.14]
 
 	// remove the last empty line
 	msg = strings.TrimSuffix(msg, "\n")
@@ -260,6 +272,7 @@ func ParseListUpgradableOutput(msg string, opts *manager.Options) []manager.Pack
 				Category:       category,
 				Arch:           arch,
 				Status:         manager.PackageStatusUpgradable,
+				UpdateType:     updateType(category),
 				PackageManager: pm,
 			}
 			packages = append(packages, packageInfo)
@@ -269,10 +282,28 @@ func ParseListUpgradableOutput(msg string, opts *manager.Options) []manager.Pack
 	return packages
 }
 
+// updateType returns the kind of update from the comma-separated suites that ship it, as listed by `apt list`:
+// a version shipped by a -security suite is a security update, even if an -updates suite ships it too.
+// Debian and Ubuntu do not rate the severity of their updates in the repositories.
+func updateType(suites string) manager.UpdateType {
+	t := manager.UpdateTypeUnknown
+	for _, suite := range strings.Split(suites, ",") {
+		switch {
+		case strings.HasSuffix(suite, "-security"):
+			return manager.UpdateTypeSecurity
+		case strings.HasSuffix(suite, "-updates"):
+			t = manager.UpdateTypeBugfix
+		case strings.HasSuffix(suite, "-backports") && t == manager.UpdateTypeUnknown:
+			t = manager.UpdateTypeEnhancement
+		}
+	}
+	return t
+}
+
 // getPackageStatus takes a map of package names and manager.PackageInfo objects, and returns a list
 // of manager.PackageInfo objects with their statuses updated using the output of `dpkg-query` command.
 // It also adds any packages not found by dpkg-query to the list with their status set to unknown.
-func getPackageStatus(packages map[string]manager.PackageInfo) ([]manager.PackageInfo, error) {
+func getPackageStatus(ctx context.Context, runner manager.CommandRunner, packages map[string]manager.PackageInfo) ([]manager.PackageInfo, error) {
 	var packageNames []string
 	var packagesList []manager.PackageInfo
 
@@ -283,19 +314,22 @@ func getPackageStatus(packages map[string]manager.PackageInfo) ([]manager.Packag
 	for name := range packages {
 		packageNames = append(packageNames, name)
 	}
+	sort.Strings(packageNames)
 
 	args := []string{"-W", "--showformat", "${binary:Package} ${Status} ${Version}\n"}
 	args = append(args, packageNames...)
-	cmd := exec.Command("dpkg-query", args...)
-	cmd.Env = ENV_NonInteractive
+	res, err := runner.Run(ctx, manager.Command{Name: "dpkg-query", Args: args, Env: ENV_NonInteractive})
 
 	// dpkg-query might exit with status 1, which is not an error when some packages are not found
-	out, err := cmd.CombinedOutput()
+	out := append(res.Stdout, res.Stderr...)
 	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			if exitErr.ExitCode() != 1 && !strings.Contains(string(out), "no packages found matching") {
+		var exitErr *manager.ExitError
+		if errors.As(err, &exitErr) {
+			if exitErr.ExitCode != 1 && !strings.Contains(string(out), "no packages found matching") {
 				return nil, fmt.Errorf("command failed with output: %s", string(out))
 			}
+		} else if ctx.Err() != nil {
+			return nil, err
 		}
 	}
 
@@ -429,3 +463,339 @@ func ParsePackageInfoOutput(msg string, opts *manager.Options) manager.PackageIn
 
 	return pkg
 }
+
+// dpkgProgressMessages maps the prefixes of the dpkg progress messages reported on APT::Status-Fd
+// to the progress phase and event type they stand for. Longer prefixes come first.
+var dpkgProgressMessages = []struct {
+	prefix    string
+	phase     manager.ProgressPhase
+	eventType manager.ProgressEventType
+}{
+	{"Preparing for removal of ", manager.ProgressPhaseRemoving, manager.ProgressPackageStarted},
+	{"Preparing to completely remove ", manager.ProgressPhaseRemoving, manager.ProgressPackageStarted},
+	{"Preparing to configure ", manager.ProgressPhaseConfiguring, manager.ProgressStatus},
+	{"Preparing ", manager.ProgressPhaseUnpacking, manager.ProgressPackageStarted},
+	{"Installing ", manager.ProgressPhaseUnpacking, manager.ProgressPackageStarted},
+	{"Unpacking ", manager.ProgressPhaseUnpacking, manager.ProgressStatus},
+	{"Configuring ", manager.ProgressPhaseConfiguring, manager.ProgressStatus},
+	{"Installed ", manager.ProgressPhaseConfiguring, manager.ProgressPackageFinished},
+	{"Removing ", manager.ProgressPhaseRemoving, manager.ProgressStatus},
+	{"Removed ", manager.ProgressPhaseRemoving, manager.ProgressPackageFinished},
+	{"Completely removed ", manager.ProgressPhaseRemoving, manager.ProgressPackageFinished},
+	{"Running post-installation trigger ", manager.ProgressPhaseConfiguring, manager.ProgressStatus},
+}
+
+// NewProgressParser returns a manager.ProgressParser for the status lines apt writes with `-o APT::Status-Fd`.
+// Other lines are ignored. Example lines:
+//
+//	dlstatus:1:9.0976:Retrieving file 1 of 3 (1,234 kB/s)
+//	pmstatus:libssl3:amd64:20.0000:Unpacking libssl3 (amd64)
+//	pmstatus:openssl:80.0000:Installed openssl (amd64)
+func NewProgressParser() manager.ProgressParser {
+	dlstatusPattern := regexp.MustCompile(`^dlstatus:\d+:(\d+(?:\.\d+)?):(.*)$`)
+	pmstatusPattern := regexp.MustCompile(`^pmstatus:(.+?):(\d+(?:\.\d+)?):(.*)$`)
+
+	return func(line string) []manager.ProgressEvent {
+		if match := dlstatusPattern.FindStringSubmatch(line); match != nil {
+			percent, _ := strconv.ParseFloat(match[1], 64)
+			return []manager.ProgressEvent{{
+				Type:    manager.ProgressStatus,
+				Phase:   manager.ProgressPhaseDownloading,
+				Percent: percent,
+				Message: match[2],
+			}}
+		}
+
+		match := pmstatusPattern.FindStringSubmatch(line)
+		if match == nil {
+			return nil
+		}
+		name := strings.Split(match[1], ":")[0]
+		percent, _ := strconv.ParseFloat(match[2], 64)
+		message := match[3]
+
+		// "dpkg-exec" is a pseudo package apt reports when it starts dpkg
+		if name == "dpkg-exec" {
+			return nil
+		}
+
+		for _, m := range dpkgProgressMessages {
+			if !strings.HasPrefix(message, m.prefix) {
+				continue
+			}
+			status := manager.ProgressEvent{
+				Type:    manager.ProgressStatus,
+				Phase:   m.phase,
+				Package: name,
+				Percent: percent,
+				Message: message,
+			}
+			if m.eventType == manager.ProgressStatus {
+				return []manager.ProgressEvent{status}
+			}
+			event := status
+			event.Type = m.eventType
+			if m.eventType == manager.ProgressPackageStarted {
+				return []manager.ProgressEvent{event, status}
+			}
+			return []manager.ProgressEvent{status, event}
+		}
+
+		return []manager.ProgressEvent{{
+			Type:    manager.ProgressStatus,
+			Phase:   manager.ProgressPhaseConfiguring,
+			Package: name,
+			Percent: percent,
+			Message: message,
+		}}
+	}
+}
+
+// ParseAptMarkShowOutput parses the output of the `apt-mark showauto`, `showmanual` and `showhold` commands,
+// which print one package name per line, with its architecture for foreign packages ("libc6:i386").
+func ParseAptMarkShowOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, arch, _ := strings.Cut(line, ":")
+		packages = append(packages, manager.PackageInfo{
+			Name:           name,
+			Arch:           arch,
+			Status:         manager.PackageStatusInstalled,
+			PackageManager: pm,
+		})
+	}
+
+	return packages
+}
+
+// relationshipFields are the fields of the Debian control files that relate a package with other packages, and their kind.
+var relationshipFields = map[string]manager.DependencyKind{
+	"Pre-Depends": manager.DependencyPreDepends,
+	"Depends":     manager.DependencyDepends,
+	"Recommends":  manager.DependencyRecommends,
+	"Suggests":    manager.DependencySuggests,
+	"Conflicts":   manager.DependencyConflicts,
+	"Breaks":      manager.DependencyBreaks,
+	"Provides":    manager.DependencyProvides,
+}
+
+// relationshipRe matches a package of a relationship field, with its architecture qualifier and version constraint,
+// such as "libc6:any (>= 2.34)".
+var relationshipRe = regexp.MustCompile(`^([^\s:(\[<]+)(?::[^\s(]+)?\s*(?:\(\s*([<>=]+)\s*([^\s)]+)\s*\))?`)
+
+// ParseRelationships parses the value of a relationship field of a Debian control file, such as the Depends field
+// of `apt-cache show` or of the dpkg status database, and returns its dependencies of the given kind. Example field:
+//
+//	libc6 (>= 2.34), libcurl4 (= 7.81.0-1ubuntu1.15), zlib1g (>= 1:1.1.4) | zlib-ng-compat
+func ParseRelationships(kind manager.DependencyKind, field string) []manager.Dependency {
+	var dependencies []manager.Dependency
+
+	for _, group := range strings.Split(field, ",") {
+		var dep manager.Dependency
+		for _, alternative := range strings.Split(group, "|") {
+			matches := relationshipRe.FindStringSubmatch(strings.TrimSpace(alternative))
+			if matches == nil {
+				continue
+			}
+			if dep.Name != "" {
+				dep.Alternatives = append(dep.Alternatives, matches[1])
+				continue
+			}
+			dep = manager.Dependency{Kind: kind, Name: matches[1]}
+			if matches[2] != "" {
+				dep.Constraint = matches[2] + " " + matches[3]
+			}
+		}
+		if dep.Name != "" {
+			dependencies = append(dependencies, dep)
+		}
+	}
+
+	return dependencies
+}
+
+// ParseDependenciesOutput parses the output of `apt-cache show --no-all-versions packageName`
+// and returns the dependencies of the first version shown. Example msg:
+//
+//	Package: curl
+//	Version: 7.81.0-1ubuntu1.15
+//	Depends: libc6 (>= 2.34), libcurl4 (= 7.81.0-1ubuntu1.15), zlib1g (>= 1:1.1.4)
+//	Description-en: command line tool for transferring data with URL syntax
+func ParseDependenciesOutput(msg string, opts *manager.Options) []manager.Dependency {
+	var dependencies []manager.Dependency
+
+	for _, line := range strings.Split(msg, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if dependencies != nil {
+				break
+			}
+			continue
+		}
+		field, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		if kind, ok := relationshipFields[field]; ok {
+			dependencies = append(dependencies, ParseRelationships(kind, value)...)
+		}
+	}
+
+	return dependencies
+}
+
+// reverseDependencyKinds are the kinds of the dependencies printed by `apt-cache rdepends`.
+var reverseDependencyKinds = map[string]manager.DependencyKind{
+	"PreDepends": manager.DependencyPreDepends,
+	"Depends":    manager.DependencyDepends,
+	"Recommends": manager.DependencyRecommends,
+	"Suggests":   manager.DependencySuggests,
+	"Conflicts":  manager.DependencyConflicts,
+	"Breaks":     manager.DependencyBreaks,
+}
+
+// virtualPackageRe matches the virtual packages in the output of apt-cache, which are printed between angle brackets.
+var virtualPackageRe = regexp.MustCompile(`<([^\s<>]+)>`)
+
+// ParseReverseDependenciesOutput parses the output of
+// `apt-cache rdepends -o APT::Cache::ShowDependencyType=1 -o APT::Cache::ShowVersion=1 packageName`
+// and returns the packages that depend on packageName, with the version constraint they put on it.
+// Other relationships, such as Replaces, are skipped. Example msg:
+//
+//	libcurl4
+//	Reverse Depends:
+//	  Depends: curl (= 7.81.0-1ubuntu1.15)
+//	 |Recommends: libcurl4-doc
+//	  Breaks: libcurl3 (<< 7.58.0-2)
+func ParseReverseDependenciesOutput(msg string, opts *manager.Options) []manager.Dependency {
+	var dependencies []manager.Dependency
+	seen := make(map[string]bool)
+
+	for _, line := range strings.Split(msg, "\n") {
+		if !strings.HasPrefix(line, " ") {
+			continue
+		}
+		field, value, ok := strings.Cut(strings.TrimLeft(line, " |"), ":")
+		kind, known := reverseDependencyKinds[field]
+		if !ok || !known {
+			continue
+		}
+		for _, dep := range ParseRelationships(kind, virtualPackageRe.ReplaceAllString(value, "$1")) {
+			// packages of several architectures are listed once for each
+			key := string(dep.Kind) + " " + dep.Name + " " + dep.Constraint
+			if !seen[key] {
+				seen[key] = true
+				dependencies = append(dependencies, dep)
+			}
+		}
+	}
+
+	return dependencies
+}
+
+// ParseOwnerOutput parses the output of `dpkg -S path` and returns the packages that own path.
+// Lines about other paths matching path as a pattern, and about diversions, are skipped. Example msg:
+//
+//	diversion by dash from: /bin/sh
+//	diversion by dash to: /bin/sh.distrib
+//	dash: /bin/sh
+//	libc6:amd64, libc6:i386: /usr/share/doc/libc6
+func ParseOwnerOutput(msg string, path string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, line := range strings.Split(msg, "\n") {
+		if strings.HasPrefix(line, "diversion by ") {
+			continue
+		}
+		owners, file, ok := strings.Cut(line, ": ")
+		if !ok || file != path {
+			continue
+		}
+		for _, owner := range strings.Split(owners, ", ") {
+			name, arch, _ := strings.Cut(owner, ":")
+			packages = append(packages, manager.PackageInfo{
+				Name:           name,
+				Arch:           arch,
+				Status:         manager.PackageStatusInstalled,
+				PackageManager: pm,
+			})
+		}
+	}
+
+	return packages
+}
+
+// ParseListFilesOutput parses the output of `dpkg -L packageName` and returns the files of the package,
+// without the root directory "/.", and without the notes about diverted files. Example msg:
+//
+//	/.
+//	/usr
+//	/usr/bin
+//	/usr/bin/curl
+//	package diverts others to: /usr/bin/curl.real
+func ParseListFilesOutput(msg string, opts *manager.Options) []string {
+	var files []string
+
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "/") || line == "/." {
+			continue
+		}
+		files = append(files, line)
+	}
+
+	return files
+}
+
+// InstallArg returns the argument of `apt install` for req: name[:arch], followed by =version or /release.
+func InstallArg(req manager.InstallRequest) (string, error) {
+	arg := req.Name
+	if req.Arch != "" {
+		arg += ":" + req.Arch
+	}
+	switch {
+	case req.Version != "" && req.Source != "":
+		return "", fmt.Errorf("%s: apt cannot install a given version from a given release: %w", req, manager.ErrUnsupported)
+	case req.Version != "":
+		arg += "=" + req.Version
+	case req.Source != "":
+		arg += "/" + req.Source
+	}
+	return arg, nil
+}
+
+// ParseMadisonOutput parses the output of `apt-cache madison packageName` and returns the versions of the package
+// offered by the repositories, with the suite and component they come from as Category. Source packages are skipped.
+// Example msg:
+//
+//	nginx | 1.18.0-6ubuntu14.4 | http://archive.ubuntu.com/ubuntu jammy-updates/main amd64 Packages
+//	nginx | 1.18.0-6ubuntu14 | http://archive.ubuntu.com/ubuntu jammy/main amd64 Packages
+//	nginx | 1.18.0-6ubuntu14 | http://archive.ubuntu.com/ubuntu jammy/main Sources
+func ParseMadisonOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, line := range strings.Split(msg, "\n") {
+		parts := strings.Split(line, "|")
+		if len(parts) != 3 {
+			continue
+		}
+		source := strings.Fields(parts[2])
+		if len(source) != 4 || source[3] != "Packages" {
+			continue
+		}
+		packages = append(packages, manager.PackageInfo{
+			Name:           strings.TrimSpace(parts[0]),
+			Version:        strings.TrimSpace(parts[1]),
+			Category:       source[1],
+			Arch:           source[2],
+			Status:         manager.PackageStatusAvailable,
+			PackageManager: pm,
+		})
+	}
+
+	return packages
+}
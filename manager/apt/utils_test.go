@@ -208,6 +208,7 @@ func TestParseListUpgradable(t *testing.T) {
 		`cloudflared/unknown 2023.4.0 amd64 [upgradable from: 2023.3.1]`,
 		`libllvm15/jammy-updates 1:15.0.7-0ubuntu0.22.04.1 amd64 [upgradable from: 1:15.0.6-3~ubuntu0.22.04.2]`,
 		`libllvm15/jammy-updates 1:15.0.7-0ubuntu0.22.04.1 i386 [upgradable from: 1:15.0.6-3~ubuntu0.22.04.2]`,
+		`openssl/jammy-updates,jammy-security 3.0.2-0ubuntu1.15 amd64 [upgradable from: 3.0.2-0ubuntu1.14]`,
 	}, "\n")
 
 	var expectedPackageInfo = []manager.PackageInfo{
@@ -225,6 +226,7 @@ func TestParseListUpgradable(t *testing.T) {
 			Version:        "1:15.0.6-3~ubuntu0.22.04.2",
 			NewVersion:     "1:15.0.7-0ubuntu0.22.04.1",
 			Status:         manager.PackageStatusUpgradable,
+			UpdateType:     manager.UpdateTypeBugfix,
 			Category:       "jammy-updates",
 			Arch:           "amd64",
 			PackageManager: "apt",
@@ -234,10 +236,21 @@ func TestParseListUpgradable(t *testing.T) {
 			Version:        "1:15.0.6-3~ubuntu0.22.04.2",
 			NewVersion:     "1:15.0.7-0ubuntu0.22.04.1",
 			Status:         manager.PackageStatusUpgradable,
+			UpdateType:     manager.UpdateTypeBugfix,
 			Category:       "jammy-updates",
 			Arch:           "i386",
 			PackageManager: "apt",
 		},
+		{
+			Name:           "openssl",
+			Version:        "3.0.2-0ubuntu1.14",
+			NewVersion:     "3.0.2-0ubuntu1.15",
+			Status:         manager.PackageStatusUpgradable,
+			UpdateType:     manager.UpdateTypeSecurity,
+			Category:       "jammy-updates,jammy-security",
+			Arch:           "amd64",
+			PackageManager: "apt",
+		},
 	}
 
 	actualPackageInfo := apt.ParseListUpgradableOutput(inputParseListUpgradable, &manager.Options{Verbose: true})
@@ -336,3 +349,56 @@ func TestParseDpkgQueryOutput(t *testing.T) {
 		})
 	}
 }
+
+func TestParseDependenciesOutput(t *testing.T) {
+	msg := strings.Join([]string{
+		`Package: curl`,
+		`Version: 7.81.0-1ubuntu1.15`,
+		`Pre-Depends: dpkg (>= 1.15)`,
+		`Depends: libc6 (>= 2.34), libcurl4 (= 7.81.0-1ubuntu1.15), zlib1g:any (>= 1:1.1.4) | zlib-ng-compat`,
+		`Recommends: ca-certificates [!s390x]`,
+		`Provides: curl-ssl`,
+		`Description-en: command line tool for transferring data with URL syntax`,
+		``,
+		`Package: curl`,
+		`Version: 7.81.0-1`,
+		`Depends: libc6 (>= 2.17)`,
+	}, "\n")
+
+	want := []manager.Dependency{
+		{Kind: manager.DependencyPreDepends, Name: "dpkg", Constraint: ">= 1.15"},
+		{Kind: manager.DependencyDepends, Name: "libc6", Constraint: ">= 2.34"},
+		{Kind: manager.DependencyDepends, Name: "libcurl4", Constraint: "= 7.81.0-1ubuntu1.15"},
+		{Kind: manager.DependencyDepends, Name: "zlib1g", Constraint: ">= 1:1.1.4", Alternatives: []string{"zlib-ng-compat"}},
+		{Kind: manager.DependencyRecommends, Name: "ca-certificates"},
+		{Kind: manager.DependencyProvides, Name: "curl-ssl"},
+	}
+	got := apt.ParseDependenciesOutput(msg, nil)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDependenciesOutput() = %+v, want %+v", got, want)
+	}
+	if s := got[3].String(); s != "depends: zlib1g (>= 1:1.1.4) | zlib-ng-compat" {
+		t.Errorf("Dependency.String() = %q", s)
+	}
+}
+
+func TestParseReverseDependenciesOutput(t *testing.T) {
+	msg := strings.Join([]string{
+		`libcurl4`,
+		`Reverse Depends:`,
+		`  Depends: curl (= 7.81.0-1ubuntu1.15)`,
+		`  Depends: curl (= 7.81.0-1ubuntu1.15)`,
+		` |Recommends: libcurl4-doc`,
+		`  Replaces: libcurl3`,
+		`  Breaks: <libcurl3-gnutls> (<< 7.58.0-2)`,
+	}, "\n")
+
+	want := []manager.Dependency{
+		{Kind: manager.DependencyDepends, Name: "curl", Constraint: "= 7.81.0-1ubuntu1.15"},
+		{Kind: manager.DependencyRecommends, Name: "libcurl4-doc"},
+		{Kind: manager.DependencyBreaks, Name: "libcurl3-gnutls", Constraint: "<< 7.58.0-2"},
+	}
+	if got := apt.ParseReverseDependenciesOutput(msg, nil); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseReverseDependenciesOutput() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,111 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DependencyKind is the kind of a relationship between two packages.
+type DependencyKind string
+
+// DependencyKind constants define the relationships between packages. Package managers that do not
+// distinguish some of them report the closest one, e.g. dnf reports its "Requires" as DependencyDepends.
+const (
+	// DependencyDepends is a package that must be installed for the package to work.
+	DependencyDepends DependencyKind = "depends"
+
+	// DependencyPreDepends is a package that must be installed and configured before the package is installed.
+	DependencyPreDepends DependencyKind = "pre-depends"
+
+	// DependencyRecommends is a package that is installed with the package by default.
+	DependencyRecommends DependencyKind = "recommends"
+
+	// DependencySuggests is a package that enhances the package, but is not installed with it by default.
+	DependencySuggests DependencyKind = "suggests"
+
+	// DependencyConflicts is a package that cannot be installed together with the package.
+	DependencyConflicts DependencyKind = "conflicts"
+
+	// DependencyBreaks is a package that the package breaks: it cannot be configured together with the package.
+	DependencyBreaks DependencyKind = "breaks"
+
+	// DependencyProvides is a virtual package, or capability, that the package provides.
+	DependencyProvides DependencyKind = "provides"
+)
+
+// Dependency is a relationship of a package with another package.
+type Dependency struct {
+	Kind DependencyKind
+
+	// Name is the name of the other package. It may be a virtual package, or a capability such as "libc.so.6()(64bit)".
+	Name string
+
+	// Constraint is the version constraint on the other package, such as ">= 2.34", if any.
+	Constraint string
+
+	// Alternatives are the packages that satisfy the relationship instead of Name, such as b and c for "a | b | c".
+	Alternatives []string
+}
+
+// String returns a human-readable description of the dependency, such as "depends: libc6 (>= 2.34)".
+func (d Dependency) String() string {
+	s := fmt.Sprintf("%s: %s", d.Kind, d.Name)
+	if d.Constraint != "" {
+		s += fmt.Sprintf(" (%s)", d.Constraint)
+	}
+	for _, alt := range d.Alternatives {
+		s += " | " + alt
+	}
+	return s
+}
+
+// DependencyNode is a package of a dependency tree, with the packages it depends on, or that depend on it.
+type DependencyNode struct {
+	Dependency
+
+	// Children are the dependencies of the package. They are not listed if the package is already
+	// listed elsewhere in the tree, which Repeated reports.
+	Children []DependencyNode
+
+	// Repeated reports that the package is listed elsewhere in the tree, with its dependencies.
+	Repeated bool
+}
+
+// DependencyTree returns the tree of the packages that pkg depends on, through the depends and pre-depends relationships,
+// or of the installed packages that depend on pkg if reverse is true, down to depth levels, or all of them if depth is 0.
+// Packages that the package manager does not know, such as virtual packages, have no children.
+func DependencyTree(ctx context.Context, dm DependencyManager, pkg string, reverse bool, depth int, opts *Options) ([]DependencyNode, error) {
+	return dependencyTree(ctx, dm, pkg, reverse, depth, map[string]bool{pkg: true}, opts)
+}
+
+func dependencyTree(ctx context.Context, dm DependencyManager, pkg string, reverse bool, depth int, seen map[string]bool, opts *Options) ([]DependencyNode, error) {
+	query := dm.DependenciesContext
+	if reverse {
+		query = dm.ReverseDependenciesContext
+	}
+	deps, err := query(ctx, pkg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []DependencyNode
+	for _, dep := range deps {
+		if dep.Kind != DependencyDepends && dep.Kind != DependencyPreDepends {
+			continue
+		}
+		node := DependencyNode{Dependency: dep}
+		switch {
+		case seen[dep.Name]:
+			node.Repeated = true
+		case depth != 1:
+			seen[dep.Name] = true
+			node.Children, err = dependencyTree(ctx, dm, dep.Name, reverse, depth-1, seen, opts)
+			if err != nil && !errors.Is(err, ErrPackageNotFound) {
+				return nil, fmt.Errorf("%s: %w", dep.Name, err)
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,73 @@
+package manager_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// fakeDependencies is a DependencyManager whose packages depend on each other as listed.
+type fakeDependencies map[string][]manager.Dependency
+
+func (f fakeDependencies) DependenciesContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.Dependency, error) {
+	deps, ok := f[pkg]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", pkg, manager.ErrPackageNotFound)
+	}
+	return deps, nil
+}
+
+func (f fakeDependencies) ReverseDependenciesContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.Dependency, error) {
+	var deps []manager.Dependency
+	for name, pkgDeps := range f {
+		for _, dep := range pkgDeps {
+			if dep.Name == pkg {
+				deps = append(deps, manager.Dependency{Kind: dep.Kind, Name: name})
+			}
+		}
+	}
+	return deps, nil
+}
+
+func TestDependencyTree(t *testing.T) {
+	dm := fakeDependencies{
+		"curl":     {{Kind: manager.DependencyDepends, Name: "libcurl4"}, {Kind: manager.DependencyRecommends, Name: "ca-certificates"}, {Kind: manager.DependencyDepends, Name: "libc6"}},
+		"libcurl4": {{Kind: manager.DependencyDepends, Name: "libc6"}, {Kind: manager.DependencyDepends, Name: "debconf-2.0"}},
+		"libc6":    {{Kind: manager.DependencyPreDepends, Name: "libgcc-s1"}},
+	}
+	depends := func(name string) manager.Dependency {
+		return manager.Dependency{Kind: manager.DependencyDepends, Name: name}
+	}
+
+	tree, err := manager.DependencyTree(context.Background(), dm, "curl", false, 0, nil)
+	if err != nil {
+		t.Fatalf("DependencyTree() error = %v", err)
+	}
+	want := []manager.DependencyNode{
+		{Dependency: depends("libcurl4"), Children: []manager.DependencyNode{
+			{Dependency: depends("libc6"), Children: []manager.DependencyNode{
+				{Dependency: manager.Dependency{Kind: manager.DependencyPreDepends, Name: "libgcc-s1"}},
+			}},
+			{Dependency: depends("debconf-2.0")},
+		}},
+		{Dependency: depends("libc6"), Repeated: true},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("DependencyTree() = %+v, want %+v", tree, want)
+	}
+
+	tree, err = manager.DependencyTree(context.Background(), dm, "libc6", true, 1, nil)
+	if err != nil {
+		t.Fatalf("DependencyTree() of the reverse dependencies error = %v", err)
+	}
+	if len(tree) != 2 || tree[0].Children != nil || tree[1].Children != nil {
+		t.Errorf("DependencyTree() of the reverse dependencies with depth 1 = %+v, want curl and libcurl4 without children", tree)
+	}
+
+	if _, err := manager.DependencyTree(context.Background(), dm, "nosuchpackage", false, 0, nil); err == nil {
+		t.Errorf("DependencyTree() of an unknown package: error = nil, want an error")
+	}
+}
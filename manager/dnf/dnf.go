@@ -1,14 +1,21 @@
 package dnf
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"github.com/sjwhyte/syspkg/manager"
 	"log"
-	"os"
 	"os/exec"
+	"path/filepath"
 )
 
 var pm string = "dnf"
 
+func init() {
+	manager.Register(pm, manager.PrioritySystem, func() manager.PackageManager { return &PackageManager{} })
+}
+
 // Constants used for dnf commands
 const (
 	ArgsAssumeYes      string = "-y"
@@ -21,7 +28,25 @@ const (
 )
 
 // PackageManager implements the manager.PackageManager interface for the dnf package manager.
-type PackageManager struct{}
+type PackageManager struct {
+	// Runner runs the package manager commands. If nil, manager.DefaultRunner is used.
+	Runner manager.CommandRunner
+
+	// Root is the root directory of the files that the package manager reads and writes itself, such as its .repo files.
+	// If empty, "/" is used.
+	Root string
+}
+
+// runner returns the CommandRunner used to run the package manager commands.
+func (a *PackageManager) runner() manager.CommandRunner {
+	return manager.RunnerOrDefault(a.Runner)
+}
+
+// run runs cmd with the CommandRunner of the package manager, and classifies its failures with errorRules.
+func (a *PackageManager) run(ctx context.Context, cmd manager.Command) (manager.Result, error) {
+	res, err := a.runner().Run(ctx, cmd)
+	return res, manager.ClassifyError(pm, res, err, errorRules)
+}
 
 // IsAvailable checks if the dnf package manager is available on the system.
 func (a *PackageManager) IsAvailable() bool {
@@ -30,36 +55,102 @@ func (a *PackageManager) IsAvailable() bool {
 }
 
 func (a *PackageManager) Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.FindContext(context.Background(), keywords, opts)
+}
+
+// FindContext is like Find but uses ctx to bound the dnf command.
+func (a *PackageManager) FindContext(ctx context.Context, keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	if opts == nil {
+		opts = &manager.Options{}
+	}
 	args := append([]string{"search"}, opts.CustomCommandArgs...)
 	args = append(args, keywords...)
 
-	cmd := exec.Command("dnf", args...)
-
-	out, err := cmd.Output()
+	res, err := a.run(ctx, manager.Command{Name: "dnf", Args: args})
 	if err != nil {
 		return nil, err
 	}
 
-	return ParseFindOutput(string(out), true, opts), nil
+	return ParseFindOutput(string(res.Stdout), true, opts), nil
 }
 
 func (a *PackageManager) ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
-	cmd := exec.Command("dnf", "list", "installed", "${binary:Package} ${Version}\n")
-	// NOTE: can also use `apt list --installed`, but it's slower
-	out, err := cmd.Output()
+	return a.ListInstalledContext(context.Background(), opts)
+}
+
+// ListInstalledContext is like ListInstalled but uses ctx to bound the dnf command.
+func (a *PackageManager) ListInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: "dnf", Args: []string{"list", "installed"}})
 	if err != nil {
 		return nil, err
 	}
-	return ParseInstallOutput(string(out), opts), nil
+	return ParseInstallOutput(string(res.Stdout), opts), nil
 }
 
+// ListUpgradable lists the installed packages that have a newer version, using dnf list --upgrades.
+// Packages locked by the versionlock plugin are reported with manager.PackageStatusHeld.
+// The UpdateType and Severity of the packages come from the advisories of dnf updateinfo.
 func (a *PackageManager) ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error) {
-	//TODO implement me
-	panic("implement me")
+	return a.ListUpgradableContext(context.Background(), opts)
+}
+
+// ListUpgradableContext is like ListUpgradable but uses ctx to bound the dnf and rpm commands.
+func (a *PackageManager) ListUpgradableContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	packages, err := a.listUpgradable(ctx, opts)
+	if err != nil || len(packages) == 0 {
+		return packages, err
+	}
+	held, err := a.ListHeldContext(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"updateinfo", "list", ArgsQuiet}})
+	if err != nil {
+		return nil, err
+	}
+	return markUpdateTypes(manager.MarkHeld(packages, held), ParseUpdateinfoListOutput(string(res.Stdout), opts)), nil
+}
+
+// listUpgradable lists the upgradable packages, locked or not, with their installed version.
+func (a *PackageManager) listUpgradable(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"list", ArgsQuiet, "--upgrades"}})
+	// dnf fails with "No matching Packages to list" when there is nothing to upgrade
+	if errors.Is(err, manager.ErrPackageNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	packages := ParseListUpgradableOutput(string(res.Stdout), opts)
+	if len(packages) == 0 {
+		return nil, nil
+	}
+
+	args := []string{"-q", "--queryformat", "%{NAME} %{ARCH} %{EVR}\n"}
+	for _, pkg := range packages {
+		args = append(args, pkg.Name)
+	}
+	res, err = a.run(ctx, manager.Command{Name: "rpm", Args: args})
+	if err != nil {
+		return nil, err
+	}
+	installed := make(map[string]string)
+	for _, pkg := range ParseRpmQueryOutput(string(res.Stdout), opts) {
+		installed[pkg.Name+"."+pkg.Arch] = pkg.Version
+	}
+	for i, pkg := range packages {
+		packages[i].Version = installed[pkg.Name+"."+pkg.Arch]
+	}
+	return packages, nil
 }
 
 // Upgrade upgrades the provided packages using the apt package manager.
 func (a *PackageManager) Upgrade(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.UpgradeContext(context.Background(), pkgs, opts)
+}
+
+// UpgradeContext is like Upgrade but uses ctx to bound the dnf command.
+func (a *PackageManager) UpgradeContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
 	args := []string{"upgrade"}
 	if len(pkgs) > 0 {
 		args = append(args, pkgs...)
@@ -73,41 +164,51 @@ func (a *PackageManager) Upgrade(pkgs []string, opts *manager.Options) ([]manage
 		}
 	}
 
-	cmd := exec.Command(pm, args...)
+	// assume yes if not interactive, to avoid hanging
+	if !opts.Interactive {
+		args = append(args, ArgsAssumeYes)
+	}
 
 	log.Printf("Running command: %s %s", pm, args)
 
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	}
 
-	out, err := cmd.Output()
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
 	if err != nil {
 		return nil, err
 	}
-	return ParseInstallOutput(string(out), opts), nil
+	return ParseInstallOutput(string(res.Stdout), opts), nil
 }
 
+// UpgradeAll upgrades the provided packages, or all the packages if none is provided, using dnf.
+// Packages locked by the versionlock plugin are not upgraded, but reported with manager.PackageStatusHeld.
 func (a *PackageManager) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
-	return a.Upgrade(pkgs, opts)
+	return a.UpgradeAllContext(context.Background(), pkgs, opts)
+}
+
+// UpgradeAllContext is like UpgradeAll but uses ctx to bound the dnf and rpm commands.
+func (a *PackageManager) UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return manager.UpgradeHolding(ctx, a, pkgs, opts, a.listUpgradable, a.UpgradeContext)
 }
 
 func (a *PackageManager) GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error) {
-	err := a.Refresh(nil)
+	return a.GetPackageInfoContext(context.Background(), pkg, opts)
+}
+
+// GetPackageInfoContext is like GetPackageInfo but uses ctx to bound the dnf commands.
+func (a *PackageManager) GetPackageInfoContext(ctx context.Context, pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	err := a.RefreshContext(ctx, nil)
 	if err != nil {
 		return manager.PackageInfo{}, err
 	}
-	cmd := exec.Command("info", pkg)
-
-	out, err := cmd.Output()
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"info", pkg}})
 	if err != nil {
 		return manager.PackageInfo{}, err
 	}
-	return ParsePackageInfoOutput(string(out), opts), nil
+	return ParsePackageInfoOutput(string(res.Stdout), opts), nil
 }
 
 // GetPackageManager returns the name of the dnf package manager.
@@ -117,6 +218,11 @@ func (a *PackageManager) GetPackageManager() string {
 
 // Install installs the provided packages using the apt package manager.
 func (a *PackageManager) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.InstallContext(context.Background(), pkgs, opts)
+}
+
+// InstallContext is like Install but uses ctx to bound the dnf command.
+func (a *PackageManager) InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
 	args := append([]string{"install"}, pkgs...)
 
 	if opts == nil {
@@ -132,25 +238,25 @@ func (a *PackageManager) Install(pkgs []string, opts *manager.Options) ([]manage
 		args = append(args, ArgsAssumeYes)
 	}
 
-	cmd := exec.Command(pm, args...)
-
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	} else {
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
 		if err != nil {
 			return nil, err
 		}
-		return ParseInstallOutput(string(out), opts), nil
+		return ParseInstallOutput(string(res.Stdout), opts), nil
 	}
 }
 
 // Delete removes the provided packages using the apt package manager.
 func (a *PackageManager) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.DeleteContext(context.Background(), pkgs, opts)
+}
+
+// DeleteContext is like Delete but uses ctx to bound the dnf command.
+func (a *PackageManager) DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
 	// args := append([]string{"remove", ArgsFixBroken, ArgsPurge, ArgsAutoRemove}, pkgs...)
 	args := append([]string{"remove", ArgsAutoRemove}, pkgs...)
 	if opts == nil {
@@ -165,27 +271,25 @@ func (a *PackageManager) Delete(pkgs []string, opts *manager.Options) ([]manager
 		args = append(args, ArgsAssumeYes)
 	}
 
-	cmd := exec.Command(pm, args...)
-
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	} else {
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
 		if err != nil {
 			return nil, err
 		}
-		return ParseDeletedOutput(string(out), opts), nil
+		return ParseDeletedOutput(string(res.Stdout), opts), nil
 	}
 }
 
 // Refresh updates the package list using the apt package manager.
 func (a *PackageManager) Refresh(opts *manager.Options) error {
-	cmd := exec.Command(pm, "update")
+	return a.RefreshContext(context.Background(), opts)
+}
 
+// RefreshContext is like Refresh but uses ctx to bound the dnf command.
+func (a *PackageManager) RefreshContext(ctx context.Context, opts *manager.Options) error {
 	if opts == nil {
 		opts = &manager.Options{
 			Verbose:   false,
@@ -193,19 +297,366 @@ func (a *PackageManager) Refresh(opts *manager.Options) error {
 		}
 	}
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"update"}, Interactive: true})
 		return err
 	} else {
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"update"}})
 		if err != nil {
 			return err
 		}
 		if opts.Verbose {
-			log.Println(string(out))
+			log.Println(string(res.Stdout))
 		}
 		return nil
 	}
 }
+
+// ListAutoInstalled lists the packages that were installed automatically, as dependencies, using dnf repoquery.
+func (a *PackageManager) ListAutoInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.ListAutoInstalledContext(context.Background(), opts)
+}
+
+// ListAutoInstalledContext is like ListAutoInstalled but uses ctx to bound the dnf command.
+func (a *PackageManager) ListAutoInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"repoquery", ArgsQuiet, "--installed", "--queryformat", "%{name} %{arch} %{evr} %{reason}\n"}})
+	if err != nil {
+		return nil, err
+	}
+	return ParseAutoInstalledOutput(string(res.Stdout), opts), nil
+}
+
+// MarkAutoInstalled marks the specified packages as installed automatically using `dnf mark remove`,
+// so that `dnf autoremove` removes them once no other package depends on them.
+func (a *PackageManager) MarkAutoInstalled(pkgs []string, opts *manager.Options) error {
+	return a.MarkAutoInstalledContext(context.Background(), pkgs, opts)
+}
+
+// MarkAutoInstalledContext is like MarkAutoInstalled but uses ctx to bound the dnf command.
+func (a *PackageManager) MarkAutoInstalledContext(ctx context.Context, pkgs []string, opts *manager.Options) error {
+	if opts != nil && opts.DryRun {
+		log.Printf("dnf: would mark as automatically installed: %v\n", pkgs)
+		return nil
+	}
+	_, err := a.run(ctx, manager.Command{Name: pm, Args: append([]string{"mark", "remove"}, pkgs...)})
+	return err
+}
+
+// ListHeld lists the packages locked at their version by the versionlock plugin of dnf.
+// No package is locked if the plugin is not installed.
+func (a *PackageManager) ListHeld(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.ListHeldContext(context.Background(), opts)
+}
+
+// ListHeldContext is like ListHeld but uses ctx to bound the dnf command.
+func (a *PackageManager) ListHeldContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"versionlock", ArgsQuiet, "list"}})
+	if errors.Is(err, manager.ErrUnsupported) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseVersionlockListOutput(string(res.Stdout), opts), nil
+}
+
+// Hold locks the specified packages at their installed version with the versionlock plugin of dnf,
+// which must be installed (python3-dnf-plugin-versionlock). Without it, Hold returns an error wrapping manager.ErrUnsupported.
+func (a *PackageManager) Hold(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.HoldContext(context.Background(), pkgs, opts)
+}
+
+// HoldContext is like Hold but uses ctx to bound the dnf command.
+func (a *PackageManager) HoldContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.versionlock(ctx, "add", pkgs, manager.PackageStatusHeld, opts)
+}
+
+// Unhold removes the versionlock of the specified packages.
+func (a *PackageManager) Unhold(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.UnholdContext(context.Background(), pkgs, opts)
+}
+
+// UnholdContext is like Unhold but uses ctx to bound the dnf command.
+func (a *PackageManager) UnholdContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.versionlock(ctx, "delete", pkgs, manager.PackageStatusInstalled, opts)
+}
+
+// versionlock runs `dnf versionlock command pkgs...`, and returns pkgs with the given status.
+func (a *PackageManager) versionlock(ctx context.Context, command string, pkgs []string, status manager.PackageStatus, opts *manager.Options) ([]manager.PackageInfo, error) {
+	if opts != nil && opts.DryRun {
+		log.Printf("dnf: would versionlock %s: %v\n", command, pkgs)
+		return nil, nil
+	}
+	if _, err := a.run(ctx, manager.Command{Name: pm, Args: append([]string{"versionlock", command}, pkgs...)}); err != nil {
+		return nil, err
+	}
+	packages := make([]manager.PackageInfo, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		packages = append(packages, manager.PackageInfo{Name: pkg, Status: status, PackageManager: pm})
+	}
+	return packages, nil
+}
+
+// LastTransaction returns the ID of the last transaction in the dnf history, or an empty string if there is none.
+func (a *PackageManager) LastTransaction(opts *manager.Options) (string, error) {
+	return a.LastTransactionContext(context.Background(), opts)
+}
+
+// LastTransactionContext is like LastTransaction but uses ctx to bound the dnf command.
+func (a *PackageManager) LastTransactionContext(ctx context.Context, opts *manager.Options) (string, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"history", "list"}})
+	if err != nil {
+		return "", err
+	}
+	return ParseHistoryListOutput(string(res.Stdout), opts), nil
+}
+
+// UndoTransaction reverts the changes of the transaction with the given ID using `dnf history undo`.
+func (a *PackageManager) UndoTransaction(id string, opts *manager.Options) error {
+	return a.UndoTransactionContext(context.Background(), id, opts)
+}
+
+// UndoTransactionContext is like UndoTransaction but uses ctx to bound the dnf command.
+func (a *PackageManager) UndoTransactionContext(ctx context.Context, id string, opts *manager.Options) error {
+	if opts == nil {
+		opts = &manager.Options{}
+	}
+	if opts.DryRun {
+		log.Printf("dnf: would undo transaction %s\n", id)
+		return nil
+	}
+
+	args := []string{"history", "undo", id}
+	if opts.Interactive {
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
+		return err
+	}
+	_, err := a.run(ctx, manager.Command{Name: pm, Args: append(args, ArgsAssumeYes), Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
+	return err
+}
+
+// dependencyQueries are the dnf repoquery options that list the relationships of a package, and their kind.
+var dependencyQueries = []struct {
+	option string
+	kind   manager.DependencyKind
+}{
+	{"--requires-pre", manager.DependencyPreDepends},
+	{"--requires", manager.DependencyDepends},
+	{"--recommends", manager.DependencyRecommends},
+	{"--suggests", manager.DependencySuggests},
+	{"--conflicts", manager.DependencyConflicts},
+	{"--provides", manager.DependencyProvides},
+}
+
+// reverseDependencyQueries are the dnf repoquery options that list the packages related to a package, and their kind.
+var reverseDependencyQueries = []struct {
+	option string
+	kind   manager.DependencyKind
+}{
+	{"--whatrequires", manager.DependencyDepends},
+	{"--whatrecommends", manager.DependencyRecommends},
+	{"--whatsuggests", manager.DependencySuggests},
+	{"--whatconflicts", manager.DependencyConflicts},
+}
+
+// Dependencies returns the relationships of the latest version of the specified package with other packages, using dnf repoquery.
+// dnf relates packages through capabilities, such as "libc.so.6()(64bit)", which are reported as the names of the dependencies.
+func (a *PackageManager) Dependencies(pkg string, opts *manager.Options) ([]manager.Dependency, error) {
+	return a.DependenciesContext(context.Background(), pkg, opts)
+}
+
+// DependenciesContext is like Dependencies but uses ctx to bound the dnf commands.
+func (a *PackageManager) DependenciesContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.Dependency, error) {
+	var dependencies []manager.Dependency
+	for _, q := range dependencyQueries {
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"repoquery", ArgsQuiet, "--latest-limit", "1", q.option, pkg}})
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, ParseRepoqueryDependenciesOutput(q.kind, string(res.Stdout), opts)...)
+	}
+
+	// every package provides itself, so a package without relationships does not exist
+	if len(dependencies) == 0 {
+		return nil, fmt.Errorf("%s: %w", pkg, manager.ErrPackageNotFound)
+	}
+	return dependencies, nil
+}
+
+// ReverseDependencies returns the installed packages that require, recommend, suggest or conflict with
+// the specified package, using dnf repoquery.
+func (a *PackageManager) ReverseDependencies(pkg string, opts *manager.Options) ([]manager.Dependency, error) {
+	return a.ReverseDependenciesContext(context.Background(), pkg, opts)
+}
+
+// ReverseDependenciesContext is like ReverseDependencies but uses ctx to bound the dnf commands.
+func (a *PackageManager) ReverseDependenciesContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.Dependency, error) {
+	var dependencies []manager.Dependency
+	for _, q := range reverseDependencyQueries {
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"repoquery", ArgsQuiet, "--installed", q.option, pkg, "--queryformat", "%{name}\n"}})
+		if err != nil {
+			return nil, err
+		}
+		dependencies = append(dependencies, ParseRepoqueryDependenciesOutput(q.kind, string(res.Stdout), opts)...)
+	}
+	return dependencies, nil
+}
+
+// OwnerOf returns the installed packages that own the file or directory at path, using rpm -qf.
+func (a *PackageManager) OwnerOf(path string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.OwnerOfContext(context.Background(), path, opts)
+}
+
+// OwnerOfContext is like OwnerOf but uses ctx to bound the rpm command.
+func (a *PackageManager) OwnerOfContext(ctx context.Context, path string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: "rpm", Args: []string{"-qf", "--queryformat", "%{NAME} %{ARCH} %{EVR}\n", path}})
+	if err != nil {
+		return nil, err
+	}
+	return ParseRpmQueryOutput(string(res.Stdout), opts), nil
+}
+
+// ListFiles returns the files shipped by the specified installed package, using rpm -ql.
+func (a *PackageManager) ListFiles(pkg string, opts *manager.Options) ([]string, error) {
+	return a.ListFilesContext(context.Background(), pkg, opts)
+}
+
+// ListFilesContext is like ListFiles but uses ctx to bound the rpm command.
+func (a *PackageManager) ListFilesContext(ctx context.Context, pkg string, opts *manager.Options) ([]string, error) {
+	res, err := a.run(ctx, manager.Command{Name: "rpm", Args: []string{"-ql", pkg}})
+	if err != nil {
+		return nil, err
+	}
+	return ParseListFilesOutput(string(res.Stdout), opts), nil
+}
+
+// InstallRequests installs the packages of reqs using dnf, as name-version.arch.
+// dnf cannot install from a given Source.
+func (a *PackageManager) InstallRequests(reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.InstallRequestsContext(context.Background(), reqs, opts)
+}
+
+// InstallRequestsContext is like InstallRequests but uses ctx to bound the dnf command.
+func (a *PackageManager) InstallRequestsContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	args := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		arg, err := InstallArg(req)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return a.InstallContext(ctx, args, opts)
+}
+
+// ListVersions lists the installed and available versions of the specified package, using dnf list --showduplicates.
+func (a *PackageManager) ListVersions(pkg string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.ListVersionsContext(context.Background(), pkg, opts)
+}
+
+// ListVersionsContext is like ListVersions but uses ctx to bound the dnf command.
+func (a *PackageManager) ListVersionsContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"list", ArgsQuiet, "--showduplicates", pkg}})
+	if err != nil {
+		return nil, err
+	}
+	return ParseShowDuplicatesOutput(string(res.Stdout), opts), nil
+}
+
+// Downgrade moves the packages of reqs to an older version using dnf downgrade: to the Version they request,
+// or to the previous version available in the repositories if Version is empty.
+// dnf cannot downgrade from a given Source.
+func (a *PackageManager) Downgrade(reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.DowngradeContext(context.Background(), reqs, opts)
+}
+
+// DowngradeContext is like Downgrade but uses ctx to bound the dnf commands.
+func (a *PackageManager) DowngradeContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	args := []string{"downgrade"}
+	for _, req := range reqs {
+		arg, err := InstallArg(req)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if opts == nil {
+		opts = &manager.Options{}
+	}
+	if opts.DryRun {
+		log.Printf("dnf: would downgrade %v\n", args[1:])
+		return nil, nil
+	}
+
+	return manager.TrackVersions(ctx, opts, a.ListInstalledContext, func() error {
+		if opts.Interactive {
+			_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
+			return err
+		}
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: append(args, ArgsAssumeYes), Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
+		return err
+	})
+}
+
+// UpgradeSecurity upgrades the installed packages that have a security advisory using dnf upgrade --security.
+// Packages locked by the versionlock plugin are not upgraded.
+func (a *PackageManager) UpgradeSecurity(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.UpgradeSecurityContext(context.Background(), opts)
+}
+
+// UpgradeSecurityContext is like UpgradeSecurity but uses ctx to bound the dnf command.
+func (a *PackageManager) UpgradeSecurityContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	if opts == nil {
+		opts = &manager.Options{}
+	}
+	if opts.DryRun {
+		log.Printf("dnf: would upgrade --security\n")
+		return nil, nil
+	}
+
+	args := []string{"upgrade", "--security"}
+	if opts.Interactive {
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
+		return nil, err
+	}
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: append(args, ArgsAssumeYes), Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
+	if err != nil {
+		return nil, err
+	}
+	return ParseInstallOutput(string(res.Stdout), opts), nil
+}
+
+// PackageFileTypes returns the types of the package files dnf installs: .rpm packages.
+func (a *PackageManager) PackageFileTypes() []manager.PackageFileType {
+	return []manager.PackageFileType{manager.PackageFileRPM}
+}
+
+// InstallFiles installs the .rpm packages at paths using dnf install, which installs their dependencies from the repositories.
+// dnf takes the arguments that end with .rpm as files, so the paths must have that extension.
+func (a *PackageManager) InstallFiles(paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.InstallFilesContext(context.Background(), paths, opts)
+}
+
+// InstallFilesContext is like InstallFiles but uses ctx to bound the dnf command.
+func (a *PackageManager) InstallFilesContext(ctx context.Context, paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	args := make([]string, 0, len(paths))
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, abs)
+	}
+	return a.InstallContext(ctx, args, opts)
+}
+
+// StateFiles returns the files under Root that change with the packages: the rpm database, at its current
+// and former locations, the dnf history, and the directory of the solv files dnf rebuilds when the metadata changes.
+func (a *PackageManager) StateFiles() []string {
+	return []string{
+		a.path("usr/lib/sysimage/rpm/rpmdb.sqlite"),
+		a.path("var/lib/rpm/rpmdb.sqlite"),
+		a.path("var/lib/rpm/Packages"),
+		a.path("var/lib/dnf/history.sqlite"),
+		a.path("var/cache/dnf"),
+	}
+}
@@ -0,0 +1,265 @@
+package dnf_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/dnf"
+	"github.com/sjwhyte/syspkg/manager/runnertest"
+)
+
+func TestGetPackageInfoArgs(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{},
+		runnertest.Response{Stdout: packageInfo},
+	)
+	dnfManager := &dnf.PackageManager{Runner: runner}
+
+	pkg, err := dnfManager.GetPackageInfo("gzip", &manager.Options{})
+	if err != nil {
+		t.Fatalf("GetPackageInfo() error: %+v", err)
+	}
+
+	wantArgv := [][]string{{"dnf", "update"}, {"dnf", "info", "gzip"}}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("GetPackageInfo() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+	if pkg.Name != "gzip" || pkg.Version != "1.9-13.el8_5" {
+		t.Errorf("GetPackageInfo() = %+v, want gzip 1.9-13.el8_5", pkg)
+	}
+}
+
+func TestFindWithoutOptions(t *testing.T) {
+	runner := runnertest.New(runnertest.Response{Stdout: findOutput})
+	dnfManager := &dnf.PackageManager{Runner: runner}
+
+	if _, err := dnfManager.Find([]string{"vim"}, nil); err != nil {
+		t.Fatalf("Find() error: %+v", err)
+	}
+	if want := [][]string{{"dnf", "search", "vim"}}; !reflect.DeepEqual(runner.Argv(), want) {
+		t.Errorf("Find() ran %+v, want %+v", runner.Argv(), want)
+	}
+}
+
+func TestInstallErrors(t *testing.T) {
+	tests := []struct {
+		exitCode int
+		stderr   string
+		want     error
+	}{
+		{1, "Error: Unable to find a match: nosuchpackage\n", manager.ErrPackageNotFound},
+		{1, "Error: This command has to be run with superuser privileges (under the root user on most systems).\n", manager.ErrPermissionDenied},
+		{200, "", manager.ErrLocked},
+		{1, "Error: \n Problem: conflicting requests\n  - nothing provides libfoo.so.1()(64bit) needed by bar-1.0-1.x86_64\n", manager.ErrDependencyConflict},
+		{1, "Error: Failed to download metadata for repo 'appstream': Cannot download repomd.xml\n", manager.ErrNetwork},
+		{1, "Error: Transaction test error:\n  installing package kernel needs 37MB more space on the /boot filesystem\n", manager.ErrDiskFull},
+	}
+	for _, tt := range tests {
+		runner := runnertest.New(runnertest.Response{Stderr: tt.stderr, ExitCode: tt.exitCode})
+		dnfManager := &dnf.PackageManager{Runner: runner}
+
+		_, err := dnfManager.Install([]string{"vim"}, nil)
+
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Install() with exit code %d and stderr %q: error = %+v, want %+v", tt.exitCode, tt.stderr, err, tt.want)
+		}
+	}
+}
+
+func TestListInstalledArgs(t *testing.T) {
+	runner := runnertest.New(runnertest.Response{Stdout: "Installed Packages\nbash.x86_64    5.1.8-6.el9    @anaconda\n"})
+	dnfManager := &dnf.PackageManager{Runner: runner}
+
+	pkgs, err := dnfManager.ListInstalled(nil)
+	if err != nil {
+		t.Fatalf("ListInstalled() error: %+v", err)
+	}
+
+	wantArgv := [][]string{{"dnf", "list", "installed"}}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("ListInstalled() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "bash" || pkgs[0].Version != "5.1.8-6.el9" {
+		t.Errorf("ListInstalled() = %+v, want bash 5.1.8-6.el9", pkgs)
+	}
+}
+
+func TestUndoLastTransaction(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "ID     | Command line             | Date and time    | Action(s)      | Altered\n-------------------------------------------------------------------------------\n     7 | install vim              | 2024-03-02 10:12 | Install        |    2\n     6 | upgrade                  | 2024-02-28 09:40 | Upgrade        |   31 EE\n"},
+		runnertest.Response{},
+	)
+	dnfManager := &dnf.PackageManager{Runner: runner}
+
+	id, err := dnfManager.LastTransaction(nil)
+	if err != nil || id != "7" {
+		t.Fatalf("LastTransaction() = %q, %v, want 7", id, err)
+	}
+	if err := dnfManager.UndoTransaction(id, nil); err != nil {
+		t.Fatalf("UndoTransaction() error: %+v", err)
+	}
+
+	wantArgv := [][]string{{"dnf", "history", "list"}, {"dnf", "history", "undo", "7", "-y"}}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("LastTransaction() and UndoTransaction() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+
+	if id := dnf.ParseHistoryListOutput("No transaction 'last' found\n", nil); id != "" {
+		t.Errorf("ParseHistoryListOutput() of an empty history = %q, want none", id)
+	}
+}
+
+func TestDowngrade(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "Installed Packages\nvim-enhanced.x86_64    2:9.0.2120-1.fc39    @updates\n"},
+		runnertest.Response{},
+		runnertest.Response{Stdout: "Installed Packages\nvim-enhanced.x86_64    2:9.0.1927-1.fc39    @fedora\n"},
+	)
+	dnfManager := &dnf.PackageManager{Runner: runner}
+
+	pkgs, err := dnfManager.Downgrade([]manager.InstallRequest{{Name: "vim-enhanced"}}, nil)
+	if err != nil {
+		t.Fatalf("Downgrade() error: %+v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "vim-enhanced" || pkgs[0].Version != "2:9.0.2120-1.fc39" || pkgs[0].NewVersion != "2:9.0.1927-1.fc39" {
+		t.Errorf("Downgrade() = %+v, want vim-enhanced 2:9.0.2120-1.fc39 -> 2:9.0.1927-1.fc39", pkgs)
+	}
+	if _, err := dnfManager.Downgrade([]manager.InstallRequest{{Name: "vim-enhanced", Source: "fedora"}}, nil); !errors.Is(err, manager.ErrUnsupported) {
+		t.Errorf("Downgrade() with a source: error = %v, want %v", err, manager.ErrUnsupported)
+	}
+
+	wantArgv := [][]string{{"dnf", "list", "installed"}, {"dnf", "downgrade", "vim-enhanced", "-y"}, {"dnf", "list", "installed"}}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("Downgrade() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+}
+
+func TestUpgradeAll(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{},
+		runnertest.Response{Stdout: "Upgraded:\n  vim-enhanced-2:9.1.031-1.fc39.x86_64\n"},
+	)
+	dnfManager := &dnf.PackageManager{Runner: runner}
+
+	if _, err := dnfManager.UpgradeAll([]string{"vim-enhanced"}, nil); err != nil {
+		t.Fatalf("UpgradeAll() error: %+v", err)
+	}
+
+	// without a terminal, dnf must not wait for a confirmation
+	wantArgv := [][]string{
+		{"dnf", "versionlock", "-q", "list"},
+		{"dnf", "upgrade", "vim-enhanced", "-y"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("UpgradeAll() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+}
+
+func TestUpgradeSecurity(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "Available Upgrades\ncurl.x86_64    8.2.1-4.fc39    updates\nkernel-core.x86_64    6.7.5-200.fc39    updates\nvim-enhanced.x86_64    2:9.1.031-1.fc39    updates\n"},
+		runnertest.Response{Stdout: "curl x86_64 8.2.1-3.fc39\nkernel-core x86_64 6.6.8-200.fc39\nvim-enhanced x86_64 2:9.0.2120-1.fc39\n"},
+		runnertest.Response{},
+		runnertest.Response{Stdout: "FEDORA-2024-1b2c3d4e5f Low/Sec.       curl-8.2.1-4.fc39.x86_64\nFEDORA-2024-3e0b5b6fb9 Important/Sec. curl-8.2.1-4.fc39.x86_64\nFEDORA-2024-0f1e2d3c4b bugfix         kernel-core-6.7.5-200.fc39.x86_64\n"},
+		runnertest.Response{},
+	)
+	dnfManager := &dnf.PackageManager{Runner: runner}
+
+	pkgs, err := dnfManager.ListUpgradable(nil)
+	if err != nil {
+		t.Fatalf("ListUpgradable() error: %+v", err)
+	}
+	want := []struct {
+		updateType manager.UpdateType
+		severity   string
+	}{{manager.UpdateTypeSecurity, "Important"}, {manager.UpdateTypeBugfix, ""}, {manager.UpdateTypeUnknown, ""}}
+	if len(pkgs) != len(want) {
+		t.Fatalf("ListUpgradable() = %+v, want %d packages", pkgs, len(want))
+	}
+	for i, w := range want {
+		if pkgs[i].UpdateType != w.updateType || pkgs[i].Severity != w.severity {
+			t.Errorf("ListUpgradable() = %s %q %q, want %q %q", pkgs[i].Name, pkgs[i].UpdateType, pkgs[i].Severity, w.updateType, w.severity)
+		}
+	}
+
+	if _, err := dnfManager.UpgradeSecurity(nil); err != nil {
+		t.Fatalf("UpgradeSecurity() error: %+v", err)
+	}
+
+	wantArgv := [][]string{
+		{"dnf", "list", "-q", "--upgrades"},
+		{"rpm", "-q", "--queryformat", "%{NAME} %{ARCH} %{EVR}\n", "curl", "kernel-core", "vim-enhanced"},
+		{"dnf", "versionlock", "-q", "list"},
+		{"dnf", "updateinfo", "list", "-q"},
+		{"dnf", "upgrade", "--security", "-y"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("ListUpgradable() and UpgradeSecurity() ran %+v, want %+v", runner.Argv(), wantArgv)
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "/bin/sh\n"},
+		runnertest.Response{Stdout: "glibc >= 2.34\nlibc.so.6()(64bit)\nlibc.so.6()(64bit)\n"},
+		runnertest.Response{},
+		runnertest.Response{},
+		runnertest.Response{},
+		runnertest.Response{Stdout: "curl = 7.76.1-26.el9\ncurl(x86-64) = 7.76.1-26.el9\n"},
+	)
+	dnfManager := &dnf.PackageManager{Runner: runner}
+
+	deps, err := dnfManager.Dependencies("curl", nil)
+	if err != nil {
+		t.Fatalf("Dependencies() error: %+v", err)
+	}
+
+	want := []manager.Dependency{
+		{Kind: manager.DependencyPreDepends, Name: "/bin/sh"},
+		{Kind: manager.DependencyDepends, Name: "glibc", Constraint: ">= 2.34"},
+		{Kind: manager.DependencyDepends, Name: "libc.so.6()(64bit)"},
+		{Kind: manager.DependencyProvides, Name: "curl", Constraint: "= 7.76.1-26.el9"},
+		{Kind: manager.DependencyProvides, Name: "curl(x86-64)", Constraint: "= 7.76.1-26.el9"},
+	}
+	if !reflect.DeepEqual(deps, want) {
+		t.Errorf("Dependencies() = %+v, want %+v", deps, want)
+	}
+	if argv := runner.Argv(); len(argv) != 6 || !reflect.DeepEqual(argv[1], []string{"dnf", "repoquery", "-q", "--latest-limit", "1", "--requires", "curl"}) {
+		t.Errorf("Dependencies() ran %+v, want one dnf repoquery per kind of dependency", argv)
+	}
+
+	runner = runnertest.New(runnertest.Response{}, runnertest.Response{}, runnertest.Response{}, runnertest.Response{}, runnertest.Response{}, runnertest.Response{})
+	dnfManager = &dnf.PackageManager{Runner: runner}
+	if _, err := dnfManager.Dependencies("nosuchpackage", nil); !errors.Is(err, manager.ErrPackageNotFound) {
+		t.Errorf("Dependencies() of an unknown package: error = %+v, want %+v", err, manager.ErrPackageNotFound)
+	}
+}
+
+func TestOwnerOfListFiles(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "bash x86_64 5.1.8-6.el9\n"},
+		runnertest.Response{Stdout: "file /usr/bin/foo is not owned by any package\n", ExitCode: 1},
+		runnertest.Response{Stdout: "/usr/bin/bash\n/usr/bin/sh\n"},
+	)
+	dnfManager := &dnf.PackageManager{Runner: runner}
+
+	pkgs, err := dnfManager.OwnerOf("/usr/bin/bash", nil)
+	want := []manager.PackageInfo{{Name: "bash", Arch: "x86_64", Version: "5.1.8-6.el9", Status: manager.PackageStatusInstalled, PackageManager: "dnf"}}
+	if err != nil || !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("OwnerOf() = %+v, %v, want %+v", pkgs, err, want)
+	}
+
+	if _, err := dnfManager.OwnerOf("/usr/bin/foo", nil); !errors.Is(err, manager.ErrPackageNotFound) {
+		t.Errorf("OwnerOf() of a file without package: error = %+v, want %+v", err, manager.ErrPackageNotFound)
+	}
+
+	files, err := dnfManager.ListFiles("bash", nil)
+	if wantFiles := []string{"/usr/bin/bash", "/usr/bin/sh"}; err != nil || !reflect.DeepEqual(files, wantFiles) {
+		t.Errorf("ListFiles() = %+v, %v, want %+v", files, err, wantFiles)
+	}
+	if argv := runner.Argv(); !reflect.DeepEqual(argv[2], []string{"rpm", "-ql", "bash"}) {
+		t.Errorf("ListFiles() ran %+v, want rpm -ql bash", argv[2])
+	}
+}
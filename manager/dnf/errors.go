@@ -0,0 +1,20 @@
+package dnf
+
+import (
+	"regexp"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// errorRules classify the failures of dnf and rpm, checked in order.
+// dnf exits with status 200 when it cannot acquire its lock, and with status 1 for most other errors.
+var errorRules = []manager.ErrorRule{
+	{Kind: manager.ErrLocked, ExitCode: 200},
+	{Kind: manager.ErrUnsupported, Pattern: regexp.MustCompile(`No such command: versionlock|Unknown argument "versionlock"`)},
+	{Kind: manager.ErrPermissionDenied, Pattern: regexp.MustCompile(`has to be run with superuser privileges|Permission denied`)},
+	{Kind: manager.ErrLocked, Pattern: regexp.MustCompile(`Waiting for process with pid|another copy is running|Failed to obtain the transaction lock|can't create transaction lock`)},
+	{Kind: manager.ErrDiskFull, Pattern: regexp.MustCompile(`Disk Requirements|needs .* more space on the|No space left on device`)},
+	{Kind: manager.ErrPackageNotFound, Pattern: regexp.MustCompile(`No match for argument|Unable to find a match|No matching Packages|No package .* available|No packages marked for|is not owned by any package|is not installed`)},
+	{Kind: manager.ErrDependencyConflict, Pattern: regexp.MustCompile(`conflicting requests|nothing provides|conflicts with|requires .* but none of the providers can be installed|Depsolve Error`)},
+	{Kind: manager.ErrNetwork, Pattern: regexp.MustCompile(`Failed to download metadata|Cannot download|Curl error|Could not resolve host|All mirrors were tried|Cannot retrieve repository|GPG check FAILED`)},
+}
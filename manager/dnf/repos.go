@@ -0,0 +1,307 @@
+package dnf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// reposDir is the directory of the .repo files, relative to the Root of the package manager.
+const reposDir = "etc/yum.repos.d"
+
+// path returns the path of the file at the given path relative to the Root of the package manager.
+func (a *PackageManager) path(name string) string {
+	root := a.Root
+	if root == "" {
+		root = "/"
+	}
+	return filepath.Join(root, name)
+}
+
+// repoFiles returns the .repo files, sorted by name.
+func (a *PackageManager) repoFiles() ([]string, error) {
+	entries, err := os.ReadDir(a.path(reposDir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".repo" {
+			files = append(files, filepath.Join(a.path(reposDir), entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// findRepo returns the .repo file that defines the repository with the given name, and its content.
+func (a *PackageManager) findRepo(name string) (string, string, error) {
+	files, err := a.repoFiles()
+	if err != nil {
+		return "", "", err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", "", err
+		}
+		for _, repo := range ParseRepoFile(string(data)) {
+			if repo.Name == name {
+				return file, string(data), nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("%s: %w", name, manager.ErrRepositoryNotFound)
+}
+
+// ListRepositories returns the repositories defined in the .repo files of /etc/yum.repos.d.
+func (a *PackageManager) ListRepositories(opts *manager.Options) ([]manager.Repository, error) {
+	return a.ListRepositoriesContext(context.Background(), opts)
+}
+
+// ListRepositoriesContext is like ListRepositories. It does not run any command.
+func (a *PackageManager) ListRepositoriesContext(ctx context.Context, opts *manager.Options) ([]manager.Repository, error) {
+	files, err := a.repoFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var repos []manager.Repository
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range ParseRepoFile(string(data)) {
+			repo.File = file
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
+}
+
+// AddRepository validates repo, then writes it to /etc/yum.repos.d/<name>.repo.
+// Its Key, if any, must be a URL, such as file:///etc/pki/rpm-gpg/RPM-GPG-KEY-docker; it turns on the GPG check.
+func (a *PackageManager) AddRepository(repo manager.Repository, opts *manager.Options) error {
+	return a.AddRepositoryContext(context.Background(), repo, opts)
+}
+
+// AddRepositoryContext is like AddRepository. It does not run any command.
+func (a *PackageManager) AddRepositoryContext(ctx context.Context, repo manager.Repository, opts *manager.Options) error {
+	if err := repo.Validate(); err != nil {
+		return err
+	}
+	if len(repo.Types)+len(repo.Suites)+len(repo.Components)+len(repo.Architectures) > 0 {
+		return fmt.Errorf("repository %s: dnf repositories have no types, suites, components nor architectures", repo.Name)
+	}
+	if repo.Key != "" {
+		if u, err := url.Parse(repo.Key); err != nil || !u.IsAbs() {
+			return fmt.Errorf("repository %s: the key %s must be a URL, such as file:///etc/pki/rpm-gpg/KEY", repo.Name, repo.Key)
+		}
+	}
+	if _, _, err := a.findRepo(repo.Name); err == nil {
+		return fmt.Errorf("repository %s already exists", repo.Name)
+	}
+
+	file := filepath.Join(a.path(reposDir), repo.Name+".repo")
+	if opts != nil && opts.DryRun {
+		log.Printf("dnf: would write %s:\n%s", file, FormatRepo(repo))
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(FormatRepo(repo)), 0o644)
+}
+
+// RemoveRepository removes the repository with the given name from its .repo file, and removes the file
+// if it defines no other repository.
+func (a *PackageManager) RemoveRepository(name string, opts *manager.Options) error {
+	return a.RemoveRepositoryContext(context.Background(), name, opts)
+}
+
+// RemoveRepositoryContext is like RemoveRepository. It does not run any command.
+func (a *PackageManager) RemoveRepositoryContext(ctx context.Context, name string, opts *manager.Options) error {
+	file, content, err := a.findRepo(name)
+	if err != nil {
+		return err
+	}
+
+	var kept []string
+	in := false
+	for _, line := range strings.Split(content, "\n") {
+		if section, ok := sectionName(line); ok {
+			in = section == name
+		}
+		if !in {
+			kept = append(kept, line)
+		}
+	}
+	content = strings.Join(kept, "\n")
+
+	if opts != nil && opts.DryRun {
+		log.Printf("dnf: would remove repository %s from %s\n", name, file)
+		return nil
+	}
+	if len(ParseRepoFile(content)) == 0 {
+		return os.Remove(file)
+	}
+	return writeFile(file, content)
+}
+
+// SetRepositoryEnabled enables or disables the repository with the given name, by setting its enabled option.
+func (a *PackageManager) SetRepositoryEnabled(name string, enabled bool, opts *manager.Options) error {
+	return a.SetRepositoryEnabledContext(context.Background(), name, enabled, opts)
+}
+
+// SetRepositoryEnabledContext is like SetRepositoryEnabled. It does not run any command.
+func (a *PackageManager) SetRepositoryEnabledContext(ctx context.Context, name string, enabled bool, opts *manager.Options) error {
+	file, content, err := a.findRepo(name)
+	if err != nil {
+		return err
+	}
+
+	option := "enabled=0"
+	if enabled {
+		option = "enabled=1"
+	}
+	var lines []string
+	in, set := false, false
+	for _, line := range strings.Split(content, "\n") {
+		if section, ok := sectionName(line); ok {
+			in = section == name
+			lines = append(lines, line)
+			if in {
+				// the option is set right after the section header, and any other enabled option of the section is dropped
+				lines = append(lines, option)
+				set = true
+			}
+			continue
+		}
+		if key, _, ok := strings.Cut(line, "="); in && ok && strings.TrimSpace(key) == "enabled" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if !set {
+		return fmt.Errorf("%s: %w", name, manager.ErrRepositoryNotFound)
+	}
+	content = strings.Join(lines, "\n")
+
+	if opts != nil && opts.DryRun {
+		log.Printf("dnf: would write %s:\n%s", file, content)
+		return nil
+	}
+	return writeFile(file, content)
+}
+
+// writeFile replaces the content of file, keeping its permissions.
+func writeFile(file, content string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, []byte(content), info.Mode().Perm())
+}
+
+// sectionName returns the name of the section that line starts, and whether it starts one.
+func sectionName(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+		return "", false
+	}
+	return strings.TrimSpace(line[1 : len(line)-1]), true
+}
+
+// ParseRepoFile parses the repositories of a .repo file. Their URLs are the ones of the baseurl option,
+// or else of the metalink or mirrorlist option. Example content:
+//
+//	[docker-ce-stable]
+//	name=Docker CE Stable - $basearch
+//	baseurl=https://download.docker.com/linux/centos/$releasever/$basearch/stable
+//	enabled=1
+//	gpgcheck=1
+//	gpgkey=https://download.docker.com/linux/centos/gpg
+func ParseRepoFile(content string) []manager.Repository {
+	var repos []manager.Repository
+	var options []map[string]string
+
+	var key string
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+		if name, ok := sectionName(line); ok {
+			repos = append(repos, manager.Repository{Name: name})
+			options = append(options, make(map[string]string))
+			key = ""
+			continue
+		}
+		if len(repos) == 0 {
+			continue
+		}
+		current := options[len(options)-1]
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && key != "" {
+			// continuation of a multi-line value, such as a list of URLs
+			current[key] += " " + trimmed
+			continue
+		}
+		k, v, ok := strings.Cut(trimmed, "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(k)
+		current[key] = strings.TrimSpace(v)
+	}
+
+	for i := range repos {
+		o := options[i]
+		repos[i].Title = o["name"]
+		for _, key := range []string{"baseurl", "metalink", "mirrorlist"} {
+			if o[key] != "" {
+				repos[i].URLs = strings.FieldsFunc(o[key], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+				break
+			}
+		}
+		switch strings.ToLower(o["enabled"]) {
+		case "0", "false", "no", "off":
+			repos[i].Disabled = true
+		}
+		repos[i].Key = o["gpgkey"]
+	}
+	return repos
+}
+
+// FormatRepo returns repo as a section of a .repo file.
+func FormatRepo(repo manager.Repository) string {
+	title := repo.Title
+	if title == "" {
+		title = repo.Name
+	}
+	enabled := 1
+	if repo.Disabled {
+		enabled = 0
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]\n", repo.Name)
+	fmt.Fprintf(&b, "name=%s\n", title)
+	fmt.Fprintf(&b, "baseurl=%s\n", strings.Join(repo.URLs, " "))
+	fmt.Fprintf(&b, "enabled=%d\n", enabled)
+	if repo.Key != "" {
+		b.WriteString("gpgcheck=1\n")
+		fmt.Fprintf(&b, "gpgkey=%s\n", repo.Key)
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package dnf_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/dnf"
+)
+
+func TestParseRepoFile(t *testing.T) {
+	content := `[fedora]
+name=Fedora $releasever - $basearch
+#baseurl=http://download.example/pub/fedora/linux/releases/$releasever/Everything/$basearch/os/
+metalink=https://mirrors.fedoraproject.org/metalink?repo=fedora-$releasever&arch=$basearch
+enabled=1
+gpgcheck=1
+gpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-fedora-$releasever-$basearch
+
+[fedora-debuginfo]
+name=Fedora $releasever - $basearch - Debug
+baseurl=https://mirror1.example/fedora/debug/
+  https://mirror2.example/fedora/debug/
+enabled=0
+`
+	want := []manager.Repository{
+		{Name: "fedora", Title: "Fedora $releasever - $basearch", URLs: []string{"https://mirrors.fedoraproject.org/metalink?repo=fedora-$releasever&arch=$basearch"}, Key: "file:///etc/pki/rpm-gpg/RPM-GPG-KEY-fedora-$releasever-$basearch"},
+		{Name: "fedora-debuginfo", Title: "Fedora $releasever - $basearch - Debug", URLs: []string{"https://mirror1.example/fedora/debug/", "https://mirror2.example/fedora/debug/"}, Disabled: true},
+	}
+	if got := dnf.ParseRepoFile(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseRepoFile() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRepositories(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "etc/yum.repos.d")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fedora.repo"), []byte("[fedora]\nname=Fedora\nbaseurl=https://example.com/fedora/\n\n[fedora-source]\nname=Fedora Source\nbaseurl=https://example.com/fedora/source/\nenabled=0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dnfManager := &dnf.PackageManager{Root: root}
+
+	docker := manager.Repository{
+		Name:  "docker-ce-stable",
+		Title: "Docker CE Stable",
+		URLs:  []string{"https://download.docker.com/linux/fedora/$releasever/$basearch/stable"},
+		Key:   "https://download.docker.com/linux/fedora/gpg",
+	}
+	invalid := []manager.Repository{
+		{Name: "docker-ce-stable", URLs: docker.URLs, Suites: []string{"stable"}},
+		{Name: "docker-ce-stable", URLs: docker.URLs, Key: "/etc/pki/rpm-gpg/docker"},
+		{Name: "fedora", URLs: docker.URLs},
+	}
+	for _, repo := range invalid {
+		if err := dnfManager.AddRepository(repo, nil); err == nil {
+			t.Errorf("AddRepository(%+v) error = nil, want an error", repo)
+		}
+	}
+
+	if err := dnfManager.AddRepository(docker, nil); err != nil {
+		t.Fatalf("AddRepository() error = %v", err)
+	}
+	if err := dnfManager.SetRepositoryEnabled("docker-ce-stable", false, nil); err != nil {
+		t.Fatalf("SetRepositoryEnabled(false) error = %v", err)
+	}
+	if err := dnfManager.SetRepositoryEnabled("fedora-source", true, nil); err != nil {
+		t.Fatalf("SetRepositoryEnabled(true) error = %v", err)
+	}
+
+	repos, err := dnfManager.ListRepositories(nil)
+	if err != nil {
+		t.Fatalf("ListRepositories() error = %v", err)
+	}
+	docker.Disabled = true
+	docker.File = filepath.Join(dir, "docker-ce-stable.repo")
+	want := []manager.Repository{
+		docker,
+		{Name: "fedora", Title: "Fedora", URLs: []string{"https://example.com/fedora/"}, File: filepath.Join(dir, "fedora.repo")},
+		{Name: "fedora-source", Title: "Fedora Source", URLs: []string{"https://example.com/fedora/source/"}, File: filepath.Join(dir, "fedora.repo")},
+	}
+	if !reflect.DeepEqual(repos, want) {
+		t.Errorf("ListRepositories() = %+v, want %+v", repos, want)
+	}
+
+	if err := dnfManager.RemoveRepository("fedora-source", nil); err != nil {
+		t.Fatalf("RemoveRepository() error = %v", err)
+	}
+	if err := dnfManager.RemoveRepository("docker-ce-stable", nil); err != nil {
+		t.Fatalf("RemoveRepository() error = %v", err)
+	}
+	if _, err := os.Stat(docker.File); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("RemoveRepository() left %s, want it removed with its only repository", docker.File)
+	}
+	if repos, _ := dnfManager.ListRepositories(nil); len(repos) != 1 || repos[0].Name != "fedora" {
+		t.Errorf("ListRepositories() after RemoveRepository() = %+v, want only fedora", repos)
+	}
+	if err := dnfManager.SetRepositoryEnabled("docker-ce-stable", true, nil); !errors.Is(err, manager.ErrRepositoryNotFound) {
+		t.Errorf("SetRepositoryEnabled() of a removed repository: error = %v, want %v", err, manager.ErrRepositoryNotFound)
+	}
+}
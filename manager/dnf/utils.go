@@ -1,9 +1,11 @@
 package dnf
 
 import (
+	"fmt"
 	"github.com/sjwhyte/syspkg/manager"
 	"log"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
@@ -252,3 +254,422 @@ func ParseUpgradedPackageInfoOutput(msg string, opts *manager.Options) []manager
 	}
 	return pi
 }
+
+// dnfTransactionSteps maps the transaction steps printed by dnf to the progress phase and event type they stand for.
+var dnfTransactionSteps = map[string]struct {
+	phase     manager.ProgressPhase
+	eventType manager.ProgressEventType
+}{
+	"Installing":        {manager.ProgressPhaseInstalling, manager.ProgressPackageStarted},
+	"Upgrading":         {manager.ProgressPhaseInstalling, manager.ProgressPackageStarted},
+	"Downgrading":       {manager.ProgressPhaseInstalling, manager.ProgressPackageStarted},
+	"Reinstalling":      {manager.ProgressPhaseInstalling, manager.ProgressPackageStarted},
+	"Erasing":           {manager.ProgressPhaseRemoving, manager.ProgressPackageStarted},
+	"Removing":          {manager.ProgressPhaseRemoving, manager.ProgressPackageStarted},
+	"Obsoleting":        {manager.ProgressPhaseRemoving, manager.ProgressStatus},
+	"Cleanup":           {manager.ProgressPhaseRemoving, manager.ProgressStatus},
+	"Running scriptlet": {manager.ProgressPhaseConfiguring, manager.ProgressStatus},
+	"Verifying":         {manager.ProgressPhaseVerifying, manager.ProgressPackageFinished},
+}
+
+// NewProgressParser returns a manager.ProgressParser for the download and transaction lines printed by dnf.
+// Other lines are ignored. Example lines:
+//
+//	(1/2): corelight-selinux-27.11.1-1.el8.noarch.rpm   12 MB/s | 1.2 MB     00:00
+//	  Upgrading        : corelight-selinux-27.11.1-1.el8.noarch             1/4
+//	  Running scriptlet: corelight-selinux-27.11.1-1.el8.noarch             1/4
+//	  Verifying        : corelight-selinux-27.11.1-1.el8.noarch             1/4
+func NewProgressParser() manager.ProgressParser {
+	downloadPattern := regexp.MustCompile(`^\((\d+)/(\d+)\): (\S+)`)
+	stepPattern := regexp.MustCompile(`^\s+([A-Z][a-z]+(?: [a-z]+)?)\s*: (\S+)\s*(?:(\d+)/(\d+))?\s*$`)
+
+	return func(line string) []manager.ProgressEvent {
+		if match := downloadPattern.FindStringSubmatch(line); match != nil {
+			return []manager.ProgressEvent{{
+				Type:    manager.ProgressStatus,
+				Phase:   manager.ProgressPhaseDownloading,
+				Package: packageName(strings.TrimSuffix(match[3], ".rpm")),
+				Percent: percentOf(match[1], match[2]),
+				Message: strings.TrimSpace(line),
+			}}
+		}
+
+		match := stepPattern.FindStringSubmatch(line)
+		if match == nil {
+			return nil
+		}
+		step, ok := dnfTransactionSteps[match[1]]
+		if !ok {
+			return nil
+		}
+		status := manager.ProgressEvent{
+			Type:    manager.ProgressStatus,
+			Phase:   step.phase,
+			Package: packageName(match[2]),
+			Percent: percentOf(match[3], match[4]),
+			Message: strings.TrimSpace(line),
+		}
+		if step.eventType == manager.ProgressStatus {
+			return []manager.ProgressEvent{status}
+		}
+		event := status
+		event.Type = step.eventType
+		if step.eventType == manager.ProgressPackageStarted {
+			return []manager.ProgressEvent{event, status}
+		}
+		return []manager.ProgressEvent{status, event}
+	}
+}
+
+// packageName returns the name of the package from its name-[epoch:]version-release.arch string,
+// or nevra as is if it does not look like one.
+func packageName(nevra string) string {
+	parts := strings.Split(nevra, "-")
+	if len(parts) < 3 {
+		return nevra
+	}
+	return strings.Join(parts[:len(parts)-2], "-")
+}
+
+// percentOf returns the percentage n is of total, or -1 if either is not a number.
+func percentOf(n, total string) float64 {
+	a, errA := strconv.Atoi(n)
+	b, errB := strconv.Atoi(total)
+	if errA != nil || errB != nil || b == 0 {
+		return -1
+	}
+	return float64(a) * 100 / float64(b)
+}
+
+// ParseAutoInstalledOutput parses the output of `dnf repoquery --installed --queryformat "%{name} %{arch} %{evr} %{reason}\n"`
+// and returns the packages that were installed as dependencies: the ones whose reason is "dependency",
+// "weak-dependency" or "clean". Example msg:
+//
+//	bash x86_64 5.1.8-6.el9 user
+//	glibc x86_64 2.34-60.el9 dependency
+//	langpacks-core-en noarch 3.0-16.el9 weak-dependency
+func ParseAutoInstalledOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, line := range strings.Split(msg, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		switch fields[3] {
+		case "dependency", "weak-dependency", "clean":
+			packages = append(packages, manager.PackageInfo{
+				Name:           fields[0],
+				Arch:           fields[1],
+				Version:        fields[2],
+				Status:         manager.PackageStatusInstalled,
+				PackageManager: pm,
+			})
+		}
+	}
+
+	return packages
+}
+
+// ParseHistoryListOutput parses the output of `dnf history list` and returns the ID of the last transaction,
+// or an empty string if there is none. Example msg:
+//
+//	ID     | Command line             | Date and time    | Action(s)      | Altered
+//	-------------------------------------------------------------------------------
+//	     7 | install vim              | 2024-03-02 10:12 | Install        |    2
+//	     6 | upgrade                  | 2024-02-28 09:40 | Upgrade        |   31 EE
+func ParseHistoryListOutput(msg string, opts *manager.Options) string {
+	last := 0
+	for _, line := range strings.Split(msg, "\n") {
+		fields := strings.Fields(strings.ReplaceAll(line, "|", " "))
+		if len(fields) == 0 {
+			continue
+		}
+		if id, err := strconv.Atoi(fields[0]); err == nil && id > last {
+			last = id
+		}
+	}
+	if last == 0 {
+		return ""
+	}
+	return strconv.Itoa(last)
+}
+
+// ParseRepoqueryDependenciesOutput parses the output of `dnf repoquery --requires packageName`, or of the other
+// dependency queries, and returns the capabilities it lists as dependencies of the given kind. Example msg:
+//
+//	/bin/sh
+//	glibc >= 2.34
+//	libcurl(x86-64) = 7.76.1-26.el9
+//	libc.so.6()(64bit)
+func ParseRepoqueryDependenciesOutput(kind manager.DependencyKind, msg string, opts *manager.Options) []manager.Dependency {
+	var dependencies []manager.Dependency
+	seen := make(map[string]bool)
+
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || seen[line] {
+			continue
+		}
+		seen[line] = true
+
+		dep := manager.Dependency{Kind: kind, Name: line}
+		if fields := strings.Fields(line); len(fields) == 3 && strings.Trim(fields[1], "<>=") == "" {
+			dep.Name = fields[0]
+			dep.Constraint = fields[1] + " " + fields[2]
+		}
+		dependencies = append(dependencies, dep)
+	}
+
+	return dependencies
+}
+
+// ParseRpmQueryOutput parses the output of `rpm -q --queryformat "%{NAME} %{ARCH} %{EVR}\n"`, such as the one of
+// `rpm -qf path`, and returns the installed packages it lists. Example msg:
+//
+//	bash x86_64 5.1.8-6.el9
+//	glibc-common x86_64 2.34-60.el9
+func ParseRpmQueryOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, line := range strings.Split(msg, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		packages = append(packages, manager.PackageInfo{
+			Name:           fields[0],
+			Arch:           fields[1],
+			Version:        fields[2],
+			Status:         manager.PackageStatusInstalled,
+			PackageManager: pm,
+		})
+	}
+
+	return packages
+}
+
+// ParseListFilesOutput parses the output of `rpm -ql packageName` and returns the files of the package.
+// A package without files is listed as "(contains no files)". Example msg:
+//
+//	/usr/bin/curl
+//	/usr/share/doc/curl
+//	/usr/share/man/man1/curl.1.gz
+func ParseListFilesOutput(msg string, opts *manager.Options) []string {
+	var files []string
+
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "/") {
+			continue
+		}
+		files = append(files, line)
+	}
+
+	return files
+}
+
+// ParseListUpgradableOutput parses the output of `dnf list --upgrades` and returns the upgradable packages,
+// with their new version. dnf wraps the lines of long package names. Example msg:
+//
+//	Available Upgrades
+//	curl.x86_64                          8.2.1-4.fc39              updates
+//	python3-setuptools-wheel.noarch
+//	                                     67.7.2-7.fc39             updates
+func ParseListUpgradableOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, pkg := range parseListOutput(msg) {
+		pkg.NewVersion, pkg.Version = pkg.Version, ""
+		pkg.Status = manager.PackageStatusUpgradable
+		packages = append(packages, pkg)
+	}
+
+	return packages
+}
+
+// ParseShowDuplicatesOutput parses the output of `dnf list --showduplicates packageName` and returns the installed
+// and available versions of the package, with the repository they come from as Category. Example msg:
+//
+//	Installed Packages
+//	nginx.x86_64                 1:1.20.1-14.el9_2.1                 @appstream
+//	Available Packages
+//	nginx.x86_64                 1:1.20.1-10.el9                     appstream
+//	nginx.x86_64                 1:1.20.1-14.el9_2.1                 appstream
+func ParseShowDuplicatesOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, pkg := range parseListOutput(msg) {
+		pkg.Status = manager.PackageStatusAvailable
+		if strings.HasPrefix(pkg.Category, "@") {
+			pkg.Category = strings.TrimPrefix(pkg.Category, "@")
+			pkg.Status = manager.PackageStatusInstalled
+		}
+		packages = append(packages, pkg)
+	}
+
+	return packages
+}
+
+// parseListOutput parses the name.arch, version and repository columns of the output of `dnf list`,
+// whose lines are wrapped after long package names, and skips its section titles.
+func parseListOutput(msg string) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	var pending []string
+	for _, line := range strings.Split(msg, "\n") {
+		fields := append(pending, strings.Fields(line)...)
+		pending = nil
+		if len(fields) == 1 && strings.Contains(fields[0], ".") {
+			pending = fields
+			continue
+		}
+		if len(fields) != 3 {
+			continue
+		}
+		dot := strings.LastIndex(fields[0], ".")
+		if dot <= 0 {
+			continue
+		}
+		packages = append(packages, manager.PackageInfo{
+			Name:           fields[0][:dot],
+			Arch:           fields[0][dot+1:],
+			Version:        fields[1],
+			Category:       fields[2],
+			PackageManager: pm,
+		})
+	}
+
+	return packages
+}
+
+// InstallArg returns the argument of `dnf install` for req: name, followed by -version and .arch.
+func InstallArg(req manager.InstallRequest) (string, error) {
+	if req.Source != "" {
+		return "", fmt.Errorf("%s: dnf cannot install from a given source: %w", req, manager.ErrUnsupported)
+	}
+	arg := req.Name
+	if req.Version != "" {
+		arg += "-" + req.Version
+	}
+	if req.Arch != "" {
+		arg += "." + req.Arch
+	}
+	return arg, nil
+}
+
+// ParseVersionlockListOutput parses the output of `dnf versionlock list` and returns the locked packages,
+// with their locked version. dnf 4 lists the locks as name-[epoch:]version-release.* patterns, and dnf 5 as
+// "Package name:" entries. Excluded versions, listed with a leading "!", are not locks. Example msg:
+//
+//	vim-enhanced-2:9.0.2120-1.fc39.*
+//	kernel-core-0:6.6.8-200.fc39.*
+func ParseVersionlockListOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, line := range strings.Split(msg, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Package name:"):
+			name := strings.TrimSpace(strings.TrimPrefix(line, "Package name:"))
+			packages = append(packages, manager.PackageInfo{Name: name, Status: manager.PackageStatusHeld, PackageManager: pm})
+		case strings.HasPrefix(line, "evr = ") && len(packages) > 0:
+			packages[len(packages)-1].Version = strings.TrimPrefix(line, "evr = ")
+		case strings.HasSuffix(line, ".*") && !strings.ContainsAny(line, " !"):
+			nevr := strings.TrimSuffix(line, ".*")
+			name := packageName(nevr)
+			packages = append(packages, manager.PackageInfo{
+				Name:           name,
+				Version:        strings.TrimPrefix(nevr, name+"-"),
+				Status:         manager.PackageStatusHeld,
+				PackageManager: pm,
+			})
+		}
+	}
+
+	return packages
+}
+
+// updateTypes maps the advisory types of dnf updateinfo to the kinds of updates.
+var updateTypes = map[string]manager.UpdateType{
+	"security":    manager.UpdateTypeSecurity,
+	"bugfix":      manager.UpdateTypeBugfix,
+	"enhancement": manager.UpdateTypeEnhancement,
+	"newpackage":  manager.UpdateTypeEnhancement,
+}
+
+// ParseUpdateinfoListOutput parses the output of `dnf updateinfo list` and returns the packages updated by each advisory,
+// with the version the advisory brings as NewVersion, and the ID of the advisory in AdditionalData, as "advisory".
+// dnf 4 prints the severity of security advisories as their type, such as "Moderate/Sec.", and dnf 5 prints
+// Type and Severity columns after a header. Example msg:
+//
+//	FEDORA-2024-3e0b5b6fb9 Moderate/Sec.  curl-8.2.1-4.fc39.x86_64
+//	FEDORA-2024-7a3a1e6b21 bugfix         vim-enhanced-2:9.1.031-1.fc39.x86_64
+func ParseUpdateinfoListOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, line := range strings.Split(msg, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] == "Name" {
+			continue
+		}
+
+		pkg := manager.PackageInfo{
+			Status:         manager.PackageStatusUpgradable,
+			PackageManager: pm,
+			AdditionalData: map[string]string{"advisory": fields[0]},
+		}
+		nevra := fields[2]
+		if severity, ok := strings.CutSuffix(fields[1], "/Sec."); ok {
+			pkg.UpdateType = manager.UpdateTypeSecurity
+			pkg.Severity = severity
+		} else {
+			pkg.UpdateType = updateTypes[strings.ToLower(fields[1])]
+			// dnf 5 has a Severity column, which is empty for most advisories that are not security ones
+			if !strings.Contains(fields[2], "-") && len(fields) > 3 {
+				pkg.Severity = fields[2]
+				nevra = fields[3]
+			}
+		}
+		if pkg.Severity == "None" || pkg.Severity == "Unknown" {
+			pkg.Severity = ""
+		}
+
+		dot := strings.LastIndex(nevra, ".")
+		if dot <= 0 {
+			continue
+		}
+		pkg.Name = packageName(nevra[:dot])
+		pkg.Arch = nevra[dot+1:]
+		pkg.NewVersion = strings.TrimPrefix(nevra[:dot], pkg.Name+"-")
+		packages = append(packages, pkg)
+	}
+
+	return packages
+}
+
+// updateTypeRanks and severityRanks order the kinds of updates and the severities, the most important last.
+var (
+	updateTypeRanks = map[manager.UpdateType]int{manager.UpdateTypeEnhancement: 1, manager.UpdateTypeBugfix: 2, manager.UpdateTypeSecurity: 3}
+	severityRanks   = map[string]int{"Low": 1, "Moderate": 2, "Important": 3, "Critical": 4}
+)
+
+// markUpdateTypes sets the UpdateType and Severity of packages from the advisories that update them, as returned by
+// ParseUpdateinfoListOutput. A package updated by several advisories takes the most important type and severity.
+func markUpdateTypes(packages, advisories []manager.PackageInfo) []manager.PackageInfo {
+	byPackage := make(map[string][]manager.PackageInfo)
+	for _, advisory := range advisories {
+		byPackage[advisory.Name+"."+advisory.Arch] = append(byPackage[advisory.Name+"."+advisory.Arch], advisory)
+	}
+	for i, pkg := range packages {
+		for _, advisory := range byPackage[pkg.Name+"."+pkg.Arch] {
+			if updateTypeRanks[advisory.UpdateType] > updateTypeRanks[packages[i].UpdateType] {
+				packages[i].UpdateType = advisory.UpdateType
+			}
+			if severityRanks[advisory.Severity] > severityRanks[packages[i].Severity] {
+				packages[i].Severity = advisory.Severity
+			}
+		}
+	}
+	return packages
+}
@@ -1,7 +1,10 @@
 package dnf_test
 
 import (
+	"errors"
+	"github.com/sjwhyte/syspkg/manager"
 	"github.com/sjwhyte/syspkg/manager/dnf"
+	"reflect"
 	"testing"
 )
 
@@ -162,3 +165,132 @@ func TestParseUpgradeOutput(t *testing.T) {
 		t.Errorf("should have returned corelightctl name, but got %v", len(packageInfo))
 	}
 }
+
+func TestNewProgressParser(t *testing.T) {
+	parse := dnf.NewProgressParser()
+
+	tests := []struct {
+		line string
+		want []manager.ProgressEvent
+	}{
+		{
+			"(1/2): corelight-selinux-27.11.1-1.el8.noarch.rpm   12 MB/s | 1.2 MB     00:00",
+			[]manager.ProgressEvent{
+				{Type: manager.ProgressStatus, Phase: manager.ProgressPhaseDownloading, Package: "corelight-selinux", Percent: 50, Message: "(1/2): corelight-selinux-27.11.1-1.el8.noarch.rpm   12 MB/s | 1.2 MB     00:00"},
+			},
+		},
+		{
+			"  Upgrading        : corelight-selinux-27.11.1-1.el8.noarch             1/4 ",
+			[]manager.ProgressEvent{
+				{Type: manager.ProgressPackageStarted, Phase: manager.ProgressPhaseInstalling, Package: "corelight-selinux", Percent: 25, Message: "Upgrading        : corelight-selinux-27.11.1-1.el8.noarch             1/4"},
+				{Type: manager.ProgressStatus, Phase: manager.ProgressPhaseInstalling, Package: "corelight-selinux", Percent: 25, Message: "Upgrading        : corelight-selinux-27.11.1-1.el8.noarch             1/4"},
+			},
+		},
+		{
+			"  Running scriptlet: corelight-selinux-27.11.1-1.el8.noarch             1/4 ",
+			[]manager.ProgressEvent{
+				{Type: manager.ProgressStatus, Phase: manager.ProgressPhaseConfiguring, Package: "corelight-selinux", Percent: 25, Message: "Running scriptlet: corelight-selinux-27.11.1-1.el8.noarch             1/4"},
+			},
+		},
+		{
+			"  Verifying        : vim-enhanced-2:8.2.2637-20.el9_1.x86_64             4/4 ",
+			[]manager.ProgressEvent{
+				{Type: manager.ProgressStatus, Phase: manager.ProgressPhaseVerifying, Package: "vim-enhanced", Percent: 100, Message: "Verifying        : vim-enhanced-2:8.2.2637-20.el9_1.x86_64             4/4"},
+				{Type: manager.ProgressPackageFinished, Phase: manager.ProgressPhaseVerifying, Package: "vim-enhanced", Percent: 100, Message: "Verifying        : vim-enhanced-2:8.2.2637-20.el9_1.x86_64             4/4"},
+			},
+		},
+		{"Upgraded:", nil},
+		{"Complete!", nil},
+	}
+	for _, tt := range tests {
+		if got := parse(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("NewProgressParser()(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseAutoInstalledOutput(t *testing.T) {
+	msg := "bash x86_64 5.1.8-6.el9 user\n\nglibc x86_64 2.34-60.el9 dependency\n\nlangpacks-core-en noarch 3.0-16.el9 weak-dependency\n\nvim-enhanced x86_64 2:8.2.2637-20.el9 group\n"
+	got := dnf.ParseAutoInstalledOutput(msg, nil)
+
+	want := []manager.PackageInfo{
+		{Name: "glibc", Arch: "x86_64", Version: "2.34-60.el9", Status: manager.PackageStatusInstalled, PackageManager: "dnf"},
+		{Name: "langpacks-core-en", Arch: "noarch", Version: "3.0-16.el9", Status: manager.PackageStatusInstalled, PackageManager: "dnf"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseAutoInstalledOutput() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseListUpgradableOutput(t *testing.T) {
+	msg := "Available Upgrades\ncurl.x86_64                          8.2.1-4.fc39              updates\npython3-setuptools-wheel.noarch\n                                     67.7.2-7.fc39             updates\n"
+	got := dnf.ParseListUpgradableOutput(msg, nil)
+
+	want := []manager.PackageInfo{
+		{Name: "curl", Arch: "x86_64", NewVersion: "8.2.1-4.fc39", Category: "updates", Status: manager.PackageStatusUpgradable, PackageManager: "dnf"},
+		{Name: "python3-setuptools-wheel", Arch: "noarch", NewVersion: "67.7.2-7.fc39", Category: "updates", Status: manager.PackageStatusUpgradable, PackageManager: "dnf"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseListUpgradableOutput() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseVersionlockListOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"dnf4", "Last metadata expiration check: 0:10:12 ago on Mon 15 Jan 2024 10:00:00 AM UTC.\nvim-enhanced-2:9.0.2120-1.fc39.*\n!kernel-core-0:6.6.8-200.fc39.*\n"},
+		{"dnf5", "# Added by 'versionlock add' command on 2024-02-28 10:15:32\nPackage name: vim-enhanced\nevr = 2:9.0.2120-1.fc39\n"},
+	}
+	want := []manager.PackageInfo{
+		{Name: "vim-enhanced", Version: "2:9.0.2120-1.fc39", Status: manager.PackageStatusHeld, PackageManager: "dnf"},
+	}
+	for _, tt := range tests {
+		if got := dnf.ParseVersionlockListOutput(tt.msg, nil); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseVersionlockListOutput(%s) = %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
+
+func TestParseShowDuplicatesOutput(t *testing.T) {
+	msg := "Installed Packages\nnginx.x86_64                 1:1.20.1-14.el9_2.1                 @appstream\nAvailable Packages\nnginx.x86_64                 1:1.20.1-10.el9                     appstream\n"
+	got := dnf.ParseShowDuplicatesOutput(msg, nil)
+
+	want := []manager.PackageInfo{
+		{Name: "nginx", Arch: "x86_64", Version: "1:1.20.1-14.el9_2.1", Category: "appstream", Status: manager.PackageStatusInstalled, PackageManager: "dnf"},
+		{Name: "nginx", Arch: "x86_64", Version: "1:1.20.1-10.el9", Category: "appstream", Status: manager.PackageStatusAvailable, PackageManager: "dnf"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseShowDuplicatesOutput() = %+v, want %+v", got, want)
+	}
+}
+
+func TestInstallArg(t *testing.T) {
+	got, err := dnf.InstallArg(manager.InstallRequest{Name: "nginx", Version: "1:1.20.1-10.el9", Arch: "x86_64"})
+	if want := "nginx-1:1.20.1-10.el9.x86_64"; err != nil || got != want {
+		t.Errorf("InstallArg() = %q, %v, want %q", got, err, want)
+	}
+	if _, err := dnf.InstallArg(manager.InstallRequest{Name: "nginx", Source: "epel"}); !errors.Is(err, manager.ErrUnsupported) {
+		t.Errorf("InstallArg() with a source: error = %v, want %v", err, manager.ErrUnsupported)
+	}
+}
+
+func TestParseUpdateinfoListOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+	}{
+		{"dnf4", "FEDORA-2024-3e0b5b6fb9 Moderate/Sec.  curl-8.2.1-4.fc39.x86_64\nFEDORA-2024-7a3a1e6b21 bugfix         vim-enhanced-2:9.1.031-1.fc39.x86_64\n"},
+		{"dnf5", "Name                   Type     Severity Package                              Issued\nFEDORA-2024-3e0b5b6fb9 security Moderate curl-8.2.1-4.fc39.x86_64             2024-01-12 01:23:45\nFEDORA-2024-7a3a1e6b21 bugfix   None     vim-enhanced-2:9.1.031-1.fc39.x86_64 2024-01-20 02:10:11\n"},
+	}
+	want := []manager.PackageInfo{
+		{Name: "curl", Arch: "x86_64", NewVersion: "8.2.1-4.fc39", Status: manager.PackageStatusUpgradable, UpdateType: manager.UpdateTypeSecurity, Severity: "Moderate", PackageManager: "dnf", AdditionalData: map[string]string{"advisory": "FEDORA-2024-3e0b5b6fb9"}},
+		{Name: "vim-enhanced", Arch: "x86_64", NewVersion: "2:9.1.031-1.fc39", Status: manager.PackageStatusUpgradable, UpdateType: manager.UpdateTypeBugfix, PackageManager: "dnf", AdditionalData: map[string]string{"advisory": "FEDORA-2024-7a3a1e6b21"}},
+	}
+	for _, tt := range tests {
+		if got := dnf.ParseUpdateinfoListOutput(tt.msg, nil); !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseUpdateinfoListOutput(%s) = %+v, want %+v", tt.name, got, want)
+		}
+	}
+}
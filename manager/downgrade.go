@@ -0,0 +1,47 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+)
+
+// TrackVersions is a helper for the operations that move packages to other versions, such as a downgrade.
+// It lists the installed packages with list before and after running fn, and returns the packages whose version changed,
+// with their previous version as Version and their current one as NewVersion, along with the error of fn.
+// For a dry run, it only runs fn.
+func TrackVersions(ctx context.Context, opts *Options, list func(context.Context, *Options) ([]PackageInfo, error), fn func() error) ([]PackageInfo, error) {
+	if opts != nil && opts.DryRun {
+		return nil, fn()
+	}
+
+	before, err := list(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("listing the installed packages: %w", err)
+	}
+	versions := make(map[string]string, len(before))
+	for _, pkg := range before {
+		versions[pkg.Name+":"+pkg.Arch] = pkg.Version
+	}
+
+	err = fn()
+
+	// list the packages even if ctx is done, to report what a canceled operation changed
+	after, listErr := list(context.WithoutCancel(ctx), opts)
+	if listErr != nil {
+		if err == nil {
+			err = fmt.Errorf("listing the installed packages: %w", listErr)
+		}
+		return nil, err
+	}
+	var changed []PackageInfo
+	for _, pkg := range after {
+		old, ok := versions[pkg.Name+":"+pkg.Arch]
+		if !ok || old == pkg.Version {
+			continue
+		}
+		pkg.NewVersion, pkg.Version = pkg.Version, old
+		pkg.Status = PackageStatusInstalled
+		changed = append(changed, pkg)
+	}
+	return changed, err
+}
@@ -0,0 +1,49 @@
+package manager_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+func TestTrackVersions(t *testing.T) {
+	installed := []manager.PackageInfo{
+		{Name: "nginx", Version: "1.18.0-6ubuntu14.4", Arch: "amd64"},
+		{Name: "vim", Version: "2:8.2.3995-1ubuntu2.15"},
+	}
+	list := func(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+		return installed, nil
+	}
+	errFailed := errors.New("failed")
+	downgrade := func() error {
+		installed = []manager.PackageInfo{
+			{Name: "nginx", Version: "1.18.0-6ubuntu14", Arch: "amd64"},
+			{Name: "nginx-common", Version: "1.18.0-6ubuntu14"},
+			{Name: "vim", Version: "2:8.2.3995-1ubuntu2.15"},
+		}
+		return errFailed
+	}
+
+	got, err := manager.TrackVersions(context.Background(), nil, list, downgrade)
+	if !errors.Is(err, errFailed) {
+		t.Errorf("TrackVersions() error = %v, want %v", err, errFailed)
+	}
+	want := []manager.PackageInfo{
+		{Name: "nginx", Version: "1.18.0-6ubuntu14.4", NewVersion: "1.18.0-6ubuntu14", Arch: "amd64", Status: manager.PackageStatusInstalled},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("TrackVersions() = %+v, want %+v", got, want)
+	}
+
+	listed := false
+	list = func(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+		listed = true
+		return nil, nil
+	}
+	if got, err := manager.TrackVersions(context.Background(), &manager.Options{DryRun: true}, list, func() error { return nil }); got != nil || err != nil || listed {
+		t.Errorf("TrackVersions() with DryRun = %+v, %v, listed %v, want nothing listed", got, err, listed)
+	}
+}
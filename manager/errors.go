@@ -0,0 +1,145 @@
+// Package manager provides utilities for managing the application.
+package manager
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Sentinel errors describing why a package manager command failed.
+// Errors returned by the package managers wrap one of them when the failure could be classified,
+// so callers can check them with errors.Is.
+var (
+	// ErrPackageNotFound means that one of the requested packages does not exist in the configured repositories.
+	ErrPackageNotFound = errors.New("package not found")
+
+	// ErrLocked means that the package manager database is locked by another process.
+	ErrLocked = errors.New("package manager is locked by another process")
+
+	// ErrPermissionDenied means that the command needs more privileges, usually root.
+	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrNetwork means that a repository could not be reached, or returned invalid data.
+	ErrNetwork = errors.New("network or repository failure")
+
+	// ErrDependencyConflict means that the requested operation would break package dependencies.
+	ErrDependencyConflict = errors.New("dependency conflict")
+
+	// ErrDiskFull means that there is not enough disk space to complete the operation.
+	ErrDiskFull = errors.New("not enough disk space")
+
+	// ErrRepositoryNotFound means that the requested repository is not configured.
+	ErrRepositoryNotFound = errors.New("repository not found")
+
+	// ErrUnsupported means that the package manager does not support the requested operation.
+	ErrUnsupported = errors.New("operation not supported by the package manager")
+)
+
+// IsTemporary reports whether err is a failure that may go away on its own,
+// so that the operation is worth retrying later: a held lock or a network failure.
+func IsTemporary(err error) bool {
+	return errors.Is(err, ErrLocked) || errors.Is(err, ErrNetwork)
+}
+
+// Error is returned by package managers when a command exits with a non-zero status.
+type Error struct {
+	// PackageManager is the name of the package manager that failed, such as "apt".
+	PackageManager string
+
+	// Kind is the sentinel error the failure was classified as, such as ErrLocked, or nil if it could not be classified.
+	Kind error
+
+	// Message is the line of the command output that explains the failure, if known.
+	Message string
+
+	// Stderr is the captured standard error of the command, for diagnostics.
+	Stderr string
+
+	// Err is the underlying error, usually an *ExitError.
+	Err error
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	msg := e.PackageManager + ": "
+	if e.Kind != nil {
+		msg += e.Kind.Error() + ": "
+	}
+	if e.Message != "" {
+		return msg + e.Message
+	}
+	return msg + e.Err.Error()
+}
+
+// Unwrap returns the Kind and the underlying error of e, so that errors.Is and errors.As can match either.
+func (e *Error) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// ErrorRule maps a failure of a package manager command to one of the sentinel errors.
+type ErrorRule struct {
+	// Kind is the sentinel error the failure is classified as.
+	Kind error
+
+	// ExitCode, if not zero, is the exit code the command must have exited with.
+	ExitCode int
+
+	// Pattern, if not nil, must match a line of the command output (stderr first, then stdout).
+	Pattern *regexp.Regexp
+}
+
+// ClassifyError turns an *ExitError returned by a CommandRunner into an *Error, classified with the first matching rule.
+// Other errors, such as context cancellation or a command that cannot be started, are returned as is.
+func ClassifyError(pm string, res Result, err error, rules []ErrorRule) error {
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+
+	pmErr := &Error{
+		PackageManager: pm,
+		Stderr:         string(res.Stderr),
+		Message:        lastLine(res.Stderr),
+		Err:            err,
+	}
+
+	for _, rule := range rules {
+		if rule.ExitCode != 0 && rule.ExitCode != exitErr.ExitCode {
+			continue
+		}
+		if rule.Pattern == nil {
+			pmErr.Kind = rule.Kind
+			return pmErr
+		}
+		for _, output := range [][]byte{res.Stderr, res.Stdout} {
+			if line := matchLine(rule.Pattern, output); line != "" {
+				pmErr.Kind = rule.Kind
+				pmErr.Message = line
+				return pmErr
+			}
+		}
+	}
+
+	return pmErr
+}
+
+// matchLine returns the first line of output matched by pattern, or an empty string.
+func matchLine(pattern *regexp.Regexp, output []byte) string {
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		if pattern.Match(line) {
+			return strings.TrimSpace(string(line))
+		}
+	}
+	return ""
+}
+
+// lastLine returns the last non-empty line of output, which is usually the most relevant error message.
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
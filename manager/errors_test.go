@@ -0,0 +1,45 @@
+package manager_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+func TestClassifyError(t *testing.T) {
+	rules := []manager.ErrorRule{
+		{Kind: manager.ErrLocked, ExitCode: 200},
+		{Kind: manager.ErrPackageNotFound, Pattern: regexp.MustCompile(`No match for argument`)},
+	}
+	cmd := manager.Command{Name: "dnf", Args: []string{"install", "foo"}}
+
+	res := manager.Result{Stdout: []byte("No match for argument: foo\n"), Stderr: []byte("Error: Unable to find a match: foo\n"), ExitCode: 1}
+	err := manager.ClassifyError("dnf", res, &manager.ExitError{Command: cmd, ExitCode: 1}, rules)
+	if !errors.Is(err, manager.ErrPackageNotFound) {
+		t.Errorf("ClassifyError() = %+v, want manager.ErrPackageNotFound", err)
+	}
+	if want := "dnf: package not found: No match for argument: foo"; err.Error() != want {
+		t.Errorf("ClassifyError().Error() = %q, want %q", err.Error(), want)
+	}
+
+	res = manager.Result{ExitCode: 200}
+	err = manager.ClassifyError("dnf", res, &manager.ExitError{Command: cmd, ExitCode: 200}, rules)
+	if !errors.Is(err, manager.ErrLocked) {
+		t.Errorf("ClassifyError() = %+v, want manager.ErrLocked", err)
+	}
+
+	res = manager.Result{Stderr: []byte("Error: something else\n"), ExitCode: 1}
+	err = manager.ClassifyError("dnf", res, &manager.ExitError{Command: cmd, ExitCode: 1}, rules)
+	var pmErr *manager.Error
+	if !errors.As(err, &pmErr) || pmErr.Kind != nil || pmErr.Message != "Error: something else" {
+		t.Errorf("ClassifyError() = %+v, want an unclassified *manager.Error", err)
+	}
+
+	ctxErr := context.DeadlineExceeded
+	if err := manager.ClassifyError("dnf", manager.Result{}, ctxErr, rules); err != ctxErr {
+		t.Errorf("ClassifyError() = %+v, want %+v", err, ctxErr)
+	}
+}
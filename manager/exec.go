@@ -0,0 +1,49 @@
+// Package manager provides utilities for managing the application.
+package manager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// KillGracePeriod is how long a canceled command is given to exit after being asked to terminate,
+// before it and all of its children are killed forcefully.
+var KillGracePeriod = 5 * time.Second
+
+// CommandContext is like exec.CommandContext, but the command is started in its own process group,
+// so that canceling ctx also stops every process it spawned (e.g. dpkg and maintainer scripts under apt).
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.WaitDelay = 2 * KillGracePeriod
+	return cmd
+}
+
+// InteractiveCommandContext is like CommandContext, but the command is attached to the current terminal.
+// It stays in the foreground process group so that it can prompt the user; on cancellation only the
+// command itself is killed, its children receive the terminal's signals as usual.
+func InteractiveCommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	cmd.WaitDelay = 2 * KillGracePeriod
+	return cmd
+}
+
+// ContextError returns err, unless ctx is done, in which case it returns an error wrapping ctx.Err().
+// The process error of a killed command ("signal: killed") is meaningless to callers, so this lets
+// them tell a timeout or cancellation apart from a failure of the package manager itself with
+// errors.Is(err, context.DeadlineExceeded) or errors.Is(err, context.Canceled).
+func ContextError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("command stopped: %w", ctxErr)
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package manager_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+func TestCommandContextTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the child sleep keeps stdout open, so Output only returns once the whole process group is gone
+	cmd := manager.CommandContext(ctx, "sh", "-c", "sleep 30 & wait")
+	start := time.Now()
+	_, err := cmd.Output()
+	err = manager.ContextError(ctx, err)
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ContextError() = %+v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed >= manager.KillGracePeriod {
+		t.Errorf("command took %s to stop, want less than %s", elapsed, manager.KillGracePeriod)
+	}
+}
+
+func TestContextErrorPassesThrough(t *testing.T) {
+	failure := errors.New("exit status 100")
+
+	if err := manager.ContextError(context.Background(), failure); err != failure {
+		t.Errorf("ContextError() = %+v, want %+v", err, failure)
+	}
+	if err := manager.ContextError(context.Background(), nil); err != nil {
+		t.Errorf("ContextError() = %+v, want nil", err)
+	}
+}
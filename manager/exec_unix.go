@@ -0,0 +1,23 @@
+//go:build !windows
+
+package manager
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup makes cmd the leader of a new process group, and replaces its Cancel function so that
+// the whole group gets SIGTERM, followed by SIGKILL if it is still around after KillGracePeriod.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		err := syscall.Kill(pgid, syscall.SIGTERM)
+		time.AfterFunc(KillGracePeriod, func() {
+			_ = syscall.Kill(pgid, syscall.SIGKILL)
+		})
+		return err
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package manager
+
+import "os/exec"
+
+// setProcessGroup is a no-op on Windows, where canceling a command only kills the command itself.
+func setProcessGroup(cmd *exec.Cmd) {}
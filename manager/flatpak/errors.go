@@ -0,0 +1,19 @@
+package flatpak
+
+import (
+	"regexp"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// errorRules classify the failures of flatpak, checked in order.
+// flatpak exits with status 1 for every error, so the classification relies on its "error:" messages.
+var errorRules = []manager.ErrorRule{
+	{Kind: manager.ErrPermissionDenied, Pattern: regexp.MustCompile(`not allowed for user|Permission denied|Not authorized`)},
+	{Kind: manager.ErrLocked, Pattern: regexp.MustCompile(`Ongoing operation|Unable to lock|is locked`)},
+	{Kind: manager.ErrDiskFull, Pattern: regexp.MustCompile(`not enough disk space|No space left on device`)},
+	{Kind: manager.ErrRepositoryNotFound, Pattern: regexp.MustCompile(`Remote "?[^ "]+"? not found|No remote [^ ]+`)},
+	{Kind: manager.ErrPackageNotFound, Pattern: regexp.MustCompile(`Nothing matches|No remote refs found|not installed|No ref chosen`)},
+	{Kind: manager.ErrDependencyConflict, Pattern: regexp.MustCompile(`requires the runtime .* which (was not found|is not installed)|needs a later flatpak version`)},
+	{Kind: manager.ErrNetwork, Pattern: regexp.MustCompile(`Could not resolve hostname|Unable to connect|While downloading|While pulling|Server returned status|Timeout was reached|Error resolving`)},
+}
@@ -0,0 +1,72 @@
+package flatpak
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// OwnerOf returns the application or runtime that owns the file or directory at path: the one whose deployment
+// it is in, such as /var/lib/flatpak/app/org.gimp.GIMP/..., or that exports it, such as /var/lib/flatpak/exports/bin/org.gimp.GIMP.
+// Both system-wide and per-user installations are recognized.
+func (a *PackageManager) OwnerOf(path string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.OwnerOfContext(context.Background(), path, opts)
+}
+
+// OwnerOfContext is like OwnerOf. It does not run any command.
+func (a *PackageManager) OwnerOfContext(ctx context.Context, path string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	id := ownerOf(path)
+	if id == "" {
+		return nil, fmt.Errorf("%s: %w", path, manager.ErrPackageNotFound)
+	}
+	return []manager.PackageInfo{{Name: id, Status: manager.PackageStatusInstalled, PackageManager: pm}}, nil
+}
+
+// ownerOf returns the ID of the application or runtime whose installation contains path, if any.
+func ownerOf(path string) string {
+	parts := strings.Split(filepath.Clean(path), string(filepath.Separator))
+	for i, part := range parts {
+		if part != "flatpak" || i+2 >= len(parts) {
+			continue
+		}
+		switch {
+		case parts[i+1] == "app" || parts[i+1] == "runtime":
+			return parts[i+2]
+		case parts[i+1] == "exports" && parts[i+2] == "bin" && i+3 < len(parts):
+			return parts[i+3]
+		case parts[i+1] == "exports" && parts[i+2] == "share" && i+4 < len(parts):
+			// exported desktop files, icons and services are named after the application, e.g. org.gimp.GIMP.desktop
+			base := parts[len(parts)-1]
+			return strings.TrimSuffix(base, filepath.Ext(base))
+		}
+	}
+	return ""
+}
+
+// ListFiles returns the files of the deployment of the specified installed application or runtime,
+// found with `flatpak info --show-location`.
+func (a *PackageManager) ListFiles(pkg string, opts *manager.Options) ([]string, error) {
+	return a.ListFilesContext(context.Background(), pkg, opts)
+}
+
+// ListFilesContext is like ListFiles but uses ctx to bound the flatpak command, and the listing of the files.
+func (a *PackageManager) ListFilesContext(ctx context.Context, pkg string, opts *manager.Options) ([]string, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"info", "--show-location", pkg}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	err = filepath.WalkDir(strings.TrimSpace(string(res.Stdout)), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		files = append(files, path)
+		return ctx.Err()
+	})
+	return files, err
+}
@@ -12,9 +12,13 @@
 package flatpak
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 
 	// "github.com/rs/zerolog"
 	// "github.com/rs/zerolog/log"
@@ -24,6 +28,10 @@ import (
 
 var pm string = "flatpak"
 
+func init() {
+	manager.Register(pm, manager.PriorityUniversal, func() manager.PackageManager { return &PackageManager{} })
+}
+
 // Constants representing Flatpak command arguments.
 const (
 	ArgsAssumeYes string = "-y"
@@ -44,7 +52,21 @@ const (
 var ENV_NonInteractive []string = []string{"LC_ALL=C"}
 
 // PackageManager implements the syspkg manager interface for Flatpak.
-type PackageManager struct{}
+type PackageManager struct {
+	// Runner runs the package manager commands. If nil, manager.DefaultRunner is used.
+	Runner manager.CommandRunner
+}
+
+// runner returns the CommandRunner used to run the package manager commands.
+func (a *PackageManager) runner() manager.CommandRunner {
+	return manager.RunnerOrDefault(a.Runner)
+}
+
+// run runs cmd with the CommandRunner of the package manager, and classifies its failures with errorRules.
+func (a *PackageManager) run(ctx context.Context, cmd manager.Command) (manager.Result, error) {
+	res, err := a.runner().Run(ctx, cmd)
+	return res, manager.ClassifyError(pm, res, err, errorRules)
+}
 
 // IsAvailable checks if the Flatpak package manager is available on the system.
 func (a *PackageManager) IsAvailable() bool {
@@ -59,7 +81,17 @@ func (a *PackageManager) GetPackageManager() string {
 
 // Install installs the given packages using Flatpak with the provided options.
 func (a *PackageManager) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
-	args := append([]string{"install", ArgsFixBroken, ArgsUpsert, ArgsVerbose}, pkgs...)
+	return a.InstallContext(context.Background(), pkgs, opts)
+}
+
+// InstallContext is like Install but uses ctx to bound the flatpak command.
+func (a *PackageManager) InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.install(ctx, pkgs, nil, opts)
+}
+
+// install installs pkgs with flatpak install, passing it the extra flags.
+func (a *PackageManager) install(ctx context.Context, pkgs []string, flags []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	args := append(append([]string{"install", ArgsFixBroken, ArgsUpsert, ArgsVerbose}, pkgs...), flags...)
 
 	if opts == nil {
 		opts = &manager.Options{
@@ -82,26 +114,25 @@ func (a *PackageManager) Install(pkgs []string, opts *manager.Options) ([]manage
 		args = append(args, ArgsVerbose)
 	}
 
-	cmd := exec.Command(pm, args...)
-
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	} else {
-		cmd.Env = ENV_NonInteractive
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: ENV_NonInteractive, Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
 		if err != nil {
 			return nil, err
 		}
-		return ParseInstallOutput(string(out), opts), nil
+		return ParseInstallOutput(string(res.Stdout), opts), nil
 	}
 }
 
 // Delete removes the given packages using Flatpak with the provided options.
 func (a *PackageManager) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.DeleteContext(context.Background(), pkgs, opts)
+}
+
+// DeleteContext is like Delete but uses ctx to bound the flatpak command.
+func (a *PackageManager) DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
 	args := append([]string{"uninstall", ArgsFixBroken, ArgsVerbose}, pkgs...)
 
 	if opts == nil {
@@ -125,26 +156,25 @@ func (a *PackageManager) Delete(pkgs []string, opts *manager.Options) ([]manager
 		args = append(args, ArgsVerbose)
 	}
 
-	cmd := exec.Command(pm, args...)
-
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	} else {
-		cmd.Env = ENV_NonInteractive
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: ENV_NonInteractive, Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
 		if err != nil {
 			return nil, err
 		}
-		return ParseInstallOutput(string(out), opts), nil
+		return ParseInstallOutput(string(res.Stdout), opts), nil
 	}
 }
 
 // Refresh updates the package metadata for Flatpak. Not currently implemented.
 func (a *PackageManager) Refresh(opts *manager.Options) error {
+	return a.RefreshContext(context.Background(), opts)
+}
+
+// RefreshContext is like Refresh. Not currently implemented.
+func (a *PackageManager) RefreshContext(ctx context.Context, opts *manager.Options) error {
 	// not sure if this is needed
 
 	return nil
@@ -152,6 +182,11 @@ func (a *PackageManager) Refresh(opts *manager.Options) error {
 
 // Find searches for packages matching the given keywords using Flatpak with the provided options.
 func (a *PackageManager) Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.FindContext(context.Background(), keywords, opts)
+}
+
+// FindContext is like Find but uses ctx to bound the flatpak command.
+func (a *PackageManager) FindContext(ctx context.Context, keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
 	args := append([]string{"search", ArgsVerbose}, keywords...)
 
 	if opts == nil {
@@ -166,49 +201,68 @@ func (a *PackageManager) Find(keywords []string, opts *manager.Options) ([]manag
 		args = append(args, ArgsVerbose)
 	}
 
-	cmd := exec.Command(pm, args...)
-
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	} else {
-		cmd.Env = ENV_NonInteractive
-		out, err := cmd.Output()
+		res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: ENV_NonInteractive})
 		if err != nil {
 			return nil, err
 		}
-		return ParseFindOutput(string(out), opts), nil
+		return ParseFindOutput(string(res.Stdout), opts), nil
 	}
 }
 
 // ListInstalled lists installed packages using Flatpak with the provided options.
 func (a *PackageManager) ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
-	cmd := exec.Command("flatpak", "list")
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	return a.ListInstalledContext(context.Background(), opts)
+}
+
+// ListInstalledContext is like ListInstalled but uses ctx to bound the flatpak command.
+func (a *PackageManager) ListInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: "flatpak", Args: []string{"list"}, Env: ENV_NonInteractive})
 	if err != nil {
 		return nil, err
 	}
-	return ParseListInstalledOutput(string(out), opts), nil
+	return ParseListInstalledOutput(string(res.Stdout), opts), nil
 }
 
 // ListUpgradable lists upgradable packages using Flatpak with the provided options.
 func (a *PackageManager) ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error) {
-	cmd := exec.Command(pm, "remote-ls", "--updates")
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	return a.ListUpgradableContext(context.Background(), opts)
+}
+
+// ListUpgradableContext is like ListUpgradable but uses ctx to bound the flatpak commands.
+// Masked packages are reported with manager.PackageStatusHeld.
+func (a *PackageManager) ListUpgradableContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	packages, err := a.listUpgradable(ctx, opts)
+	if err != nil || len(packages) == 0 {
+		return packages, err
+	}
+	held, err := a.ListHeldContext(ctx, opts)
 	if err != nil {
 		return nil, err
 	}
-	return ParseListUpgradableOutput(string(out), opts), nil
+	return manager.MarkHeld(packages, held), nil
+}
+
+// listUpgradable lists the upgradable packages, masked or not.
+func (a *PackageManager) listUpgradable(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"remote-ls", "--updates"}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	return ParseListUpgradableOutput(string(res.Stdout), opts), nil
 }
 
 // UpgradeAll upgrades all packages using Flatpak with the provided options.
 func (a *PackageManager) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
-	args := []string{"update"}
+	return a.UpgradeAllContext(context.Background(), pkgs, opts)
+}
+
+// UpgradeAllContext is like UpgradeAll but uses ctx to bound the flatpak commands.
+// Masked packages are not upgraded, but reported with manager.PackageStatusHeld.
+func (a *PackageManager) UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
 	if opts == nil {
 		opts = &manager.Options{
 			Verbose:     false,
@@ -216,6 +270,12 @@ func (a *PackageManager) UpgradeAll(pkgs []string, opts *manager.Options) ([]man
 			Interactive: false,
 		}
 	}
+	return manager.UpgradeHolding(ctx, a, pkgs, opts, a.listUpgradable, a.update)
+}
+
+// update updates the given packages, or all the packages if pkgs is empty.
+func (a *PackageManager) update(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	args := append([]string{"update"}, pkgs...)
 
 	if opts.DryRun {
 		args = append(args, ArgsDryRun)
@@ -224,33 +284,208 @@ func (a *PackageManager) UpgradeAll(pkgs []string, opts *manager.Options) ([]man
 		args = append(args, ArgsAssumeYes)
 	}
 
-	cmd := exec.Command(pm, args...)
-
 	log.Printf("Running command: %s %s", pm, args)
 
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	}
 
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: ENV_NonInteractive, Stdout: manager.ProgressWriter(pm, opts, NewProgressParser())})
 	if err != nil {
 		return nil, err
 	}
-	return ParseInstallOutput(string(out), opts), nil
+	return ParseInstallOutput(string(res.Stdout), opts), nil
+}
+
+// InstallRequests installs the packages of reqs using flatpak, from the remote given as Source,
+// at the commit given as Version, for the given Arch.
+func (a *PackageManager) InstallRequests(reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.InstallRequestsContext(context.Background(), reqs, opts)
+}
+
+// InstallRequestsContext is like InstallRequests but uses ctx to bound the flatpak commands.
+// flatpak takes a remote, a commit or an architecture for all the refs it installs, so such requests are installed one at a time.
+func (a *PackageManager) InstallRequestsContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	var names []string
+	var pinned []manager.InstallRequest
+	for _, req := range reqs {
+		if req.Version == "" && req.Source == "" && req.Arch == "" {
+			names = append(names, req.Name)
+		} else {
+			pinned = append(pinned, req)
+		}
+	}
+
+	var packages []manager.PackageInfo
+	if len(names) > 0 {
+		pkgs, err := a.install(ctx, names, nil, opts)
+		packages = append(packages, pkgs...)
+		if err != nil {
+			return packages, err
+		}
+	}
+	for _, req := range pinned {
+		args := []string{req.Name}
+		if req.Source != "" {
+			args = []string{req.Source, req.Name}
+		}
+		var flags []string
+		if req.Version != "" {
+			flags = append(flags, "--commit="+req.Version)
+		}
+		if req.Arch != "" {
+			flags = append(flags, "--arch="+req.Arch)
+		}
+		pkgs, err := a.install(ctx, args, flags, opts)
+		packages = append(packages, pkgs...)
+		if err != nil {
+			return packages, err
+		}
+	}
+	return packages, nil
+}
+
+// ListHeld lists the packages whose updates are masked, using flatpak mask.
+func (a *PackageManager) ListHeld(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.ListHeldContext(context.Background(), opts)
+}
+
+// ListHeldContext is like ListHeld but uses ctx to bound the flatpak command.
+func (a *PackageManager) ListHeldContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"mask"}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	return ParseMaskOutput(string(res.Stdout), opts), nil
+}
+
+// Hold masks the updates of the specified packages, using flatpak mask.
+func (a *PackageManager) Hold(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.HoldContext(context.Background(), pkgs, opts)
+}
+
+// HoldContext is like Hold but uses ctx to bound the flatpak command.
+func (a *PackageManager) HoldContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.mask(ctx, []string{"mask"}, pkgs, manager.PackageStatusHeld, opts)
+}
+
+// Unhold removes the masks of the specified packages, using flatpak mask --remove.
+func (a *PackageManager) Unhold(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.UnholdContext(context.Background(), pkgs, opts)
+}
+
+// UnholdContext is like Unhold but uses ctx to bound the flatpak command.
+func (a *PackageManager) UnholdContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.mask(ctx, []string{"mask", "--remove"}, pkgs, manager.PackageStatusInstalled, opts)
+}
+
+// mask runs the flatpak mask command given by args on pkgs, and returns pkgs with the given status.
+func (a *PackageManager) mask(ctx context.Context, args []string, pkgs []string, status manager.PackageStatus, opts *manager.Options) ([]manager.PackageInfo, error) {
+	if opts != nil && opts.DryRun {
+		log.Printf("flatpak: would run: flatpak %s %s\n", strings.Join(args, " "), strings.Join(pkgs, " "))
+		return nil, nil
+	}
+	if _, err := a.run(ctx, manager.Command{Name: pm, Args: append(args, pkgs...), Env: ENV_NonInteractive}); err != nil {
+		return nil, err
+	}
+	packages := make([]manager.PackageInfo, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		packages = append(packages, manager.PackageInfo{Name: pkg, Status: status, PackageManager: pm})
+	}
+	return packages, nil
 }
 
 // GetPackageInfo retrieves package information for a single package using Flatpak with the provided options.
 func (a *PackageManager) GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error) {
-	cmd := exec.Command(pm, "info", pkg)
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	return a.GetPackageInfoContext(context.Background(), pkg, opts)
+}
+
+// GetPackageInfoContext is like GetPackageInfo but uses ctx to bound the flatpak command.
+func (a *PackageManager) GetPackageInfoContext(ctx context.Context, pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"info", pkg}, Env: ENV_NonInteractive})
 	if err != nil {
 		return manager.PackageInfo{}, err
 	}
-	return ParsePackageInfoOutput(string(out), opts), nil
+	return ParsePackageInfoOutput(string(res.Stdout), opts), nil
+}
+
+// Downgrade updates the refs of reqs to the older commit given as Version using flatpak update --commit,
+// for the given Arch. flatpak cannot find the previous commit by itself: each request must have a Version,
+// see `flatpak remote-info --log`. The refs are updated from the remote they were installed from, so Source is not supported.
+func (a *PackageManager) Downgrade(reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.DowngradeContext(context.Background(), reqs, opts)
+}
+
+// DowngradeContext is like Downgrade but uses ctx to bound the flatpak commands.
+// flatpak takes a commit for a single ref, so the refs are updated one at a time.
+func (a *PackageManager) DowngradeContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	for _, req := range reqs {
+		switch {
+		case req.Version == "":
+			return nil, fmt.Errorf("%s: flatpak needs the commit to downgrade to", req.Name)
+		case req.Source != "":
+			return nil, fmt.Errorf("%s: flatpak cannot downgrade from a given remote: %w", req, manager.ErrUnsupported)
+		}
+	}
+	if opts == nil {
+		opts = &manager.Options{}
+	}
+
+	return manager.TrackVersions(ctx, opts, a.ListInstalledContext, func() error {
+		for _, req := range reqs {
+			args := []string{"--commit=" + req.Version}
+			if req.Arch != "" {
+				args = append(args, "--arch="+req.Arch)
+			}
+			if _, err := a.update(ctx, append(args, req.Name), opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PackageFileTypes returns the types of the package files flatpak installs: .flatpakref files and .flatpak bundles.
+func (a *PackageManager) PackageFileTypes() []manager.PackageFileType {
+	return []manager.PackageFileType{manager.PackageFileFlatpakRef, manager.PackageFileFlatpakBundle}
+}
+
+// InstallFiles installs the applications of the .flatpakref files at paths using flatpak install --from,
+// which adds their remote if needed, and the .flatpak bundles at paths using flatpak install --bundle.
+func (a *PackageManager) InstallFiles(paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.InstallFilesContext(context.Background(), paths, opts)
+}
+
+// InstallFilesContext is like InstallFiles but uses ctx to bound the flatpak commands.
+// flatpak installs a single file at a time, so the files are installed one after the other.
+func (a *PackageManager) InstallFilesContext(ctx context.Context, paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	var packages []manager.PackageInfo
+	for _, path := range paths {
+		t, err := manager.DetectPackageFile(path)
+		if err != nil {
+			return packages, err
+		}
+		flag := "--from"
+		if t == manager.PackageFileFlatpakBundle {
+			flag = "--bundle"
+		}
+		pkgs, err := a.install(ctx, []string{path}, []string{flag}, opts)
+		packages = append(packages, pkgs...)
+		if err != nil {
+			return packages, err
+		}
+	}
+	return packages, nil
+}
+
+// StateFiles returns the .changed files that flatpak touches when it changes the system and the user installations.
+func (a *PackageManager) StateFiles() []string {
+	files := []string{"/var/lib/flatpak/.changed"}
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		files = append(files, filepath.Join(dataHome, "flatpak/.changed"))
+	} else if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".local/share/flatpak/.changed"))
+	}
+	return files
 }
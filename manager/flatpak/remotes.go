@@ -0,0 +1,119 @@
+package flatpak
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// ListRepositories lists the remotes of Flatpak, including the disabled ones.
+func (a *PackageManager) ListRepositories(opts *manager.Options) ([]manager.Repository, error) {
+	return a.ListRepositoriesContext(context.Background(), opts)
+}
+
+// ListRepositoriesContext is like ListRepositories but uses ctx to bound the flatpak command.
+func (a *PackageManager) ListRepositoriesContext(ctx context.Context, opts *manager.Options) ([]manager.Repository, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"remotes", "--show-disabled", "--columns=name,title,url,options"}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	return ParseRemotesOutput(string(res.Stdout), opts), nil
+}
+
+// AddRepository adds a Flatpak remote. Its URL is the one of the repository or of a .flatpakrepo file,
+// and its Key, if any, is the path of a GPG key file to import for it.
+func (a *PackageManager) AddRepository(repo manager.Repository, opts *manager.Options) error {
+	return a.AddRepositoryContext(context.Background(), repo, opts)
+}
+
+// AddRepositoryContext is like AddRepository but uses ctx to bound the flatpak command.
+func (a *PackageManager) AddRepositoryContext(ctx context.Context, repo manager.Repository, opts *manager.Options) error {
+	if err := repo.Validate(); err != nil {
+		return err
+	}
+	if len(repo.URLs) != 1 {
+		return fmt.Errorf("repository %s: flatpak remotes have a single URL", repo.Name)
+	}
+	if len(repo.Types)+len(repo.Suites)+len(repo.Components)+len(repo.Architectures) > 0 {
+		return fmt.Errorf("repository %s: flatpak remotes have no types, suites, components nor architectures", repo.Name)
+	}
+
+	args := []string{"remote-add"}
+	if repo.Title != "" {
+		args = append(args, "--title="+repo.Title)
+	}
+	if repo.Key != "" {
+		args = append(args, "--gpg-import="+repo.Key)
+	}
+	if repo.Disabled {
+		args = append(args, "--disable")
+	}
+	args = append(args, repo.Name, repo.URLs[0])
+	return a.runRemoteCommand(ctx, args, opts)
+}
+
+// RemoveRepository removes the Flatpak remote with the given name.
+func (a *PackageManager) RemoveRepository(name string, opts *manager.Options) error {
+	return a.RemoveRepositoryContext(context.Background(), name, opts)
+}
+
+// RemoveRepositoryContext is like RemoveRepository but uses ctx to bound the flatpak command.
+func (a *PackageManager) RemoveRepositoryContext(ctx context.Context, name string, opts *manager.Options) error {
+	return a.runRemoteCommand(ctx, []string{"remote-delete", name}, opts)
+}
+
+// SetRepositoryEnabled enables or disables the Flatpak remote with the given name.
+func (a *PackageManager) SetRepositoryEnabled(name string, enabled bool, opts *manager.Options) error {
+	return a.SetRepositoryEnabledContext(context.Background(), name, enabled, opts)
+}
+
+// SetRepositoryEnabledContext is like SetRepositoryEnabled but uses ctx to bound the flatpak command.
+func (a *PackageManager) SetRepositoryEnabledContext(ctx context.Context, name string, enabled bool, opts *manager.Options) error {
+	flag := "--disable"
+	if enabled {
+		flag = "--enable"
+	}
+	return a.runRemoteCommand(ctx, []string{"remote-modify", flag, name}, opts)
+}
+
+// runRemoteCommand runs the flatpak command that changes a remote, or only logs it for a dry run.
+func (a *PackageManager) runRemoteCommand(ctx context.Context, args []string, opts *manager.Options) error {
+	if opts != nil && opts.DryRun {
+		log.Printf("flatpak: would run: flatpak %s\n", strings.Join(args, " "))
+		return nil
+	}
+	if opts != nil && opts.Interactive {
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
+		return err
+	}
+	_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: ENV_NonInteractive})
+	return err
+}
+
+// ParseRemotesOutput parses the output of `flatpak remotes --show-disabled --columns=name,title,url,options`.
+// Example msg:
+//
+//	flathub	Flathub	https://dl.flathub.org/repo/	system
+//	fedora	Fedora Flatpaks	oci+https://registry.fedoraproject.org	system,oci,disabled
+func ParseRemotesOutput(msg string, opts *manager.Options) []manager.Repository {
+	var repos []manager.Repository
+	for _, line := range strings.Split(msg, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 || fields[0] == "" {
+			continue
+		}
+		repo := manager.Repository{Name: fields[0], Title: fields[1], URLs: []string{fields[2]}}
+		if len(fields) > 3 {
+			for _, option := range strings.Split(fields[3], ",") {
+				if option == "disabled" {
+					repo.Disabled = true
+				}
+			}
+		}
+		repos = append(repos, repo)
+	}
+	return repos
+}
@@ -3,6 +3,8 @@ package flatpak
 import (
 	"fmt"
 	"log"
+	"regexp"
+	"strconv"
 	"strings"
 
 	// "github.com/rs/zerolog"
@@ -214,6 +216,35 @@ func ParseListUpgradableOutput(msg string, opts *manager.Options) []manager.Pack
 	return packages
 }
 
+// ParseMaskOutput parses the output of the flatpak mask command, which lists the masked patterns,
+// and returns the packages they mask. Patterns that are refs, such as app/org.gimp.GIMP/x86_64/stable, are reported by ID.
+// Example msg:
+//
+//	Masked patterns:
+//	  org.gimp.GIMP
+//	  app/org.mozilla.firefox/x86_64/stable
+func ParseMaskOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, line := range strings.Split(msg, "\n") {
+		pattern := strings.TrimSpace(line)
+		if pattern == "" || strings.HasSuffix(pattern, ":") {
+			continue
+		}
+		name := pattern
+		if parts := strings.Split(pattern, "/"); len(parts) > 1 {
+			name = parts[1]
+		}
+		packages = append(packages, manager.PackageInfo{
+			Name:           name,
+			Status:         manager.PackageStatusHeld,
+			PackageManager: pm,
+		})
+	}
+
+	return packages
+}
+
 // ParsePackageInfoOutput parses the output of the flatpak info command and returns a PackageInfo struct.
 func ParsePackageInfoOutput(msg string, opts *manager.Options) manager.PackageInfo {
 	var pkg manager.PackageInfo
@@ -252,3 +283,76 @@ func ParsePackageInfoOutput(msg string, opts *manager.Options) manager.PackageIn
 
 	return pkg
 }
+
+// NewProgressParser returns a manager.ProgressParser for the lines printed by flatpak while it runs a transaction.
+// A ref is reported as finished when the next one starts, or when the transaction completes. Example lines:
+//
+//	Installing app/net.davidotek.pupgui2/x86_64/stable
+//	Installing 2/3… ████████            45%  1.2 MB/s  00:05
+//	Installation complete.
+func NewProgressParser() manager.ProgressParser {
+	refPattern := regexp.MustCompile(`^(Installing|Updating|Uninstalling) (?:app|runtime)/([^/\s]+)/`)
+	progressPattern := regexp.MustCompile(`^(Installing|Updating|Uninstalling) (\d+)/(\d+)\S*(?:.*?(\d+)%)?`)
+	completePattern := regexp.MustCompile(`^(Installation|Updates|Uninstall|Changes) complete\.`)
+
+	var current string
+	var currentPhase manager.ProgressPhase
+	finish := func() []manager.ProgressEvent {
+		if current == "" {
+			return nil
+		}
+		event := manager.ProgressEvent{
+			Type:    manager.ProgressPackageFinished,
+			Phase:   currentPhase,
+			Package: current,
+			Percent: -1,
+		}
+		current = ""
+		return []manager.ProgressEvent{event}
+	}
+
+	return func(line string) []manager.ProgressEvent {
+		line = strings.TrimSpace(line)
+
+		if match := progressPattern.FindStringSubmatch(line); match != nil {
+			n, _ := strconv.Atoi(match[2])
+			total, _ := strconv.Atoi(match[3])
+			percent := -1.0
+			if total > 0 {
+				opPercent, _ := strconv.Atoi(match[4])
+				percent = (float64(n-1) + float64(opPercent)/100) * 100 / float64(total)
+			}
+			return []manager.ProgressEvent{{
+				Type:    manager.ProgressStatus,
+				Phase:   flatpakPhase(match[1]),
+				Package: current,
+				Percent: percent,
+				Message: line,
+			}}
+		}
+
+		if match := refPattern.FindStringSubmatch(line); match != nil {
+			events := finish()
+			current = match[2]
+			currentPhase = flatpakPhase(match[1])
+			return append(events,
+				manager.ProgressEvent{Type: manager.ProgressPackageStarted, Phase: currentPhase, Package: current, Percent: -1, Message: line},
+				manager.ProgressEvent{Type: manager.ProgressStatus, Phase: currentPhase, Package: current, Percent: -1, Message: line},
+			)
+		}
+
+		if completePattern.MatchString(line) {
+			return finish()
+		}
+
+		return nil
+	}
+}
+
+// flatpakPhase returns the progress phase of a flatpak operation, as printed by flatpak.
+func flatpakPhase(operation string) manager.ProgressPhase {
+	if operation == "Uninstalling" {
+		return manager.ProgressPhaseRemoving
+	}
+	return manager.ProgressPhaseInstalling
+}
@@ -0,0 +1,69 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+)
+
+// MarkHeld sets the Status of the packages of pkgs that are in held to PackageStatusHeld, and returns pkgs.
+// Packages match by name, and by architecture when both have one.
+func MarkHeld(pkgs []PackageInfo, held []PackageInfo) []PackageInfo {
+	for i, pkg := range pkgs {
+		for _, h := range held {
+			if h.Name == pkg.Name && (h.Arch == "" || pkg.Arch == "" || h.Arch == pkg.Arch) {
+				pkgs[i].Status = PackageStatusHeld
+				break
+			}
+		}
+	}
+	return pkgs
+}
+
+// UpgradeHolding is a helper for the UpgradeAll operation of the package managers that implement HoldManager.
+// It runs upgrade on pkgs, or on all the packages if pkgs is empty, without the packages held by hm,
+// and returns the upgraded packages followed by the held packages that listUpgradable lists, with PackageStatusHeld.
+// If pkgs are all held, nothing is upgraded.
+func UpgradeHolding(ctx context.Context, hm HoldManager, pkgs []string, opts *Options,
+	listUpgradable func(context.Context, *Options) ([]PackageInfo, error),
+	upgrade func(context.Context, []string, *Options) ([]PackageInfo, error)) ([]PackageInfo, error) {
+	held, err := hm.ListHeldContext(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("listing the held packages: %w", err)
+	}
+	if len(held) == 0 {
+		return upgrade(ctx, pkgs, opts)
+	}
+
+	upgradable, err := listUpgradable(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("listing the upgradable packages: %w", err)
+	}
+	heldNames := make(map[string]bool, len(held))
+	for _, h := range held {
+		heldNames[h.Name] = true
+		if h.Arch != "" {
+			heldNames[h.Name+":"+h.Arch] = true
+		}
+	}
+	requested := make(map[string]bool, len(pkgs))
+	var unheld []string
+	for _, pkg := range pkgs {
+		requested[pkg] = true
+		if !heldNames[pkg] {
+			unheld = append(unheld, pkg)
+		}
+	}
+
+	var kept []PackageInfo
+	for _, pkg := range MarkHeld(upgradable, held) {
+		if pkg.Status == PackageStatusHeld && (len(pkgs) == 0 || requested[pkg.Name]) {
+			kept = append(kept, pkg)
+		}
+	}
+	if len(pkgs) > 0 && len(unheld) == 0 {
+		return kept, nil
+	}
+
+	packages, err := upgrade(ctx, unheld, opts)
+	return append(packages, kept...), err
+}
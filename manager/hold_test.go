@@ -0,0 +1,68 @@
+package manager_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// fakeHolder is a HoldManager that holds the packages it lists.
+type fakeHolder []manager.PackageInfo
+
+func (f fakeHolder) ListHeldContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f, nil
+}
+func (f fakeHolder) HoldContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f fakeHolder) UnholdContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+
+func TestUpgradeHolding(t *testing.T) {
+	listUpgradable := func(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+		return []manager.PackageInfo{
+			{Name: "kernel", NewVersion: "6.7", Status: manager.PackageStatusUpgradable},
+			{Name: "vim", NewVersion: "9.1", Status: manager.PackageStatusUpgradable},
+		}, nil
+	}
+	var upgraded [][]string
+	upgrade := func(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+		upgraded = append(upgraded, pkgs)
+		var packages []manager.PackageInfo
+		for _, pkg := range pkgs {
+			packages = append(packages, manager.PackageInfo{Name: pkg, Status: manager.PackageStatusInstalled})
+		}
+		return packages, nil
+	}
+	held := fakeHolder{{Name: "kernel", Status: manager.PackageStatusHeld}}
+	heldKernel := manager.PackageInfo{Name: "kernel", NewVersion: "6.7", Status: manager.PackageStatusHeld}
+
+	tests := []struct {
+		name         string
+		holder       fakeHolder
+		pkgs         []string
+		want         []manager.PackageInfo
+		wantUpgraded [][]string
+	}{
+		{"nothing held", nil, []string{"kernel"}, []manager.PackageInfo{{Name: "kernel", Status: manager.PackageStatusInstalled}}, [][]string{{"kernel"}}},
+		{"all packages", held, nil, []manager.PackageInfo{heldKernel}, [][]string{nil}},
+		{"held and unheld packages", held, []string{"kernel", "vim"}, []manager.PackageInfo{{Name: "vim", Status: manager.PackageStatusInstalled}, heldKernel}, [][]string{{"vim"}}},
+		{"only held packages", held, []string{"kernel"}, []manager.PackageInfo{heldKernel}, nil},
+	}
+	for _, tt := range tests {
+		upgraded = nil
+		got, err := manager.UpgradeHolding(context.Background(), tt.holder, tt.pkgs, nil, listUpgradable, upgrade)
+		if err != nil {
+			t.Fatalf("UpgradeHolding(%s) error = %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("UpgradeHolding(%s) = %+v, want %+v", tt.name, got, tt.want)
+		}
+		if !reflect.DeepEqual(upgraded, tt.wantUpgraded) {
+			t.Errorf("UpgradeHolding(%s) upgraded %+v, want %+v", tt.name, upgraded, tt.wantUpgraded)
+		}
+	}
+}
@@ -0,0 +1,250 @@
+// Package manager provides utilities for managing the application.
+package manager
+
+import "context"
+
+// PackageManager is the interface that defines the methods for interacting with various package managers.
+type PackageManager interface {
+	// IsAvailable checks if the package manager is available on the current system.
+	IsAvailable() bool
+
+	// GetPackageManager returns the name of the package manager.
+	GetPackageManager() string
+
+	// Install installs the specified packages using the package manager.
+	Install(pkgs []string, opts *Options) ([]PackageInfo, error)
+
+	// Delete removes the specified packages using the package manager.
+	Delete(pkgs []string, opts *Options) ([]PackageInfo, error)
+
+	// Find searches for packages using the specified keywords.
+	Find(keywords []string, opts *Options) ([]PackageInfo, error)
+
+	// ListInstalled lists all installed packages.
+	ListInstalled(opts *Options) ([]PackageInfo, error)
+
+	// ListUpgradable lists all upgradable packages.
+	ListUpgradable(opts *Options) ([]PackageInfo, error)
+
+	// UpgradeAll Upgrade upgrades all packages or only the specified ones.
+	UpgradeAll(pkgs []string, opts *Options) ([]PackageInfo, error)
+
+	// Refresh refreshes the package index.
+	Refresh(opts *Options) error
+
+	// GetPackageInfo returns information about the specified package.
+	GetPackageInfo(pkg string, opts *Options) (PackageInfo, error)
+}
+
+// PackageManagerContext is the context-aware variant of PackageManager.
+// Each method runs the package manager command bound to ctx: when ctx is canceled or its deadline passes,
+// the command and all of its child processes are killed, and the returned error wraps ctx.Err(),
+// so it can be checked with errors.Is(err, context.DeadlineExceeded) or errors.Is(err, context.Canceled).
+// All package managers shipped with syspkg implement it.
+type PackageManagerContext interface {
+	PackageManager
+
+	// InstallContext is like Install but uses ctx to bound the command.
+	InstallContext(ctx context.Context, pkgs []string, opts *Options) ([]PackageInfo, error)
+
+	// DeleteContext is like Delete but uses ctx to bound the command.
+	DeleteContext(ctx context.Context, pkgs []string, opts *Options) ([]PackageInfo, error)
+
+	// FindContext is like Find but uses ctx to bound the command.
+	FindContext(ctx context.Context, keywords []string, opts *Options) ([]PackageInfo, error)
+
+	// ListInstalledContext is like ListInstalled but uses ctx to bound the command.
+	ListInstalledContext(ctx context.Context, opts *Options) ([]PackageInfo, error)
+
+	// ListUpgradableContext is like ListUpgradable but uses ctx to bound the command.
+	ListUpgradableContext(ctx context.Context, opts *Options) ([]PackageInfo, error)
+
+	// UpgradeAllContext is like UpgradeAll but uses ctx to bound the command.
+	UpgradeAllContext(ctx context.Context, pkgs []string, opts *Options) ([]PackageInfo, error)
+
+	// RefreshContext is like Refresh but uses ctx to bound the command.
+	RefreshContext(ctx context.Context, opts *Options) error
+
+	// GetPackageInfoContext is like GetPackageInfo but uses ctx to bound the command.
+	GetPackageInfoContext(ctx context.Context, pkg string, opts *Options) (PackageInfo, error)
+}
+
+// The following interfaces are implemented by the package managers that support more than the common operations.
+// Callers check for them with As.
+
+// InstallReasonManager is implemented by the package managers that record whether packages were installed explicitly,
+// or automatically as dependencies of other packages.
+type InstallReasonManager interface {
+	// ListAutoInstalledContext lists the installed packages that were installed automatically, as dependencies.
+	ListAutoInstalledContext(ctx context.Context, opts *Options) ([]PackageInfo, error)
+
+	// MarkAutoInstalledContext marks the specified packages as installed automatically,
+	// so that they can be removed once no other package depends on them.
+	MarkAutoInstalledContext(ctx context.Context, pkgs []string, opts *Options) error
+}
+
+// AutoRemover is implemented by the package managers that can remove the packages that were installed automatically,
+// and that no other package depends on anymore.
+type AutoRemover interface {
+	// AutoRemoveContext removes the unused automatically installed packages, and returns them.
+	AutoRemoveContext(ctx context.Context, opts *Options) ([]PackageInfo, error)
+}
+
+// HistoryManager is implemented by the package managers that keep their own history of transactions,
+// and can undo them.
+type HistoryManager interface {
+	// LastTransactionContext returns the ID of the last transaction in the history of the package manager,
+	// or an empty string if there is none.
+	LastTransactionContext(ctx context.Context, opts *Options) (string, error)
+
+	// UndoTransactionContext reverts the changes of the transaction with the given ID.
+	UndoTransactionContext(ctx context.Context, id string, opts *Options) error
+}
+
+// DependencyManager is implemented by the package managers that can report the relationships between packages.
+type DependencyManager interface {
+	// DependenciesContext returns the relationships of the specified package with other packages:
+	// what it depends on, recommends, suggests, conflicts with, breaks and provides.
+	DependenciesContext(ctx context.Context, pkg string, opts *Options) ([]Dependency, error)
+
+	// ReverseDependenciesContext returns the relationships of the installed packages with the specified package:
+	// the packages that depend on it, recommend it, suggest it, conflict with it or break it, each as Name.
+	ReverseDependenciesContext(ctx context.Context, pkg string, opts *Options) ([]Dependency, error)
+}
+
+// FileManager is implemented by the package managers that know which files the installed packages ship.
+type FileManager interface {
+	// OwnerOfContext returns the installed packages that own the file or directory at path, which must be absolute.
+	// Several packages may own the same directory. It returns an error wrapping ErrPackageNotFound if no package owns it.
+	OwnerOfContext(ctx context.Context, path string, opts *Options) ([]PackageInfo, error)
+
+	// ListFilesContext returns the paths of the files and directories shipped by the specified installed package.
+	// It returns an error wrapping ErrPackageNotFound if the package is not installed.
+	ListFilesContext(ctx context.Context, pkg string, opts *Options) ([]string, error)
+}
+
+// RepositoryManager is implemented by the package managers that can manage the repositories they install packages from.
+// Changes take effect once the package index is refreshed, with Refresh.
+type RepositoryManager interface {
+	// ListRepositoriesContext returns the configured repositories, enabled or not.
+	ListRepositoriesContext(ctx context.Context, opts *Options) ([]Repository, error)
+
+	// AddRepositoryContext validates repo, then adds it. It fails if a repository with the same name exists.
+	AddRepositoryContext(ctx context.Context, repo Repository, opts *Options) error
+
+	// RemoveRepositoryContext removes the repository with the given name.
+	// It returns an error wrapping ErrRepositoryNotFound if there is none.
+	RemoveRepositoryContext(ctx context.Context, name string, opts *Options) error
+
+	// SetRepositoryEnabledContext enables or disables the repository with the given name.
+	// It returns an error wrapping ErrRepositoryNotFound if there is none.
+	SetRepositoryEnabledContext(ctx context.Context, name string, enabled bool, opts *Options) error
+}
+
+// HoldManager is implemented by the package managers that can hold packages at their installed version,
+// so that upgrades leave them alone until they are unheld. Their ListUpgradable reports the held packages
+// that have a newer version with PackageStatusHeld, and their UpgradeAll does not upgrade them, even when requested,
+// but reports them with PackageStatusHeld.
+type HoldManager interface {
+	// ListHeldContext lists the held packages.
+	ListHeldContext(ctx context.Context, opts *Options) ([]PackageInfo, error)
+
+	// HoldContext holds the specified packages at their installed version.
+	HoldContext(ctx context.Context, pkgs []string, opts *Options) ([]PackageInfo, error)
+
+	// UnholdContext releases the hold of the specified packages.
+	UnholdContext(ctx context.Context, pkgs []string, opts *Options) ([]PackageInfo, error)
+}
+
+// RequestInstaller is implemented by the package managers that can install given versions of packages,
+// for given architectures or from given sources.
+type RequestInstaller interface {
+	// InstallRequestsContext installs the packages of reqs. It returns an error wrapping ErrUnsupported
+	// if one of them uses a field that the package manager does not support.
+	InstallRequestsContext(ctx context.Context, reqs []InstallRequest, opts *Options) ([]PackageInfo, error)
+}
+
+// VersionLister is implemented by the package managers that can list the versions of a package they can install.
+type VersionLister interface {
+	// ListVersionsContext lists the versions of the specified package offered by the repositories, each as a PackageInfo
+	// whose Category is where the version comes from, such as a repository or a channel. Package managers that report
+	// the installed version list it with PackageStatusInstalled.
+	// It returns an error wrapping ErrPackageNotFound if the package manager does not know the package.
+	ListVersionsContext(ctx context.Context, pkg string, opts *Options) ([]PackageInfo, error)
+}
+
+// Downgrader is implemented by the package managers that can move installed packages to an older version.
+type Downgrader interface {
+	// DowngradeContext moves the packages of reqs to the Version they request, or, for the package managers that
+	// support it, to their previous version if Version is empty. It returns the packages whose version changed,
+	// with their previous version as Version and their current one as NewVersion.
+	DowngradeContext(ctx context.Context, reqs []InstallRequest, opts *Options) ([]PackageInfo, error)
+}
+
+// SecurityUpgrader is implemented by the package managers that can tell security updates apart from the other updates.
+// Their ListUpgradableContext reports the UpdateType of the upgradable packages, and the Severity of the security updates when known.
+type SecurityUpgrader interface {
+	// UpgradeSecurityContext upgrades the installed packages that have a security update, and returns them.
+	// Held packages are not upgraded.
+	UpgradeSecurityContext(ctx context.Context, opts *Options) ([]PackageInfo, error)
+}
+
+// FileInstaller is implemented by the package managers that can install packages from local package files,
+// such as internal builds shipped as artifacts. See DetectPackageFile.
+type FileInstaller interface {
+	// PackageFileTypes returns the types of the package files the package manager installs.
+	PackageFileTypes() []PackageFileType
+
+	// InstallFilesContext installs the packages of the files at paths, which must be of the types of PackageFileTypes,
+	// and returns the installed packages. Their dependencies are installed from the repositories.
+	InstallFilesContext(ctx context.Context, paths []string, opts *Options) ([]PackageInfo, error)
+}
+
+// StateReporter is implemented by the package managers that keep their state in files, such as their database
+// of installed packages, so that a change of the packages can be noticed without running the package manager,
+// whichever process made it.
+type StateReporter interface {
+	// StateFiles returns the paths of the files and directories whose modification time or size change
+	// when packages are installed, removed or upgraded, or when the package index is refreshed. Some may not exist.
+	StateFiles() []string
+}
+
+// Decorator wraps a package manager to add behavior to its operations, such as recording them.
+// The package manager it returns should implement Wrapper, so that As can find the optional interfaces of the wrapped one,
+// and an As method for the optional interfaces whose operations it decorates too (see As).
+type Decorator func(PackageManager) PackageManager
+
+// Wrapper is implemented by the package managers that decorate another package manager.
+type Wrapper interface {
+	// Unwrap returns the wrapped package manager.
+	Unwrap() PackageManager
+}
+
+// As returns the first package manager of the chain of pm that implements T, following Unwrap,
+// and whether there is one. Use it instead of a type assertion to check for an optional interface,
+// such as InstallReasonManager, on a package manager that may be decorated.
+//
+// Like errors.As, a package manager of the chain with an As(any) bool method is asked for T before it is unwrapped:
+// decorators use it to return their own implementation of an optional interface of the package manager they wrap,
+// so that its operations are decorated too. The method sets the *T it is given and returns true only
+// if the wrapped package manager implements T.
+func As[T any](pm PackageManager) (T, bool) {
+	for pm != nil {
+		if t, ok := pm.(T); ok {
+			return t, true
+		}
+		if a, ok := pm.(interface{ As(any) bool }); ok {
+			var t T
+			if a.As(&t) {
+				return t, true
+			}
+		}
+		w, ok := pm.(Wrapper)
+		if !ok {
+			break
+		}
+		pm = w.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
@@ -20,4 +20,11 @@ type Options struct {
 
 	// CustomCommandArgs is a slice of strings that can be used to pass additional custom arguments to the application.
 	CustomCommandArgs []string
+
+	// Progress, if set, receives structured progress events while Install, Delete and UpgradeAll are running, in non-interactive mode.
+	Progress ProgressFunc
+
+	// Concurrency limits how many package managers are queried at once by the read-only operations of SysPkg
+	// (Find, ListInstalled, ListUpgradable and GetPackageInfo). Zero means no limit, 1 queries them one at a time.
+	Concurrency int
 }
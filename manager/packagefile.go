@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PackageFileType is the format of a local package file, see FileInstaller.
+type PackageFileType string
+
+// PackageFileType constants define the formats of the package files installed by the package managers shipped with syspkg.
+const (
+	// PackageFileDeb is a Debian package, installed by apt.
+	PackageFileDeb PackageFileType = "deb"
+
+	// PackageFileRPM is an RPM package, installed by dnf.
+	PackageFileRPM PackageFileType = "rpm"
+
+	// PackageFileSnap is a snap, installed by snap.
+	PackageFileSnap PackageFileType = "snap"
+
+	// PackageFileFlatpakRef is a .flatpakref file, which describes an application and the remote it is installed from.
+	PackageFileFlatpakRef PackageFileType = "flatpakref"
+
+	// PackageFileFlatpakBundle is a .flatpak single-file bundle, which contains the application itself.
+	PackageFileFlatpakBundle PackageFileType = "flatpak"
+)
+
+// packageFileSignatures are the first bytes of the package files that have a signature.
+var packageFileSignatures = []struct {
+	prefix []byte
+	t      PackageFileType
+}{
+	// an ar archive whose first member is debian-binary
+	{[]byte("!<arch>\ndebian-binary"), PackageFileDeb},
+	// the lead of RPM packages
+	{[]byte{0xed, 0xab, 0xee, 0xdb}, PackageFileRPM},
+	// snaps are squashfs images
+	{[]byte("hsqs"), PackageFileSnap},
+	// .flatpakref files are key files whose group is Flatpak Ref
+	{[]byte("[Flatpak Ref]"), PackageFileFlatpakRef},
+}
+
+// DetectPackageFile returns the type of the package file at path, from the signature of its content,
+// or from its extension for Flatpak bundles, which have none. It returns an error wrapping ErrUnsupported
+// if path is not a package file of a known type.
+func DetectPackageFile(path string) (PackageFileType, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 64)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	head = bytes.TrimLeft(head[:n], " \t\r\n")
+
+	for _, sig := range packageFileSignatures {
+		if bytes.HasPrefix(head, sig.prefix) {
+			return sig.t, nil
+		}
+	}
+	if strings.EqualFold(filepath.Ext(path), ".flatpak") {
+		return PackageFileFlatpakBundle, nil
+	}
+	return "", fmt.Errorf("%s: unknown package file type: %w", path, ErrUnsupported)
+}
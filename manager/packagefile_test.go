@@ -0,0 +1,43 @@
+package manager_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+func TestDetectPackageFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		want    manager.PackageFileType
+	}{
+		{"hello_1.0_amd64.deb", "!<arch>\ndebian-binary   1706000000  0     0     100644  4         `\n2.0\n", manager.PackageFileDeb},
+		{"hello-1.0-1.x86_64.rpm", "\xed\xab\xee\xdb\x03\x00\x00\x00\x00\x01hello-1.0-1", manager.PackageFileRPM},
+		{"hello_1.0_amd64.snap", "hsqs\x12\x00\x00\x00", manager.PackageFileSnap},
+		{"hello.flatpakref", "[Flatpak Ref]\nName=org.example.Hello\nUrl=https://dl.example.org/repo/\n", manager.PackageFileFlatpakRef},
+		{"hello.flatpak", "\x00\x00\x00\x00bundle", manager.PackageFileFlatpakBundle},
+		{"internal-build", "!<arch>\ndebian-binary   ", manager.PackageFileDeb},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := manager.DetectPackageFile(path); got != tt.want || err != nil {
+			t.Errorf("DetectPackageFile(%s) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	path := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(path, []byte("not a package\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.DetectPackageFile(path); !errors.Is(err, manager.ErrUnsupported) {
+		t.Errorf("DetectPackageFile(notes.txt) error = %v, want %v", err, manager.ErrUnsupported)
+	}
+}
@@ -1,6 +1,8 @@
 // Package manager provides utilities for managing the application.
 package manager
 
+import "github.com/sjwhyte/syspkg/manager/version"
+
 // PackageStatus represents the current status of a package in the system.
 type PackageStatus string
 
@@ -21,6 +23,27 @@ const (
 
 	// PackageStatusConfigFiles represents a package that has only configuration files remaining on the system.
 	PackageStatusConfigFiles PackageStatus = "config-files"
+
+	// PackageStatusHeld represents an installed package that is held at its version, so that upgrades leave it alone.
+	PackageStatusHeld PackageStatus = "held"
+)
+
+// UpdateType is the kind of change an update brings, as classified by the package manager or its repositories.
+type UpdateType string
+
+// UpdateType constants define the kinds of updates.
+const (
+	// UpdateTypeSecurity is an update that fixes security issues.
+	UpdateTypeSecurity UpdateType = "security"
+
+	// UpdateTypeBugfix is an update that fixes bugs, but no security issue.
+	UpdateTypeBugfix UpdateType = "bugfix"
+
+	// UpdateTypeEnhancement is an update that brings new features.
+	UpdateTypeEnhancement UpdateType = "enhancement"
+
+	// UpdateTypeUnknown is an update whose kind the package manager does not report.
+	UpdateTypeUnknown UpdateType = ""
 )
 
 // PackageInfo contains information about a specific package.
@@ -37,6 +60,14 @@ type PackageInfo struct {
 	// Status indicates the current PackageStatus of the package.
 	Status PackageStatus
 
+	// UpdateType is the kind of update NewVersion brings, for upgradable packages. It is UpdateTypeUnknown
+	// for the package managers that do not implement SecurityUpgrader.
+	UpdateType UpdateType
+
+	// Severity is the severity of a security update, such as "Critical", "Important", "Moderate" or "Low",
+	// as reported by the package manager. It is empty if the package manager does not rate its updates.
+	Severity string
+
 	// Category is the category the package belongs to, such as "utilities" or "development".
 	Category string
 
@@ -49,3 +80,9 @@ type PackageInfo struct {
 	// AdditionalData is a map of key-value pairs that store any additional package-specific data.
 	AdditionalData map[string]string
 }
+
+// Compare compares the Version of the package with v, using the version scheme of its PackageManager
+// (see version.SchemeFor). It returns -1 if the package is older than v, 0 if it is the same version, and +1 if it is newer.
+func (p PackageInfo) Compare(v string) int {
+	return version.Compare(version.SchemeFor(p.PackageManager), p.Version, v)
+}
@@ -0,0 +1,25 @@
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+func TestPackageInfoCompare(t *testing.T) {
+	tests := []struct {
+		pkg     manager.PackageInfo
+		version string
+		want    int
+	}{
+		{manager.PackageInfo{Name: "openssl", Version: "3.0.2-0ubuntu1.8", PackageManager: "apt"}, "3.0.2-0ubuntu1.9", -1},
+		{manager.PackageInfo{Name: "vim", Version: "1.0~rc1", PackageManager: "apt"}, "1.0", -1},
+		{manager.PackageInfo{Name: "vim-enhanced", Version: "2:8.2.2637-20.el9_1", PackageManager: "dnf"}, "8.2.2637-21.el9", 1},
+		{manager.PackageInfo{Name: "hello", Version: "2.10", PackageManager: "snap"}, "2.9", 1},
+	}
+	for _, tt := range tests {
+		if got := tt.pkg.Compare(tt.version); got != tt.want {
+			t.Errorf("%+v.Compare(%q) = %d, want %d", tt.pkg, tt.version, got, tt.want)
+		}
+	}
+}
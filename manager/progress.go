@@ -0,0 +1,140 @@
+// Package manager provides utilities for managing the application.
+package manager
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// ProgressPhase is the phase of a package manager operation a ProgressEvent belongs to.
+type ProgressPhase string
+
+// ProgressPhase constants define the phases reported by the package managers.
+// Not every package manager goes through every phase.
+const (
+	// ProgressPhaseDownloading is reported while packages are downloaded.
+	ProgressPhaseDownloading ProgressPhase = "downloading"
+
+	// ProgressPhaseUnpacking is reported while package files are unpacked or mounted.
+	ProgressPhaseUnpacking ProgressPhase = "unpacking"
+
+	// ProgressPhaseInstalling is reported while packages are installed, by package managers which do not unpack and configure separately.
+	ProgressPhaseInstalling ProgressPhase = "installing"
+
+	// ProgressPhaseConfiguring is reported while packages are configured, and their scripts or hooks are run.
+	ProgressPhaseConfiguring ProgressPhase = "configuring"
+
+	// ProgressPhaseRemoving is reported while packages are removed.
+	ProgressPhaseRemoving ProgressPhase = "removing"
+
+	// ProgressPhaseVerifying is reported while the installed packages are verified.
+	ProgressPhaseVerifying ProgressPhase = "verifying"
+)
+
+// ProgressEventType is the type of a ProgressEvent.
+type ProgressEventType string
+
+// ProgressEventType constants define the types of progress events.
+const (
+	// ProgressStatus reports the current phase and completion of the operation.
+	ProgressStatus ProgressEventType = "status"
+
+	// ProgressPackageStarted reports that the package manager started working on a package.
+	ProgressPackageStarted ProgressEventType = "package-started"
+
+	// ProgressPackageFinished reports that the package manager finished working on a package.
+	ProgressPackageFinished ProgressEventType = "package-finished"
+)
+
+// ProgressEvent is a structured progress report of a running package manager operation.
+type ProgressEvent struct {
+	// PackageManager is the name of the package manager reporting the event, such as "apt".
+	PackageManager string
+
+	// Type is the type of the event.
+	Type ProgressEventType
+
+	// Phase is the phase of the operation the event belongs to.
+	Phase ProgressPhase
+
+	// Package is the name of the package the event is about, if any.
+	Package string
+
+	// Percent is the completion of the operation (or of its current phase), from 0 to 100, or -1 if unknown.
+	Percent float64
+
+	// Message is the human-readable progress message of the package manager, if any.
+	Message string
+}
+
+// ProgressFunc receives the progress events of an operation.
+// It is called from the goroutine reading the output of the package manager, so it should not block for long.
+type ProgressFunc func(event ProgressEvent)
+
+// ProgressParser turns a line of package manager output into progress events.
+// A ProgressParser may keep state between lines, so a new one must be used for every command.
+type ProgressParser func(line string) []ProgressEvent
+
+// ProgressWriter returns an io.Writer that splits what is written to it into lines, parses them with parse,
+// and reports the resulting events to opts.Progress, tagged with the package manager name pm.
+// Each package is reported as started and as finished at most once.
+// It returns nil if opts is nil or has no Progress callback, so it can be assigned to Command.Stdout as is.
+func ProgressWriter(pm string, opts *Options, parse ProgressParser) io.Writer {
+	if opts == nil || opts.Progress == nil {
+		return nil
+	}
+	return &progressWriter{
+		pm:       pm,
+		progress: opts.Progress,
+		parse:    parse,
+		seen:     make(map[ProgressEventType]map[string]bool),
+	}
+}
+
+// progressWriter is the io.Writer returned by ProgressWriter.
+type progressWriter struct {
+	mu       sync.Mutex
+	pm       string
+	progress ProgressFunc
+	parse    ProgressParser
+	partial  []byte
+	seen     map[ProgressEventType]map[string]bool
+}
+
+// Write implements io.Writer. Both "\n" and "\r" end a line, since progress bars are redrawn with "\r".
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexAny(w.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		line := string(w.partial[:i])
+		w.partial = w.partial[i+1:]
+		if len(line) > 0 {
+			w.emit(line)
+		}
+	}
+	return len(p), nil
+}
+
+// emit parses line and reports its events, skipping repeated package start and finish events.
+func (w *progressWriter) emit(line string) {
+	for _, event := range w.parse(line) {
+		if event.Type != ProgressStatus && event.Package != "" {
+			if w.seen[event.Type] == nil {
+				w.seen[event.Type] = make(map[string]bool)
+			}
+			if w.seen[event.Type][event.Package] {
+				continue
+			}
+			w.seen[event.Type][event.Package] = true
+		}
+		event.PackageManager = w.pm
+		w.progress(event)
+	}
+}
@@ -0,0 +1,51 @@
+package manager_test
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+func TestProgressWriter(t *testing.T) {
+	var events []manager.ProgressEvent
+	opts := &manager.Options{Progress: func(event manager.ProgressEvent) { events = append(events, event) }}
+
+	// reports every line as a start event, and as a status event with the line as message
+	parse := func(line string) []manager.ProgressEvent {
+		name := strings.Fields(line)[0]
+		return []manager.ProgressEvent{
+			{Type: manager.ProgressPackageStarted, Package: name},
+			{Type: manager.ProgressStatus, Package: name, Message: line},
+		}
+	}
+
+	w := manager.ProgressWriter("apt", opts, parse)
+	for _, chunk := range []string{"vim 1", "0%\rvim 20%\n", "\ngit 5%\n"} {
+		if _, err := io.WriteString(w, chunk); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	want := []manager.ProgressEvent{
+		{PackageManager: "apt", Type: manager.ProgressPackageStarted, Package: "vim"},
+		{PackageManager: "apt", Type: manager.ProgressStatus, Package: "vim", Message: "vim 10%"},
+		{PackageManager: "apt", Type: manager.ProgressStatus, Package: "vim", Message: "vim 20%"},
+		{PackageManager: "apt", Type: manager.ProgressPackageStarted, Package: "git"},
+		{PackageManager: "apt", Type: manager.ProgressStatus, Package: "git", Message: "git 5%"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("ProgressWriter() events = %+v, want %+v", events, want)
+	}
+}
+
+func TestProgressWriterWithoutCallback(t *testing.T) {
+	if w := manager.ProgressWriter("apt", &manager.Options{}, nil); w != nil {
+		t.Errorf("ProgressWriter() = %+v, want nil", w)
+	}
+	if w := manager.ProgressWriter("apt", nil, nil); w != nil {
+		t.Errorf("ProgressWriter() = %+v, want nil", w)
+	}
+}
@@ -0,0 +1,84 @@
+// Package manager provides utilities for managing the application.
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Detection priorities of the package managers shipped with syspkg.
+// Package managers with a higher priority are preferred when several of them are available.
+const (
+	// PrioritySystem is the priority of the system package managers, such as apt and dnf.
+	PrioritySystem = 100
+
+	// PriorityUniversal is the priority of the distribution-independent package managers, such as snap and flatpak.
+	PriorityUniversal = 50
+)
+
+// Factory creates a new instance of a package manager.
+type Factory func() PackageManager
+
+// Registration describes a package manager registered with Register.
+type Registration struct {
+	// Name is the name the package manager is selected by, such as "apt".
+	Name string
+
+	// Priority is the detection priority of the package manager. Higher priorities come first.
+	Priority int
+
+	// New creates a new instance of the package manager.
+	New Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Registration)
+)
+
+// Register makes a package manager available to syspkg under the given name.
+// It is meant to be called from the init function of the package implementing the package manager,
+// like apt, dnf, snap and flatpak do. If Register is called twice with the same name or if factory is nil, it panics.
+func Register(name string, priority int, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("manager: Register factory is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("manager: Register called twice for " + name)
+	}
+	registry[name] = Registration{Name: name, Priority: priority, New: factory}
+}
+
+// Registered returns the registered package managers, by decreasing priority, then by name.
+func Registered() []Registration {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	registrations := make([]Registration, 0, len(registry))
+	for _, r := range registry {
+		registrations = append(registrations, r)
+	}
+	sort.Slice(registrations, func(i, j int) bool {
+		if registrations[i].Priority != registrations[j].Priority {
+			return registrations[i].Priority > registrations[j].Priority
+		}
+		return registrations[i].Name < registrations[j].Name
+	})
+	return registrations
+}
+
+// Lookup returns the registration of the package manager with the given name.
+func Lookup(name string) (Registration, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	r, ok := registry[name]
+	if !ok {
+		return Registration{}, fmt.Errorf("unknown package manager %q", name)
+	}
+	return r, nil
+}
@@ -0,0 +1,38 @@
+package manager_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+func TestRegistry(t *testing.T) {
+	factory := func() manager.PackageManager { return nil }
+	manager.Register("test-universal", manager.PriorityUniversal, factory)
+	manager.Register("test-system-b", manager.PrioritySystem, factory)
+	manager.Register("test-system-a", manager.PrioritySystem, factory)
+
+	var names []string
+	for _, r := range manager.Registered() {
+		names = append(names, r.Name)
+	}
+	want := []string{"test-system-a", "test-system-b", "test-universal"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Registered() = %+v, want %+v", names, want)
+	}
+
+	if r, err := manager.Lookup("test-universal"); err != nil || r.Priority != manager.PriorityUniversal {
+		t.Errorf("Lookup() = %+v, %v, want priority %d", r, err, manager.PriorityUniversal)
+	}
+	if _, err := manager.Lookup("nosuchmanager"); err == nil {
+		t.Errorf("Lookup() error = nil, want an error for an unknown package manager")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Register() twice did not panic")
+		}
+	}()
+	manager.Register("test-universal", manager.PriorityUniversal, factory)
+}
@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Repository is a source of packages of a package manager: an apt source, a dnf repository or a flatpak remote.
+// Fields that a package manager does not use are empty, and rejected by its AddRepository.
+type Repository struct {
+	// Name identifies the repository in its package manager: the name of a dnf repository or of a flatpak remote,
+	// or the name of the file of an apt source, without directory nor extension, such as "docker" for
+	// /etc/apt/sources.list.d/docker.sources. apt sources defined in the same file share their name.
+	Name string
+
+	// Title is the human-readable name of the repository, if any.
+	Title string
+
+	// URLs are the base URLs of the repository. For dnf, they may be a metalink or mirror list URL instead.
+	URLs []string
+
+	// Disabled reports that the repository is configured, but not used.
+	Disabled bool
+
+	// Key is the key the repository is signed with: the keyring file (Signed-By) of an apt source,
+	// the key URL (gpgkey) of a dnf repository, or the key file imported for a flatpak remote.
+	Key string
+
+	// Types are the types of an apt source, "deb" or "deb-src". apt sources are added with type "deb" by default.
+	Types []string
+
+	// Suites are the distributions of an apt source, such as "jammy" and "jammy-updates",
+	// or a path ending with a slash for a flat repository.
+	Suites []string
+
+	// Components are the components of an apt source, such as "main" and "universe". Flat repositories have none.
+	Components []string
+
+	// Architectures are the architectures an apt source is restricted to, if any.
+	Architectures []string
+
+	// File is the file the repository is defined in, if any. It is ignored by AddRepository.
+	File string
+}
+
+// String returns a human-readable description of the repository, such as "docker: https://download.docker.com/linux/ubuntu jammy stable".
+func (r Repository) String() string {
+	s := r.Name + ":"
+	if len(r.Types) > 0 {
+		s += " " + strings.Join(r.Types, ",")
+	}
+	s += " " + strings.Join(r.URLs, " ")
+	if len(r.Suites) > 0 {
+		s += " " + strings.Join(r.Suites, ",")
+	}
+	if len(r.Components) > 0 {
+		s += " " + strings.Join(r.Components, " ")
+	}
+	if r.Disabled {
+		s += " (disabled)"
+	}
+	return s
+}
+
+// repositoryNameRe matches the valid repository names. They are used as file names.
+var repositoryNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Validate checks the fields common to all package managers: the name of the repository, which must be usable
+// as a file name, and its URLs, which must be absolute. Package managers check the other fields when adding it.
+func (r Repository) Validate() error {
+	if !repositoryNameRe.MatchString(r.Name) {
+		return fmt.Errorf("invalid repository name %q: it must only contain letters, digits, dots, dashes and underscores", r.Name)
+	}
+	if len(r.URLs) == 0 {
+		return fmt.Errorf("repository %s: no URL", r.Name)
+	}
+	for _, u := range r.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("repository %s: invalid URL %q: %w", r.Name, u, err)
+		}
+		if !parsed.IsAbs() {
+			return fmt.Errorf("repository %s: URL %q is not absolute", r.Name, u)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+)
+
+// InstallRequest is a request to install a package, optionally at a given version, for a given architecture,
+// or from a given source. Each package manager translates it into its own arguments, see RequestInstaller.
+type InstallRequest struct {
+	// Name is the name of the package, such as "nginx", or the ID of a Flatpak application.
+	Name string
+
+	// Version is the exact version to install, such as "1.18.0-6ubuntu14" for apt or "1:1.20.1-10.el9" for dnf.
+	// For snap it is a revision, such as "3728", and for flatpak a commit. Empty for the version the package manager picks.
+	Version string
+
+	// Arch is the architecture to install the package for, such as "i386". Empty for the native one.
+	Arch string
+
+	// Source is where to install the package from: a release such as "jammy-backports" for apt,
+	// a channel such as "latest/beta" for snap, or a remote such as "flathub" for flatpak.
+	Source string
+}
+
+// String returns the request in the syntax read by ParseInstallRequest, such as "nginx:amd64=1.18.0-6ubuntu14".
+func (r InstallRequest) String() string {
+	s := r.Name
+	if r.Arch != "" {
+		s += ":" + r.Arch
+	}
+	if r.Version != "" {
+		s += "=" + r.Version
+	}
+	if r.Source != "" {
+		s += "@" + r.Source
+	}
+	return s
+}
+
+// ParseInstallRequest parses an install request written as name[:arch][=version][@source],
+// such as "nginx=1.18.0-6ubuntu14", "libc6:i386" or "firefox@latest/beta".
+func ParseInstallRequest(s string) (InstallRequest, error) {
+	var r InstallRequest
+	rest, source, _ := strings.Cut(s, "@")
+	rest, r.Version, _ = strings.Cut(rest, "=")
+	r.Name, r.Arch, _ = strings.Cut(rest, ":")
+	r.Source = source
+	if r.Name == "" || strings.ContainsAny(s, " \t") {
+		return r, fmt.Errorf("invalid install request %q: it must be name[:arch][=version][@source]", s)
+	}
+	return r, nil
+}
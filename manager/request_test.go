@@ -0,0 +1,36 @@
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+func TestParseInstallRequest(t *testing.T) {
+	tests := []struct {
+		in   string
+		want manager.InstallRequest
+	}{
+		{"nginx", manager.InstallRequest{Name: "nginx"}},
+		{"nginx=1.18.0-6ubuntu14", manager.InstallRequest{Name: "nginx", Version: "1.18.0-6ubuntu14"}},
+		{"vim=2:8.2.3995-1ubuntu2", manager.InstallRequest{Name: "vim", Version: "2:8.2.3995-1ubuntu2"}},
+		{"libc6:i386", manager.InstallRequest{Name: "libc6", Arch: "i386"}},
+		{"firefox@latest/beta", manager.InstallRequest{Name: "firefox", Source: "latest/beta"}},
+		{"org.gimp.GIMP:aarch64=4f0e2d@flathub", manager.InstallRequest{Name: "org.gimp.GIMP", Arch: "aarch64", Version: "4f0e2d", Source: "flathub"}},
+	}
+	for _, tt := range tests {
+		got, err := manager.ParseInstallRequest(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseInstallRequest(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+		if got.String() != tt.in {
+			t.Errorf("ParseInstallRequest(%q).String() = %q, want %q", tt.in, got.String(), tt.in)
+		}
+	}
+
+	for _, in := range []string{"", "=1.0", "nginx 1.0"} {
+		if _, err := manager.ParseInstallRequest(in); err == nil {
+			t.Errorf("ParseInstallRequest(%q) error = nil, want an error", in)
+		}
+	}
+}
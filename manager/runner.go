@@ -0,0 +1,146 @@
+// Package manager provides utilities for managing the application.
+package manager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// Command describes a single package manager command to be run by a CommandRunner.
+type Command struct {
+	// Name is the program to run, such as "apt" or "dpkg-query".
+	Name string
+
+	// Args are the command line arguments, not including the program name.
+	Args []string
+
+	// Env is the environment of the command. If nil, the command inherits the environment of the current process.
+	Env []string
+
+	// Stdin is the standard input of the command. If nil, the command reads from the null device.
+	Stdin io.Reader
+
+	// Stdout, if not nil, receives the standard output of the command as it is produced, in addition to it being captured.
+	Stdout io.Writer
+
+	// Stderr, if not nil, receives the standard error of the command as it is produced, in addition to it being captured.
+	Stderr io.Writer
+
+	// Interactive indicates that the command should be attached to the current terminal, so that it can prompt the user.
+	// The output of an interactive command is not captured.
+	Interactive bool
+}
+
+// Argv returns the program name followed by the arguments of the command.
+func (c Command) Argv() []string {
+	return append([]string{c.Name}, c.Args...)
+}
+
+// String returns the command line of the command, for logging purposes.
+func (c Command) String() string {
+	return strings.Join(c.Argv(), " ")
+}
+
+// Result is the outcome of a command run by a CommandRunner.
+type Result struct {
+	// Stdout is the captured standard output of the command.
+	Stdout []byte
+
+	// Stderr is the captured standard error of the command.
+	Stderr []byte
+
+	// ExitCode is the exit code of the command, or -1 if it did not exit normally (e.g. it was killed).
+	ExitCode int
+}
+
+// CommandRunner runs package manager commands.
+// Every package manager shipped with syspkg runs its commands through a CommandRunner,
+// which makes it possible to redirect their execution (e.g. to a container or a remote host),
+// or to replace it with a scripted fake in tests (see the runnertest package).
+type CommandRunner interface {
+	// Run runs cmd and waits for it to complete.
+	// If the command exits with a non-zero status, Run returns the Result along with an *ExitError.
+	// If ctx is done before the command completes, the command is stopped and the returned error wraps ctx.Err().
+	Run(ctx context.Context, cmd Command) (Result, error)
+}
+
+// ExitError is returned by a CommandRunner when a command exits with a non-zero status.
+type ExitError struct {
+	// Command is the command that failed.
+	Command Command
+
+	// ExitCode is the exit code of the command.
+	ExitCode int
+
+	// Stderr is the captured standard error of the command, if any.
+	Stderr []byte
+}
+
+// Error implements the error interface.
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("%s: exit status %d", e.Command.Name, e.ExitCode)
+}
+
+// LocalRunner is a CommandRunner that runs commands on the local system.
+type LocalRunner struct{}
+
+// DefaultRunner is the CommandRunner used by package managers that are not given one explicitly.
+var DefaultRunner CommandRunner = LocalRunner{}
+
+// Run runs cmd on the local system. Non-interactive commands are started in their own process group,
+// so that canceling ctx stops every process they spawned.
+func (LocalRunner) Run(ctx context.Context, cmd Command) (Result, error) {
+	var c *exec.Cmd
+	var stdout, stderr bytes.Buffer
+
+	if cmd.Interactive {
+		c = InteractiveCommandContext(ctx, cmd.Name, cmd.Args...)
+	} else {
+		c = CommandContext(ctx, cmd.Name, cmd.Args...)
+		c.Stdout = teeWriter(&stdout, cmd.Stdout)
+		c.Stderr = teeWriter(&stderr, cmd.Stderr)
+	}
+	c.Env = cmd.Env
+	if cmd.Stdin != nil {
+		c.Stdin = cmd.Stdin
+	}
+
+	err := c.Run()
+	res := Result{
+		Stdout:   stdout.Bytes(),
+		Stderr:   stderr.Bytes(),
+		ExitCode: c.ProcessState.ExitCode(),
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return res, ContextError(ctx, err)
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && res.ExitCode > 0 {
+			return res, &ExitError{Command: cmd, ExitCode: res.ExitCode, Stderr: res.Stderr}
+		}
+		return res, err
+	}
+	return res, nil
+}
+
+// teeWriter returns a writer duplicating its writes to buf and w, or buf alone if w is nil.
+func teeWriter(buf *bytes.Buffer, w io.Writer) io.Writer {
+	if w == nil {
+		return buf
+	}
+	return io.MultiWriter(buf, w)
+}
+
+// RunnerOrDefault returns runner, or DefaultRunner if runner is nil.
+func RunnerOrDefault(runner CommandRunner) CommandRunner {
+	if runner == nil {
+		return DefaultRunner
+	}
+	return runner
+}
@@ -0,0 +1,34 @@
+//go:build !windows
+
+package manager_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+func TestLocalRunner(t *testing.T) {
+	cmd := manager.Command{
+		Name:  "sh",
+		Args:  []string{"-c", "cat; echo oops >&2; exit 3"},
+		Env:   []string{"LC_ALL=C"},
+		Stdin: strings.NewReader("hello\n"),
+	}
+
+	res, err := manager.LocalRunner{}.Run(context.Background(), cmd)
+
+	var exitErr *manager.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode != 3 {
+		t.Fatalf("Run() error = %+v, want exit status 3", err)
+	}
+	if string(res.Stdout) != "hello\n" || string(res.Stderr) != "oops\n" || res.ExitCode != 3 {
+		t.Errorf("Run() = %+v, want stdout %q, stderr %q, exit code 3", res, "hello\n", "oops\n")
+	}
+	if string(exitErr.Stderr) != "oops\n" {
+		t.Errorf("ExitError.Stderr = %q, want %q", exitErr.Stderr, "oops\n")
+	}
+}
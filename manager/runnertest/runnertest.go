@@ -0,0 +1,135 @@
+// Package runnertest provides a scripted manager.CommandRunner for testing package managers
+// without running the real package manager tools.
+//
+// Example:
+//
+//	runner := runnertest.New(runnertest.Response{Stdout: "Setting up vim (8.2.3995-1ubuntu2) ...\n"})
+//	aptManager := &apt.PackageManager{Runner: runner}
+//	pkgs, err := aptManager.Install([]string{"vim"}, nil)
+//	// runner.Argv() == [][]string{{"apt", "install", "-f", "vim", "-y"}}
+package runnertest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// Response is the scripted outcome of a single command.
+type Response struct {
+	// Stdout is returned as the standard output of the command.
+	Stdout string
+
+	// Stderr is returned as the standard error of the command.
+	Stderr string
+
+	// ExitCode is the exit code of the command. A non-zero exit code makes Run return a *manager.ExitError.
+	ExitCode int
+
+	// Err, if set, is returned by Run as is, e.g. to simulate a command that cannot be started.
+	Err error
+}
+
+// Runner is a manager.CommandRunner that records the commands it is asked to run,
+// and answers them with scripted responses, in order.
+// It is safe for concurrent use.
+type Runner struct {
+	mu        sync.Mutex
+	responses []Response
+	calls     []manager.Command
+	stdin     [][]byte
+}
+
+// make sure Runner implements manager.CommandRunner
+var _ manager.CommandRunner = (*Runner)(nil)
+
+// New returns a Runner that answers commands with the given responses, in order.
+func New(responses ...Response) *Runner {
+	return &Runner{responses: responses}
+}
+
+// Push appends responses to the script of the Runner.
+func (r *Runner) Push(responses ...Response) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responses = append(r.responses, responses...)
+}
+
+// Run records cmd and returns the next scripted response.
+// The scripted output is also written to cmd.Stdout and cmd.Stderr, if set.
+// It returns an error if the script has run out of responses, or if ctx is already done.
+func (r *Runner) Run(ctx context.Context, cmd manager.Command) (manager.Result, error) {
+	var stdin []byte
+	if cmd.Stdin != nil {
+		stdin, _ = io.ReadAll(cmd.Stdin)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, cmd)
+	r.stdin = append(r.stdin, stdin)
+
+	if err := ctx.Err(); err != nil {
+		return manager.Result{ExitCode: -1}, manager.ContextError(ctx, err)
+	}
+
+	if len(r.responses) == 0 {
+		return manager.Result{ExitCode: -1}, fmt.Errorf("runnertest: unexpected command: %s", cmd)
+	}
+	resp := r.responses[0]
+	r.responses = r.responses[1:]
+
+	if cmd.Stdout != nil {
+		_, _ = io.WriteString(cmd.Stdout, resp.Stdout)
+	}
+	if cmd.Stderr != nil {
+		_, _ = io.WriteString(cmd.Stderr, resp.Stderr)
+	}
+
+	res := manager.Result{
+		Stdout:   []byte(resp.Stdout),
+		Stderr:   []byte(resp.Stderr),
+		ExitCode: resp.ExitCode,
+	}
+	if resp.Err != nil {
+		return res, resp.Err
+	}
+	if resp.ExitCode != 0 {
+		return res, &manager.ExitError{Command: cmd, ExitCode: resp.ExitCode, Stderr: res.Stderr}
+	}
+	return res, nil
+}
+
+// Calls returns the commands run so far, in order.
+func (r *Runner) Calls() []manager.Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]manager.Command(nil), r.calls...)
+}
+
+// Argv returns the program name and arguments of the commands run so far, in order.
+func (r *Runner) Argv() [][]string {
+	var argv [][]string
+	for _, cmd := range r.Calls() {
+		argv = append(argv, cmd.Argv())
+	}
+	return argv
+}
+
+// Stdin returns what the i-th command run so far received on its standard input.
+func (r *Runner) Stdin(i int) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stdin[i]
+}
+
+// Remaining returns the number of scripted responses that have not been used yet.
+func (r *Runner) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.responses)
+}
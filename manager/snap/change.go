@@ -0,0 +1,163 @@
+package snap
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// ChangePollInterval is how often the tasks of a snapd change are polled to report its progress.
+var ChangePollInterval = time.Second
+
+// changeIDPattern matches the change id printed by snap commands run with ArgsNoWait.
+var changeIDPattern = regexp.MustCompile(`^\d+$`)
+
+// runChange runs the snap command with args without waiting for the resulting snapd change,
+// then polls the tasks of the change and reports them to opts.Progress until the change is ready.
+// It returns the names of the snaps the change worked on, and whether a change was started at all:
+// if not (e.g. nothing to refresh), res holds the output of the command.
+func (a *PackageManager) runChange(ctx context.Context, args []string, opts *manager.Options) (snaps []string, changed bool, res manager.Result, err error) {
+	args = append(args, ArgsNoWait)
+	res, err = a.run(ctx, manager.Command{Name: pm, Args: args, Env: append(os.Environ(), ENV_NonInteractive...)})
+	if err != nil {
+		return nil, false, res, err
+	}
+	id := strings.TrimSpace(string(res.Stdout))
+	if !changeIDPattern.MatchString(id) {
+		return nil, false, res, nil
+	}
+
+	tracker := changeTracker{progress: opts.Progress, started: make(map[string]bool), finished: make(map[string]bool)}
+	ticker := time.NewTicker(ChangePollInterval)
+	defer ticker.Stop()
+
+	for {
+		tasksRes, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"tasks", id}, Env: ENV_NonInteractive})
+		if err != nil {
+			if ctx.Err() != nil {
+				a.abortChange(id)
+			}
+			return nil, true, res, err
+		}
+		if tracker.update(ParseTasksOutput(string(tasksRes.Stdout))) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			a.abortChange(id)
+			return nil, true, res, manager.ContextError(ctx, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	// snap watch returns at once for a ready change, and fails with the errors of the change, if any
+	_, err = a.run(ctx, manager.Command{Name: pm, Args: []string{"watch", id}, Env: ENV_NonInteractive})
+	return tracker.snaps, true, res, err
+}
+
+// listSnaps returns the installed snaps among names.
+func (a *PackageManager) listSnaps(ctx context.Context, names []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: append([]string{"list"}, names...), Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	packages := ParseListOutput(string(res.Stdout), opts)
+	for i := range packages {
+		packages[i].Status = manager.PackageStatusInstalled
+	}
+	return packages, nil
+}
+
+// abortChange asks snapd to abort the change with the given id, after the operation was canceled.
+func (a *PackageManager) abortChange(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), manager.KillGracePeriod)
+	defer cancel()
+	_, _ = a.run(ctx, manager.Command{Name: pm, Args: []string{"abort", id}, Env: ENV_NonInteractive})
+}
+
+// changeTracker turns successive task lists of a snapd change into progress events.
+type changeTracker struct {
+	progress manager.ProgressFunc
+	snaps    []string
+	started  map[string]bool
+	finished map[string]bool
+	last     manager.ProgressEvent
+}
+
+// update reports the progress made since the previous task list, and whether the change is ready.
+func (c *changeTracker) update(tasks []Task) bool {
+	if len(tasks) == 0 {
+		return false
+	}
+
+	ready := 0
+	current := currentTask(tasks)
+	pending := make(map[string]bool)
+	for _, task := range tasks {
+		if task.Ready() {
+			ready++
+		}
+		name := task.Snap()
+		if name == "" {
+			continue
+		}
+		if task.Status != "Do" && !c.started[name] {
+			c.started[name] = true
+			c.snaps = append(c.snaps, name)
+			c.emit(manager.ProgressEvent{Type: manager.ProgressPackageStarted, Phase: task.Phase(), Package: name, Percent: -1, Message: task.Summary})
+		}
+		if !task.Ready() {
+			pending[name] = true
+		}
+	}
+
+	status := manager.ProgressEvent{
+		Type:    manager.ProgressStatus,
+		Phase:   current.Phase(),
+		Package: current.Snap(),
+		Percent: float64(ready) * 100 / float64(len(tasks)),
+		Message: current.Summary,
+	}
+	if status != c.last {
+		c.last = status
+		c.emit(status)
+	}
+
+	for _, name := range c.snaps {
+		if !pending[name] && !c.finished[name] {
+			c.finished[name] = true
+			c.emit(manager.ProgressEvent{Type: manager.ProgressPackageFinished, Phase: status.Phase, Package: name, Percent: status.Percent})
+		}
+	}
+
+	return ready == len(tasks)
+}
+
+// currentTask returns the task snapd is working on: the first one in progress, or else the first one not ready yet, or else the last one.
+func currentTask(tasks []Task) Task {
+	for _, task := range tasks {
+		if task.Status == "Doing" || task.Status == "Undoing" {
+			return task
+		}
+	}
+	for _, task := range tasks {
+		if !task.Ready() {
+			return task
+		}
+	}
+	return tasks[len(tasks)-1]
+}
+
+// emit reports event to the progress callback.
+func (c *changeTracker) emit(event manager.ProgressEvent) {
+	event.PackageManager = pm
+	c.progress(event)
+}
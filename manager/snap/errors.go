@@ -0,0 +1,18 @@
+package snap
+
+import (
+	"regexp"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// errorRules classify the failures of snap, checked in order.
+// snap exits with status 1 for every error, so the classification relies on its "error:" messages.
+var errorRules = []manager.ErrorRule{
+	{Kind: manager.ErrPermissionDenied, Pattern: regexp.MustCompile(`access denied|Permission denied|permission denied`)},
+	{Kind: manager.ErrLocked, Pattern: regexp.MustCompile(`has .* change in progress|changes in progress|snap "[^"]*" has running apps`)},
+	{Kind: manager.ErrDiskFull, Pattern: regexp.MustCompile(`insufficient space|not enough disk space|No space left on device`)},
+	{Kind: manager.ErrPackageNotFound, Pattern: regexp.MustCompile(`snap "[^"]*" not found|snap "[^"]*" is not installed|no matching snaps`)},
+	{Kind: manager.ErrDependencyConflict, Pattern: regexp.MustCompile(`cannot install .* requires|conflicts with`)},
+	{Kind: manager.ErrNetwork, Pattern: regexp.MustCompile(`unable to contact snap store|cannot communicate with server|dial tcp|no such host|timeout exceeded while waiting`)},
+}
@@ -0,0 +1,71 @@
+package snap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// snapDir is the directory where snaps are mounted, each under its name.
+const snapDir = "/snap"
+
+// OwnerOf returns the snap that owns the file or directory at path: the one mounted on /snap/<name>, whose
+// commands are /snap/bin/<name> and /snap/bin/<name>.<command>, or whose data is in /var/snap/<name>.
+func (a *PackageManager) OwnerOf(path string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.OwnerOfContext(context.Background(), path, opts)
+}
+
+// OwnerOfContext is like OwnerOf. It does not run any command.
+func (a *PackageManager) OwnerOfContext(ctx context.Context, path string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	name := ownerOf(path)
+	if name == "" {
+		return nil, fmt.Errorf("%s: %w", path, manager.ErrPackageNotFound)
+	}
+	return []manager.PackageInfo{{Name: name, Status: manager.PackageStatusInstalled, PackageManager: pm}}, nil
+}
+
+// ownerOf returns the name of the snap whose mount point, commands or data contain path, if any.
+func ownerOf(path string) string {
+	parts := strings.Split(strings.TrimPrefix(filepath.Clean(path), "/"), "/")
+	switch {
+	case len(parts) >= 3 && parts[0] == "snap" && parts[1] == "bin":
+		name, _, _ := strings.Cut(parts[2], ".")
+		return name
+	case len(parts) >= 2 && parts[0] == "snap" && parts[1] != "bin":
+		return parts[1]
+	case len(parts) >= 3 && parts[0] == "var" && parts[1] == "snap":
+		return parts[2]
+	}
+	return ""
+}
+
+// ListFiles returns the files of the current revision of the specified installed snap, under /snap/<name>/current.
+func (a *PackageManager) ListFiles(pkg string, opts *manager.Options) ([]string, error) {
+	return a.ListFilesContext(context.Background(), pkg, opts)
+}
+
+// ListFilesContext is like ListFiles. It does not run any command, and stops listing the files when ctx is done.
+func (a *PackageManager) ListFilesContext(ctx context.Context, pkg string, opts *manager.Options) ([]string, error) {
+	// snap names never contain slashes nor start with a dot, so pkg cannot point outside of snapDir
+	if pkg == "" || strings.ContainsRune(pkg, '/') || strings.HasPrefix(pkg, ".") {
+		return nil, fmt.Errorf("%q: %w", pkg, manager.ErrPackageNotFound)
+	}
+
+	var files []string
+	err := filepath.WalkDir(filepath.Join(snapDir, pkg, "current"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		files = append(files, path)
+		return ctx.Err()
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s: %w", pkg, manager.ErrPackageNotFound)
+	}
+	return files, err
+}
@@ -16,6 +16,8 @@
 package snap
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
@@ -25,6 +27,10 @@ import (
 
 var pm string = "snap"
 
+func init() {
+	manager.Register(pm, manager.PriorityUniversal, func() manager.PackageManager { return &PackageManager{} })
+}
+
 // Constants for various command line arguments used by the snap package manager.
 const (
 	ArgsAssumeYes    string = "-y"
@@ -35,13 +41,28 @@ const (
 	ArgsPurge        string = "--purge"
 	ArgsAutoRemove   string = "--autoremove"
 	ArgsShowProgress string = "--show-progress"
+	ArgsNoWait       string = "--no-wait"
 )
 
 // ENV_NonInteractive is an environment variable configuration to set non-interactive mode for package manager commands.
 var ENV_NonInteractive []string = []string{"LC_ALL=C"}
 
-// PackageManager is an empty struct that implements the manager.PackageManager interface for the snap package manager.
-type PackageManager struct{}
+// PackageManager implements the manager.PackageManager interface for the snap package manager.
+type PackageManager struct {
+	// Runner runs the package manager commands. If nil, manager.DefaultRunner is used.
+	Runner manager.CommandRunner
+}
+
+// runner returns the CommandRunner used to run the package manager commands.
+func (a *PackageManager) runner() manager.CommandRunner {
+	return manager.RunnerOrDefault(a.Runner)
+}
+
+// run runs cmd with the CommandRunner of the package manager, and classifies its failures with errorRules.
+func (a *PackageManager) run(ctx context.Context, cmd manager.Command) (manager.Result, error) {
+	res, err := a.runner().Run(ctx, cmd)
+	return res, manager.ClassifyError(pm, res, err, errorRules)
+}
 
 // IsAvailable checks if the snap package manager is available on the system.
 func (a *PackageManager) IsAvailable() bool {
@@ -56,7 +77,17 @@ func (a *PackageManager) GetPackageManager() string {
 
 // Install installs the specified packages using the snap package manager with the provided options.
 func (a *PackageManager) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
-	args := append([]string{"install", ArgsFixBroken}, pkgs...)
+	return a.InstallContext(context.Background(), pkgs, opts)
+}
+
+// InstallContext is like Install but uses ctx to bound the snap command.
+func (a *PackageManager) InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.install(ctx, pkgs, nil, opts)
+}
+
+// install installs pkgs with snap install, passing it the extra flags.
+func (a *PackageManager) install(ctx context.Context, pkgs []string, flags []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	args := append(append([]string{"install", ArgsFixBroken}, pkgs...), flags...)
 
 	if opts == nil {
 		opts = &manager.Options{
@@ -79,29 +110,39 @@ func (a *PackageManager) Install(pkgs []string, opts *manager.Options) ([]manage
 		args = append(args, ArgsShowProgress)
 	}
 
-	cmd := exec.Command(pm, args...)
-	// cmd.Env = append(os.Environ(), ENV_NonInteractive...)
-
 	log.Printf("Running command: %s %s", pm, args)
 
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	}
 
-	cmd.Env = append(os.Environ(), ENV_NonInteractive...)
-	out, err := cmd.Output()
+	// follow the snapd change to report its progress
+	if opts.Progress != nil && !opts.DryRun {
+		snaps, changed, res, err := a.runChange(ctx, args, opts)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			return ParseInstallOutput(string(res.Stdout), opts), nil
+		}
+		return a.listSnaps(ctx, snaps, opts)
+	}
+
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: append(os.Environ(), ENV_NonInteractive...)})
 	if err != nil {
 		return nil, err
 	}
-	return ParseInstallOutput(string(out), opts), nil
+	return ParseInstallOutput(string(res.Stdout), opts), nil
 }
 
 // Delete removes the specified packages using the snap package manager with the provided options.
 func (a *PackageManager) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.DeleteContext(context.Background(), pkgs, opts)
+}
+
+// DeleteContext is like Delete but uses ctx to bound the snap command.
+func (a *PackageManager) DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
 	args := append([]string{"remove", ArgsFixBroken}, pkgs...)
 
 	if opts == nil {
@@ -125,74 +166,117 @@ func (a *PackageManager) Delete(pkgs []string, opts *manager.Options) ([]manager
 		args = append(args, ArgsShowProgress)
 	}
 
-	cmd := exec.Command(pm, args...)
-	// cmd.Env = append(os.Environ(), ENV_NonInteractive...)
-
 	log.Printf("Running command: %s %s", pm, args)
 
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	}
 
-	cmd.Env = append(os.Environ(), ENV_NonInteractive...)
-	out, err := cmd.Output()
+	// follow the snapd change to report its progress
+	if opts.Progress != nil && !opts.DryRun {
+		snaps, changed, res, err := a.runChange(ctx, args, opts)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			return ParseInstallOutput(string(res.Stdout), opts), nil
+		}
+		var packages []manager.PackageInfo
+		for _, name := range snaps {
+			packages = append(packages, manager.PackageInfo{Name: name, Status: manager.PackageStatusAvailable, PackageManager: pm})
+		}
+		return packages, nil
+	}
+
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: append(os.Environ(), ENV_NonInteractive...)})
 	if err != nil {
 		return nil, err
 	}
-	return ParseInstallOutput(string(out), opts), nil
+	return ParseInstallOutput(string(res.Stdout), opts), nil
 }
 
 // Refresh refreshes the package index for the snap package manager. Currently not implemented.
 func (a *PackageManager) Refresh(opts *manager.Options) error {
+	return a.RefreshContext(context.Background(), opts)
+}
+
+// RefreshContext is like Refresh. Currently not implemented.
+func (a *PackageManager) RefreshContext(ctx context.Context, opts *manager.Options) error {
 	return nil
 }
 
 // Find searches for packages matching the provided keywords using the snap package manager.
 func (a *PackageManager) Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
-	args := append([]string{"search"}, keywords...)
-	cmd := exec.Command("snap", args...)
-	cmd.Env = ENV_NonInteractive
+	return a.FindContext(context.Background(), keywords, opts)
+}
 
-	out, err := cmd.Output()
+// FindContext is like Find but uses ctx to bound the snap command.
+func (a *PackageManager) FindContext(ctx context.Context, keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	args := append([]string{"search"}, keywords...)
+	res, err := a.run(ctx, manager.Command{Name: "snap", Args: args, Env: ENV_NonInteractive})
 	if err != nil {
 		return nil, err
 	}
 
-	return ParseFindOutput(string(out), opts), nil
+	return ParseFindOutput(string(res.Stdout), opts), nil
 }
 
 // ListInstalled lists all installed packages using the snap package manager.
 func (a *PackageManager) ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
-	cmd := exec.Command("snap", "list")
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	return a.ListInstalledContext(context.Background(), opts)
+}
+
+// ListInstalledContext is like ListInstalled but uses ctx to bound the snap command.
+func (a *PackageManager) ListInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: "snap", Args: []string{"list"}, Env: ENV_NonInteractive})
 	if err != nil {
 		return nil, err
 	}
-	return ParseListInstalledOutput(string(out), opts), nil
+	return ParseListInstalledOutput(string(res.Stdout), opts), nil
 }
 
 // ListUpgradable lists all upgradable packages using the snap package manager.
 func (a *PackageManager) ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error) {
-	cmd := exec.Command(pm, "refresh", "--list")
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	return a.ListUpgradableContext(context.Background(), opts)
+}
+
+// ListUpgradableContext is like ListUpgradable but uses ctx to bound the snap commands.
+// Held snaps are reported with manager.PackageStatusHeld.
+func (a *PackageManager) ListUpgradableContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	packages, err := a.listUpgradable(ctx, opts)
+	if err != nil || len(packages) == 0 {
+		return packages, err
+	}
+	held, err := a.ListHeldContext(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return manager.MarkHeld(packages, held), nil
+}
+
+// listUpgradable lists the upgradable snaps, held or not.
+func (a *PackageManager) listUpgradable(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"refresh", "--list"}, Env: ENV_NonInteractive})
 	if err != nil {
 		return nil, err
 	}
-	return ParseListUpgradableOutput(string(out), opts), nil
+	return ParseListUpgradableOutput(string(res.Stdout), opts), nil
 }
 
 // Upgrade upgrades the specified packages using the snap package manager with the provided options.
 func (a *PackageManager) Upgrade(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
-	args := []string{"refresh"}
-	if len(pkgs) > 0 {
-		args = append(args, pkgs...)
-	}
+	return a.UpgradeContext(context.Background(), pkgs, opts)
+}
+
+// UpgradeContext is like Upgrade but uses ctx to bound the snap command.
+func (a *PackageManager) UpgradeContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.refresh(ctx, pkgs, nil, opts)
+}
+
+// refresh refreshes pkgs, or all the snaps if there are none, with snap refresh, passing it the extra flags.
+func (a *PackageManager) refresh(ctx context.Context, pkgs []string, flags []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	args := append(append([]string{"refresh"}, pkgs...), flags...)
 
 	if opts == nil {
 		opts = &manager.Options{
@@ -215,40 +299,250 @@ func (a *PackageManager) Upgrade(pkgs []string, opts *manager.Options) ([]manage
 		args = append(args, ArgsShowProgress)
 	}
 
-	cmd := exec.Command(pm, args...)
-	// cmd.Env = append(os.Environ(), ENV_NonInteractive...)
-
 	log.Printf("Running command: %s %s", pm, args)
 
 	if opts.Interactive {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		err := cmd.Run()
+		_, err := a.run(ctx, manager.Command{Name: pm, Args: args, Interactive: true})
 		return nil, err
 	}
 
+	// follow the snapd change to report its progress
+	if opts.Progress != nil && !opts.DryRun {
+		snaps, changed, res, err := a.runChange(ctx, args, opts)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			return ParseInstallOutput(string(res.Stdout), opts), nil
+		}
+		return a.listSnaps(ctx, snaps, opts)
+	}
+
 	// cmd.Env = append(os.Environ(), ENV_NonInteractive...)
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: ENV_NonInteractive})
 	if err != nil {
 		return nil, err
 	}
-	return ParseInstallOutput(string(out), opts), nil
+	return ParseInstallOutput(string(res.Stdout), opts), nil
 }
 
 // UpgradeAll upgrades all upgradable packages using the snap package manager with the provided options.
+// Held snaps are not refreshed, but reported with manager.PackageStatusHeld.
 func (a *PackageManager) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
-	return a.Upgrade(pkgs, opts)
+	return a.UpgradeAllContext(context.Background(), pkgs, opts)
+}
+
+// UpgradeAllContext is like UpgradeAll but uses ctx to bound the snap commands.
+func (a *PackageManager) UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	if opts == nil {
+		opts = &manager.Options{
+			DryRun:      false,
+			Interactive: false,
+			Verbose:     false,
+		}
+	}
+	return manager.UpgradeHolding(ctx, a, pkgs, opts, a.listUpgradable, a.UpgradeContext)
+}
+
+// ListHeld lists the snaps whose refreshes are held, as noted by snap list.
+func (a *PackageManager) ListHeld(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.ListHeldContext(context.Background(), opts)
+}
+
+// ListHeldContext is like ListHeld but uses ctx to bound the snap command.
+func (a *PackageManager) ListHeldContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"list"}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	return ParseListHeldOutput(string(res.Stdout), opts), nil
+}
+
+// Hold holds the refreshes of the specified snaps indefinitely, using snap refresh --hold.
+func (a *PackageManager) Hold(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.HoldContext(context.Background(), pkgs, opts)
+}
+
+// HoldContext is like Hold but uses ctx to bound the snap command.
+func (a *PackageManager) HoldContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.refreshHold(ctx, "--hold", pkgs, manager.PackageStatusHeld, opts)
+}
+
+// Unhold releases the hold on the refreshes of the specified snaps, using snap refresh --unhold.
+func (a *PackageManager) Unhold(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.UnholdContext(context.Background(), pkgs, opts)
+}
+
+// UnholdContext is like Unhold but uses ctx to bound the snap command.
+func (a *PackageManager) UnholdContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.refreshHold(ctx, "--unhold", pkgs, manager.PackageStatusInstalled, opts)
+}
+
+// refreshHold runs `snap refresh flag pkgs...`, and returns pkgs with the given status.
+func (a *PackageManager) refreshHold(ctx context.Context, flag string, pkgs []string, status manager.PackageStatus, opts *manager.Options) ([]manager.PackageInfo, error) {
+	if opts != nil && opts.DryRun {
+		log.Printf("snap: would refresh %s: %v\n", flag, pkgs)
+		return nil, nil
+	}
+	if _, err := a.run(ctx, manager.Command{Name: pm, Args: append([]string{"refresh", flag}, pkgs...), Env: ENV_NonInteractive}); err != nil {
+		return nil, err
+	}
+	packages := make([]manager.PackageInfo, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		packages = append(packages, manager.PackageInfo{Name: pkg, Status: status, PackageManager: pm})
+	}
+	return packages, nil
 }
 
 // GetPackageInfo retrieves information about the specified package using the snap package manager.
 func (a *PackageManager) GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error) {
-	cmd := exec.Command("snap", "info", pkg)
-	cmd.Env = ENV_NonInteractive
-	out, err := cmd.Output()
+	return a.GetPackageInfoContext(context.Background(), pkg, opts)
+}
+
+// GetPackageInfoContext is like GetPackageInfo but uses ctx to bound the snap command.
+func (a *PackageManager) GetPackageInfoContext(ctx context.Context, pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: "snap", Args: []string{"info", pkg}, Env: ENV_NonInteractive})
 	if err != nil {
 		return manager.PackageInfo{}, err
 	}
-	return ParsePackageInfoOutput(string(out), opts), nil
+	return ParsePackageInfoOutput(string(res.Stdout), opts), nil
+}
+
+// InstallRequests installs the packages of reqs using snap, from the channel given as Source, at the revision given as Version.
+// Snaps have no Arch.
+func (a *PackageManager) InstallRequests(reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.InstallRequestsContext(context.Background(), reqs, opts)
+}
+
+// InstallRequestsContext is like InstallRequests but uses ctx to bound the snap commands.
+// snap takes a channel or a revision for a single snap, so such requests are installed one at a time,
+// or, for the snaps that are already installed, refreshed to the channel or revision.
+func (a *PackageManager) InstallRequestsContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	var names []string
+	var pinned []manager.InstallRequest
+	for _, req := range reqs {
+		switch {
+		case req.Arch != "":
+			return nil, fmt.Errorf("%s: snap cannot install a given architecture: %w", req, manager.ErrUnsupported)
+		case req.Version == "" && req.Source == "":
+			names = append(names, req.Name)
+		default:
+			pinned = append(pinned, req)
+		}
+	}
+
+	var packages []manager.PackageInfo
+	if len(names) > 0 {
+		pkgs, err := a.install(ctx, names, nil, opts)
+		packages = append(packages, pkgs...)
+		if err != nil {
+			return packages, err
+		}
+	}
+	if len(pinned) == 0 {
+		return packages, nil
+	}
+
+	// snap install leaves an installed snap alone, whatever its channel or revision
+	installed, err := a.ListInstalledContext(ctx, opts)
+	if err != nil {
+		return packages, err
+	}
+	isInstalled := make(map[string]bool, len(installed))
+	for _, pkg := range installed {
+		isInstalled[pkg.Name] = true
+	}
+	for _, req := range pinned {
+		var flags []string
+		if req.Source != "" {
+			flags = append(flags, "--channel="+req.Source)
+		}
+		if req.Version != "" {
+			flags = append(flags, "--revision="+req.Version)
+		}
+		run := a.install
+		if isInstalled[req.Name] {
+			run = a.refresh
+		}
+		pkgs, err := run(ctx, []string{req.Name}, flags, opts)
+		packages = append(packages, pkgs...)
+		if err != nil {
+			return packages, err
+		}
+	}
+	return packages, nil
+}
+
+// ListVersions lists the versions of the specified snap published in its channels, using snap info.
+// The revision of each version is in its AdditionalData, as "revision".
+func (a *PackageManager) ListVersions(pkg string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.ListVersionsContext(context.Background(), pkg, opts)
+}
+
+// ListVersionsContext is like ListVersions but uses ctx to bound the snap command.
+func (a *PackageManager) ListVersionsContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	res, err := a.run(ctx, manager.Command{Name: pm, Args: []string{"info", pkg}, Env: ENV_NonInteractive})
+	if err != nil {
+		return nil, err
+	}
+	return ParseChannelsOutput(string(res.Stdout), opts), nil
+}
+
+// Downgrade reverts the snaps of reqs using snap revert: to the revision given as Version,
+// or to the revision they had before their last refresh if Version is empty.
+// Snaps have no Arch, and are reverted to a revision they had, not to a channel, so Source is not supported either.
+func (a *PackageManager) Downgrade(reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.DowngradeContext(context.Background(), reqs, opts)
+}
+
+// DowngradeContext is like Downgrade but uses ctx to bound the snap commands.
+// snap takes a revision for a single snap, so the snaps are reverted one at a time.
+func (a *PackageManager) DowngradeContext(ctx context.Context, reqs []manager.InstallRequest, opts *manager.Options) ([]manager.PackageInfo, error) {
+	for _, req := range reqs {
+		if req.Arch != "" || req.Source != "" {
+			return nil, fmt.Errorf("%s: snap can only revert to a given revision: %w", req, manager.ErrUnsupported)
+		}
+	}
+	if opts == nil {
+		opts = &manager.Options{}
+	}
+	if opts.DryRun {
+		log.Printf("snap: would revert %v\n", reqs)
+		return nil, nil
+	}
+
+	return manager.TrackVersions(ctx, opts, a.ListInstalledContext, func() error {
+		for _, req := range reqs {
+			args := []string{"revert", req.Name}
+			if req.Version != "" {
+				args = append(args, "--revision="+req.Version)
+			}
+			if _, err := a.run(ctx, manager.Command{Name: pm, Args: args, Env: ENV_NonInteractive, Interactive: opts.Interactive}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PackageFileTypes returns the types of the package files snap installs: .snap files.
+func (a *PackageManager) PackageFileTypes() []manager.PackageFileType {
+	return []manager.PackageFileType{manager.PackageFileSnap}
+}
+
+// InstallFiles installs the .snap files at paths using snap install --dangerous, as they are not signed by the store.
+func (a *PackageManager) InstallFiles(paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.InstallFilesContext(context.Background(), paths, opts)
+}
+
+// InstallFilesContext is like InstallFiles but uses ctx to bound the snap command.
+func (a *PackageManager) InstallFilesContext(ctx context.Context, paths []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return a.install(ctx, paths, []string{"--dangerous"}, opts)
+}
+
+// StateFiles returns the directory of the snap files, which changes when snaps are installed, refreshed or removed.
+// The state of snapd, /var/lib/snapd/state.json, is not one of them: snapd rewrites it all the time, even when the snaps
+// do not change, such as when it checks for refreshes.
+func (a *PackageManager) StateFiles() []string {
+	return []string{"/var/lib/snapd/snaps"}
 }
@@ -229,3 +229,181 @@ func ParseListOutput(msg string, opts *manager.Options) []manager.PackageInfo {
 
 	return packages
 }
+
+// ParseListHeldOutput parses the output of `snap list` command
+// and returns the snaps whose Notes include "held".
+//
+// Example output:
+// Name      Version   Rev    Tracking       Publisher   Notes
+// core22    20240111  1122   latest/stable  canonical✓  base
+// firefox   122.0-2   3728   latest/stable  mozilla✓    held
+// lxd       5.19      26200  latest/stable  canonical✓  disabled,held
+func ParseListHeldOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	for _, line := range strings.Split(msg, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) < 6 || parts[0] == "Name" {
+			continue
+		}
+		for _, note := range strings.Split(parts[len(parts)-1], ",") {
+			if note == "held" {
+				packages = append(packages, manager.PackageInfo{
+					Name:           parts[0],
+					Version:        parts[1],
+					Status:         manager.PackageStatusHeld,
+					PackageManager: pm,
+				})
+				break
+			}
+		}
+	}
+
+	return packages
+}
+
+// ParseChannelsOutput parses the channels and installed lines of the output of `snap info` command
+// and returns the version published in each open channel, with the channel as Category,
+// and the installed version, with its tracked channel as Category.
+//
+// Example msg:
+// name:      firefox
+// tracking:     latest/stable
+// channels:
+//
+//	latest/stable:    122.0-2  2024-01-23 (3728) 263MB -
+//	latest/candidate: ↑
+//	latest/beta:      123.0b3-1 2024-01-25 (3740) 264MB -
+//	esr/stable:       115.7.0esr-1 2024-01-23 (3731) 258MB -
+//
+// installed:          122.0-2             (3728) 263MB -
+func ParseChannelsOutput(msg string, opts *manager.Options) []manager.PackageInfo {
+	var packages []manager.PackageInfo
+
+	var name, tracking string
+	inChannels := false
+	for _, line := range strings.Split(msg, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		fields := strings.Fields(value)
+		switch {
+		case key == "name":
+			name = value
+		case key == "tracking":
+			tracking = value
+		case key == "channels":
+			inChannels = true
+		case key == "installed" && len(fields) >= 2:
+			inChannels = false
+			packages = append(packages, manager.PackageInfo{
+				Name:           name,
+				Version:        fields[0],
+				Category:       tracking,
+				Status:         manager.PackageStatusInstalled,
+				PackageManager: pm,
+				AdditionalData: map[string]string{"revision": strings.Trim(fields[1], "()")},
+			})
+		case inChannels && strings.HasPrefix(line, " ") && len(fields) >= 3:
+			// closed channels are listed as "–", and channels that follow the one above as "↑"
+			packages = append(packages, manager.PackageInfo{
+				Name:           name,
+				Version:        fields[0],
+				Category:       key,
+				Status:         manager.PackageStatusAvailable,
+				PackageManager: pm,
+				AdditionalData: map[string]string{"revision": strings.Trim(fields[2], "()")},
+			})
+		case !strings.HasPrefix(line, " "):
+			inChannels = false
+		}
+	}
+
+	return packages
+}
+
+// Task is a task of a snapd change, as listed by `snap tasks`.
+type Task struct {
+	// Status is the status of the task, such as "Do", "Doing", "Done" or "Error".
+	Status string
+
+	// Summary describes the task, and usually names the snap it works on.
+	Summary string
+}
+
+// ParseTasksOutput parses the output of `snap tasks <change-id>` command
+// and returns the tasks of the change.
+//
+// Example output:
+// Status  Spawn               Ready               Summary
+// Done    today at 10:00 UTC  today at 10:00 UTC  Ensure prerequisites for "hello" are available
+// Doing   today at 10:00 UTC  -                   Download snap "hello" (42) from channel "stable"
+// Do      today at 10:00 UTC  -                   Mount snap "hello" (42)
+func ParseTasksOutput(msg string) []Task {
+	var tasks []Task
+
+	// remove the last empty line
+	msg = strings.TrimSuffix(msg, "\n")
+	var lines []string = strings.Split(string(msg), "\n")
+
+	// the Spawn and Ready columns contain spaces, so the summary is found from the position of its header
+	summaryIndex := -1
+	for _, line := range lines {
+		if summaryIndex < 0 {
+			if strings.HasPrefix(line, "Status") {
+				summaryIndex = strings.Index(line, "Summary")
+			}
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) == 0 || len(line) <= summaryIndex {
+			continue
+		}
+		tasks = append(tasks, Task{
+			Status:  parts[0],
+			Summary: strings.TrimSpace(line[summaryIndex:]),
+		})
+	}
+
+	return tasks
+}
+
+// Ready reports whether the task is in a final state.
+func (t Task) Ready() bool {
+	switch t.Status {
+	case "Done", "Undone", "Error", "Hold":
+		return true
+	}
+	return false
+}
+
+// Snap returns the name of the snap the task works on, or an empty string if its summary does not name one.
+func (t Task) Snap() string {
+	start := strings.Index(t.Summary, "\"")
+	if start < 0 {
+		return ""
+	}
+	end := strings.Index(t.Summary[start+1:], "\"")
+	if end < 0 {
+		return ""
+	}
+	return t.Summary[start+1 : start+1+end]
+}
+
+// Phase returns the progress phase the task belongs to.
+func (t Task) Phase() manager.ProgressPhase {
+	switch {
+	case strings.HasPrefix(t.Summary, "Download snap"), strings.HasPrefix(t.Summary, "Fetch and check assertions"):
+		return manager.ProgressPhaseDownloading
+	case strings.HasPrefix(t.Summary, "Mount snap"), strings.HasPrefix(t.Summary, "Copy snap"):
+		return manager.ProgressPhaseUnpacking
+	case strings.HasPrefix(t.Summary, "Remove"), strings.HasPrefix(t.Summary, "Discard"),
+		strings.HasPrefix(t.Summary, "Stop snap"), strings.HasPrefix(t.Summary, "Disconnect"):
+		return manager.ProgressPhaseRemoving
+	case strings.HasPrefix(t.Summary, "Ensure prerequisites"), strings.HasPrefix(t.Summary, "Prepare snap"):
+		return manager.ProgressPhaseInstalling
+	}
+	return manager.ProgressPhaseConfiguring
+}
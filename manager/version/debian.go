@@ -0,0 +1,75 @@
+package version
+
+import "strings"
+
+// CompareDebian compares two Debian package versions like `dpkg --compare-versions`.
+// The epochs are compared first, then the upstream versions, then the Debian revisions.
+// A "~" sorts before anything, even the end of the version, so that "1.0~rc1" is older than "1.0".
+func CompareDebian(a, b string) int {
+	epochA, restA := splitEpoch(a)
+	epochB, restB := splitEpoch(b)
+	if c := compareNumbers(epochA, epochB); c != 0 {
+		return c
+	}
+
+	upstreamA, revisionA := splitRevision(restA)
+	upstreamB, revisionB := splitRevision(restB)
+	if c := verrevcmp(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return verrevcmp(revisionA, revisionB)
+}
+
+// splitRevision splits the Debian revision, after the last hyphen, from a version without epoch.
+func splitRevision(v string) (upstream, revision string) {
+	if i := strings.LastIndexByte(v, '-'); i >= 0 {
+		return v[:i], v[i+1:]
+	}
+	return v, ""
+}
+
+// debianOrder returns the sort weight of the character of s at i in a non-digit part of a Debian version:
+// "~" first, then the end of the part, then letters, then the other characters.
+func debianOrder(s string, i int) int {
+	if i >= len(s) {
+		return 0
+	}
+	c := s[i]
+	switch {
+	case isDigit(c):
+		return 0
+	case isAlpha(c):
+		return int(c)
+	case c == '~':
+		return -1
+	}
+	return int(c) + 256
+}
+
+// verrevcmp compares two upstream versions or two revisions, by alternating non-digit and digit parts,
+// as dpkg does.
+func verrevcmp(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			ac, bc := debianOrder(a, i), debianOrder(b, j)
+			if ac != bc {
+				return sign(ac - bc)
+			}
+			i++
+			j++
+		}
+
+		startA, startB := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		if c := compareNumbers(a[startA:i], b[startB:j]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,33 @@
+package version
+
+import "strings"
+
+// CompareGeneric compares two version strings that follow no particular package scheme,
+// such as the versions of snaps and flatpaks.
+// A leading "v" and semver build metadata ("+...") are ignored, the remaining versions are compared
+// segment by segment like rpmvercmp, and a semver pre-release ("1.0-rc1") is older than its release ("1.0").
+func CompareGeneric(a, b string) int {
+	coreA, preA := splitPrerelease(a)
+	coreB, preB := splitPrerelease(b)
+	if c := Rpmvercmp(coreA, coreB); c != 0 {
+		return c
+	}
+
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return Rpmvercmp(preA, preB)
+}
+
+// splitPrerelease splits a version into its core and its pre-release, without the leading "v" and build metadata.
+func splitPrerelease(v string) (core, prerelease string) {
+	v = strings.TrimPrefix(strings.TrimPrefix(v, "v"), "V")
+	v, _, _ = strings.Cut(v, "+")
+	core, prerelease, _ = strings.Cut(v, "-")
+	return core, prerelease
+}
@@ -0,0 +1,130 @@
+package version
+
+import "strings"
+
+// CompareRPM compares two RPM package versions like rpm does.
+// The epochs are compared first, then the versions with rpmvercmp, then the releases, if both versions have one.
+func CompareRPM(a, b string) int {
+	epochA, restA := splitEpoch(a)
+	epochB, restB := splitEpoch(b)
+	if c := compareNumbers(epochA, epochB); c != 0 {
+		return c
+	}
+
+	versionA, releaseA, _ := strings.Cut(restA, "-")
+	versionB, releaseB, _ := strings.Cut(restB, "-")
+	if c := Rpmvercmp(versionA, versionB); c != 0 {
+		return c
+	}
+	if releaseA == "" || releaseB == "" {
+		return 0
+	}
+	return Rpmvercmp(releaseA, releaseB)
+}
+
+// Rpmvercmp compares two RPM version or release strings with the rpmvercmp algorithm:
+// they are split into alternating runs of digits and letters, separators are ignored,
+// numeric runs are newer than alphabetic ones, "~" sorts before anything and "^" after the end of the string.
+func Rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isRPMSegment(a[i]) {
+			i++
+		}
+		for j < len(b) && !isRPMSegment(b[j]) {
+			j++
+		}
+
+		// a tilde sorts before everything else
+		if at(a, i) == '~' || at(b, j) == '~' {
+			if at(a, i) != '~' {
+				return 1
+			}
+			if at(b, j) != '~' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		// a caret sorts after the end of the string, but before anything else
+		if at(a, i) == '^' || at(b, j) == '^' {
+			if i >= len(a) {
+				return -1
+			}
+			if j >= len(b) {
+				return 1
+			}
+			if at(a, i) != '^' {
+				return 1
+			}
+			if at(b, j) != '^' {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		if i >= len(a) || j >= len(b) {
+			break
+		}
+
+		startA, startB := i, j
+		isNum := isDigit(a[i])
+		for i < len(a) && isDigit(a[i]) == isNum && isAlnum(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) == isNum && isAlnum(b[j]) {
+			j++
+		}
+
+		// segments of different types: numeric is newer
+		if j == startB {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+
+		var c int
+		if isNum {
+			c = compareNumbers(a[startA:i], b[startB:j])
+		} else {
+			c = strings.Compare(a[startA:i], b[startB:j])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i < len(a):
+		return 1
+	}
+	return -1
+}
+
+// isRPMSegment reports whether c starts a segment of an RPM version: a letter, a digit, "~" or "^".
+func isRPMSegment(c byte) bool {
+	return isAlnum(c) || c == '~' || c == '^'
+}
+
+func isAlnum(c byte) bool {
+	return isDigit(c) || isAlpha(c)
+}
+
+// at returns the character of s at i, or 0 past the end of s.
+func at(s string, i int) byte {
+	if i >= len(s) {
+		return 0
+	}
+	return s[i]
+}
@@ -0,0 +1,97 @@
+// Package version compares package versions the way the package managers do,
+// without running them: Debian versions like dpkg, RPM versions like rpm, and other version strings
+// (such as the ones of snap and flatpak) with a generic, semver-aware ordering.
+//
+// Example:
+//
+//	version.Compare(version.SchemeFor("apt"), "3.0.2-0ubuntu1.8", "3.0.2-0ubuntu1.9") // -1
+package version
+
+import "strings"
+
+// Scheme is a version numbering scheme.
+type Scheme string
+
+// Scheme constants define the supported version numbering schemes.
+const (
+	// Debian is the scheme of Debian packages: [epoch:]upstream_version[-debian_revision].
+	Debian Scheme = "debian"
+
+	// RPM is the scheme of RPM packages: [epoch:]version[-release].
+	RPM Scheme = "rpm"
+
+	// Generic is the fallback scheme, for version strings of any other package manager.
+	Generic Scheme = "generic"
+)
+
+// SchemeFor returns the version scheme used by the package manager with the given name, such as "apt" or "dnf".
+func SchemeFor(packageManager string) Scheme {
+	switch packageManager {
+	case "apt", "apt-get", "dpkg":
+		return Debian
+	case "dnf", "yum", "zypper", "rpm":
+		return RPM
+	}
+	return Generic
+}
+
+// Compare compares the versions a and b with the given scheme.
+// It returns -1 if a is older than b, 0 if they are equivalent, and +1 if a is newer than b.
+func Compare(scheme Scheme, a, b string) int {
+	switch scheme {
+	case Debian:
+		return CompareDebian(a, b)
+	case RPM:
+		return CompareRPM(a, b)
+	}
+	return CompareGeneric(a, b)
+}
+
+// splitEpoch splits the epoch from a version string, if it has one. A missing epoch is "0".
+func splitEpoch(v string) (epoch, rest string) {
+	if i := strings.IndexByte(v, ':'); i >= 0 && isDigits(v[:i]) {
+		return v[:i], v[i+1:]
+	}
+	return "0", v
+}
+
+// compareNumbers compares two strings of digits numerically, whatever their length.
+func compareNumbers(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return sign(len(a) - len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+// isDigits reports whether s is a non-empty string of ASCII digits.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
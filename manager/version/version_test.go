@@ -0,0 +1,96 @@
+package version_test
+
+import (
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager/version"
+)
+
+func TestCompareDebian(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0-0", 0},
+		{"1:1.0", "1.0", 1},
+		{"1:1.0", "2:0.1", -1},
+		{"3.0.2-0ubuntu1.8", "3.0.2-0ubuntu1.9", -1},
+		{"3.0.2-0ubuntu1.10", "3.0.2-0ubuntu1.9", 1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~~", 1},
+		{"1.0~", "1.0", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0+dfsg", "1.0a", 1},
+		{"1.0.1", "1.0a", 1},
+		{"2:8.2.3995-1ubuntu2", "2:8.2.3995-1ubuntu2.1", -1},
+		{"1.2-3-4", "1.2-3-5", -1},
+		{"007", "7", 0},
+		{"1.18446744073709551616", "1.18446744073709551615", 1},
+	}
+	for _, tt := range tests {
+		if got := version.CompareDebian(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareDebian(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := version.CompareDebian(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareDebian(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestCompareRPM(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0.1", "2.0", 1},
+		{"2.0", "2_0", 0},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0.1", -1},
+		{"a", "1", -1},
+		{"5.5p1", "5.5p10", -1},
+		{"10b2", "10a1", 1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1.0^git1", "1.0~rc1", 1},
+		{"1:1.0-1", "2.0-1", 1},
+		{"27.11.1-1.el8", "27.11.0-1.el8", 1},
+		{"8.2.2637-20.el9_1", "8.2.2637-20.el9", 1},
+		{"1.0-1", "1.0", 0},
+	}
+	for _, tt := range tests {
+		if got := version.CompareRPM(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareRPM(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := version.CompareRPM(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareRPM(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestCompareGeneric(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"2.61.3", "2.61.3", 0},
+		{"2.61.3", "2.61.10", -1},
+		{"v1.2.0", "1.2.0", 0},
+		{"1.2.0-rc1", "1.2.0", -1},
+		{"1.2.0-rc1", "1.2.0-rc2", -1},
+		{"1.2.0+build5", "1.2.0", 0},
+		{"6.4", "22.08", -1},
+	}
+	for _, tt := range tests {
+		if got := version.CompareGeneric(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareGeneric(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := version.CompareGeneric(tt.b, tt.a); got != -tt.want {
+			t.Errorf("CompareGeneric(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// Package manifest describes the desired state of the packages of a system in a YAML or JSON manifest,
+// and reconciles the system with it: NewPlan compares the manifest with the packages installed by each package manager,
+// and Apply installs, removes and holds packages until the system matches the manifest.
+//
+// Example manifest:
+//
+//	packages:
+//	  - name: vim
+//	  - name: curl
+//	    manager: apt
+//	    version: 7.81.0-1ubuntu1.15
+//	    held: true
+//	  - name: libc6
+//	    arch: i386
+//	  - name: org.gimp.GIMP
+//	    manager: flatpak
+//	  - name: nano
+//	    state: absent
+//
+// Example:
+//
+//	m, err := manifest.Load("packages.yaml")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	plan, err := manifest.NewPlan(ctx, sysPkg, m, nil)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fmt.Print(plan)
+//	_, err = manifest.Apply(ctx, sysPkg, plan, nil)
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// State is the desired state of a package.
+type State string
+
+// State constants define the possible desired states of a package.
+const (
+	// StatePresent means that the package must be installed. It is the default state.
+	StatePresent State = "present"
+
+	// StateAbsent means that the package must not be installed.
+	StateAbsent State = "absent"
+)
+
+// Manifest is the desired state of the packages of a system.
+type Manifest struct {
+	// Packages are the packages managed by the manifest. Packages that are not listed are left alone.
+	Packages []Entry `json:"packages" yaml:"packages"`
+}
+
+// Entry is the desired state of a package.
+type Entry struct {
+	// Name is the package name.
+	Name string `json:"name" yaml:"name"`
+
+	// Manager is the name of the package manager of the package, such as "apt" or "flatpak".
+	// If empty, the available package manager with the highest priority is used.
+	Manager string `json:"manager,omitempty" yaml:"manager,omitempty"`
+
+	// Version is the version the package must be installed at. If empty, any installed version is accepted,
+	// and the latest available one is installed.
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+
+	// Arch is the architecture the package must be installed for, such as "i386", for the package managers that
+	// implement manager.RequestInstaller. If empty, the package may be installed for any architecture.
+	Arch string `json:"arch,omitempty" yaml:"arch,omitempty"`
+
+	// State is whether the package must be installed or not. An empty state means StatePresent.
+	State State `json:"state,omitempty" yaml:"state,omitempty"`
+
+	// Held is whether the package must be held at its installed version, so that upgrades leave it alone.
+	// If nil, the package is left held or not, as it is.
+	Held *bool `json:"held,omitempty" yaml:"held,omitempty"`
+}
+
+// Load reads the manifest from the file at path. Files with a ".json" extension are parsed as JSON,
+// other files as YAML.
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return ParseJSON(data)
+	}
+	return ParseYAML(data)
+}
+
+// ParseJSON parses and validates a JSON manifest. Unknown fields are rejected.
+func ParseJSON(data []byte) (*Manifest, error) {
+	var m Manifest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ParseYAML parses and validates a YAML manifest. Unknown fields are rejected.
+func ParseYAML(data []byte) (*Manifest, error) {
+	var m Manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate checks that every entry of the manifest has a name and a valid state,
+// that absent packages are neither pinned nor held, and that no package is listed twice for the same package manager
+// and architecture.
+func (m *Manifest) Validate() error {
+	seen := make(map[string]bool)
+	for i, e := range m.Packages {
+		if e.Name == "" {
+			return fmt.Errorf("invalid manifest: package #%d has no name", i+1)
+		}
+		switch e.State {
+		case "", StatePresent:
+		case StateAbsent:
+			if e.Version != "" || (e.Held != nil && *e.Held) {
+				return fmt.Errorf("invalid manifest: package %s is absent, it cannot have a version or be held", e.Name)
+			}
+		default:
+			return fmt.Errorf("invalid manifest: package %s has an invalid state %q (want %q or %q)", e.Name, e.State, StatePresent, StateAbsent)
+		}
+
+		key := e.Manager + "\x00" + e.Name + "\x00" + e.Arch
+		if seen[key] {
+			return fmt.Errorf("invalid manifest: package %s is listed more than once", e.Name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
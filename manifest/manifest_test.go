@@ -0,0 +1,406 @@
+package manifest_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sjwhyte/syspkg"
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/apt"
+	"github.com/sjwhyte/syspkg/manager/runnertest"
+	"github.com/sjwhyte/syspkg/manifest"
+)
+
+// held returns a pointer to b, for Entry.Held.
+func held(b bool) *bool {
+	return &b
+}
+
+// fakeManager is a package manager with a fixed set of installed and held packages, that records the operations it runs.
+type fakeManager struct {
+	name      string
+	installed []manager.PackageInfo
+	held      []string
+	calls     []string
+}
+
+func (f *fakeManager) record(op string, pkgs []string) ([]manager.PackageInfo, error) {
+	f.calls = append(f.calls, op+" "+strings.Join(pkgs, " "))
+	var changed []manager.PackageInfo
+	for _, pkg := range pkgs {
+		changed = append(changed, manager.PackageInfo{Name: pkg, PackageManager: f.name})
+	}
+	return changed, nil
+}
+
+func (f *fakeManager) IsAvailable() bool         { return true }
+func (f *fakeManager) GetPackageManager() string { return f.name }
+func (f *fakeManager) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.InstallContext(context.Background(), pkgs, opts)
+}
+func (f *fakeManager) InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.record("install", pkgs)
+}
+func (f *fakeManager) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.DeleteContext(context.Background(), pkgs, opts)
+}
+func (f *fakeManager) DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.record("delete", pkgs)
+}
+func (f *fakeManager) Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) FindContext(ctx context.Context, keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.installed, nil
+}
+func (f *fakeManager) ListInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.installed, nil
+}
+func (f *fakeManager) ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) ListUpgradableContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) Refresh(opts *manager.Options) error { return nil }
+func (f *fakeManager) RefreshContext(ctx context.Context, opts *manager.Options) error {
+	return nil
+}
+func (f *fakeManager) GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	return manager.PackageInfo{}, nil
+}
+func (f *fakeManager) GetPackageInfoContext(ctx context.Context, pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	return manager.PackageInfo{}, nil
+}
+
+// holdingManager is a fakeManager that can also hold packages.
+type holdingManager struct {
+	fakeManager
+}
+
+func (f *holdingManager) ListHeldContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	var held []manager.PackageInfo
+	for _, name := range f.held {
+		held = append(held, manager.PackageInfo{Name: name, PackageManager: f.name})
+	}
+	return held, nil
+}
+func (f *holdingManager) HoldContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.record("hold", pkgs)
+}
+func (f *holdingManager) UnholdContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.record("unhold", pkgs)
+}
+
+var (
+	holding = &holdingManager{fakeManager{
+		name: "manifest-holding",
+		installed: []manager.PackageInfo{
+			{Name: "vim", Version: "9.0", PackageManager: "manifest-holding"},
+			{Name: "nano", Version: "6.2", PackageManager: "manifest-holding"},
+			{Name: "curl", Version: "7.81", PackageManager: "manifest-holding"},
+			{Name: "less", Version: "590", PackageManager: "manifest-holding"},
+		},
+		held: []string{"curl", "less"},
+	}}
+	plain = &fakeManager{
+		name:      "manifest-plain",
+		installed: []manager.PackageInfo{{Name: "org.gimp.GIMP", Version: "2.10", PackageManager: "manifest-plain"}},
+	}
+)
+
+func init() {
+	manager.Register(holding.name, manager.PrioritySystem, func() manager.PackageManager { return holding })
+	manager.Register(plain.name, manager.PriorityUniversal, func() manager.PackageManager { return plain })
+}
+
+func newSysPkg(t *testing.T) syspkg.SysPkg {
+	t.Helper()
+	s, err := syspkg.New(syspkg.IncludeOptions{Managers: []string{holding.name, plain.name}})
+	if err != nil {
+		t.Fatalf("syspkg.New() error = %v", err)
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	want := &manifest.Manifest{Packages: []manifest.Entry{
+		{Name: "vim"},
+		{Name: "curl", Manager: "apt", Version: "7.81.0-1ubuntu1.15", Held: held(true)},
+		{Name: "nano", State: manifest.StateAbsent},
+	}}
+
+	yamlManifest := `
+packages:
+  - name: vim
+  - name: curl
+    manager: apt
+    version: 7.81.0-1ubuntu1.15
+    held: true
+  - name: nano
+    state: absent
+`
+	m, err := manifest.ParseYAML([]byte(yamlManifest))
+	if err != nil || !reflect.DeepEqual(m, want) {
+		t.Errorf("ParseYAML() = %+v, %v, want %+v", m, err, want)
+	}
+
+	jsonManifest := `{"packages": [
+		{"name": "vim"},
+		{"name": "curl", "manager": "apt", "version": "7.81.0-1ubuntu1.15", "held": true},
+		{"name": "nano", "state": "absent"}
+	]}`
+	m, err = manifest.ParseJSON([]byte(jsonManifest))
+	if err != nil || !reflect.DeepEqual(m, want) {
+		t.Errorf("ParseJSON() = %+v, %v, want %+v", m, err, want)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":  "packages:\n  - name: vim\n    pinned: true\n",
+		"missing name":   "packages:\n  - manager: apt\n",
+		"invalid state":  "packages:\n  - name: vim\n    state: latest\n",
+		"absent held":    "packages:\n  - name: vim\n    state: absent\n    held: true\n",
+		"absent version": "packages:\n  - name: vim\n    state: absent\n    version: \"1.0\"\n",
+		"duplicate":      "packages:\n  - name: vim\n  - name: vim\n    held: true\n",
+	}
+	for name, data := range tests {
+		if m, err := manifest.ParseYAML([]byte(data)); err == nil {
+			t.Errorf("%s: ParseYAML() = %+v, want an error", name, m)
+		}
+	}
+}
+
+func TestPlanAndApply(t *testing.T) {
+	s := newSysPkg(t)
+	m := &manifest.Manifest{Packages: []manifest.Entry{
+		{Name: "vim"},
+		{Name: "git", Held: held(true)},
+		{Name: "nano", State: manifest.StateAbsent},
+		{Name: "curl", Held: held(false)},
+		{Name: "less"},
+		{Name: "emacs", State: manifest.StateAbsent},
+		{Name: "org.gimp.GIMP", Manager: plain.name},
+		{Name: "org.inkscape.Inkscape", Manager: plain.name},
+	}}
+
+	plan, err := manifest.NewPlan(context.Background(), s, m, nil)
+	if err != nil {
+		t.Fatalf("NewPlan() error = %v", err)
+	}
+
+	want := []manifest.Step{
+		{Action: manifest.ActionUnhold, PackageManager: holding.name, Name: "curl", CurrentVersion: "7.81"},
+		{Action: manifest.ActionRemove, PackageManager: holding.name, Name: "nano", CurrentVersion: "6.2"},
+		{Action: manifest.ActionInstall, PackageManager: holding.name, Name: "git"},
+		{Action: manifest.ActionHold, PackageManager: holding.name, Name: "git"},
+		{Action: manifest.ActionInstall, PackageManager: plain.name, Name: "org.inkscape.Inkscape"},
+	}
+	if !reflect.DeepEqual(plan.Steps, want) {
+		t.Errorf("NewPlan() = %+v, want %+v", plan.Steps, want)
+	}
+	if got := plan.Steps[1].String(); got != "manifest-holding: remove nano (6.2)" {
+		t.Errorf("Step.String() = %q, want %q", got, "manifest-holding: remove nano (6.2)")
+	}
+
+	if _, err := manifest.Apply(context.Background(), s, plan, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	wantCalls := []string{"unhold curl", "delete nano", "install git", "hold git"}
+	if !reflect.DeepEqual(holding.calls, wantCalls) {
+		t.Errorf("Apply() ran %q with %s, want %q", holding.calls, holding.name, wantCalls)
+	}
+	if !reflect.DeepEqual(plain.calls, []string{"install org.inkscape.Inkscape"}) {
+		t.Errorf("Apply() ran %q with %s, want %q", plain.calls, plain.name, []string{"install org.inkscape.Inkscape"})
+	}
+}
+
+// aptSysPkg is a syspkg.SysPkg with a single apt package manager.
+type aptSysPkg struct {
+	syspkg.SysPkg
+	apt *apt.PackageManager
+}
+
+func (s aptSysPkg) GetPackageManager(name string) syspkg.PackageManager {
+	if name != "" && name != "apt" {
+		return nil
+	}
+	return s.apt
+}
+
+func (s aptSysPkg) GetPackageManagerContext(name string) syspkg.PackageManagerContext {
+	if name != "" && name != "apt" {
+		return nil
+	}
+	return s.apt
+}
+
+func TestApplyApt(t *testing.T) {
+	const dpkgQuery = "curl 7.81.0-1ubuntu1.16\nvim 2:8.2.3995-1ubuntu2.15\n"
+	runner := runnertest.New(
+		runnertest.Response{Stdout: dpkgQuery},
+		runnertest.Response{Stdout: "curl\n"},
+	)
+	s := aptSysPkg{apt: &apt.PackageManager{Runner: runner, Root: t.TempDir()}}
+	m := &manifest.Manifest{Packages: []manifest.Entry{
+		{Name: "curl", Version: "7.81.0-1ubuntu1.15"},
+		{Name: "vim"},
+		{Name: "nano", Version: "6.2-1"},
+		{Name: "git", Held: held(false)},
+	}}
+
+	plan, err := manifest.NewPlan(context.Background(), s, m, nil)
+	if err != nil {
+		t.Fatalf("NewPlan() error = %v", err)
+	}
+	want := []manifest.Step{
+		{Action: manifest.ActionUnhold, PackageManager: "apt", Name: "curl", CurrentVersion: "7.81.0-1ubuntu1.16"},
+		{Action: manifest.ActionDowngrade, PackageManager: "apt", Name: "curl", Version: "7.81.0-1ubuntu1.15", CurrentVersion: "7.81.0-1ubuntu1.16"},
+		{Action: manifest.ActionInstall, PackageManager: "apt", Name: "nano", Version: "6.2-1"},
+		{Action: manifest.ActionInstall, PackageManager: "apt", Name: "git"},
+		{Action: manifest.ActionHold, PackageManager: "apt", Name: "curl", CurrentVersion: "7.81.0-1ubuntu1.16"},
+	}
+	if !reflect.DeepEqual(plan.Steps, want) {
+		t.Errorf("NewPlan() = %+v, want %+v", plan.Steps, want)
+	}
+
+	// the held curl is released to downgrade it, and held again
+	runner.Push(
+		runnertest.Response{},
+		runnertest.Response{},
+		runnertest.Response{},
+		runnertest.Response{Stdout: dpkgQuery},
+		runnertest.Response{},
+		runnertest.Response{Stdout: "curl 7.81.0-1ubuntu1.15\nvim 2:8.2.3995-1ubuntu2.15\n"},
+		runnertest.Response{},
+	)
+	if _, err := manifest.Apply(context.Background(), s, plan, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	wantArgv := [][]string{
+		{"dpkg-query", "-W", "-f", "${binary:Package} ${Version}\n"},
+		{"apt-mark", "showhold"},
+		{"apt-mark", "unhold", "curl"},
+		{"apt", "install", "-f", "git", "-y"},
+		{"apt", "install", "-f", "nano=6.2-1", "-y"},
+		{"dpkg-query", "-W", "-f", "${binary:Package} ${Version}\n"},
+		{"apt", "install", "-f", "--allow-downgrades", "curl=7.81.0-1ubuntu1.15", "-y"},
+		{"dpkg-query", "-W", "-f", "${binary:Package} ${Version}\n"},
+		{"apt-mark", "hold", "curl"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("Apply() ran %q, want %q", runner.Argv(), wantArgv)
+	}
+}
+
+func TestApplyAptArch(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stdout: "libc6 2.35-0ubuntu3.6\nlibc6:i386 2.35-0ubuntu3.6\nzlib1g 1:1.2.11.dfsg-2ubuntu9.2\nzlib1g:i386 1:1.2.11.dfsg-2ubuntu9.2\n"},
+		runnertest.Response{Stdout: "zlib1g:i386\n"},
+	)
+	s := aptSysPkg{apt: &apt.PackageManager{Runner: runner, Root: t.TempDir()}}
+	m := &manifest.Manifest{Packages: []manifest.Entry{
+		{Name: "libc6", Arch: "i386", State: manifest.StateAbsent},
+		{Name: "zlib1g", Arch: "i386", Held: held(false)},
+		{Name: "zlib1g"},
+	}}
+
+	// the hold of the i386 zlib1g leaves the native one alone
+	plan, err := manifest.NewPlan(context.Background(), s, m, nil)
+	if err != nil {
+		t.Fatalf("NewPlan() error = %v", err)
+	}
+	want := []manifest.Step{
+		{Action: manifest.ActionUnhold, PackageManager: "apt", Name: "zlib1g", Arch: "i386", CurrentVersion: "1:1.2.11.dfsg-2ubuntu9.2"},
+		{Action: manifest.ActionRemove, PackageManager: "apt", Name: "libc6", Arch: "i386", CurrentVersion: "2.35-0ubuntu3.6"},
+	}
+	if !reflect.DeepEqual(plan.Steps, want) {
+		t.Errorf("NewPlan() = %+v, want %+v", plan.Steps, want)
+	}
+
+	runner.Push(runnertest.Response{}, runnertest.Response{})
+	if _, err := manifest.Apply(context.Background(), s, plan, nil); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	wantArgv := [][]string{
+		{"apt-mark", "unhold", "zlib1g:i386"},
+		{"apt", "remove", "-f", "--autoremove", "libc6:i386", "-y"},
+	}
+	if got := runner.Argv()[2:]; !reflect.DeepEqual(got, wantArgv) {
+		t.Errorf("Apply() ran %q, want %q", got, wantArgv)
+	}
+}
+
+func TestApplyEach(t *testing.T) {
+	runner := runnertest.New(
+		runnertest.Response{Stderr: "E: Unable to locate package nano\n", ExitCode: 100},
+		runnertest.Response{Stderr: "E: Unable to locate package nano\n", ExitCode: 100},
+		runnertest.Response{},
+	)
+	s := aptSysPkg{apt: &apt.PackageManager{Runner: runner, Root: t.TempDir()}}
+	nano := manifest.Step{Action: manifest.ActionInstall, PackageManager: "apt", Name: "nano", Version: "6.2-1"}
+	libc6 := manifest.Step{Action: manifest.ActionInstall, PackageManager: "apt", Name: "libc6", Arch: "i386", Version: "2.35-0ubuntu3.6"}
+
+	_, err := manifest.ApplyEach(context.Background(), s, &manifest.Plan{Steps: []manifest.Step{nano, libc6}}, nil)
+	var errs manifest.StepErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Step != nano || !errors.Is(err, manager.ErrPackageNotFound) {
+		t.Errorf("ApplyEach() error = %v, want the failure of %v only", err, nano)
+	}
+	wantArgv := [][]string{
+		{"apt", "install", "-f", "nano=6.2-1", "libc6:i386=2.35-0ubuntu3.6", "-y"},
+		{"apt", "install", "-f", "nano=6.2-1", "-y"},
+		{"apt", "install", "-f", "libc6:i386=2.35-0ubuntu3.6", "-y"},
+	}
+	if !reflect.DeepEqual(runner.Argv(), wantArgv) {
+		t.Errorf("ApplyEach() ran %q, want %q", runner.Argv(), wantArgv)
+	}
+}
+
+func TestPlanUnsupported(t *testing.T) {
+	s := newSysPkg(t)
+	tests := map[string]manifest.Entry{
+		"held":    {Name: "org.gimp.GIMP", Manager: plain.name, Held: held(true)},
+		"version": {Name: "org.gimp.GIMP", Manager: plain.name, Version: "2.10"},
+		"arch":    {Name: "org.gimp.GIMP", Manager: plain.name, Arch: "aarch64"},
+	}
+	for name, e := range tests {
+		_, err := manifest.NewPlan(context.Background(), s, &manifest.Manifest{Packages: []manifest.Entry{e}}, nil)
+		if !errors.Is(err, manager.ErrUnsupported) {
+			t.Errorf("%s: NewPlan() error = %v, want %v", name, err, manager.ErrUnsupported)
+		}
+	}
+
+	_, err := manifest.NewPlan(context.Background(), s, &manifest.Manifest{Packages: []manifest.Entry{{Name: "vim", Manager: "apt"}}}, nil)
+	if err == nil {
+		t.Errorf("NewPlan() with a package manager that is not available: error = nil, want an error")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"packages.json", "packages.yaml"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(`{"packages": [{"name": "vim"}]}`), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m, err := manifest.Load(path)
+		if err != nil || len(m.Packages) != 1 || m.Packages[0].Name != "vim" {
+			t.Errorf("Load(%s) = %+v, %v, want a manifest with vim", name, m, err)
+		}
+	}
+}
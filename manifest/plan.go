@@ -0,0 +1,473 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sjwhyte/syspkg"
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/version"
+)
+
+// Action is a change made to a package to reconcile the system with a manifest.
+type Action string
+
+// Action constants define the changes a plan can make.
+const (
+	// ActionInstall installs a package that is not installed.
+	ActionInstall Action = "install"
+
+	// ActionUpgrade installs a newer version of an installed package.
+	ActionUpgrade Action = "upgrade"
+
+	// ActionDowngrade installs an older version of an installed package.
+	ActionDowngrade Action = "downgrade"
+
+	// ActionRemove removes an installed package.
+	ActionRemove Action = "remove"
+
+	// ActionHold holds a package at its installed version.
+	ActionHold Action = "hold"
+
+	// ActionUnhold releases a held package, so that it is upgraded again.
+	ActionUnhold Action = "unhold"
+)
+
+// actionOrder is the order in which the actions are applied for each package manager: packages are released first,
+// so that their version can change, then removed, to make room for the installed ones, and held last,
+// once they are at the right version.
+var actionOrder = map[Action]int{
+	ActionUnhold:    0,
+	ActionRemove:    1,
+	ActionInstall:   2,
+	ActionUpgrade:   2,
+	ActionDowngrade: 2,
+	ActionHold:      3,
+}
+
+// Step is a change to a single package.
+type Step struct {
+	// Action is the change to make.
+	Action Action
+
+	// PackageManager is the name of the package manager of the package.
+	PackageManager string
+
+	// Name is the package name.
+	Name string
+
+	// Arch is the architecture to install the package for, or empty for any.
+	Arch string
+
+	// Version is the version to install, or empty for the latest available one.
+	Version string
+
+	// CurrentVersion is the installed version of the package, or empty if it is not installed.
+	CurrentVersion string
+}
+
+// String returns a human-readable description of the step, such as "apt: upgrade curl (7.81.0-1 -> 7.81.0-2)".
+func (s Step) String() string {
+	name := s.Name
+	if s.Arch != "" {
+		name += ":" + s.Arch
+	}
+	desc := fmt.Sprintf("%s: %s %s", s.PackageManager, s.Action, name)
+	switch {
+	case s.CurrentVersion != "" && s.Version != "":
+		desc += fmt.Sprintf(" (%s -> %s)", s.CurrentVersion, s.Version)
+	case s.Version != "":
+		desc += fmt.Sprintf(" (%s)", s.Version)
+	case s.CurrentVersion != "":
+		desc += fmt.Sprintf(" (%s)", s.CurrentVersion)
+	}
+	return desc
+}
+
+// Plan is the list of changes that reconcile the system with a manifest, grouped by package manager
+// by decreasing priority, in the order they are applied.
+type Plan struct {
+	Steps []Step
+}
+
+// Empty reports whether the system already matches the manifest.
+func (p *Plan) Empty() bool {
+	return len(p.Steps) == 0
+}
+
+// String returns the steps of the plan, one per line.
+func (p *Plan) String() string {
+	var b strings.Builder
+	for _, step := range p.Steps {
+		b.WriteString(step.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// NewPlan compares m with the packages installed by the package managers of s, and returns the changes that reconcile them.
+// Entries without a package manager use the available package manager of s with the highest priority.
+// Packages that are not in the manifest are left alone.
+//
+// It returns an error if the manifest uses a package manager that s does not have, pins a version with a package manager
+// that cannot install a given version, or holds packages with a package manager that cannot hold them (manager.ErrUnsupported).
+func NewPlan(ctx context.Context, s syspkg.SysPkg, m *Manifest, opts *manager.Options) (*Plan, error) {
+	var defaultManager string
+	if pm := s.GetPackageManager(""); pm != nil {
+		defaultManager = pm.GetPackageManager()
+	}
+
+	entries := make(map[string][]Entry)
+	for _, e := range m.Packages {
+		if e.Manager == "" {
+			e.Manager = defaultManager
+		}
+		entries[e.Manager] = append(entries[e.Manager], e)
+	}
+
+	plan := &Plan{}
+	for _, name := range managerNames(entries) {
+		steps, err := planManager(ctx, s, name, entries[name], opts)
+		if err != nil {
+			return nil, err
+		}
+		plan.Steps = append(plan.Steps, steps...)
+	}
+	return plan, nil
+}
+
+// managerNames returns the names of the package managers used by entries, by decreasing priority.
+// The ones that are not registered come first, so that NewPlan fails before listing any package.
+func managerNames(entries map[string][]Entry) []string {
+	var names []string
+	for _, m := range manager.Registered() {
+		if _, ok := entries[m.Name]; ok {
+			names = append(names, m.Name)
+		}
+	}
+
+	var unknown []string
+	for name := range entries {
+		if _, err := manager.Lookup(name); err != nil {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return append(unknown, names...)
+}
+
+// planManager returns the steps that reconcile the packages of the package manager with the given name with entries.
+func planManager(ctx context.Context, s syspkg.SysPkg, name string, entries []Entry, opts *manager.Options) ([]Step, error) {
+	pm := s.GetPackageManagerContext(name)
+	if pm == nil {
+		if name == "" {
+			return nil, fmt.Errorf("no package manager is available")
+		}
+		return nil, fmt.Errorf("package manager %s is not available", name)
+	}
+
+	installed, err := pm.ListInstalledContext(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("listing the packages installed by %s: %w", name, err)
+	}
+	// the entries without an architecture match the package installed for any architecture
+	type key struct{ name, arch string }
+	installedByKey := make(map[key]manager.PackageInfo, len(installed))
+	installedByName := make(map[string]manager.PackageInfo, len(installed))
+	for _, pkg := range installed {
+		installedByKey[key{pkg.Name, pkg.Arch}] = pkg
+		if _, ok := installedByName[pkg.Name]; !ok {
+			installedByName[pkg.Name] = pkg
+		}
+	}
+
+	_, canRequest := manager.As[manager.RequestInstaller](pm)
+	canPin := canRequest && PinsVersions(name)
+
+	// a hold without an architecture holds the package for any architecture
+	held := make(map[key]bool)
+	h, canHold := manager.As[manager.HoldManager](pm)
+	if canHold {
+		heldPkgs, err := h.ListHeldContext(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("listing the packages held by %s: %w", name, err)
+		}
+		for _, pkg := range heldPkgs {
+			held[key{pkg.Name, pkg.Arch}] = true
+		}
+	}
+
+	var steps []Step
+	for _, e := range entries {
+		pkg, isInstalled := installedByKey[key{e.Name, e.Arch}]
+		if !isInstalled && e.Arch == "" {
+			pkg, isInstalled = installedByName[e.Name]
+		}
+		step := Step{PackageManager: name, Name: e.Name, Arch: e.Arch, CurrentVersion: pkg.Version}
+
+		if e.State == StateAbsent {
+			if isInstalled {
+				step.Action = ActionRemove
+				steps = append(steps, step)
+			}
+			continue
+		}
+
+		if e.Version != "" && !canPin {
+			return nil, fmt.Errorf("%s cannot install version %s of %s: %w", name, e.Version, e.Name, manager.ErrUnsupported)
+		}
+		if e.Arch != "" && !canRequest {
+			return nil, fmt.Errorf("%s cannot install %s for architecture %s: %w", name, e.Name, e.Arch, manager.ErrUnsupported)
+		}
+		if e.Held != nil && *e.Held && !canHold {
+			return nil, fmt.Errorf("%s cannot hold package %s: %w", name, e.Name, manager.ErrUnsupported)
+		}
+
+		changesVersion := false
+		switch {
+		case !isInstalled:
+			step.Action = ActionInstall
+			step.Version = e.Version
+			steps = append(steps, step)
+		case e.Version != "":
+			pkg.PackageManager = name
+			if c := pkg.Compare(e.Version); c != 0 {
+				step.Action = ActionUpgrade
+				if c > 0 {
+					step.Action = ActionDowngrade
+				}
+				step.Version = e.Version
+				steps = append(steps, step)
+				changesVersion = true
+			}
+		}
+		if !canHold {
+			continue
+		}
+
+		// a held package is released to change its version, and held again afterwards unless it must not be
+		isHeld := held[key{e.Name, e.Arch}] || held[key{e.Name, ""}]
+		wantHeld := isHeld
+		if e.Held != nil {
+			wantHeld = *e.Held
+		}
+		step.Version = ""
+		if isHeld && (changesVersion || !wantHeld) {
+			step.Action = ActionUnhold
+			steps = append(steps, step)
+		}
+		if wantHeld && (changesVersion || !isHeld) {
+			step.Action = ActionHold
+			steps = append(steps, step)
+		}
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		return actionOrder[steps[i].Action] < actionOrder[steps[j].Action]
+	})
+	return steps, nil
+}
+
+// PinsVersions reports whether the package manager with the given name can install a given version of a package,
+// so that manifest entries can pin their version.
+func PinsVersions(packageManager string) bool {
+	scheme := version.SchemeFor(packageManager)
+	return scheme == version.Debian || scheme == version.RPM
+}
+
+// Apply applies the steps of plan with the package managers of s, and returns the packages they changed.
+// For each package manager, packages are released, then removed, then installed (at their pinned version, if any,
+// with manager.RequestInstaller, or manager.Downgrader for older versions), then held. The packages of the steps
+// with an Arch are removed, held and released for that architecture only.
+// A package manager failing stops its remaining steps, but not the ones of the other package managers:
+// the failures are returned together as a syspkg.ManagerErrors.
+func Apply(ctx context.Context, s syspkg.SysPkg, plan *Plan, opts *manager.Options) ([]manager.PackageInfo, error) {
+	var names []string
+	steps := make(map[string][]Step)
+	for _, step := range plan.Steps {
+		if _, ok := steps[step.PackageManager]; !ok {
+			names = append(names, step.PackageManager)
+		}
+		steps[step.PackageManager] = append(steps[step.PackageManager], step)
+	}
+
+	var packages []manager.PackageInfo
+	errs := make(syspkg.ManagerErrors)
+	for _, name := range names {
+		pkgs, err := applyManager(ctx, s, name, steps[name], opts)
+		packages = append(packages, pkgs...)
+		if err != nil {
+			errs[name] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return packages, errs
+	}
+	return packages, nil
+}
+
+// StepError is the error of a step that failed.
+type StepError struct {
+	Step Step
+	Err  error
+}
+
+// Error implements the error interface.
+func (e StepError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Step, e.Err)
+}
+
+// Unwrap returns the error of the step.
+func (e StepError) Unwrap() error {
+	return e.Err
+}
+
+// StepErrors is the error returned by ApplyEach: the steps that failed, in the order of the plan.
+// Use errors.As to get it from the returned error; errors.Is matches the error of any step.
+type StepErrors []StepError
+
+// Error implements the error interface.
+func (e StepErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, stepErr := range e {
+		msgs[i] = stepErr.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the steps, so that errors.Is and errors.As can match any of them.
+func (e StepErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, stepErr := range e {
+		errs[i] = stepErr
+	}
+	return errs
+}
+
+// ApplyEach is like Apply, but when the steps of a package manager fail together, it applies them again one by one,
+// so that a failing step, such as a version the repositories no longer offer, does not prevent the other changes.
+// The steps that still fail are returned as a StepErrors.
+func ApplyEach(ctx context.Context, s syspkg.SysPkg, plan *Plan, opts *manager.Options) ([]manager.PackageInfo, error) {
+	packages, err := Apply(ctx, s, plan, opts)
+	var managerErrs syspkg.ManagerErrors
+	if !errors.As(err, &managerErrs) {
+		return packages, err
+	}
+
+	var errs StepErrors
+	for _, step := range plan.Steps {
+		if managerErrs[step.PackageManager] == nil {
+			continue
+		}
+		pkgs, err := applyManager(ctx, s, step.PackageManager, []Step{step}, opts)
+		packages = append(packages, pkgs...)
+		if err != nil {
+			errs = append(errs, StepError{step, err})
+		}
+	}
+	if len(errs) > 0 {
+		return packages, errs
+	}
+	return packages, nil
+}
+
+// batch is an operation of a package manager, and the number of packages it runs on.
+type batch struct {
+	n   int
+	run func() ([]manager.PackageInfo, error)
+}
+
+// applyManager applies steps with the package manager with the given name.
+func applyManager(ctx context.Context, s syspkg.SysPkg, name string, steps []Step, opts *manager.Options) ([]manager.PackageInfo, error) {
+	pm := s.GetPackageManagerContext(name)
+	if pm == nil {
+		return nil, fmt.Errorf("package manager %s is not available", name)
+	}
+
+	var remove, install, hold, unhold []string
+	var pinned, downgrade []manager.InstallRequest
+	for _, step := range steps {
+		req := manager.InstallRequest{Name: step.Name, Version: step.Version, Arch: step.Arch}
+		arg := step.Name
+		switch step.Action {
+		case ActionRemove, ActionHold, ActionUnhold:
+			var err error
+			if arg, err = packageArg(name, step); err != nil {
+				return nil, err
+			}
+		}
+		switch step.Action {
+		case ActionRemove:
+			remove = append(remove, arg)
+		case ActionInstall, ActionUpgrade:
+			if step.Version == "" && step.Arch == "" {
+				install = append(install, step.Name)
+			} else {
+				pinned = append(pinned, req)
+			}
+		case ActionDowngrade:
+			downgrade = append(downgrade, req)
+		case ActionHold:
+			hold = append(hold, arg)
+		case ActionUnhold:
+			unhold = append(unhold, arg)
+		default:
+			return nil, fmt.Errorf("unknown action %q for package %s", step.Action, step.Name)
+		}
+	}
+
+	h, canHold := manager.As[manager.HoldManager](pm)
+	if !canHold && len(hold)+len(unhold) > 0 {
+		return nil, fmt.Errorf("%s cannot hold packages: %w", name, manager.ErrUnsupported)
+	}
+	installer, canRequest := manager.As[manager.RequestInstaller](pm)
+	if !canRequest && len(pinned) > 0 {
+		return nil, fmt.Errorf("%s cannot install a given version or architecture: %w", name, manager.ErrUnsupported)
+	}
+	downgrader, canDowngrade := manager.As[manager.Downgrader](pm)
+	if !canDowngrade && len(downgrade) > 0 {
+		return nil, fmt.Errorf("%s cannot downgrade packages: %w", name, manager.ErrUnsupported)
+	}
+
+	batches := []batch{
+		{len(unhold), func() ([]manager.PackageInfo, error) { return h.UnholdContext(ctx, unhold, opts) }},
+		{len(remove), func() ([]manager.PackageInfo, error) { return pm.DeleteContext(ctx, remove, opts) }},
+		{len(install), func() ([]manager.PackageInfo, error) { return pm.InstallContext(ctx, install, opts) }},
+		{len(pinned), func() ([]manager.PackageInfo, error) { return installer.InstallRequestsContext(ctx, pinned, opts) }},
+		{len(downgrade), func() ([]manager.PackageInfo, error) { return downgrader.DowngradeContext(ctx, downgrade, opts) }},
+		{len(hold), func() ([]manager.PackageInfo, error) { return h.HoldContext(ctx, hold, opts) }},
+	}
+
+	var packages []manager.PackageInfo
+	for _, b := range batches {
+		if b.n == 0 {
+			continue
+		}
+		pkgs, err := b.run()
+		packages = append(packages, pkgs...)
+		if err != nil {
+			return packages, err
+		}
+	}
+	return packages, nil
+}
+
+// packageArg returns the name of the package of step as the package manager with the given name takes it to remove,
+// hold or release the package: name:arch for the Debian package managers and name.arch for the RPM ones,
+// if step has an Arch.
+func packageArg(packageManager string, step Step) (string, error) {
+	if step.Arch == "" {
+		return step.Name, nil
+	}
+	switch version.SchemeFor(packageManager) {
+	case version.Debian:
+		return step.Name + ":" + step.Arch, nil
+	case version.RPM:
+		return step.Name + "." + step.Arch, nil
+	}
+	return "", fmt.Errorf("%s cannot %s %s for a given architecture: %w", packageManager, step.Action, step.Name, manager.ErrUnsupported)
+}
@@ -0,0 +1,236 @@
+package syspkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// ManagerErrors is the error returned by the operations of SysPkg that run on several package managers.
+// It maps the names of the package managers that failed to their error.
+// Use errors.As to get it from the returned error; errors.Is matches the error of any package manager.
+type ManagerErrors map[string]error
+
+// Error implements the error interface.
+func (e ManagerErrors) Error() string {
+	var msgs []string
+	for _, name := range e.Names() {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", name, e[name]))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the package managers, so that errors.Is and errors.As can match any of them.
+func (e ManagerErrors) Unwrap() []error {
+	var errs []error
+	for _, name := range e.Names() {
+		errs = append(errs, e[name])
+	}
+	return errs
+}
+
+// Names returns the names of the package managers that failed, sorted.
+func (e ManagerErrors) Names() []string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// names returns the names of the package managers of s, by decreasing priority. s.mu must be held.
+func (s *sysPkgImpl) names() []string {
+	var names []string
+	for _, m := range manager.Registered() {
+		if _, ok := s.pms[m.Name]; ok {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// lock returns the lock of the package manager with the given name: mutating operations hold it exclusively,
+// read-only operations share it.
+func (s *sysPkgImpl) lock(name string) *sync.RWMutex {
+	s.locksMu.Lock()
+	defer s.locksMu.Unlock()
+
+	if s.locks == nil {
+		s.locks = make(map[string]*sync.RWMutex)
+	}
+	if s.locks[name] == nil {
+		s.locks[name] = new(sync.RWMutex)
+	}
+	return s.locks[name]
+}
+
+// each calls fn with every package manager of s, and merges the packages it returns by decreasing priority of the package managers.
+// Read-only operations run concurrently on the package managers, up to opts.Concurrency at once;
+// mutating operations run on one package manager after the other, and never at the same time as another operation on the same one.
+// The errors are returned as a ManagerErrors, or nil if there are none.
+func (s *sysPkgImpl) each(mutating bool, opts *manager.Options, fn func(pm PackageManagerContext) ([]manager.PackageInfo, error)) ([]manager.PackageInfo, error) {
+	s.mu.RLock()
+	names := s.names()
+	pms := make([]PackageManager, len(names))
+	for i, name := range names {
+		pms[i] = s.pms[name]
+	}
+	s.mu.RUnlock()
+
+	results := make([][]manager.PackageInfo, len(names))
+	errs := make([]error, len(names))
+	run := func(i int) {
+		lock := s.lock(names[i])
+		if mutating {
+			lock.Lock()
+			defer lock.Unlock()
+		} else {
+			lock.RLock()
+			defer lock.RUnlock()
+		}
+		results[i], errs[i] = fn(manager.WithContext(pms[i]))
+	}
+
+	if mutating {
+		for i := range names {
+			run(i)
+		}
+	} else {
+		limit := len(names)
+		if opts != nil && opts.Concurrency > 0 && opts.Concurrency < limit {
+			limit = opts.Concurrency
+		}
+		sem := make(chan struct{}, limit)
+		var wg sync.WaitGroup
+		for i := range names {
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	var packages []manager.PackageInfo
+	managerErrs := make(ManagerErrors)
+	for i, name := range names {
+		packages = append(packages, results[i]...)
+		if errs[i] != nil {
+			managerErrs[name] = errs[i]
+		}
+	}
+
+	if len(managerErrs) > 0 {
+		return packages, managerErrs
+	}
+	return packages, nil
+}
+
+// Install installs the specified packages with every package manager.
+func (s *sysPkgImpl) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.InstallContext(context.Background(), pkgs, opts)
+}
+
+// InstallContext is like Install but uses ctx to bound the commands.
+func (s *sysPkgImpl) InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.each(true, opts, func(pm PackageManagerContext) ([]manager.PackageInfo, error) {
+		return pm.InstallContext(ctx, pkgs, opts)
+	})
+}
+
+// Delete removes the specified packages with every package manager.
+func (s *sysPkgImpl) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.DeleteContext(context.Background(), pkgs, opts)
+}
+
+// DeleteContext is like Delete but uses ctx to bound the commands.
+func (s *sysPkgImpl) DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.each(true, opts, func(pm PackageManagerContext) ([]manager.PackageInfo, error) {
+		return pm.DeleteContext(ctx, pkgs, opts)
+	})
+}
+
+// Find searches for packages using the specified keywords with every package manager.
+func (s *sysPkgImpl) Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.FindContext(context.Background(), keywords, opts)
+}
+
+// FindContext is like Find but uses ctx to bound the commands.
+func (s *sysPkgImpl) FindContext(ctx context.Context, keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.each(false, opts, func(pm PackageManagerContext) ([]manager.PackageInfo, error) {
+		return pm.FindContext(ctx, keywords, opts)
+	})
+}
+
+// ListInstalled lists the installed packages of every package manager.
+func (s *sysPkgImpl) ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.ListInstalledContext(context.Background(), opts)
+}
+
+// ListInstalledContext is like ListInstalled but uses ctx to bound the commands.
+func (s *sysPkgImpl) ListInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.each(false, opts, func(pm PackageManagerContext) ([]manager.PackageInfo, error) {
+		return pm.ListInstalledContext(ctx, opts)
+	})
+}
+
+// ListUpgradable lists the upgradable packages of every package manager.
+func (s *sysPkgImpl) ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.ListUpgradableContext(context.Background(), opts)
+}
+
+// ListUpgradableContext is like ListUpgradable but uses ctx to bound the commands.
+func (s *sysPkgImpl) ListUpgradableContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.each(false, opts, func(pm PackageManagerContext) ([]manager.PackageInfo, error) {
+		return pm.ListUpgradableContext(ctx, opts)
+	})
+}
+
+// UpgradeAll upgrades all packages, or only the specified ones, with every package manager.
+func (s *sysPkgImpl) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.UpgradeAllContext(context.Background(), pkgs, opts)
+}
+
+// UpgradeAllContext is like UpgradeAll but uses ctx to bound the commands.
+func (s *sysPkgImpl) UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.each(true, opts, func(pm PackageManagerContext) ([]manager.PackageInfo, error) {
+		return pm.UpgradeAllContext(ctx, pkgs, opts)
+	})
+}
+
+// Refresh refreshes the package index of every package manager.
+func (s *sysPkgImpl) Refresh(opts *manager.Options) error {
+	return s.RefreshContext(context.Background(), opts)
+}
+
+// RefreshContext is like Refresh but uses ctx to bound the commands.
+func (s *sysPkgImpl) RefreshContext(ctx context.Context, opts *manager.Options) error {
+	_, err := s.each(true, opts, func(pm PackageManagerContext) ([]manager.PackageInfo, error) {
+		return nil, pm.RefreshContext(ctx, opts)
+	})
+	return err
+}
+
+// GetPackageInfo returns information about the specified package from every package manager that knows it.
+func (s *sysPkgImpl) GetPackageInfo(pkg string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.GetPackageInfoContext(context.Background(), pkg, opts)
+}
+
+// GetPackageInfoContext is like GetPackageInfo but uses ctx to bound the commands.
+func (s *sysPkgImpl) GetPackageInfoContext(ctx context.Context, pkg string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return s.each(false, opts, func(pm PackageManagerContext) ([]manager.PackageInfo, error) {
+		info, err := pm.GetPackageInfoContext(ctx, pkg, opts)
+		if err != nil || info.Name == "" {
+			return nil, err
+		}
+		return []manager.PackageInfo{info}, nil
+	})
+}
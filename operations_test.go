@@ -0,0 +1,165 @@
+package syspkg_test
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sjwhyte/syspkg"
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// fakeManager is a PackageManager that answers every operation with the same packages and error.
+type fakeManager struct {
+	name string
+	pkgs []manager.PackageInfo
+	err  error
+	hook func()
+}
+
+func (f *fakeManager) IsAvailable() bool         { return true }
+func (f *fakeManager) GetPackageManager() string { return f.name }
+func (f *fakeManager) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.pkgs, f.err
+}
+func (f *fakeManager) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.pkgs, f.err
+}
+func (f *fakeManager) Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.pkgs, f.err
+}
+func (f *fakeManager) ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.pkgs, f.err
+}
+func (f *fakeManager) ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error) {
+	if f.hook != nil {
+		f.hook()
+	}
+	return f.pkgs, f.err
+}
+func (f *fakeManager) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.pkgs, f.err
+}
+func (f *fakeManager) Refresh(opts *manager.Options) error { return f.err }
+func (f *fakeManager) GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	return f.pkgs[0], f.err
+}
+
+var errFake = errors.New("fake failure")
+
+// slowCalls tracks the calls to the "slow-*" package managers in progress.
+var slowCalls struct {
+	sync.Mutex
+	active, max int
+}
+
+func slowHook() {
+	slowCalls.Lock()
+	slowCalls.active++
+	if slowCalls.active > slowCalls.max {
+		slowCalls.max = slowCalls.active
+	}
+	slowCalls.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	slowCalls.Lock()
+	slowCalls.active--
+	slowCalls.Unlock()
+}
+
+func init() {
+	for _, name := range []string{"slow-c", "slow-a", "slow-b"} {
+		manager.Register(name, manager.PriorityUniversal, func() manager.PackageManager {
+			return &fakeManager{name: name, pkgs: []manager.PackageInfo{{Name: name, PackageManager: name}}, hook: slowHook}
+		})
+	}
+	manager.Register("fake-low", manager.PriorityUniversal, func() manager.PackageManager {
+		return &fakeManager{name: "fake-low", pkgs: []manager.PackageInfo{{Name: "low", PackageManager: "fake-low"}}}
+	})
+	manager.Register("fake-high", manager.PrioritySystem, func() manager.PackageManager {
+		return &fakeManager{name: "fake-high", pkgs: []manager.PackageInfo{{Name: "high", PackageManager: "fake-high"}}}
+	})
+	manager.Register("fake-failing", manager.PrioritySystem, func() manager.PackageManager {
+		return &fakeManager{name: "fake-failing", pkgs: []manager.PackageInfo{{Name: "partial", PackageManager: "fake-failing"}}, err: errFake}
+	})
+}
+
+func TestAggregateOperations(t *testing.T) {
+	s, err := syspkg.New(syspkg.IncludeOptions{Managers: []string{"fake-low", "fake-high", "fake-failing"}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	pkgs, err := s.ListInstalled(nil)
+
+	want := []manager.PackageInfo{
+		{Name: "partial", PackageManager: "fake-failing"},
+		{Name: "high", PackageManager: "fake-high"},
+		{Name: "low", PackageManager: "fake-low"},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("ListInstalled() = %+v, want %+v", pkgs, want)
+	}
+
+	var errs syspkg.ManagerErrors
+	if !errors.As(err, &errs) || !reflect.DeepEqual(errs.Names(), []string{"fake-failing"}) {
+		t.Errorf("ListInstalled() error = %+v, want a failure of fake-failing only", err)
+	}
+	if !errors.Is(err, errFake) {
+		t.Errorf("ListInstalled() error = %+v, want it to wrap %v", err, errFake)
+	}
+
+	if name := s.GetPackageManager("").GetPackageManager(); name != "fake-failing" {
+		t.Errorf("GetPackageManager(\"\") = %s, want the first package manager by priority and name", name)
+	}
+}
+
+func TestAggregateOperationsWithoutErrors(t *testing.T) {
+	s, err := syspkg.New(syspkg.IncludeOptions{Managers: []string{"fake-low", "fake-high"}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := s.Refresh(nil); err != nil {
+		t.Errorf("Refresh() error = %+v, want nil", err)
+	}
+	if _, err := syspkg.New(syspkg.IncludeOptions{Managers: []string{"nosuchmanager"}}); err == nil {
+		t.Errorf("New() error = nil, want an error for an unknown package manager")
+	}
+}
+
+func TestReadOnlyOperationsConcurrency(t *testing.T) {
+	s, err := syspkg.New(syspkg.IncludeOptions{Managers: []string{"slow-a", "slow-b", "slow-c"}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		concurrency int
+		wantMax     int
+	}{
+		{0, 3},
+		{2, 2},
+		{1, 1},
+	} {
+		slowCalls.max = 0
+		pkgs, err := s.ListUpgradable(&manager.Options{Concurrency: tt.concurrency})
+		if err != nil {
+			t.Fatalf("ListUpgradable() error = %v", err)
+		}
+
+		var names []string
+		for _, pkg := range pkgs {
+			names = append(names, pkg.Name)
+		}
+		if want := []string{"slow-a", "slow-b", "slow-c"}; !reflect.DeepEqual(names, want) {
+			t.Errorf("ListUpgradable() with Concurrency %d = %+v, want %+v", tt.concurrency, names, want)
+		}
+		if slowCalls.max != tt.wantMax {
+			t.Errorf("ListUpgradable() with Concurrency %d ran %d package managers at once, want %d", tt.concurrency, slowCalls.max, tt.wantMax)
+		}
+	}
+}
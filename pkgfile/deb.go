@@ -0,0 +1,280 @@
+package pkgfile
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manager/apt"
+)
+
+// debScripts are the maintainer scripts of .deb packages, in the order they run on a first install, then on removal.
+var debScripts = []string{"preinst", "postinst", "prerm", "postrm"}
+
+// ReadDeb reads the .deb package from r: an ar archive of a debian-binary version, a control tarball with the control file
+// and the maintainer scripts, and a data tarball with the files. The tarballs are uncompressed, or compressed with gzip,
+// xz, zstd, bzip2 or lzma. The package has the fields of the control file, and "apt" as PackageManager.
+func ReadDeb(r io.Reader) (manager.PackageInfo, *Metadata, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, 8)
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != "!<arch>\n" {
+		return manager.PackageInfo{}, nil, errors.New("not a .deb package: missing ar archive signature")
+	}
+
+	meta := &Metadata{Type: manager.PackageFileDeb}
+	var control string
+	var seenVersion, seenControl, seenData bool
+	for {
+		name, member, err := nextArMember(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return manager.PackageInfo{}, nil, err
+		}
+
+		switch {
+		case name == "debian-binary":
+			data, err := io.ReadAll(member)
+			if err != nil {
+				return manager.PackageInfo{}, nil, err
+			}
+			if !strings.HasPrefix(string(data), "2.") {
+				return manager.PackageInfo{}, nil, fmt.Errorf("unsupported .deb format version %q", strings.TrimSpace(string(data)))
+			}
+			seenVersion = true
+		case strings.HasPrefix(name, "control.tar"):
+			if control, meta.Scripts, err = readControlTar(name, member); err != nil {
+				return manager.PackageInfo{}, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			seenControl = true
+		case strings.HasPrefix(name, "data.tar"):
+			if meta.Files, err = readDataTar(name, member); err != nil {
+				return manager.PackageInfo{}, nil, fmt.Errorf("%s: %w", name, err)
+			}
+			seenData = true
+		}
+
+		// skip what is left of the member, and the byte that pads it to an even size
+		if _, err := io.Copy(io.Discard, member); err != nil {
+			return manager.PackageInfo{}, nil, err
+		}
+		if member.size%2 == 1 {
+			if _, err := br.Discard(1); err != nil && err != io.EOF {
+				return manager.PackageInfo{}, nil, err
+			}
+		}
+	}
+	if !seenVersion || !seenControl || !seenData {
+		return manager.PackageInfo{}, nil, errors.New("not a .deb package: missing debian-binary, control or data member")
+	}
+
+	fields := parseControl(control)
+	pkg := manager.PackageInfo{
+		Name:           fields["Package"],
+		Version:        fields["Version"],
+		Arch:           fields["Architecture"],
+		Category:       fields["Section"],
+		Status:         manager.PackageStatusAvailable,
+		PackageManager: "apt",
+	}
+	if pkg.Name == "" || pkg.Version == "" {
+		return manager.PackageInfo{}, nil, errors.New("control file without Package or Version")
+	}
+	meta.Maintainer = fields["Maintainer"]
+	meta.Summary, meta.Description = splitDescription(fields["Description"])
+	meta.Dependencies = apt.ParseDependenciesOutput(foldControl(control), nil)
+	if kib, err := strconv.ParseInt(fields["Installed-Size"], 10, 64); err == nil {
+		meta.InstalledSize = kib * 1024
+	}
+	return pkg, meta, nil
+}
+
+// arMember is the content of a member of an ar archive.
+type arMember struct {
+	io.Reader
+	size int64
+}
+
+// nextArMember reads the header of the next member of the ar archive r, and returns its name and content.
+// It returns io.EOF at the end of the archive.
+func nextArMember(r io.Reader) (string, *arMember, error) {
+	header := make([]byte, 60)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return "", nil, errors.New("truncated ar archive")
+		}
+		return "", nil, err
+	}
+	if string(header[58:60]) != "`\n" {
+		return "", nil, errors.New("invalid ar member header")
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(header[48:58])), 10, 64)
+	if err != nil || size < 0 {
+		return "", nil, errors.New("invalid ar member size")
+	}
+	// GNU ar ends the names with a slash
+	name := strings.TrimSuffix(strings.TrimSpace(string(header[:16])), "/")
+	return name, &arMember{Reader: io.LimitReader(r, size), size: size}, nil
+}
+
+// decompress returns the content of the tarball member of a .deb package, decompressed according to its name,
+// such as data.tar.xz, and a function that releases the decompressor.
+func decompress(name string, r io.Reader) (io.Reader, func(), error) {
+	noop := func() {}
+	switch path.Ext(name) {
+	case ".tar":
+		return r, noop, nil
+	case ".gz":
+		zr, err := gzip.NewReader(r)
+		return zr, noop, err
+	case ".xz":
+		xr, err := xz.NewReader(r)
+		return xr, noop, err
+	case ".zst":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, noop, err
+		}
+		return zr, zr.Close, nil
+	case ".bz2":
+		return bzip2.NewReader(r), noop, nil
+	case ".lzma":
+		lr, err := lzma.NewReader(r)
+		return lr, noop, err
+	}
+	return nil, noop, fmt.Errorf("unknown compression: %w", manager.ErrUnsupported)
+}
+
+// readControlTar reads the control tarball of a .deb package, and returns its control file and the maintainer scripts it has.
+func readControlTar(name string, r io.Reader) (string, []string, error) {
+	dr, release, err := decompress(name, r)
+	if err != nil {
+		return "", nil, err
+	}
+	defer release()
+
+	var control string
+	present := make(map[string]bool)
+	tr := tar.NewReader(dr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		switch base := path.Clean(h.Name); base {
+		case "control":
+			data, err := io.ReadAll(io.LimitReader(tr, 1<<20))
+			if err != nil {
+				return "", nil, err
+			}
+			control = string(data)
+		default:
+			present[base] = h.Typeflag == tar.TypeReg
+		}
+	}
+	if control == "" {
+		return "", nil, errors.New("missing control file")
+	}
+
+	var scripts []string
+	for _, script := range debScripts {
+		if present[script] {
+			scripts = append(scripts, script)
+		}
+	}
+	return control, scripts, nil
+}
+
+// readDataTar reads the data tarball of a .deb package, and returns the absolute paths of its files and directories.
+func readDataTar(name string, r io.Reader) ([]string, error) {
+	dr, release, err := decompress(name, r)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var files []string
+	tr := tar.NewReader(dr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		// the paths are relative to the root, usually as ./usr/bin/hello
+		if p := path.Clean("/" + h.Name); p != "/" {
+			files = append(files, p)
+		}
+	}
+	return files, nil
+}
+
+// parseControl parses the fields of a Debian control file. The continuation lines of multi-line fields,
+// such as Description, are kept as they are, after a newline.
+func parseControl(control string) map[string]string {
+	fields := make(map[string]string)
+	var last string
+	for _, line := range strings.Split(control, "\n") {
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			if last != "" {
+				fields[last] += "\n" + line
+			}
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			last = ""
+			continue
+		}
+		last = name
+		fields[name] = strings.TrimSpace(value)
+	}
+	return fields
+}
+
+// foldControl joins the continuation lines of a Debian control file to the line of their field,
+// so that every field takes a single line.
+func foldControl(control string) string {
+	var b bytes.Buffer
+	for i, line := range strings.Split(control, "\n") {
+		if i > 0 && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			b.WriteByte('\n')
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
+
+// splitDescription splits the Description field of a Debian control file into its synopsis, on the first line,
+// and its extended description, on the continuation lines, where a single dot is an empty line.
+func splitDescription(field string) (string, string) {
+	summary, rest, _ := strings.Cut(field, "\n")
+	var lines []string
+	for _, line := range strings.Split(rest, "\n") {
+		line = strings.TrimPrefix(line, " ")
+		if line == "." {
+			line = ""
+		}
+		lines = append(lines, line)
+	}
+	return summary, strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,123 @@
+package pkgfile_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ulikunitz/xz"
+
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/pkgfile"
+)
+
+const helloControl = `Package: hello
+Version: 2.10-3
+Architecture: amd64
+Maintainer: Santiago Vila <sanvila@debian.org>
+Installed-Size: 280
+Depends: libc6 (>= 2.34),
+ install-info | dpkg (>= 1.15.4)
+Section: devel
+Description: example package based on GNU hello
+ The GNU hello program produces a familiar, friendly greeting.
+ .
+ It is an example of the GNU coding standards.
+`
+
+// tarball returns a tarball of the given files, in order, compressed by compress.
+func tarball(t *testing.T, compress func(io.Writer) io.WriteCloser, files ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	cw := compress(&buf)
+	tw := tar.NewWriter(cw)
+	for i := 0; i < len(files); i += 2 {
+		h := &tar.Header{Name: files[i], Mode: 0o755, Size: int64(len(files[i+1])), Typeflag: tar.TypeReg}
+		if files[i][len(files[i])-1] == '/' {
+			h.Typeflag, h.Size = tar.TypeDir, 0
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[i+1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// arArchive returns an ar archive of the given members, as name and content pairs.
+func arArchive(members ...any) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("!<arch>\n")
+	for i := 0; i < len(members); i += 2 {
+		data := members[i+1].([]byte)
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8s%-10d`\n", members[i].(string), 0, 0, 0, "100644", len(data))
+		buf.Write(data)
+		if len(data)%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReadDeb(t *testing.T) {
+	gz := func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }
+	xzw := func(w io.Writer) io.WriteCloser {
+		xw, err := xz.NewWriter(w)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return xw
+	}
+	deb := arArchive(
+		"debian-binary", []byte("2.0\n"),
+		"control.tar.gz", tarball(t, gz, "./", "", "./control", helloControl, "./postinst", "#!/bin/sh\n", "./md5sums", ""),
+		"data.tar.xz", tarball(t, xzw, "./", "", "./usr/", "", "./usr/bin/", "", "./usr/bin/hello", "\x7fELF"),
+	)
+	path := filepath.Join(t.TempDir(), "hello_2.10-3_amd64.deb")
+	if err := os.WriteFile(path, deb, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	pkg, meta, err := pkgfile.Inspect(path)
+	if err != nil {
+		t.Fatalf("Inspect() error = %v", err)
+	}
+	wantPkg := manager.PackageInfo{Name: "hello", Version: "2.10-3", Arch: "amd64", Category: "devel", Status: manager.PackageStatusAvailable, PackageManager: "apt"}
+	if !reflect.DeepEqual(pkg, wantPkg) {
+		t.Errorf("Inspect() = %+v, want %+v", pkg, wantPkg)
+	}
+	wantMeta := &pkgfile.Metadata{
+		Type:        manager.PackageFileDeb,
+		Maintainer:  "Santiago Vila <sanvila@debian.org>",
+		Summary:     "example package based on GNU hello",
+		Description: "The GNU hello program produces a familiar, friendly greeting.\n\nIt is an example of the GNU coding standards.",
+		Dependencies: []manager.Dependency{
+			{Kind: manager.DependencyDepends, Name: "libc6", Constraint: ">= 2.34"},
+			{Kind: manager.DependencyDepends, Name: "install-info", Alternatives: []string{"dpkg"}},
+		},
+		Scripts:       []string{"postinst"},
+		Files:         []string{"/usr", "/usr/bin", "/usr/bin/hello"},
+		InstalledSize: 280 * 1024,
+	}
+	if !reflect.DeepEqual(meta, wantMeta) {
+		t.Errorf("Inspect() metadata = %+v, want %+v", meta, wantMeta)
+	}
+
+	if _, _, err := pkgfile.ReadDeb(bytes.NewReader(deb[:100])); err == nil {
+		t.Errorf("ReadDeb() of a truncated package: error = nil, want an error")
+	}
+}
@@ -0,0 +1,76 @@
+// Package pkgfile reads the metadata of package files without installing them, and without running any command:
+// Debian packages (.deb) and RPM packages (.rpm) are parsed in Go, so that artifacts can be checked on any machine
+// before they are pushed to the machines that install them.
+//
+//	pkg, meta, err := pkgfile.Inspect("hello_1.0-1_amd64.deb")
+//	...
+//	fmt.Println(pkg.Name, pkg.Version, meta.Dependencies, meta.Scripts)
+package pkgfile
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// Metadata is the metadata of a package file that manager.PackageInfo does not hold.
+type Metadata struct {
+	// Type is the type of the package file.
+	Type manager.PackageFileType
+
+	// Maintainer is who maintains the package: the Maintainer of .deb packages, and the Packager, or else the Vendor, of .rpm packages.
+	Maintainer string
+
+	// Summary is the one-line description of the package.
+	Summary string
+
+	// Description is the long description of the package.
+	Description string
+
+	// Dependencies are the relationships of the package with other packages. The internal rpmlib() requirements
+	// of .rpm packages are left out.
+	Dependencies []manager.Dependency
+
+	// Scripts are the names of the maintainer scripts the package runs when it is installed, upgraded or removed:
+	// preinst, postinst, prerm and postrm for .deb packages, and pretrans, pre, post, preun, postun and posttrans,
+	// as in spec files, for .rpm packages.
+	Scripts []string
+
+	// Files are the absolute paths of the files and directories the package installs.
+	Files []string
+
+	// InstalledSize is the size in bytes of the installed files. .deb packages declare it in KiB, so it is a multiple of 1024 for them.
+	InstalledSize int64
+}
+
+// Inspect reads the package file at path, whose type is detected with manager.DetectPackageFile, and returns its package,
+// available to the package manager that installs it ("apt" for .deb packages and "dnf" for .rpm packages), and its other metadata.
+// It returns an error wrapping manager.ErrUnsupported for the other types of package files.
+func Inspect(path string) (manager.PackageInfo, *Metadata, error) {
+	t, err := manager.DetectPackageFile(path)
+	if err != nil {
+		return manager.PackageInfo{}, nil, err
+	}
+
+	read := ReadDeb
+	switch t {
+	case manager.PackageFileDeb:
+	case manager.PackageFileRPM:
+		read = ReadRPM
+	default:
+		return manager.PackageInfo{}, nil, fmt.Errorf("%s: cannot inspect %s files: %w", path, t, manager.ErrUnsupported)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return manager.PackageInfo{}, nil, err
+	}
+	defer f.Close()
+
+	pkg, meta, err := read(f)
+	if err != nil {
+		return manager.PackageInfo{}, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return pkg, meta, nil
+}
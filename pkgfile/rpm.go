@@ -0,0 +1,359 @@
+package pkgfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// RPM header tags read by ReadRPM, see rpmtag.h.
+const (
+	rpmTagName             = 1000
+	rpmTagVersion          = 1001
+	rpmTagRelease          = 1002
+	rpmTagEpoch            = 1003
+	rpmTagSummary          = 1004
+	rpmTagDescription      = 1005
+	rpmTagSize             = 1009
+	rpmTagVendor           = 1011
+	rpmTagPackager         = 1015
+	rpmTagGroup            = 1016
+	rpmTagArch             = 1022
+	rpmTagOldFilenames     = 1027
+	rpmTagProvideName      = 1047
+	rpmTagRequireFlags     = 1048
+	rpmTagRequireName      = 1049
+	rpmTagRequireVersion   = 1050
+	rpmTagConflictFlags    = 1053
+	rpmTagConflictName     = 1054
+	rpmTagConflictVersion  = 1055
+	rpmTagProvideFlags     = 1112
+	rpmTagProvideVersion   = 1113
+	rpmTagDirIndexes       = 1116
+	rpmTagBasenames        = 1117
+	rpmTagDirnames         = 1118
+	rpmTagLongSize         = 5009
+	rpmTagRecommendName    = 5046
+	rpmTagRecommendVersion = 5047
+	rpmTagRecommendFlags   = 5048
+	rpmTagSuggestName      = 5049
+	rpmTagSuggestVersion   = 5050
+	rpmTagSuggestFlags     = 5051
+)
+
+// RPM header data types.
+const (
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeInt64       = 5
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// RPM dependency flags.
+const (
+	rpmSenseLess      = 1 << 1
+	rpmSenseGreater   = 1 << 2
+	rpmSenseEqual     = 1 << 3
+	rpmSensePrereq    = 1 << 6
+	rpmSenseScriptPre = 1 << 9
+)
+
+// rpmScripts are the tags of the scriptlets of .rpm packages, with the name of their section in spec files,
+// in the order they run on a first install, then on removal. A scriptlet has a body, a program, or both.
+var rpmScripts = []struct {
+	name       string
+	body, prog int
+}{
+	{"pretrans", 1151, 1153},
+	{"pre", 1023, 1085},
+	{"post", 1024, 1086},
+	{"preun", 1025, 1087},
+	{"postun", 1026, 1088},
+	{"posttrans", 1152, 1154},
+}
+
+// rpmDependencyTags are the tags of the names, flags and versions of the dependencies of .rpm packages, and their kind.
+// preDepends reports that the dependencies flagged as needed by the pre scriptlet are manager.DependencyPreDepends.
+var rpmDependencyTags = []struct {
+	kind                 manager.DependencyKind
+	name, flags, version int
+	preDepends           bool
+}{
+	{manager.DependencyDepends, rpmTagRequireName, rpmTagRequireFlags, rpmTagRequireVersion, true},
+	{manager.DependencyRecommends, rpmTagRecommendName, rpmTagRecommendFlags, rpmTagRecommendVersion, false},
+	{manager.DependencySuggests, rpmTagSuggestName, rpmTagSuggestFlags, rpmTagSuggestVersion, false},
+	{manager.DependencyConflicts, rpmTagConflictName, rpmTagConflictFlags, rpmTagConflictVersion, false},
+	{manager.DependencyProvides, rpmTagProvideName, rpmTagProvideFlags, rpmTagProvideVersion, false},
+}
+
+// ReadRPM reads the .rpm package from r: a lead, a signature header, and the header of the package, which has
+// all of its metadata, including its file list, so the compressed payload that follows is not read.
+// The package has the name, [epoch:]version-release and architecture of the header, and "dnf" as PackageManager.
+func ReadRPM(r io.Reader) (manager.PackageInfo, *Metadata, error) {
+	lead := make([]byte, 96)
+	if _, err := io.ReadFull(r, lead); err != nil || !bytes.HasPrefix(lead, []byte{0xed, 0xab, 0xee, 0xdb}) {
+		return manager.PackageInfo{}, nil, errors.New("not an .rpm package: missing lead signature")
+	}
+
+	// the signature header is padded to a multiple of 8 bytes
+	_, size, err := readRPMHeader(r)
+	if err != nil {
+		return manager.PackageInfo{}, nil, fmt.Errorf("signature header: %w", err)
+	}
+	if pad := (8 - size%8) % 8; pad > 0 {
+		if _, err := io.CopyN(io.Discard, r, int64(pad)); err != nil {
+			return manager.PackageInfo{}, nil, fmt.Errorf("signature header: %w", err)
+		}
+	}
+	h, _, err := readRPMHeader(r)
+	if err != nil {
+		return manager.PackageInfo{}, nil, fmt.Errorf("header: %w", err)
+	}
+
+	pkg := manager.PackageInfo{
+		Name:           h.str(rpmTagName),
+		Version:        h.str(rpmTagVersion) + "-" + h.str(rpmTagRelease),
+		Arch:           h.str(rpmTagArch),
+		Category:       h.str(rpmTagGroup),
+		Status:         manager.PackageStatusAvailable,
+		PackageManager: "dnf",
+	}
+	if pkg.Name == "" || h.str(rpmTagVersion) == "" {
+		return manager.PackageInfo{}, nil, errors.New("header without name or version")
+	}
+	if epoch := h.ints(rpmTagEpoch); len(epoch) > 0 {
+		pkg.Version = strconv.FormatInt(epoch[0], 10) + ":" + pkg.Version
+	}
+
+	meta := &Metadata{
+		Type:        manager.PackageFileRPM,
+		Maintainer:  h.str(rpmTagPackager),
+		Summary:     h.str(rpmTagSummary),
+		Description: h.str(rpmTagDescription),
+	}
+	if meta.Maintainer == "" {
+		meta.Maintainer = h.str(rpmTagVendor)
+	}
+	meta.Dependencies = h.dependencies()
+	for _, script := range rpmScripts {
+		if h.has(script.body) || h.has(script.prog) {
+			meta.Scripts = append(meta.Scripts, script.name)
+		}
+	}
+	meta.Files = h.files()
+	if size := h.ints(rpmTagLongSize); len(size) > 0 {
+		meta.InstalledSize = size[0]
+	} else if size := h.ints(rpmTagSize); len(size) > 0 {
+		meta.InstalledSize = size[0]
+	}
+	return pkg, meta, nil
+}
+
+// rpmEntry is an entry of the index of an RPM header: where the data of a tag is in the store, and its type.
+type rpmEntry struct {
+	typ, offset, count uint32
+}
+
+// rpmHeader is an RPM header structure: an index of tags, and the store of their data.
+type rpmHeader struct {
+	entries map[int]rpmEntry
+	store   []byte
+}
+
+// Limits on the size of the RPM headers, which are far below them in practice, so that a corrupted file
+// does not make ReadRPM allocate gigabytes.
+const (
+	rpmMaxEntries   = 1 << 16
+	rpmMaxStoreSize = 256 << 20
+)
+
+// readRPMHeader reads an RPM header structure from r, and returns it with its size in bytes.
+func readRPMHeader(r io.Reader) (*rpmHeader, int, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return nil, 0, err
+	}
+	if !bytes.HasPrefix(intro, []byte{0x8e, 0xad, 0xe8, 0x01}) {
+		return nil, 0, errors.New("missing header signature")
+	}
+	nindex := binary.BigEndian.Uint32(intro[8:12])
+	hsize := binary.BigEndian.Uint32(intro[12:16])
+	if nindex > rpmMaxEntries || hsize > rpmMaxStoreSize {
+		return nil, 0, errors.New("header too large")
+	}
+
+	index := make([]byte, 16*int(nindex))
+	if _, err := io.ReadFull(r, index); err != nil {
+		return nil, 0, err
+	}
+	h := &rpmHeader{entries: make(map[int]rpmEntry, nindex), store: make([]byte, hsize)}
+	if _, err := io.ReadFull(r, h.store); err != nil {
+		return nil, 0, err
+	}
+	for i := 0; i < len(index); i += 16 {
+		tag := int(binary.BigEndian.Uint32(index[i:]))
+		h.entries[tag] = rpmEntry{
+			typ:    binary.BigEndian.Uint32(index[i+4:]),
+			offset: binary.BigEndian.Uint32(index[i+8:]),
+			count:  binary.BigEndian.Uint32(index[i+12:]),
+		}
+	}
+	return h, 16 + len(index) + len(h.store), nil
+}
+
+// has reports whether the header has the tag.
+func (h *rpmHeader) has(tag int) bool {
+	_, ok := h.entries[tag]
+	return ok
+}
+
+// stringArray returns the strings of the tag, or nil if the header does not have it, or it is not a string tag.
+// The translations of I18N strings are all returned, the default one first.
+func (h *rpmHeader) stringArray(tag int) []string {
+	e, ok := h.entries[tag]
+	if !ok || int64(e.offset) > int64(len(h.store)) {
+		return nil
+	}
+	count := e.count
+	switch e.typ {
+	case rpmTypeString:
+		count = 1
+	case rpmTypeStringArray, rpmTypeI18NString:
+	default:
+		return nil
+	}
+
+	var values []string
+	data := h.store[e.offset:]
+	for i := uint32(0); i < count; i++ {
+		end := bytes.IndexByte(data, 0)
+		if end < 0 {
+			break
+		}
+		values = append(values, string(data[:end]))
+		data = data[end+1:]
+	}
+	return values
+}
+
+// str returns the first string of the tag, or an empty string if the header does not have it.
+func (h *rpmHeader) str(tag int) string {
+	if values := h.stringArray(tag); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// ints returns the integers of the tag, or nil if the header does not have it, or it is not an integer tag.
+func (h *rpmHeader) ints(tag int) []int64 {
+	e, ok := h.entries[tag]
+	if !ok {
+		return nil
+	}
+	var width uint32
+	switch e.typ {
+	case rpmTypeInt16:
+		width = 2
+	case rpmTypeInt32:
+		width = 4
+	case rpmTypeInt64:
+		width = 8
+	default:
+		return nil
+	}
+	if int64(e.offset)+int64(e.count)*int64(width) > int64(len(h.store)) {
+		return nil
+	}
+
+	values := make([]int64, e.count)
+	for i := range values {
+		data := h.store[e.offset+uint32(i)*width:]
+		switch width {
+		case 2:
+			values[i] = int64(binary.BigEndian.Uint16(data))
+		case 4:
+			values[i] = int64(binary.BigEndian.Uint32(data))
+		case 8:
+			values[i] = int64(binary.BigEndian.Uint64(data))
+		}
+	}
+	return values
+}
+
+// dependencies returns the dependencies of the package of the header, without the rpmlib() requirements,
+// which are features of rpm itself, and without duplicates.
+func (h *rpmHeader) dependencies() []manager.Dependency {
+	var dependencies []manager.Dependency
+	seen := make(map[string]bool)
+	for _, tags := range rpmDependencyTags {
+		names := h.stringArray(tags.name)
+		flags := h.ints(tags.flags)
+		versions := h.stringArray(tags.version)
+		for i, name := range names {
+			if strings.HasPrefix(name, "rpmlib(") {
+				continue
+			}
+			dep := manager.Dependency{Kind: tags.kind, Name: name}
+			var flag int64
+			if i < len(flags) {
+				flag = flags[i]
+			}
+			if tags.preDepends && flag&(rpmSensePrereq|rpmSenseScriptPre) != 0 {
+				dep.Kind = manager.DependencyPreDepends
+			}
+			if i < len(versions) && versions[i] != "" {
+				if op := rpmSenseOperator(flag); op != "" {
+					dep.Constraint = op + " " + versions[i]
+				}
+			}
+			if !seen[dep.String()] {
+				seen[dep.String()] = true
+				dependencies = append(dependencies, dep)
+			}
+		}
+	}
+	return dependencies
+}
+
+// rpmSenseOperator returns the comparison operator of the flags of a dependency, such as ">=".
+func rpmSenseOperator(flags int64) string {
+	var op string
+	if flags&rpmSenseLess != 0 {
+		op += "<"
+	}
+	if flags&rpmSenseGreater != 0 {
+		op += ">"
+	}
+	if flags&rpmSenseEqual != 0 {
+		op += "="
+	}
+	return op
+}
+
+// files returns the paths of the files of the package of the header, from their base names and directories,
+// or from their full names for the packages built by rpm before 4.0.
+func (h *rpmHeader) files() []string {
+	basenames := h.stringArray(rpmTagBasenames)
+	if len(basenames) == 0 {
+		return h.stringArray(rpmTagOldFilenames)
+	}
+	dirnames := h.stringArray(rpmTagDirnames)
+	dirindexes := h.ints(rpmTagDirIndexes)
+
+	files := make([]string, 0, len(basenames))
+	for i, base := range basenames {
+		if i >= len(dirindexes) || dirindexes[i] < 0 || dirindexes[i] >= int64(len(dirnames)) {
+			break
+		}
+		files = append(files, dirnames[dirindexes[i]]+base)
+	}
+	return files
+}
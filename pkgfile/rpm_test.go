@@ -0,0 +1,120 @@
+package pkgfile_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/pkgfile"
+)
+
+// rpmTag is a tag of an RPM header, with its type and its values.
+type rpmTag struct {
+	tag, typ int
+	values   any
+}
+
+// rpmHeader returns an RPM header structure with the tags.
+func rpmHeader(tags ...rpmTag) []byte {
+	var index, store bytes.Buffer
+	for _, tag := range tags {
+		offset := store.Len()
+		var count int
+		switch v := tag.values.(type) {
+		case string:
+			store.WriteString(v + "\x00")
+			count = 1
+		case []string:
+			for _, s := range v {
+				store.WriteString(s + "\x00")
+			}
+			count = len(v)
+		case []int32:
+			binary.Write(&store, binary.BigEndian, v)
+			count = len(v)
+		}
+		binary.Write(&index, binary.BigEndian, []int32{int32(tag.tag), int32(tag.typ), int32(offset), int32(count)})
+	}
+
+	var h bytes.Buffer
+	h.Write([]byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0})
+	binary.Write(&h, binary.BigEndian, []int32{int32(len(tags)), int32(store.Len())})
+	h.Write(index.Bytes())
+	h.Write(store.Bytes())
+	return h.Bytes()
+}
+
+func TestReadRPM(t *testing.T) {
+	const (
+		typInt32       = 4
+		typString      = 6
+		typStringArray = 8
+		typI18NString  = 9
+	)
+
+	var rpm bytes.Buffer
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+	rpm.Write(lead)
+	// a signature header of 16+16+4 bytes, padded to 40
+	rpm.Write(rpmHeader(rpmTag{1000, typInt32, []int32{1234}}))
+	rpm.Write(make([]byte, 4))
+	rpm.Write(rpmHeader(
+		rpmTag{1000, typString, "hello"},
+		rpmTag{1001, typString, "2.12.1"},
+		rpmTag{1002, typString, "4.fc40"},
+		rpmTag{1003, typInt32, []int32{1}},
+		rpmTag{1004, typI18NString, []string{"Prints a familiar, friendly greeting"}},
+		rpmTag{1005, typI18NString, []string{"The GNU Hello program produces a familiar, friendly greeting."}},
+		rpmTag{1009, typInt32, []int32{186543}},
+		rpmTag{1011, typString, "Fedora Project"},
+		rpmTag{1016, typI18NString, []string{"Unspecified"}},
+		rpmTag{1022, typString, "x86_64"},
+		rpmTag{1024, typString, "/sbin/install-info /usr/share/info/hello.info.gz || :"},
+		rpmTag{1086, typString, "/bin/sh"},
+		rpmTag{1047, typStringArray, []string{"hello", "hello(x86-64)"}},
+		rpmTag{1112, typInt32, []int32{8, 8}},
+		rpmTag{1113, typStringArray, []string{"1:2.12.1-4.fc40", "1:2.12.1-4.fc40"}},
+		rpmTag{1049, typStringArray, []string{"/bin/sh", "libc.so.6()(64bit)", "rpmlib(CompressedFileNames)", "/bin/sh"}},
+		rpmTag{1048, typInt32, []int32{1 << 9, 0, 1<<24 | 1<<3 | 1<<1, 1 << 8}},
+		rpmTag{1050, typStringArray, []string{"", "", "3.0.4-1", ""}},
+		rpmTag{1116, typInt32, []int32{0, 1}},
+		rpmTag{1117, typStringArray, []string{"hello", "hello.info.gz"}},
+		rpmTag{1118, typStringArray, []string{"/usr/bin/", "/usr/share/info/"}},
+	))
+	rpm.WriteString("payload")
+
+	pkg, meta, err := pkgfile.ReadRPM(&rpm)
+	if err != nil {
+		t.Fatalf("ReadRPM() error = %v", err)
+	}
+	wantPkg := manager.PackageInfo{Name: "hello", Version: "1:2.12.1-4.fc40", Arch: "x86_64", Category: "Unspecified", Status: manager.PackageStatusAvailable, PackageManager: "dnf"}
+	if !reflect.DeepEqual(pkg, wantPkg) {
+		t.Errorf("ReadRPM() = %+v, want %+v", pkg, wantPkg)
+	}
+	wantMeta := &pkgfile.Metadata{
+		Type:        manager.PackageFileRPM,
+		Maintainer:  "Fedora Project",
+		Summary:     "Prints a familiar, friendly greeting",
+		Description: "The GNU Hello program produces a familiar, friendly greeting.",
+		Dependencies: []manager.Dependency{
+			{Kind: manager.DependencyPreDepends, Name: "/bin/sh"},
+			{Kind: manager.DependencyDepends, Name: "libc.so.6()(64bit)"},
+			{Kind: manager.DependencyDepends, Name: "/bin/sh"},
+			{Kind: manager.DependencyProvides, Name: "hello", Constraint: "= 1:2.12.1-4.fc40"},
+			{Kind: manager.DependencyProvides, Name: "hello(x86-64)", Constraint: "= 1:2.12.1-4.fc40"},
+		},
+		Scripts:       []string{"post"},
+		Files:         []string{"/usr/bin/hello", "/usr/share/info/hello.info.gz"},
+		InstalledSize: 186543,
+	}
+	if !reflect.DeepEqual(meta, wantMeta) {
+		t.Errorf("ReadRPM() metadata = %+v, want %+v", meta, wantMeta)
+	}
+
+	if _, _, err := pkgfile.ReadRPM(bytes.NewReader(lead)); err == nil {
+		t.Errorf("ReadRPM() of a lead alone: error = nil, want an error")
+	}
+}
@@ -0,0 +1,113 @@
+package snapshot
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sjwhyte/syspkg/manager/version"
+)
+
+// ChangeType is the kind of difference of a package between two snapshots.
+type ChangeType string
+
+// ChangeType constants define the kinds of differences between two snapshots.
+const (
+	// Added means that the package is only in the second snapshot.
+	Added ChangeType = "added"
+
+	// Removed means that the package is only in the first snapshot.
+	Removed ChangeType = "removed"
+
+	// Upgraded means that the package has a newer version in the second snapshot.
+	Upgraded ChangeType = "upgraded"
+
+	// Downgraded means that the package has an older version in the second snapshot.
+	Downgraded ChangeType = "downgraded"
+)
+
+// Change is a difference of a package between two snapshots.
+type Change struct {
+	Type ChangeType
+
+	// Manager, Name and Arch identify the package.
+	Manager string
+	Name    string
+	Arch    string
+
+	// OldVersion is the version of the package in the first snapshot, empty if it was added.
+	OldVersion string
+
+	// NewVersion is the version of the package in the second snapshot, empty if it was removed.
+	NewVersion string
+}
+
+// String returns a human-readable description of the change, such as "apt: upgraded vim 2:8.2-1 -> 2:9.0-1".
+func (c Change) String() string {
+	name := c.Name
+	if c.Arch != "" {
+		name += ":" + c.Arch
+	}
+	switch c.Type {
+	case Added:
+		return fmt.Sprintf("%s: %s %s %s", c.Manager, c.Type, name, c.NewVersion)
+	case Removed:
+		return fmt.Sprintf("%s: %s %s %s", c.Manager, c.Type, name, c.OldVersion)
+	}
+	return fmt.Sprintf("%s: %s %s %s -> %s", c.Manager, c.Type, name, c.OldVersion, c.NewVersion)
+}
+
+// Diff compares the packages of the snapshots from and to, and returns the packages added, removed, upgraded and downgraded
+// from one to the other, sorted by package manager, name and architecture.
+// Versions are ordered with the version scheme of each package manager (see version.SchemeFor),
+// so that equivalent versions, such as "1:1.0" and "1.0" for apt, are not reported.
+// To compare a snapshot with the live system, pass the snapshot returned by Take.
+func Diff(from, to *Snapshot) []Change {
+	type key struct{ manager, name, arch string }
+	keyOf := func(pkg Package) key { return key{pkg.Manager, pkg.Name, pkg.Arch} }
+
+	old := make(map[key]Package, len(from.Packages))
+	for _, pkg := range from.Packages {
+		old[keyOf(pkg)] = pkg
+	}
+
+	var changes []Change
+	seen := make(map[key]bool, len(to.Packages))
+	for _, pkg := range to.Packages {
+		k := keyOf(pkg)
+		seen[k] = true
+		change := Change{Manager: pkg.Manager, Name: pkg.Name, Arch: pkg.Arch, NewVersion: pkg.Version}
+
+		oldPkg, ok := old[k]
+		if !ok {
+			change.Type = Added
+			changes = append(changes, change)
+			continue
+		}
+		change.OldVersion = oldPkg.Version
+		switch version.Compare(version.SchemeFor(pkg.Manager), oldPkg.Version, pkg.Version) {
+		case -1:
+			change.Type = Upgraded
+			changes = append(changes, change)
+		case 1:
+			change.Type = Downgraded
+			changes = append(changes, change)
+		}
+	}
+	for _, pkg := range from.Packages {
+		if !seen[keyOf(pkg)] {
+			changes = append(changes, Change{Type: Removed, Manager: pkg.Manager, Name: pkg.Name, Arch: pkg.Arch, OldVersion: pkg.Version})
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Manager != b.Manager {
+			return a.Manager < b.Manager
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Arch < b.Arch
+	})
+	return changes
+}
@@ -0,0 +1,48 @@
+package snapshot_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sjwhyte/syspkg/snapshot"
+)
+
+func TestDiff(t *testing.T) {
+	from := &snapshot.Snapshot{Packages: []snapshot.Package{
+		{Name: "curl", Version: "7.81.0-1ubuntu1.15", Manager: "apt"},
+		{Name: "libc6", Version: "2.35-0ubuntu3.1", Arch: "i386", Manager: "apt"},
+		{Name: "nano", Version: "6.2-1", Manager: "apt"},
+		{Name: "vim", Version: "2:8.2.3995-1ubuntu2", Manager: "apt"},
+		{Name: "zsh", Version: "1:5.8.1-1", Manager: "apt"},
+		{Name: "bash", Version: "5.1.8-6.el9", Manager: "dnf"},
+	}}
+	to := &snapshot.Snapshot{Packages: []snapshot.Package{
+		{Name: "curl", Version: "7.81.0-1ubuntu1.14", Manager: "apt"},
+		{Name: "git", Version: "1:2.34.1-1ubuntu1.10", Manager: "apt"},
+		{Name: "libc6", Version: "2.35-0ubuntu3.1", Manager: "apt"},
+		{Name: "vim", Version: "2:8.2.3995-1ubuntu2.1", Manager: "apt"},
+		{Name: "zsh", Version: "1:5.8.1-1", Manager: "apt"},
+		{Name: "bash", Version: "5.1.8-9.el9", Manager: "dnf"},
+	}}
+
+	want := []snapshot.Change{
+		{Type: snapshot.Downgraded, Manager: "apt", Name: "curl", OldVersion: "7.81.0-1ubuntu1.15", NewVersion: "7.81.0-1ubuntu1.14"},
+		{Type: snapshot.Added, Manager: "apt", Name: "git", NewVersion: "1:2.34.1-1ubuntu1.10"},
+		{Type: snapshot.Added, Manager: "apt", Name: "libc6", NewVersion: "2.35-0ubuntu3.1"},
+		{Type: snapshot.Removed, Manager: "apt", Name: "libc6", Arch: "i386", OldVersion: "2.35-0ubuntu3.1"},
+		{Type: snapshot.Removed, Manager: "apt", Name: "nano", OldVersion: "6.2-1"},
+		{Type: snapshot.Upgraded, Manager: "apt", Name: "vim", OldVersion: "2:8.2.3995-1ubuntu2", NewVersion: "2:8.2.3995-1ubuntu2.1"},
+		{Type: snapshot.Upgraded, Manager: "dnf", Name: "bash", OldVersion: "5.1.8-6.el9", NewVersion: "5.1.8-9.el9"},
+	}
+	got := snapshot.Diff(from, to)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %+v, want %+v", got, want)
+	}
+
+	if s := got[5].String(); s != "apt: upgraded vim 2:8.2.3995-1ubuntu2 -> 2:8.2.3995-1ubuntu2.1" {
+		t.Errorf("Change.String() = %q", s)
+	}
+	if len(snapshot.Diff(to, to)) != 0 {
+		t.Errorf("Diff() of a snapshot with itself = %+v, want no change", snapshot.Diff(to, to))
+	}
+}
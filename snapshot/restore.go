@@ -0,0 +1,160 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sjwhyte/syspkg"
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/manifest"
+)
+
+// Unsatisfied is a package of a snapshot that could not be restored as it was.
+type Unsatisfied struct {
+	Package Package
+
+	// Reason is why the package could not be restored, such as "package manager flatpak is not available".
+	Reason string
+}
+
+// String returns a human-readable description of the unsatisfied package, such as "apt: vim 2:8.2.3995-1ubuntu2: not installed".
+func (u Unsatisfied) String() string {
+	return fmt.Sprintf("%s: %s %s: %s", u.Package.Manager, u.Package.Name, u.Package.Version, u.Reason)
+}
+
+// Plan returns the changes that install the packages of snap with the package managers of s,
+// at their version and for their architecture for the package managers that can install a given version
+// (see manifest.PinsVersions), and hold or release them as they were, for the snapshots that record it,
+// and the packages that cannot be restored because s does not have their package manager.
+// Installed packages that are not in the snapshot are left alone.
+func (snap *Snapshot) Plan(ctx context.Context, s syspkg.SysPkg, opts *manager.Options) (*manifest.Plan, []Unsatisfied, error) {
+	m, unsatisfied := snap.manifest(s)
+	plan, err := manifest.NewPlan(ctx, s, m, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plan, unsatisfied, nil
+}
+
+// manifest returns the manifest of the packages of snap that s can install, and the ones it cannot.
+func (snap *Snapshot) manifest(s syspkg.SysPkg) (*manifest.Manifest, []Unsatisfied) {
+	m := &manifest.Manifest{}
+	var unsatisfied []Unsatisfied
+	seen := make(map[string]bool)
+	for _, pkg := range snap.Packages {
+		if s.GetPackageManager(pkg.Manager) == nil {
+			unsatisfied = append(unsatisfied, Unsatisfied{pkg, fmt.Sprintf("package manager %s is not available", pkg.Manager)})
+			continue
+		}
+
+		e := manifest.Entry{Name: pkg.Name, Manager: pkg.Manager}
+		if manifest.PinsVersions(pkg.Manager) {
+			e.Version, e.Arch = pkg.Version, pkg.Arch
+		}
+		if snap.Version >= 2 {
+			held := pkg.Held
+			e.Held = &held
+		}
+
+		// the package managers that cannot install a given architecture list the packages of several architectures once
+		key := e.Manager + "\x00" + e.Name + "\x00" + e.Arch
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		m.Packages = append(m.Packages, e)
+	}
+	return m, unsatisfied
+}
+
+// Restore installs the packages of snap with the package managers of s, then marks the ones that were installed
+// automatically in the snapshot as such, for the package managers that implement manager.InstallReasonManager.
+// It returns the packages that could not be restored as they were: packages of package managers that s does not have,
+// and packages that are not installed, or at another version, once the changes are applied.
+// The changes are applied one by one if applying them together fails (see manifest.ApplyEach), so that a version
+// the repositories no longer offer does not prevent restoring the other packages. Restore goes on when a package manager
+// fails, and returns the failures, as a manifest.StepErrors, with the unsatisfied packages.
+func Restore(ctx context.Context, s syspkg.SysPkg, snap *Snapshot, opts *manager.Options) ([]Unsatisfied, error) {
+	plan, unsatisfied, err := snap.Plan(ctx, s, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	_, applyErr := manifest.ApplyEach(ctx, s, plan, opts)
+	if opts != nil && opts.DryRun {
+		return unsatisfied, applyErr
+	}
+
+	markErr := snap.markAuto(ctx, s, plan, opts)
+
+	// packages match by name and architecture, or by name alone for the package managers that cannot install
+	// a given architecture
+	installed, listErr := s.ListInstalledContext(ctx, opts)
+	versions := make(map[string]string)
+	for _, pkg := range installed {
+		versions[pkg.PackageManager+"\x00"+pkg.Name+"\x00"+pkg.Arch] = pkg.Version
+		if _, ok := versions[pkg.PackageManager+"\x00"+pkg.Name]; !ok {
+			versions[pkg.PackageManager+"\x00"+pkg.Name] = pkg.Version
+		}
+	}
+	for _, pkg := range snap.Packages {
+		if s.GetPackageManager(pkg.Manager) == nil {
+			continue
+		}
+		key := pkg.Manager + "\x00" + pkg.Name
+		if manifest.PinsVersions(pkg.Manager) {
+			key += "\x00" + pkg.Arch
+		}
+		v, ok := versions[key]
+		switch {
+		case !ok:
+			unsatisfied = append(unsatisfied, Unsatisfied{pkg, "not installed"})
+		case pkg.Version != "" && (manager.PackageInfo{Version: v, PackageManager: pkg.Manager}).Compare(pkg.Version) != 0:
+			reason := fmt.Sprintf("version %s is installed instead", v)
+			if !manifest.PinsVersions(pkg.Manager) {
+				reason = fmt.Sprintf("%s cannot install a given version, version %s is installed instead", pkg.Manager, v)
+			}
+			unsatisfied = append(unsatisfied, Unsatisfied{pkg, reason})
+		}
+	}
+
+	return unsatisfied, errors.Join(applyErr, markErr, listErr)
+}
+
+// markAuto marks the packages installed by plan that were installed automatically in snap as such.
+func (snap *Snapshot) markAuto(ctx context.Context, s syspkg.SysPkg, plan *manifest.Plan, opts *manager.Options) error {
+	installedByPlan := make(map[string]bool)
+	for _, step := range plan.Steps {
+		if step.Action == manifest.ActionInstall {
+			installedByPlan[step.PackageManager+"\x00"+step.Name] = true
+		}
+	}
+
+	var names []string
+	auto := make(map[string][]string)
+	for _, pkg := range snap.Packages {
+		if !pkg.Auto || !installedByPlan[pkg.Manager+"\x00"+pkg.Name] {
+			continue
+		}
+		if _, ok := auto[pkg.Manager]; !ok {
+			names = append(names, pkg.Manager)
+		}
+		auto[pkg.Manager] = append(auto[pkg.Manager], pkg.Name)
+	}
+
+	errs := make(syspkg.ManagerErrors)
+	for _, name := range names {
+		reasons, ok := manager.As[manager.InstallReasonManager](s.GetPackageManager(name))
+		if !ok {
+			continue
+		}
+		if err := reasons.MarkAutoInstalledContext(ctx, auto[name], opts); err != nil {
+			errs[name] = err
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
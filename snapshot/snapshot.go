@@ -0,0 +1,199 @@
+// Package snapshot exports the packages installed by the package managers of a system to a versioned JSON lockfile,
+// and restores them on another system, to clone a known-good machine.
+//
+// Example:
+//
+//	snap, err := snapshot.Take(ctx, sysPkg, nil)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	err = snap.Save("packages.lock.json")
+//
+// and on the other machine:
+//
+//	snap, err := snapshot.Load("packages.lock.json")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	unsatisfied, err := snapshot.Restore(ctx, sysPkg, snap, nil)
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sjwhyte/syspkg"
+	"github.com/sjwhyte/syspkg/manager"
+)
+
+// FormatVersion is the version of the snapshot format written by this package.
+// Snapshots with a newer format version are rejected by Read.
+// Version 2 records the held packages: the snapshots of version 1 leave the holds alone when they are restored.
+const FormatVersion = 2
+
+// Snapshot is the list of the packages installed on a system at a point in time.
+type Snapshot struct {
+	// Version is the format version of the snapshot.
+	Version int `json:"version"`
+
+	// Created is when the snapshot was taken.
+	Created time.Time `json:"created"`
+
+	// Hostname is the name of the system the snapshot was taken on.
+	Hostname string `json:"hostname,omitempty"`
+
+	// Packages are the installed packages, sorted by package manager, name and architecture.
+	Packages []Package `json:"packages"`
+}
+
+// Package is an installed package.
+type Package struct {
+	// Name is the package name.
+	Name string `json:"name"`
+
+	// Version is the installed version of the package.
+	Version string `json:"version,omitempty"`
+
+	// Arch is the architecture of the package, if the package manager reports it.
+	Arch string `json:"arch,omitempty"`
+
+	// Manager is the name of the package manager that installed the package.
+	Manager string `json:"manager"`
+
+	// Auto is whether the package was installed automatically, as a dependency of other packages.
+	// It is only recorded for the package managers that implement manager.InstallReasonManager,
+	// packages of the other package managers are considered installed explicitly.
+	Auto bool `json:"auto,omitempty"`
+
+	// Held is whether the package was held at its installed version. It is only recorded for the package managers
+	// that implement manager.HoldManager.
+	Held bool `json:"held,omitempty"`
+}
+
+// Take lists the packages installed by every package manager of s.
+// If some package managers fail, it returns the snapshot of the other ones with a syspkg.ManagerErrors.
+func Take(ctx context.Context, s syspkg.SysPkg, opts *manager.Options) (*Snapshot, error) {
+	installed, err := s.ListInstalledContext(ctx, opts)
+	errs := make(syspkg.ManagerErrors)
+	var managerErrs syspkg.ManagerErrors
+	if errors.As(err, &managerErrs) {
+		for name, err := range managerErrs {
+			errs[name] = err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	auto := make(map[string]map[string]bool)
+	held := make(map[string][]manager.PackageInfo)
+	for _, pkg := range installed {
+		name := pkg.PackageManager
+		if _, ok := auto[name]; ok {
+			continue
+		}
+		auto[name] = make(map[string]bool)
+
+		if holds, ok := manager.As[manager.HoldManager](s.GetPackageManager(name)); ok {
+			heldPkgs, err := holds.ListHeldContext(ctx, opts)
+			if err != nil {
+				errs[name] = err
+			}
+			held[name] = heldPkgs
+		}
+
+		reasons, ok := manager.As[manager.InstallReasonManager](s.GetPackageManager(name))
+		if !ok {
+			continue
+		}
+		autoPkgs, err := reasons.ListAutoInstalledContext(ctx, opts)
+		if err != nil {
+			errs[name] = err
+			continue
+		}
+		for _, p := range autoPkgs {
+			auto[name][p.Name] = true
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	snap := &Snapshot{Version: FormatVersion, Created: time.Now().UTC(), Hostname: hostname}
+	for _, pkg := range installed {
+		snap.Packages = append(snap.Packages, Package{
+			Name:    pkg.Name,
+			Version: pkg.Version,
+			Arch:    pkg.Arch,
+			Manager: pkg.PackageManager,
+			Auto:    auto[pkg.PackageManager][pkg.Name],
+			Held:    manager.MarkHeld([]manager.PackageInfo{pkg}, held[pkg.PackageManager])[0].Status == manager.PackageStatusHeld,
+		})
+	}
+	snap.sort()
+
+	if len(errs) > 0 {
+		return snap, errs
+	}
+	return snap, nil
+}
+
+// sort sorts the packages of snap by package manager, name and architecture, so that snapshots of similar systems
+// can be compared line by line.
+func (snap *Snapshot) sort() {
+	sort.SliceStable(snap.Packages, func(i, j int) bool {
+		a, b := snap.Packages[i], snap.Packages[j]
+		if a.Manager != b.Manager {
+			return a.Manager < b.Manager
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Arch < b.Arch
+	})
+}
+
+// Write writes snap to w as indented JSON.
+func (snap *Snapshot) Write(w io.Writer) error {
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Save writes snap to the file at path.
+func (snap *Snapshot) Save(path string) error {
+	var buf bytes.Buffer
+	if err := snap.Write(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// Read reads a snapshot from r. It returns an error if the snapshot has no format version, or a newer one than FormatVersion.
+func Read(r io.Reader) (*Snapshot, error) {
+	var snap Snapshot
+	if err := json.NewDecoder(r).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if snap.Version < 1 || snap.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported snapshot format version %d (want 1 to %d)", snap.Version, FormatVersion)
+	}
+	return &snap, nil
+}
+
+// Load reads the snapshot from the file at path.
+func Load(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
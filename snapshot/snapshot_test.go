@@ -0,0 +1,188 @@
+package snapshot_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sjwhyte/syspkg"
+	"github.com/sjwhyte/syspkg/manager"
+	"github.com/sjwhyte/syspkg/snapshot"
+)
+
+// fakeManager is a package manager that installs the latest version of packages, "2.0", and records the packages
+// marked as installed automatically, and the held packages.
+type fakeManager struct {
+	name      string
+	installed map[string]string
+	auto      map[string]bool
+	held      map[string]bool
+}
+
+func (f *fakeManager) IsAvailable() bool         { return true }
+func (f *fakeManager) GetPackageManager() string { return f.name }
+func (f *fakeManager) Install(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.InstallContext(context.Background(), pkgs, opts)
+}
+func (f *fakeManager) InstallContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	for _, pkg := range pkgs {
+		f.installed[pkg] = "2.0"
+	}
+	return nil, nil
+}
+func (f *fakeManager) Delete(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) DeleteContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) Find(keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) FindContext(ctx context.Context, keywords []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) ListInstalled(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return f.ListInstalledContext(context.Background(), opts)
+}
+func (f *fakeManager) ListInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	var pkgs []manager.PackageInfo
+	for name, version := range f.installed {
+		pkgs = append(pkgs, manager.PackageInfo{Name: name, Version: version, PackageManager: f.name})
+	}
+	return pkgs, nil
+}
+func (f *fakeManager) ListUpgradable(opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) ListUpgradableContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) UpgradeAll(pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) UpgradeAllContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	return nil, nil
+}
+func (f *fakeManager) Refresh(opts *manager.Options) error { return nil }
+func (f *fakeManager) RefreshContext(ctx context.Context, opts *manager.Options) error {
+	return nil
+}
+func (f *fakeManager) GetPackageInfo(pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	return manager.PackageInfo{}, nil
+}
+func (f *fakeManager) GetPackageInfoContext(ctx context.Context, pkg string, opts *manager.Options) (manager.PackageInfo, error) {
+	return manager.PackageInfo{}, nil
+}
+func (f *fakeManager) ListAutoInstalledContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	var pkgs []manager.PackageInfo
+	for name := range f.auto {
+		pkgs = append(pkgs, manager.PackageInfo{Name: name, PackageManager: f.name})
+	}
+	return pkgs, nil
+}
+func (f *fakeManager) MarkAutoInstalledContext(ctx context.Context, pkgs []string, opts *manager.Options) error {
+	for _, pkg := range pkgs {
+		f.auto[pkg] = true
+	}
+	return nil
+}
+
+func (f *fakeManager) ListHeldContext(ctx context.Context, opts *manager.Options) ([]manager.PackageInfo, error) {
+	var pkgs []manager.PackageInfo
+	for name := range f.held {
+		pkgs = append(pkgs, manager.PackageInfo{Name: name, PackageManager: f.name})
+	}
+	return pkgs, nil
+}
+func (f *fakeManager) HoldContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	for _, pkg := range pkgs {
+		f.held[pkg] = true
+	}
+	return nil, nil
+}
+func (f *fakeManager) UnholdContext(ctx context.Context, pkgs []string, opts *manager.Options) ([]manager.PackageInfo, error) {
+	for _, pkg := range pkgs {
+		delete(f.held, pkg)
+	}
+	return nil, nil
+}
+
+var fake = &fakeManager{
+	name:      "snapshot-fake",
+	installed: map[string]string{"vim": "9.0", "libvim": "9.0"},
+	auto:      map[string]bool{"libvim": true},
+	held:      map[string]bool{"vim": true},
+}
+
+func init() {
+	manager.Register(fake.name, manager.PrioritySystem, func() manager.PackageManager { return fake })
+}
+
+func TestTakeWriteRead(t *testing.T) {
+	s, err := syspkg.New(syspkg.IncludeOptions{Managers: []string{fake.name}})
+	if err != nil {
+		t.Fatalf("syspkg.New() error = %v", err)
+	}
+
+	snap, err := snapshot.Take(context.Background(), s, nil)
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	want := []snapshot.Package{
+		{Name: "libvim", Version: "9.0", Manager: fake.name, Auto: true},
+		{Name: "vim", Version: "9.0", Manager: fake.name, Held: true},
+	}
+	if snap.Version != snapshot.FormatVersion || !reflect.DeepEqual(snap.Packages, want) {
+		t.Errorf("Take() = %+v, want version %d and packages %+v", snap, snapshot.FormatVersion, want)
+	}
+
+	var buf bytes.Buffer
+	if err := snap.Write(&buf); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	read, err := snapshot.Read(&buf)
+	if err != nil || !reflect.DeepEqual(read, snap) {
+		t.Errorf("Read() = %+v, %v, want %+v", read, err, snap)
+	}
+
+	if _, err := snapshot.Read(strings.NewReader(fmt.Sprintf(`{"version": %d, "packages": []}`, snapshot.FormatVersion+1))); err == nil {
+		t.Errorf("Read() of a newer format version: error = nil, want an error")
+	}
+}
+
+func TestRestore(t *testing.T) {
+	s, err := syspkg.New(syspkg.IncludeOptions{Managers: []string{fake.name}})
+	if err != nil {
+		t.Fatalf("syspkg.New() error = %v", err)
+	}
+
+	snap := &snapshot.Snapshot{Version: snapshot.FormatVersion, Packages: []snapshot.Package{
+		{Name: "git", Version: "2.0", Manager: fake.name, Held: true},
+		{Name: "libgit", Version: "1.0", Manager: fake.name, Auto: true},
+		{Name: "vim", Version: "9.0", Manager: fake.name},
+		{Name: "org.gimp.GIMP", Version: "2.10", Manager: "flatpak"},
+	}}
+
+	unsatisfied, err := snapshot.Restore(context.Background(), s, snap, nil)
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	want := []snapshot.Unsatisfied{
+		{Package: snap.Packages[3], Reason: "package manager flatpak is not available"},
+		{Package: snap.Packages[1], Reason: "snapshot-fake cannot install a given version, version 2.0 is installed instead"},
+	}
+	if !reflect.DeepEqual(unsatisfied, want) {
+		t.Errorf("Restore() = %+v, want %+v", unsatisfied, want)
+	}
+	if fake.installed["git"] == "" || !fake.auto["libgit"] || fake.auto["git"] {
+		t.Errorf("Restore() installed %v with %v automatically installed, want git and libgit installed, and only libgit automatically", fake.installed, fake.auto)
+	}
+	if !reflect.DeepEqual(fake.held, map[string]bool{"git": true}) {
+		t.Errorf("Restore() held %v, want git only", fake.held)
+	}
+}
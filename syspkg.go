@@ -15,12 +15,16 @@
 //	    log.Fatal(err)
 //	}
 //	aptManager := sysPkg.GetPackageManager("apt")
+//
+// Package managers are found among the ones registered with manager.Register: apt, dnf, snap and flatpak
+// register themselves, and other packages can register their own backends the same way.
 package syspkg
 
 import (
 	"errors"
 	"github.com/sjwhyte/syspkg/manager/dnf"
 	"log"
+	"sync"
 
 	"github.com/sjwhyte/syspkg/manager"
 	"github.com/sjwhyte/syspkg/manager/apt"
@@ -32,8 +36,13 @@ import (
 type PackageInfo = manager.PackageInfo
 
 // IncludeOptions specifies which package managers to include when creating a SysPkg instance.
+// Package managers are selected by the name they are registered with (see manager.Register) in Managers;
+// the per-manager fields are shorthands for listing the corresponding name.
+// Decorators are applied, in order, to each package manager found, e.g. to record their operations with journal.Journal.Wrap.
 type IncludeOptions struct {
 	AllAvailable bool
+	Managers     []string
+	Decorators   []manager.Decorator
 	Apk          bool
 	Apt          bool
 	Dnf          bool
@@ -43,12 +52,68 @@ type IncludeOptions struct {
 }
 
 type sysPkgImpl struct {
+	// mu guards pms, which RefreshPackageManagers replaces
+	mu  sync.RWMutex
 	pms map[string]PackageManager
+
+	// locks serialize the mutating operations run on each package manager, by name
+	locksMu sync.Mutex
+	locks   map[string]*sync.RWMutex
 }
 
 // make sure sysPkgImpl implements SysPkg
 var _ SysPkg = (*sysPkgImpl)(nil)
 
+// make sure all package managers implement PackageManagerContext.
+// Importing them also registers them with manager.Register.
+var (
+	_ PackageManagerContext = (*apt.PackageManager)(nil)
+	_ PackageManagerContext = (*dnf.PackageManager)(nil)
+	_ PackageManagerContext = (*flatpak.PackageManager)(nil)
+	_ PackageManagerContext = (*snap.PackageManager)(nil)
+)
+
+// make sure the package managers implement the optional interfaces they support.
+var (
+	_ manager.InstallReasonManager = (*apt.PackageManager)(nil)
+	_ manager.InstallReasonManager = (*dnf.PackageManager)(nil)
+	_ manager.HistoryManager       = (*dnf.PackageManager)(nil)
+	_ manager.DependencyManager    = (*apt.PackageManager)(nil)
+	_ manager.DependencyManager    = (*dnf.PackageManager)(nil)
+	_ manager.FileManager          = (*apt.PackageManager)(nil)
+	_ manager.FileManager          = (*dnf.PackageManager)(nil)
+	_ manager.FileManager          = (*flatpak.PackageManager)(nil)
+	_ manager.FileManager          = (*snap.PackageManager)(nil)
+	_ manager.RepositoryManager    = (*apt.PackageManager)(nil)
+	_ manager.RepositoryManager    = (*dnf.PackageManager)(nil)
+	_ manager.RepositoryManager    = (*flatpak.PackageManager)(nil)
+	_ manager.HoldManager          = (*apt.PackageManager)(nil)
+	_ manager.HoldManager          = (*dnf.PackageManager)(nil)
+	_ manager.HoldManager          = (*flatpak.PackageManager)(nil)
+	_ manager.HoldManager          = (*snap.PackageManager)(nil)
+	_ manager.RequestInstaller     = (*apt.PackageManager)(nil)
+	_ manager.RequestInstaller     = (*dnf.PackageManager)(nil)
+	_ manager.RequestInstaller     = (*flatpak.PackageManager)(nil)
+	_ manager.RequestInstaller     = (*snap.PackageManager)(nil)
+	_ manager.VersionLister        = (*apt.PackageManager)(nil)
+	_ manager.VersionLister        = (*dnf.PackageManager)(nil)
+	_ manager.VersionLister        = (*snap.PackageManager)(nil)
+	_ manager.Downgrader           = (*apt.PackageManager)(nil)
+	_ manager.Downgrader           = (*dnf.PackageManager)(nil)
+	_ manager.Downgrader           = (*flatpak.PackageManager)(nil)
+	_ manager.Downgrader           = (*snap.PackageManager)(nil)
+	_ manager.SecurityUpgrader     = (*apt.PackageManager)(nil)
+	_ manager.SecurityUpgrader     = (*dnf.PackageManager)(nil)
+	_ manager.FileInstaller        = (*apt.PackageManager)(nil)
+	_ manager.FileInstaller        = (*dnf.PackageManager)(nil)
+	_ manager.FileInstaller        = (*flatpak.PackageManager)(nil)
+	_ manager.FileInstaller        = (*snap.PackageManager)(nil)
+	_ manager.StateReporter        = (*apt.PackageManager)(nil)
+	_ manager.StateReporter        = (*dnf.PackageManager)(nil)
+	_ manager.StateReporter        = (*flatpak.PackageManager)(nil)
+	_ manager.StateReporter        = (*snap.PackageManager)(nil)
+)
+
 // New creates a new SysPkg instance with the specified IncludeOptions.
 func New(include IncludeOptions) (SysPkg, error) {
 	impl := &sysPkgImpl{}
@@ -63,26 +128,24 @@ func New(include IncludeOptions) (SysPkg, error) {
 }
 
 // FindPackageManagers returns a map of available package managers based on the specified IncludeOptions.
+// The candidates are the package managers registered with manager.Register.
 func (s *sysPkgImpl) FindPackageManagers(include IncludeOptions) (map[string]PackageManager, error) {
 	var pms = make(map[string]PackageManager)
-	managerList := []struct {
-		managerName string
-		manager     PackageManager
-		include     bool
-	}{
-		{"apt", &apt.PackageManager{}, include.Apt},
-		{"flatpak", &flatpak.PackageManager{}, include.Flatpak},
-		{"snap", &snap.PackageManager{}, include.Snap},
-		{managerName: "dnf", manager: &dnf.PackageManager{}, include: include.Dnf},
-		// {"apk", &apk.PackageManager{}, include.Apk},
-		// {"zypper", &zypper.PackageManager{}, include.Zypper},
+
+	selected, err := include.selected()
+	if err != nil {
+		return nil, err
 	}
 
-	for _, m := range managerList {
-		if include.AllAvailable || m.include {
-			if m.manager.IsAvailable() {
-				pms[m.managerName] = m.manager
-				log.Printf("%s manager is available", m.managerName)
+	for _, m := range manager.Registered() {
+		if include.AllAvailable || selected[m.Name] {
+			pm := m.New()
+			if pm.IsAvailable() {
+				for _, decorate := range include.Decorators {
+					pm = decorate(pm)
+				}
+				pms[m.Name] = pm
+				log.Printf("%s manager is available", m.Name)
 			}
 		}
 	}
@@ -94,11 +157,53 @@ func (s *sysPkgImpl) FindPackageManagers(include IncludeOptions) (map[string]Pac
 	return pms, nil
 }
 
+// selected returns the names of the package managers selected by include.
+// It returns an error if Managers names a package manager that is not registered.
+func (include IncludeOptions) selected() (map[string]bool, error) {
+	selected := map[string]bool{
+		"apk":     include.Apk,
+		"apt":     include.Apt,
+		"dnf":     include.Dnf,
+		"flatpak": include.Flatpak,
+		"snap":    include.Snap,
+		"zypper":  include.Zypper,
+	}
+	for _, name := range include.Managers {
+		if _, err := manager.Lookup(name); err != nil {
+			return nil, err
+		}
+		selected[name] = true
+	}
+	return selected, nil
+}
+
 // GetPackageManager returns a PackageManager instance by its name (e.g., "apt", "snap", "flatpak", etc.).
+// If the name is empty, the available package manager with the highest priority is returned.
 func (s *sysPkgImpl) GetPackageManager(name string) PackageManager {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if name == "" {
+		if names := s.names(); len(names) > 0 {
+			return s.pms[names[0]]
+		}
+	}
 	return s.pms[name]
 }
 
+// GetPackageManagerContext returns the context-aware variant of the PackageManager with the given name,
+// or nil if there is no such package manager or it does not support contexts.
+func (s *sysPkgImpl) GetPackageManagerContext(name string) PackageManagerContext {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	pm, ok := s.pms[name].(PackageManagerContext)
+	if !ok {
+		return nil
+	}
+	return pm
+}
+
 // RefreshPackageManagers refreshes the internal list of available package managers, and returns the new list.
 func (s *sysPkgImpl) RefreshPackageManagers(include IncludeOptions) (map[string]PackageManager, error) {
 	pms, err := s.FindPackageManagers(include)
@@ -106,6 +211,8 @@ func (s *sysPkgImpl) RefreshPackageManagers(include IncludeOptions) (map[string]
 		return nil, err
 	}
 
+	s.mu.Lock()
 	s.pms = pms
+	s.mu.Unlock()
 	return pms, nil
 }